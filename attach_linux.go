@@ -0,0 +1,111 @@
+package ptrace
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// Attach attaches to the running process pid with PTRACE_SEIZE, and
+// interrupts it, returning its Tracee.  The first event is the stop of
+// the interrupt, or a GroupStopEvent if the process is stopped by job
+// control.  The options are those of Exec, except that WithSeize is
+// implied and WithStopAtEntry does not apply.  Since the process was
+// not started by the tracer, the default close policy is DetachOnClose.
+// Attaching to a process that is not a descendant of the tracer usually
+// requires CAP_SYS_PTRACE; if it is not permitted, the error wraps
+// ErrPermission and explains why.
+func Attach(pid int, opts ...Option) (*Tracee, error) {
+	t, err := newTracee(append([]Option{WithClosePolicy(DetachOnClose)}, opts...))
+	if err != nil {
+		return nil, err
+	}
+	t.seize, t.entry, t.attached = nil, nil, true
+	if err := t.launch(func() (*os.Process, error) { return t.seizeProcess(pid) }); err != nil {
+		return nil, err
+	}
+	if err := t.ready(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Seizes the process with the tracee's initial options, and interrupts
+// it, so that it reports its initial stop.  Called on the tracer thread.
+func (t *Tracee) seizeProcess(pid int) (*os.Process, error) {
+	opts := t.initialOptions()
+	if err := ptrace(ptraceSeize, pid, 0, uintptr(opts)); err != nil {
+		return nil, permissionError(err, false)
+	}
+	t.options, t.seized = opts, true
+	if err := ptrace(ptraceInterrupt, pid, 0, 0); err != nil {
+		return nil, err
+	}
+	// FindProcess does not fail on Unix.
+	return os.FindProcess(pid)
+}
+
+// Locks the wait go routine of an attached tracee to its thread, and
+// records the thread, so that wakeWait can interrupt its wait.  Called
+// on the wait go routine.
+func (t *Tracee) lockWait() {
+	if !t.attached {
+		return
+	}
+	runtime.LockOSThread()
+	t.waitTID.Store(int32(syscall.Gettid()))
+}
+
+// Wakes the wait go routine of a detached tracee that was attached.
+// After the detach, the process is no longer the tracer's to wait for,
+// but a wait already blocked is not woken by it; left blocked, it would
+// take the stops of a later tracee of the same process.  The signal,
+// which the Go runtime ignores, restarts the wait, which then fails.
+func (t *Tracee) wakeWait() {
+	if tid := t.waitTID.Load(); tid != 0 {
+		syscall.Tgkill(os.Getpid(), int(tid), syscall.SIGURG)
+	}
+}
+
+// AttachMatching attaches, as by Attach, to each process found by
+// FindProcs for which match returns true, and returns their Tracees.  A
+// process that exits before it is attached is omitted.  If attaching to
+// any other process fails, the processes already attached are closed,
+// and the error is returned.
+func AttachMatching(match func(Proc) bool, opts ...Option) ([]*Tracee, error) {
+	ps, err := FindProcs(match)
+	if err != nil {
+		return nil, err
+	}
+	return attachAll(ps, opts)
+}
+
+// AttachByName attaches, as by Attach, to each process found by
+// FindProcsByName, and returns their Tracees, as AttachMatching.
+func AttachByName(name string, opts ...Option) ([]*Tracee, error) {
+	ps, err := FindProcsByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return attachAll(ps, opts)
+}
+
+func attachAll(ps []Proc, opts []Option) ([]*Tracee, error) {
+	var ts []*Tracee
+	for _, p := range ps {
+		t, err := Attach(p.Pid, opts...)
+		switch {
+		case errors.Is(err, syscall.ESRCH):
+			continue
+		case err != nil:
+			for _, t := range ts {
+				t.Close()
+			}
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
@@ -0,0 +1,467 @@
+package ptrace
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	errRunInterrupted = errors.New("ptrace: tracee stopped before reaching the breakpoint")
+	errNoBreakpoint   = errors.New("ptrace: no breakpoint at address")
+)
+
+// A BreakpointEvent is sent when the tracee stops at a breakpoint set
+// with SetBreakpoint.  The tracee remains stopped at the breakpoint's
+// address; continuing or stepping it steps over the breakpoint.
+type BreakpointEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Addr is the address of the breakpoint.
+	Addr uint64 `json:"addr"`
+}
+
+// SetBreakpoint sets a software breakpoint at addr in the stopped
+// tracee, replacing the instruction there with a breakpoint instruction.
+// When the tracee reaches it, a BreakpointEvent is sent.  If cond is
+// non-nil, it is first called with the stopped tracee, and can use its
+// methods to read registers and memory; if it returns false, the tracee
+// is resumed transparently, as it was before it reached the breakpoint,
+// and no event is sent.  The condition must not resume the tracee.
+// Breakpoints are removed by execve.
+func (t *Tracee) SetBreakpoint(addr uintptr, cond func(*Tracee) bool) error {
+	return t.Do(func(r Raw) error {
+		return t.setBreakpoint(r, &breakpoint{
+			addr: uint64(addr),
+			user: true,
+			cond: cond,
+			hit: func(Raw, *syscall.PtraceRegs) ([]Event, bool) {
+				return nil, false
+			},
+		})
+	})
+}
+
+// ClearBreakpoint removes the breakpoint at addr set by SetBreakpoint
+// from the stopped tracee, restoring the original instruction.
+func (t *Tracee) ClearBreakpoint(addr uintptr) error {
+	return t.Do(func(r Raw) error {
+		if bp, ok := t.bps[uint64(addr)]; !ok || !bp.user {
+			return errNoBreakpoint
+		}
+		return t.clearBreakpoint(r, uint64(addr))
+	})
+}
+
+// A software breakpoint in the tracee.
+type breakpoint struct {
+	addr uint64
+	// Orig is the code replaced by the breakpoint instruction.
+	orig []byte
+	// Lib is the path of the library containing the breakpoint, if
+	// it should be forgotten when the library is unloaded.
+	lib string
+	// Hit is called on the tracer thread when the tracee stops at
+	// the breakpoint, with the registers rewound to the breakpoint's
+	// address.  It returns the events to send, and whether to resume
+	// the tracee as it was last resumed, stepping over the
+	// breakpoint transparently.  Otherwise, the stop is sent after
+	// the events, and the tracee remains stopped at the breakpoint.
+	hit func(r Raw, regs *syscall.PtraceRegs) (evs []Event, resume bool)
+	// User is whether the breakpoint was set by SetBreakpoint.
+	user bool
+	// Cond, if non-nil, is called on the wait go routine when hit
+	// returns false, and the tracee is resumed if it returns false.
+	cond func(*Tracee) bool
+}
+
+// Returns the event for a stop at the breakpoint.
+func (bp *breakpoint) stopEvent(ws syscall.WaitStatus) Event {
+	if bp.user {
+		return BreakpointEvent{Status: ws, Addr: bp.addr}
+	}
+	return Event(ws)
+}
+
+// A pending step over a breakpoint, which must be reinserted once the
+// step completes.
+type stepOver struct {
+	bp *breakpoint
+	// Then, if non-nil, resumes the tracee after the step.
+	then func() error
+}
+
+// Inserts a breakpoint at addr, replacing any existing one.  Must be
+// called on the tracer thread.
+func (t *Tracee) setBreakpoint(r Raw, bp *breakpoint) error {
+	if breakpointInsn == nil {
+		return errUnsupportedArch
+	}
+	if old, ok := t.bps[bp.addr]; ok {
+		old.hit = bp.hit
+		old.lib = bp.lib
+		old.user = bp.user
+		old.cond = bp.cond
+		return nil
+	}
+	bp.orig = make([]byte, len(breakpointInsn))
+	if _, err := r.PeekData(uintptr(bp.addr), bp.orig); err != nil {
+		return err
+	}
+	if _, err := r.PokeData(uintptr(bp.addr), breakpointInsn); err != nil {
+		return err
+	}
+	if t.bps == nil {
+		t.bps = make(map[uint64]*breakpoint)
+	}
+	t.bps[bp.addr] = bp
+	return nil
+}
+
+// Removes the breakpoint at addr, if any, restoring the original code.
+// Must be called on the tracer thread.
+func (t *Tracee) clearBreakpoint(r Raw, addr uint64) error {
+	bp, ok := t.bps[addr]
+	if !ok {
+		return nil
+	}
+	delete(t.bps, addr)
+	if s := t.stepping.Load(); s != nil && s.bp == bp {
+		// The original code is already in place.
+		return nil
+	}
+	_, err := r.PokeData(uintptr(addr), bp.orig)
+	return err
+}
+
+// Forgets the breakpoints of a library that is no longer mapped.  Must
+// be called on the tracer thread.
+func (t *Tracee) forgetBreakpoints(lib string) {
+	for addr, bp := range t.bps {
+		if bp.lib == lib {
+			delete(t.bps, addr)
+		}
+	}
+}
+
+// Returns the breakpoint at which the tracee is stopped, if any, along
+// with its registers, rewound to the breakpoint's address.  Must be
+// called on the tracer thread at a SIGTRAP stop.
+func (t *Tracee) hitBreakpoint(r Raw) (*breakpoint, syscall.PtraceRegs, bool) {
+	var regs syscall.PtraceRegs
+	if len(t.bps) == 0 || r.GetRegs(&regs) != nil {
+		return nil, regs, false
+	}
+	// A single step that ends just after a breakpoint would otherwise
+	// look like a hit on architectures whose breakpoint instruction
+	// traps after it executes.
+	if code, err := sigtrapCode(r.Pid()); err != nil || code == trapTrace {
+		return nil, regs, false
+	}
+	addr := breakpointAddr(regs.PC())
+	bp, ok := t.bps[addr]
+	if !ok {
+		return nil, regs, false
+	}
+	if regs.PC() != addr {
+		regs.SetPC(addr)
+		if r.SetRegs(&regs) != nil {
+			return nil, regs, false
+		}
+	}
+	return bp, regs, true
+}
+
+// Returns the breakpoint at the tracee's program counter, if any.  Must
+// be called on the tracer thread.
+func (t *Tracee) breakpointAtPC(r Raw) *breakpoint {
+	var regs syscall.PtraceRegs
+	if len(t.bps) == 0 || r.GetRegs(&regs) != nil {
+		return nil
+	}
+	return t.bps[regs.PC()]
+}
+
+// Returns a function that resumes the tracee with f, first stepping
+// over the breakpoint at the program counter, if any.  The step is
+// completed by the wait go routine, which reinserts the breakpoint and
+// then calls the returned function again, unless step is true, in
+// which case f is a single step, and the step over is the step itself.
+func (t *Tracee) overBreakpoint(f func() error, step bool) func() error {
+	var resume func() error
+	resume = func() error {
+		r := Raw{t}
+		bp := t.breakpointAtPC(r)
+		if bp == nil {
+			return f()
+		}
+		if _, err := r.PokeData(uintptr(bp.addr), bp.orig); err != nil {
+			return err
+		}
+		s := &stepOver{bp: bp}
+		if !step {
+			s.then = resume
+		}
+		t.stepping.Store(s)
+		if err := ptraceSingleStep(t.proc.Pid); err != nil {
+			t.stepping.Store(nil)
+			r.PokeData(uintptr(bp.addr), breakpointInsn)
+			return err
+		}
+		return nil
+	}
+	return resume
+}
+
+// Completes a pending step over a breakpoint at a stop, reinserting the
+// breakpoint.  Returns whether the stop was the end of the step, and
+// the tracee was resumed.  Called on the wait go routine.
+func (t *Tracee) finishStepOver(ws syscall.WaitStatus) bool {
+	s := t.stepping.Swap(nil)
+	if s == nil || !ws.Stopped() {
+		return false
+	}
+	resumed := false
+	t.runInternal("stepover", func() error {
+		if t.bps[s.bp.addr] == s.bp {
+			if _, err := (Raw{t}).PokeData(uintptr(s.bp.addr), breakpointInsn); err != nil {
+				return err
+			}
+		}
+		if ws.StopSignal() != syscall.SIGTRAP || s.then == nil {
+			return nil
+		}
+		err := t.resume(Running, s.then)
+		resumed = err == nil
+		return err
+	})
+	return resumed
+}
+
+// Steps the tracee over the breakpoint at which it is stopped, and
+// returns the wait status of the stop after the step.  Step must
+// single-step the tracee and return the wait status of the resulting
+// stop.  Must be called on the tracer thread.
+func (t *Tracee) stepOverBreakpoint(r Raw, bp *breakpoint, step func() (syscall.WaitStatus, error)) (syscall.WaitStatus, error) {
+	if _, err := r.PokeData(uintptr(bp.addr), bp.orig); err != nil {
+		return 0, err
+	}
+	ws, err := step()
+	if err != nil || !ws.Stopped() {
+		return ws, err
+	}
+	_, err = r.PokeData(uintptr(bp.addr), breakpointInsn)
+	return ws, err
+}
+
+// Handles a SIGTRAP stop at a breakpoint.  Returns the last event to
+// send, having sent any others, or nil if there is none, and whether
+// the stop was at a breakpoint.  Called on the wait go routine.
+func (t *Tracee) decodeBreakpoint(ws syscall.WaitStatus) (Event, bool) {
+	var bp *breakpoint
+	var evs []Event
+	var cond func(*Tracee) bool
+	resume := false
+	t.runInternal("breakpoint", func() error {
+		r := Raw{t}
+		b, regs, ok := t.hitBreakpoint(r)
+		if !ok {
+			return nil
+		}
+		bp, cond = b, b.cond
+		evs, resume = bp.hit(r, &regs)
+		return nil
+	})
+	if bp == nil {
+		return nil, false
+	}
+	// The condition is called here, not on the tracer thread, so that
+	// it can use the methods of the Tracee.
+	if !resume && cond != nil {
+		resume = !t.callCond(cond)
+	}
+	resumed := false
+	if resume {
+		t.runInternal("breakpoint", func() error {
+			if t.lastResume == nil {
+				return nil
+			}
+			err := t.resume(Running, t.overBreakpoint(t.lastResume, false))
+			resumed = err == nil
+			return err
+		})
+	}
+	if !resumed {
+		evs = append(evs, bp.stopEvent(ws))
+	}
+	if len(evs) == 0 {
+		return nil, true
+	}
+	for _, ev := range evs[:len(evs)-1] {
+		t.emit(ev)
+	}
+	return evs[len(evs)-1], true
+}
+
+// Continues the stopped tracee until it stops at addr in a state
+// accepted by done, which is called with the registers rewound to addr.
+// A temporary breakpoint is set at addr, unless there is already one,
+// and removed before returning.  Other breakpoints are handled as by the
+// wait go routine, and no event is sent for the final stop.  If the
+// tracee stops for another reason first, errRunInterrupted is returned.
+// The events of the breakpoints hit, and of an interrupting stop that
+// the intercept consumed, are returned, to be sent once the command
+// returns, as CallFunction does, since the tracer thread must not block
+// on a full events channel, nor run the observers.  Must be called on
+// the tracer thread.
+func (t *Tracee) runToBreakpoint(addr uint64, done func(regs *syscall.PtraceRegs) bool) (evs []Event, err error) {
+	if err := t.requireStopped(); err != nil {
+		return nil, err
+	}
+	stops := make(chan syscall.WaitStatus, 1)
+	intercept := func(ws syscall.WaitStatus) bool {
+		// The send must not block the wait go routine
+		// if this command has already returned.
+		select {
+		case stops <- ws:
+		default:
+		}
+		return ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP && ws.TrapCause() == 0
+	}
+	if !t.intercept.CompareAndSwap(nil, &intercept) {
+		return nil, errStopBusy
+	}
+	defer t.intercept.Store(nil)
+
+	r := Raw{t}
+	if _, ok := t.bps[addr]; !ok {
+		err := t.setBreakpoint(r, &breakpoint{
+			addr: addr,
+			hit: func(Raw, *syscall.PtraceRegs) ([]Event, bool) {
+				return nil, false
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer t.clearBreakpoint(r, addr)
+	}
+	wait := func() (syscall.WaitStatus, error) {
+		select {
+		case ws := <-stops:
+			return ws, nil
+		case <-t.waitDone:
+			return 0, ErrTraceeExited
+		}
+	}
+	cont := func() (syscall.WaitStatus, error) {
+		if bp := t.breakpointAtPC(r); bp != nil {
+			ws, err := t.stepOverBreakpoint(r, bp, func() (syscall.WaitStatus, error) {
+				err := t.resume(Running, func() error { return ptraceSingleStep(t.proc.Pid) })
+				if err != nil {
+					return 0, err
+				}
+				return wait()
+			})
+			if err != nil || !ws.Stopped() || ws.StopSignal() != syscall.SIGTRAP {
+				return ws, err
+			}
+		}
+		if err := t.resume(Running, func() error { return ptraceCont(t.proc.Pid, 0) }); err != nil {
+			return 0, err
+		}
+		return wait()
+	}
+	for {
+		ws, err := cont()
+		switch {
+		case err != nil:
+			return evs, err
+		case ws.Exited() || ws.Signaled():
+			return evs, ErrTraceeExited
+		case !ws.Stopped() || ws.StopSignal() != syscall.SIGTRAP || ws.TrapCause() != 0:
+			// The stop was not consumed by the intercept, so the
+			// wait go routine sends its event.
+			return evs, errRunInterrupted
+		}
+		bp, regs, ok := t.hitBreakpoint(r)
+		if !ok {
+			ev, ok := t.hwBreakpointEvent(r, ws)
+			if !ok {
+				ev = Event(ws)
+			}
+			return append(evs, ev), errRunInterrupted
+		}
+		hevs, resume := bp.hit(r, &regs)
+		evs = append(evs, hevs...)
+		if bp.addr == addr && done(&regs) {
+			return evs, nil
+		}
+		if !resume && bp.cond != nil {
+			resume = !t.evalCond(bp.cond)
+		}
+		if !resume && bp.addr != addr {
+			return append(evs, bp.stopEvent(ws)), errRunInterrupted
+		}
+	}
+}
+
+// Returns the result of a breakpoint condition.  The condition is called
+// on a separate go routine, and the commands that it sends are run until
+// it returns, so that it can use the methods of the Tracee.  A panic in
+// the condition is raised again here, where the command calling
+// evalCond recovers it and breaks the tracer.  Must be called on the
+// tracer thread.
+func (t *Tracee) evalCond(cond func(*Tracee) bool) bool {
+	res := make(chan bool, 1)
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panicked <- r
+			}
+		}()
+		res <- cond(t)
+	}()
+	for {
+		select {
+		case ok := <-res:
+			return ok
+		case r := <-panicked:
+			panic(r)
+		case cmd := <-t.cmds:
+			t.runCommand(cmd)
+		}
+	}
+}
+
+// Returns the result of a breakpoint condition called on the wait go
+// routine.  A panic in the condition is recovered and breaks the tracer,
+// as one in a command does, and the tracee stays stopped at the
+// breakpoint.
+func (t *Tracee) callCond(cond func(*Tracee) bool) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.breakTracer("breakpoint", r)
+			ok = true
+		}
+	}()
+	return cond(t)
+}
+
+// Forgets all breakpoints, when the tracee's image is replaced by
+// execve.  Called on the wait go routine.
+func (t *Tracee) resetBreakpoints() {
+	t.stepping.Store(nil)
+	t.runInternal("breakpoints", func() error {
+		t.bps = nil
+		return nil
+	})
+}
+
+// The si_code of a SIGTRAP caused by a single step.
+const trapTrace = 2
+
+// Returns the si_code of the signal that stopped the tracee.
+func sigtrapCode(pid int) (int32, error) {
+	info, err := getSiginfo(pid)
+	return info[2], err
+}
@@ -0,0 +1,146 @@
+package ptrace
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	errCallFaulted     = errors.New("ptrace: called function faulted")
+	errCallInterrupted = errors.New("ptrace: tracee stopped before the called function returned")
+)
+
+// CallFunction calls the function at addr in the stopped tracee with
+// the given integer arguments, and returns its integer return value.
+// The arguments are passed according to the platform's C calling
+// convention, and the function returns to address 0, where the
+// resulting fault is caught.  The tracee's registers are restored
+// afterwards; changes that the function makes to memory are not undone.
+// No events are sent for the stops of the call.  CallFunction blocks
+// until the function returns.
+//
+// As with InjectSyscall, the tracee must not be at a system call stop,
+// and ErrNotStopped is returned if it is.
+//
+// If the function faults, the fault is not delivered, and an error is
+// returned.  If the tracee stops for another reason before the function
+// returns, for example on delivery of a signal, the call is abandoned,
+// the stop is sent on the events channel as usual, and an error is
+// returned.  In both cases, the tracee's registers are restored.
+func (t *Tracee) CallFunction(addr uintptr, args []uint64) (uint64, error) {
+	var ret uint64
+	// Evs are the events of the stops consumed during the call that
+	// are to be sent.  They are emitted once the command returns, not
+	// on the tracer thread, which must not block on a full events
+	// channel; the wait go routine does not emit events meanwhile,
+	// since the tracee remains stopped.
+	var evs []Event
+	err := t.run("call", func() error {
+		if err := t.requireInjectable(); err != nil {
+			return err
+		}
+		prev := t.State()
+		stops := make(chan syscall.WaitStatus, 1)
+		intercept := func(ws syscall.WaitStatus) bool {
+			// The send must not block the wait go routine
+			// if this command has already returned.
+			select {
+			case stops <- ws:
+			default:
+			}
+			return ws.Stopped() && (ws.StopSignal() == syscall.SIGSEGV || ws.StopSignal() == syscall.SIGTRAP)
+		}
+		if !t.intercept.CompareAndSwap(nil, &intercept) {
+			return errStopBusy
+		}
+		defer t.intercept.Store(nil)
+
+		r := Raw{t}
+		var saved syscall.PtraceRegs
+		if err := r.GetRegs(&saved); err != nil {
+			return err
+		}
+		regs := saved
+		if err := setupCall(r, &regs, uint64(addr), args); err != nil {
+			return err
+		}
+		if err := r.SetRegs(&regs); err != nil {
+			return err
+		}
+		if err := t.resume(Running, func() error { return ptraceCont(t.proc.Pid, 0) }); err != nil {
+			r.SetRegs(&saved)
+			return err
+		}
+		wait := func() (syscall.WaitStatus, error) {
+			select {
+			case ws := <-stops:
+				return ws, nil
+			case <-t.waitDone:
+				return 0, ErrTraceeExited
+			}
+		}
+		ws, err := wait()
+		// Breakpoints that resume transparently, such as the
+		// loader's debug hook reached by dlopen, are stepped over
+		// here, since the intercept consumes their stops.
+		for err == nil && ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP {
+			bp, bregs, ok := t.hitBreakpoint(r)
+			if !ok {
+				break
+			}
+			hevs, resume := bp.hit(r, &bregs)
+			evs = append(evs, hevs...)
+			if !resume && bp.cond != nil {
+				resume = !t.evalCond(bp.cond)
+			}
+			if !resume {
+				break
+			}
+			ws, err = t.stepOverBreakpoint(r, bp, func() (syscall.WaitStatus, error) {
+				err := t.resume(Running, func() error { return ptraceSingleStep(t.proc.Pid) })
+				if err != nil {
+					return 0, err
+				}
+				return wait()
+			})
+			if err == nil && ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP {
+				if err = t.resume(Running, func() error { return ptraceCont(t.proc.Pid, 0) }); err == nil {
+					ws, err = wait()
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if ws.Exited() || ws.Signaled() {
+			return ErrTraceeExited
+		}
+		if err := r.GetRegs(&regs); err != nil {
+			return err
+		}
+		if err := r.SetRegs(&saved); err != nil {
+			return err
+		}
+		switch {
+		case ws.StopSignal() == syscall.SIGTRAP:
+			// The stop was consumed by the intercept, so it is
+			// sent here.
+			evs = append(evs, Event(ws))
+			return errCallInterrupted
+		case ws.StopSignal() != syscall.SIGSEGV:
+			return errCallInterrupted
+		}
+		// The stop of the return, or of the fault, was consumed, and
+		// the tracee is back where it was.
+		t.state.Store(int32(prev))
+		if regs.PC() != 0 {
+			return errCallFaulted
+		}
+		ret = callRet(&regs)
+		return nil
+	})
+	for _, ev := range evs {
+		t.emit(ev)
+	}
+	return ret, err
+}
@@ -0,0 +1,411 @@
+package ptrace
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// Redacted replaces data removed by a Redactor.
+const Redacted = "[REDACTED]"
+
+// A Redactor removes sensitive data from captured tracee data, such as
+// syscall payloads, memory, and crash dumps, before it is written.  A
+// Recorder redacts the events that it records, and writers returned by
+// NewRedactingWriter and NewEncryptedWriter redact everything written
+// to them, such as core files from WriteCore.  The zero value redacts
+// nothing.
+type Redactor struct {
+	// Paths are path.Match patterns.  Matching paths are replaced by
+	// Redacted.
+	Paths []string
+	// EnvNames are the names of environment variables whose values
+	// are redacted: replaced by Redacted in an environment given to
+	// Env, and overwritten with zeros wherever a NUL-terminated
+	// "name=value" entry, as in the environment block of a process's
+	// memory, appears in captured data.
+	EnvNames []string
+	// Bytes are byte strings that are overwritten with zeros wherever
+	// they appear in captured data.
+	Bytes [][]byte
+}
+
+// Path returns the path, or Redacted if the path matches one of the
+// redacted patterns.
+func (r *Redactor) Path(p string) string {
+	if r == nil {
+		return p
+	}
+	for _, pat := range r.Paths {
+		if ok, _ := path.Match(pat, p); ok {
+			return Redacted
+		}
+	}
+	return p
+}
+
+// Env returns a copy of the environment, given as a slice of
+// "name=value" strings, with the values of redacted variables
+// replaced by Redacted.
+func (r *Redactor) Env(env []string) []string {
+	out := make([]string, len(env))
+	for i, kv := range env {
+		out[i] = kv
+		if r == nil {
+			continue
+		}
+		name, _, _ := strings.Cut(kv, "=")
+		for _, n := range r.EnvNames {
+			if n == name {
+				out[i] = name + "=" + Redacted
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Data returns a copy of the data with every occurrence of a redacted
+// byte string, and the value of every entry of a redacted environment
+// variable, overwritten with zeros.
+func (r *Redactor) Data(data []byte) []byte {
+	out := append([]byte(nil), data...)
+	r.redact(out, true)
+	return out
+}
+
+// Redacts data in place, as Data.  Start is whether data may begin an
+// environment entry; otherwise, an entry begins only after a NUL.
+// Returns whether data ends within the value of a redacted variable,
+// which then continues in the data that follows it.
+func (r *Redactor) redact(data []byte, start bool) (open bool) {
+	if r == nil {
+		return false
+	}
+	for _, b := range r.Bytes {
+		if len(b) == 0 {
+			continue
+		}
+		for i := 0; ; {
+			j := bytes.Index(data[i:], b)
+			if j < 0 {
+				break
+			}
+			clear(data[i+j : i+j+len(b)])
+			i += j + len(b)
+		}
+	}
+	for _, name := range r.EnvNames {
+		if name == "" {
+			continue
+		}
+		entry := []byte(name + "=")
+		for i := 0; ; {
+			j := bytes.Index(data[i:], entry)
+			if j < 0 {
+				break
+			}
+			j += i
+			i = j + len(entry)
+			if j > 0 && data[j-1] != 0 || j == 0 && !start {
+				continue
+			}
+			n := bytes.IndexByte(data[i:], 0)
+			if n < 0 {
+				clear(data[i:])
+				return true
+			}
+			clear(data[i : i+n])
+			i += n
+		}
+	}
+	return false
+}
+
+// Returns the number of bytes at the end of data that can begin a
+// redacted byte string or environment entry that continues in the data
+// that follows.
+func (r *Redactor) holdLen() int {
+	n := 0
+	if r == nil {
+		return 0
+	}
+	for _, b := range r.Bytes {
+		n = max(n, len(b)-1)
+	}
+	for _, name := range r.EnvNames {
+		n = max(n, len(name))
+	}
+	return n
+}
+
+// NewRedactingWriter returns a writer that redacts everything written to
+// it, as by Data, and writes the result to w.  A redacted byte string
+// or environment entry may span writes, so the bytes that can begin one
+// are held back until the next write; Close must be called to write
+// them.  Close does not close w.
+func NewRedactingWriter(w io.Writer, r *Redactor) io.WriteCloser {
+	return &redactingWriter{w: w, r: r, start: true}
+}
+
+type redactingWriter struct {
+	w io.Writer
+	r *Redactor
+	// Held are the redacted bytes held back from the last write.
+	// Start is whether they may begin an environment entry, and open
+	// is whether the data written so far ends within the value of a
+	// redacted variable.
+	held  []byte
+	start bool
+	open  bool
+	// Closer, if non-nil, is closed by Close, after the held bytes
+	// are written to w.
+	closer io.Closer
+	err    error
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	// Appending copies p, which is not modified.
+	buf := append(rw.held, p...)
+	i := 0
+	if rw.open {
+		// The value continues up to its NUL.
+		i = bytes.IndexByte(buf, 0)
+		if i < 0 {
+			i = len(buf)
+		}
+		clear(buf[:i])
+		rw.open = i == len(buf)
+	}
+	if !rw.open {
+		rw.open = rw.r.redact(buf[i:], i == 0 && rw.start)
+	}
+	n := len(buf)
+	if !rw.open {
+		n -= min(len(buf), rw.r.holdLen())
+	}
+	if n > 0 {
+		rw.start = buf[n-1] == 0
+	}
+	if _, err := rw.w.Write(buf[:n]); err != nil {
+		rw.err = err
+		return 0, err
+	}
+	rw.held = append(rw.held[:0], buf[n:]...)
+	return len(p), nil
+}
+
+func (rw *redactingWriter) Close() error {
+	if rw.err == errWriterClosed {
+		return nil
+	}
+	if rw.err != nil {
+		return rw.err
+	}
+	if _, err := rw.w.Write(rw.held); err != nil {
+		rw.err = err
+		return err
+	}
+	rw.held = nil
+	if rw.closer != nil {
+		if err := rw.closer.Close(); err != nil {
+			rw.err = err
+			return err
+		}
+	}
+	rw.err = errWriterClosed
+	return nil
+}
+
+// A KeyFunc returns the 16, 24, or 32 byte AES key used to encrypt or
+// decrypt a trace file.
+type KeyFunc func() ([]byte, error)
+
+// The maximum number of plaintext bytes sealed in a single record.
+const recordSize = 64 << 10
+
+// NewEncryptedWriter returns a writer that encrypts everything written
+// to it with AES-GCM, using the key returned by key, and writes the
+// result to w.  If redact is non-nil, the data is first redacted, as by
+// a writer from NewRedactingWriter, so that it is never sealed in the
+// clear.  Data is buffered into records; Close must be called to flush
+// the final record, which is marked as final, so that a reader can tell
+// a complete stream from a truncated one.  Close does not close w.
+func NewEncryptedWriter(w io.Writer, key KeyFunc, redact *Redactor) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	ew := &encryptedWriter{w: w, aead: aead, nonce: make([]byte, aead.NonceSize())}
+	if _, err := rand.Read(ew.nonce); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(ew.nonce); err != nil {
+		return nil, err
+	}
+	if redact != nil {
+		return &redactingWriter{w: ew, r: redact, start: true, closer: ew}, nil
+	}
+	return ew, nil
+}
+
+var errWriterClosed = errors.New("write to closed writer")
+
+type encryptedWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	buf   []byte
+	err   error
+}
+
+func (ew *encryptedWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 && ew.err == nil {
+		m := min(len(p), recordSize-len(ew.buf))
+		ew.buf = append(ew.buf, p[:m]...)
+		p = p[m:]
+		n += m
+		if len(ew.buf) == recordSize {
+			ew.err = ew.flush(false)
+		}
+	}
+	return n, ew.err
+}
+
+func (ew *encryptedWriter) Close() error {
+	if ew.err == errWriterClosed {
+		return nil
+	}
+	if ew.err != nil {
+		return ew.err
+	}
+	if err := ew.flush(true); err != nil {
+		ew.err = err
+		return err
+	}
+	ew.err = errWriterClosed
+	return nil
+}
+
+// The additional data authenticated with each record, telling whether it
+// is the final record of the stream.
+var (
+	recordMore  = []byte{0}
+	recordFinal = []byte{1}
+)
+
+// Each record is a 4-byte, big-endian length followed by the sealed
+// data.  Every record uses the next nonce in sequence, and the last,
+// which may be empty, is sealed with recordFinal instead of recordMore.
+func (ew *encryptedWriter) flush(final bool) error {
+	ad := recordMore
+	if final {
+		ad = recordFinal
+	}
+	sealed := ew.aead.Seal(nil, ew.nonce, ew.buf, ad)
+	ew.buf = ew.buf[:0]
+	incNonce(ew.nonce)
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(sealed)))
+	if _, err := ew.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+// NewDecryptedReader returns a reader that decrypts data written by a
+// writer from NewEncryptedWriter using the same key.  Reading returns
+// io.EOF only after the final record; if the data ends before it, for
+// example because it was truncated at a record boundary, reading returns
+// io.ErrUnexpectedEOF.
+func NewDecryptedReader(r io.Reader, key KeyFunc) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	dr := &decryptedReader{r: r, aead: aead, nonce: make([]byte, aead.NonceSize())}
+	if _, err := io.ReadFull(r, dr.nonce); err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+type decryptedReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	buf   []byte
+	// Final is whether the final record has been read.
+	final bool
+}
+
+var errAfterFinal = errors.New("encrypted data after the final record")
+
+func (dr *decryptedReader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		var hdr [4]byte
+		_, err := io.ReadFull(dr.r, hdr[:])
+		switch {
+		case dr.final && err == io.EOF:
+			return 0, io.EOF
+		case dr.final && err == nil:
+			return 0, errAfterFinal
+		case err == io.EOF:
+			return 0, io.ErrUnexpectedEOF
+		case err != nil:
+			return 0, err
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n > recordSize+uint32(dr.aead.Overhead()) {
+			return 0, errors.New("encrypted record too large")
+		}
+		sealed := make([]byte, n)
+		if _, err := io.ReadFull(dr.r, sealed); err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		// A failed Open may overwrite its destination, so the record
+		// is not opened in place, and it can be tried as both kinds.
+		if dr.buf, err = dr.aead.Open(nil, dr.nonce, sealed, recordMore); err != nil {
+			if dr.buf, err = dr.aead.Open(nil, dr.nonce, sealed, recordFinal); err != nil {
+				return 0, err
+			}
+			dr.final = true
+		}
+		incNonce(dr.nonce)
+	}
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+	return n, nil
+}
+
+func newAEAD(key KeyFunc) (cipher.AEAD, error) {
+	k, err := key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func incNonce(nonce []byte) {
+	for i := len(nonce) - 1; i >= 0; i-- {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
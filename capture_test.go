@@ -0,0 +1,192 @@
+//go:build linux || darwin
+
+package ptrace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactorPathEnv(t *testing.T) {
+	r := &Redactor{Paths: []string{"/home/*/.ssh/*"}, EnvNames: []string{"TOKEN"}}
+	if got := r.Path("/home/u/.ssh/id_rsa"); got != Redacted {
+		t.Errorf("Path matching: got %q, want %q", got, Redacted)
+	}
+	if got := r.Path("/home/u/notes"); got != "/home/u/notes" {
+		t.Errorf("Path not matching: got %q", got)
+	}
+	env := []string{"HOME=/home/u", "TOKEN=abc", "TOKENS=x"}
+	want := []string{"HOME=/home/u", "TOKEN=" + Redacted, "TOKENS=x"}
+	if got := r.Env(env); !reflect.DeepEqual(got, want) {
+		t.Errorf("Env: got %q, want %q", got, want)
+	}
+	var nilr *Redactor
+	if got := nilr.Env(env); !reflect.DeepEqual(got, env) {
+		t.Errorf("nil Env: got %q, want %q", got, env)
+	}
+}
+
+var redactDataTests = []struct {
+	name       string
+	data, want string
+}{
+	{"none", "nothing to see", "nothing to see"},
+	{"bytes", "pw=hunter2, again hunter2", "pw=\x00\x00\x00\x00\x00\x00\x00, again \x00\x00\x00\x00\x00\x00\x00"},
+	{"env at start", "TOKEN=abc\x00HOME=/", "TOKEN=\x00\x00\x00\x00HOME=/"},
+	{"env after NUL", "HOME=/\x00TOKEN=abc\x00", "HOME=/\x00TOKEN=\x00\x00\x00\x00"},
+	{"env not an entry", "MYTOKEN=abc\x00", "MYTOKEN=abc\x00"},
+	{"env to end", "\x00TOKEN=abcdef", "\x00TOKEN=\x00\x00\x00\x00\x00\x00"},
+	{"both", "TOKEN=hunter2\x00hunter2", "TOKEN=" + strings.Repeat("\x00", 15)},
+}
+
+func testRedactor() *Redactor {
+	return &Redactor{EnvNames: []string{"TOKEN"}, Bytes: [][]byte{[]byte("hunter2")}}
+}
+
+func TestRedactorData(t *testing.T) {
+	r := testRedactor()
+	for _, test := range redactDataTests {
+		data := []byte(test.data)
+		if got := string(r.Data(data)); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if string(data) != test.data {
+			t.Errorf("%s: Data modified its argument", test.name)
+		}
+	}
+}
+
+// Splitting the data across writes redacts it as Data does.
+func TestRedactingWriter(t *testing.T) {
+	r := testRedactor()
+	for _, test := range redactDataTests {
+		for i := 0; i <= len(test.data); i++ {
+			for j := i; j <= len(test.data); j++ {
+				var buf bytes.Buffer
+				w := NewRedactingWriter(&buf, r)
+				for _, p := range []string{test.data[:i], test.data[i:j], test.data[j:]} {
+					if n, err := w.Write([]byte(p)); n != len(p) || err != nil {
+						t.Fatalf("%s: Write(%q) = %d, %v", test.name, p, n, err)
+					}
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("%s: Close: %v", test.name, err)
+				}
+				if got := buf.String(); got != test.want {
+					t.Errorf("%s split at %d, %d: got %q, want %q", test.name, i, j, got, test.want)
+				}
+			}
+		}
+	}
+}
+
+func testKey() ([]byte, error) { return bytes.Repeat([]byte{7}, 32), nil }
+
+// Returns data encrypted with testKey, written in chunks of the size.
+func encrypt(tb testing.TB, data []byte, chunk int, redact *Redactor) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptedWriter(&buf, testKey, redact)
+	if err != nil {
+		tb.Fatalf("NewEncryptedWriter: %v", err)
+	}
+	for p := data; len(p) > 0; {
+		n := min(chunk, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			tb.Fatalf("Write: %v", err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(enc []byte) ([]byte, error) {
+	r, err := NewDecryptedReader(bytes.NewReader(enc), testKey)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, recordSize - 1, recordSize, recordSize + 1, 3*recordSize + 5} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		for _, chunk := range []int{1000, recordSize, 5 * recordSize} {
+			got, err := decrypt(encrypt(t, data, chunk, nil))
+			if err != nil {
+				t.Fatalf("size %d, chunk %d: %v", size, chunk, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("size %d, chunk %d: data differs", size, chunk)
+			}
+		}
+	}
+}
+
+func TestEncryptedRedacts(t *testing.T) {
+	data := []byte("pw=hunter2\x00TOKEN=abc\x00")
+	got, err := decrypt(encrypt(t, data, 3, testRedactor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testRedactor().Data(data); !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncryptedTamper(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 2*recordSize+10)
+	enc := encrypt(t, data, recordSize, nil)
+	// The stream is the nonce, then records of a 4-byte length and the
+	// sealed data: two full records, and the final one.
+	nonce := 12
+	full := 4 + recordSize + 16
+	final := nonce + 2*full
+	tests := []struct {
+		name string
+		enc  []byte
+		want error
+	}{
+		{"truncated at a record", enc[:final], io.ErrUnexpectedEOF},
+		{"truncated in a record", enc[:final-5], io.ErrUnexpectedEOF},
+		{"truncated in a length", enc[:final+2], io.ErrUnexpectedEOF},
+		{"data after final", append(append([]byte(nil), enc...), enc[nonce:nonce+full]...), errAfterFinal},
+	}
+	for _, test := range tests {
+		if _, err := decrypt(test.enc); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+	for _, i := range []int{0, nonce + 4, nonce + full + 100, len(enc) - 1} {
+		bad := append([]byte(nil), enc...)
+		bad[i] ^= 1
+		if _, err := decrypt(bad); err == nil {
+			t.Errorf("byte %d flipped: decrypted without error", i)
+		}
+	}
+	swapped := append([]byte(nil), enc[:nonce]...)
+	swapped = append(swapped, enc[nonce+full:nonce+2*full]...)
+	swapped = append(swapped, enc[nonce:nonce+full]...)
+	swapped = append(swapped, enc[final:]...)
+	if _, err := decrypt(swapped); err == nil {
+		t.Error("records reordered: decrypted without error")
+	}
+	wrongKey := func() ([]byte, error) { return bytes.Repeat([]byte{8}, 32), nil }
+	r, err := NewDecryptedReader(bytes.NewReader(enc), wrongKey)
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	if err == nil {
+		t.Error("wrong key: decrypted without error")
+	}
+}
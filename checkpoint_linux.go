@@ -0,0 +1,243 @@
+package ptrace
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	errCheckpointReleased = errors.New("ptrace: checkpoint was released")
+	errCheckpointLayout   = errors.New("ptrace: tracee mappings no longer match the checkpoint")
+	errCheckpointTracee   = errors.New("ptrace: checkpoint belongs to another tracee")
+)
+
+// PTRACE_O_EXITKILL, which the syscall package does not define.
+const ptraceOExitKill = 0x100000
+
+// A Checkpoint is a copy-on-write copy of a stopped tracee, made by
+// Tracee.Checkpoint.  The copy is a process forked from the tracee,
+// which remains stopped until the checkpoint is released.
+type Checkpoint struct {
+	t   *Tracee
+	pid int
+	// Released is set by Release.  It is only accessed on the tracer
+	// thread.
+	released bool
+}
+
+// Checkpoint forks the stopped tracee, with a clone system call injected
+// as with InjectSyscall, and keeps the child stopped as a checkpoint of
+// the tracee's memory and registers, which Restore can return the tracee
+// to.  The child is a sibling of the tracee, so the tracee is not
+// notified when it exits, and it is killed if the tracer exits.  Only the
+// traced thread is copied.
+func (t *Tracee) Checkpoint() (*Checkpoint, error) {
+	nr, ok := SyscallNumber("clone")
+	if !ok {
+		return nil, t.opError("checkpoint", errUnsupportedArch)
+	}
+	var c *Checkpoint
+	err := t.run("checkpoint", func() error {
+		if err := t.requireInjectable(); err != nil {
+			return err
+		}
+		stops := make(chan syscall.WaitStatus, 1)
+		intercept := func(ws syscall.WaitStatus) bool {
+			// The send must not block the wait go routine
+			// if this command has already returned.
+			select {
+			case stops <- ws:
+			default:
+			}
+			return ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP
+		}
+		if !t.intercept.CompareAndSwap(nil, &intercept) {
+			return errStopBusy
+		}
+		defer t.intercept.Store(nil)
+
+		// The child is traced only while the clone is injected, so
+		// that the tracee's own threads are not.
+		pid := t.proc.Pid
+		if err := syscall.PtraceSetOptions(pid, t.options|syscall.PTRACE_O_TRACECLONE); err != nil {
+			return err
+		}
+		defer syscall.PtraceSetOptions(pid, t.options)
+		// Without an exit signal, the clone is a fork that the
+		// parent is not notified of; with CLONE_PARENT, the child is
+		// the tracer's to reap.
+		ret, err := t.injectSyscall(nr, []uint64{syscall.CLONE_PARENT}, func() (syscall.WaitStatus, error) {
+			for {
+				err := t.resume(Running, func() error { return ptraceSingleStep(pid) })
+				if err != nil {
+					return 0, err
+				}
+				var ws syscall.WaitStatus
+				select {
+				case ws = <-stops:
+				case <-t.waitDone:
+					return 0, ErrTraceeExited
+				}
+				// The system call continues after the clone
+				// event stop.
+				if ws.Stopped() && ws.TrapCause() == syscall.PTRACE_EVENT_CLONE {
+					continue
+				}
+				return ws, nil
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if err := syscallErrno(ret); err != nil {
+			return err
+		}
+		c = &Checkpoint{t: t, pid: int(ret)}
+		if err := t.initCheckpoint(c.pid); err != nil {
+			killChild(c.pid)
+			return err
+		}
+		return nil
+	})
+	return c, err
+}
+
+// Waits for the initial stop of a newly cloned checkpoint, and returns
+// its registers and code to those of the tracee, before the clone was
+// injected.  Must be called on the tracer thread.
+func (t *Tracee) initCheckpoint(pid int) error {
+	ws, err := waitPid(pid)
+	if err != nil {
+		return err
+	}
+	if !ws.Stopped() {
+		return ErrTraceeExited
+	}
+	if err := syscall.PtraceSetOptions(pid, ptraceOExitKill); err != nil {
+		return err
+	}
+	var regs syscall.PtraceRegs
+	if err := ptraceGetRegs(t.proc.Pid, &regs); err != nil {
+		return err
+	}
+	if err := ptraceSetRegs(pid, &regs); err != nil {
+		return err
+	}
+	// The child's memory was copied with the system call instruction
+	// written over the code at the program counter, and breakpoints
+	// inserted in the code.
+	code := make([]byte, len(syscallInsn))
+	if _, err := ptracePeek(t.proc.Pid, uintptr(regs.PC()), code); err != nil {
+		return err
+	}
+	if _, err := ptracePoke(pid, uintptr(regs.PC()), code); err != nil {
+		return err
+	}
+	for _, bp := range t.bps {
+		if _, err := ptracePoke(pid, uintptr(bp.addr), bp.orig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore returns the stopped tracee to the state of a checkpoint: its
+// writable memory, registers, and floating point registers.  Other
+// state, such as open files and the contents of file mappings, is not
+// restored.  The tracee's writable mappings must still include those of
+// the checkpoint; mappings may have grown, as the heap does, but not
+// shrunk or moved.  A checkpoint can be restored any number of times.
+func (t *Tracee) Restore(c *Checkpoint) error {
+	if c.t != t {
+		return t.opError("restore", errCheckpointTracee)
+	}
+	return t.Do(func(r Raw) error {
+		if c.released {
+			return errCheckpointReleased
+		}
+		cms, err := readMaps(c.pid)
+		if err != nil {
+			return err
+		}
+		tms, err := readMaps(t.proc.Pid)
+		if err != nil {
+			return err
+		}
+		var copies []Mapping
+		for _, m := range cms {
+			if m.Perms&PermWrite == 0 || m.Perms&PermRead == 0 {
+				continue
+			}
+			i := 0
+			for i < len(tms) && tms[i].Start != m.Start {
+				i++
+			}
+			if i == len(tms) || tms[i].End < m.End || tms[i].Perms&PermWrite == 0 {
+				return errCheckpointLayout
+			}
+			copies = append(copies, m)
+		}
+		buf := make([]byte, searchChunkSize)
+		for _, m := range copies {
+			for a := m.Start; a < m.End; a += uint64(len(buf)) {
+				b := buf[:min(uint64(len(buf)), m.End-a)]
+				if err := vmRead(c.pid, a, b); err != nil {
+					if _, err := ptracePeek(c.pid, uintptr(a), b); err != nil {
+						return err
+					}
+				}
+				if err := writeMemory(r, a, b); err != nil {
+					return err
+				}
+			}
+		}
+		// The checkpoint's copy of the code has no breakpoints, so they
+		// are reinserted.
+		for _, bp := range t.bps {
+			if _, err := r.PokeData(uintptr(bp.addr), breakpointInsn); err != nil {
+				return err
+			}
+		}
+		var regs syscall.PtraceRegs
+		if err := ptraceGetRegs(c.pid, &regs); err != nil {
+			return err
+		}
+		if err := r.SetRegs(&regs); err != nil {
+			return err
+		}
+		if fp, err := getFPRegs(c.pid); err == nil {
+			return setFPRegs(r.Pid(), fp)
+		}
+		return nil
+	})
+}
+
+// Release kills the checkpoint's process.  The checkpoint can no longer
+// be restored.  Releasing a checkpoint more than once is harmless.  Once
+// the tracee has exited, Release fails, and the checkpoint's process is
+// killed when the tracee is closed.
+func (c *Checkpoint) Release() error {
+	return c.t.run("release", func() error {
+		if c.released {
+			return nil
+		}
+		c.released = true
+		return killChild(c.pid)
+	})
+}
+
+// Kills and reaps a stopped child of the tracer thread.
+func killChild(pid int) error {
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		return err
+	}
+	for {
+		ws, err := waitPid(pid)
+		if err != nil {
+			return err
+		}
+		if ws.Exited() || ws.Signaled() {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Ptrace-doctor reports which features of the ptrace package work in the
+// current environment.
+//
+// Usage:
+//
+//	ptrace-doctor [-json]
+//
+// The exit status is 1 if any check fails.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/eaburns/ptrace"
+)
+
+var jsonOutput = flag.Bool("json", false, "print the report as JSON")
+
+func main() {
+	flag.Parse()
+	r := ptrace.Doctor()
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(r); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Printf("%s/%s %s\n", r.OS, r.Arch, r.Kernel)
+		for _, c := range r.Checks {
+			status := "ok"
+			switch {
+			case !c.OK && c.Info:
+				status = "no"
+			case !c.OK:
+				status = "FAIL"
+			}
+			fmt.Printf("%-20s %-4s %s\n", c.Name, status, c.Detail)
+		}
+	}
+	if !r.OK() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,51 @@
+// Ptrace-policydiff compares the verdict logs of two dry runs of a
+// policy, as written by ptrace.WithDryRun.
+//
+// Usage:
+//
+//	ptrace-policydiff a.log b.log
+//
+// For each rule and system call whose number of verdicts differs
+// between the runs, it prints the counts from each run.  The exit
+// status is 1 if the runs differ.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/eaburns/ptrace"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: ptrace-policydiff a.log b.log")
+		os.Exit(2)
+	}
+	a := read(os.Args[1])
+	b := read(os.Args[2])
+	diffs := ptrace.DiffVerdicts(a, b)
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Printf("%-20s %-16s %8s %8s\n", "RULE", "SYSCALL", "A", "B")
+	for _, d := range diffs {
+		fmt.Printf("%-20s %-16s %8d %8d\n", d.Rule, d.Syscall, d.A, d.B)
+	}
+	os.Exit(1)
+}
+
+func read(path string) []ptrace.Verdict {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer f.Close()
+	vs, err := ptrace.ReadVerdicts(f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, path+":", err)
+		os.Exit(2)
+	}
+	return vs
+}
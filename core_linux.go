@@ -0,0 +1,316 @@
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Note types of core files.
+const (
+	ntPrstatus = 1
+	ntPrfpreg  = 2
+	ntPrpsinfo = 3
+	ntAuxv     = 6
+	ntFile     = 0x46494c45
+)
+
+// The size of struct elf_prstatus before pr_reg, and of struct
+// elf_prpsinfo, on 64-bit architectures.
+const (
+	prstatusHeaderSize = 112
+	prpsinfoSize       = 136
+)
+
+// WriteCore writes an ELF core file of the stopped tracee to w, which
+// can be loaded by gdb or delve along with the executable.  The core has
+// a PT_LOAD segment for each mapping, with the contents of the readable
+// ones, and notes with the registers, floating point registers,
+// auxiliary vector, and mapped files of the tracee.  Only the traced
+// thread is included.  Core files are only supported on 64-bit
+// architectures.  The memory is written as it is; to redact it, w can
+// be a writer returned by NewRedactingWriter or NewEncryptedWriter.
+func (t *Tracee) WriteCore(w io.Writer) error {
+	var machine elf.Machine
+	switch runtime.GOARCH {
+	case "amd64":
+		machine = elf.EM_X86_64
+	case "arm64":
+		machine = elf.EM_AARCH64
+	case "riscv64":
+		machine = elf.EM_RISCV
+	default:
+		return t.opError("core", errUnsupportedArch)
+	}
+	ms, err := t.Mappings()
+	if err != nil {
+		return t.opError("core", err)
+	}
+	dir := "/proc/" + strconv.Itoa(t.proc.Pid)
+	return t.Do(func(r Raw) error {
+		notes, err := t.coreNotes(r, dir, ms)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(w)
+		if err := writeCore(bw, r, machine, notes, ms); err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+}
+
+// Returns the notes of a core file of the stopped tracee.  Must be
+// called on the tracer thread.
+func (t *Tracee) coreNotes(r Raw, dir string, ms []Mapping) ([]byte, error) {
+	var regs syscall.PtraceRegs
+	if err := r.GetRegs(&regs); err != nil {
+		return nil, err
+	}
+	info, _ := getSiginfo(r.Pid())
+	stat := procStat(dir)
+
+	var notes bytes.Buffer
+	prstatus := make([]byte, prstatusHeaderSize)
+	le := binary.LittleEndian
+	le.PutUint32(prstatus[0:], uint32(info[0]))
+	le.PutUint32(prstatus[4:], uint32(info[2]))
+	le.PutUint32(prstatus[8:], uint32(info[1]))
+	le.PutUint16(prstatus[12:], uint16(info[0]))
+	le.PutUint32(prstatus[32:], uint32(r.Pid()))
+	le.PutUint32(prstatus[36:], uint32(stat.field(1)))
+	le.PutUint32(prstatus[40:], uint32(stat.field(2)))
+	le.PutUint32(prstatus[44:], uint32(stat.field(3)))
+	prstatus = append(prstatus, unsafe.Slice((*byte)(unsafe.Pointer(&regs)), unsafe.Sizeof(regs))...)
+	fp, err := getFPRegs(r.Pid())
+	if err == nil {
+		// pr_fpvalid, padded to 8 bytes.
+		prstatus = append(prstatus, 1, 0, 0, 0, 0, 0, 0, 0)
+	} else {
+		prstatus = append(prstatus, make([]byte, 8)...)
+	}
+	writeNote(&notes, ntPrstatus, prstatus)
+
+	prpsinfo := make([]byte, prpsinfoSize)
+	if len(stat.state) > 0 {
+		prpsinfo[1] = stat.state[0]
+	}
+	le.PutUint32(prpsinfo[24:], uint32(r.Pid()))
+	le.PutUint32(prpsinfo[28:], uint32(stat.field(1)))
+	le.PutUint32(prpsinfo[32:], uint32(stat.field(2)))
+	le.PutUint32(prpsinfo[36:], uint32(stat.field(3)))
+	if fi, err := os.Stat(dir); err == nil {
+		st := fi.Sys().(*syscall.Stat_t)
+		le.PutUint32(prpsinfo[16:], st.Uid)
+		le.PutUint32(prpsinfo[20:], st.Gid)
+	}
+	copy(prpsinfo[40:55], stat.comm)
+	if cmdline, err := os.ReadFile(dir + "/cmdline"); err == nil {
+		args := strings.TrimRight(strings.ReplaceAll(string(cmdline), "\x00", " "), " ")
+		copy(prpsinfo[56:135], args)
+	}
+	writeNote(&notes, ntPrpsinfo, prpsinfo)
+
+	if fp != nil {
+		writeNote(&notes, ntPrfpreg, fp)
+	}
+	if auxv, err := os.ReadFile(dir + "/auxv"); err == nil {
+		writeNote(&notes, ntAuxv, auxv)
+	}
+	writeNote(&notes, ntFile, fileNote(ms))
+	return notes.Bytes(), nil
+}
+
+// Writes a core file with the given notes and a PT_LOAD segment for each
+// mapping.  Must be called on the tracer thread.
+func writeCore(w io.Writer, r Raw, machine elf.Machine, notes []byte, ms []Mapping) error {
+	const (
+		ehdrSize = 64
+		phdrSize = 56
+	)
+	le := binary.LittleEndian
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     ehdrSize,
+		Ehsize:    ehdrSize,
+		Phentsize: phdrSize,
+		Phnum:     uint16(1 + len(ms)),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	if err := binary.Write(w, le, &hdr); err != nil {
+		return err
+	}
+
+	page := uint64(os.Getpagesize())
+	off := uint64(ehdrSize + phdrSize*(1+len(ms)))
+	note := elf.Prog64{Type: uint32(elf.PT_NOTE), Off: off, Filesz: uint64(len(notes)), Align: 4}
+	if err := binary.Write(w, le, &note); err != nil {
+		return err
+	}
+	off = (off + uint64(len(notes)) + page - 1) &^ (page - 1)
+	dataOff := off
+	var loads []elf.Prog64
+	for _, m := range ms {
+		p := elf.Prog64{
+			Type:  uint32(elf.PT_LOAD),
+			Off:   off,
+			Vaddr: m.Start,
+			Memsz: m.End - m.Start,
+			Align: page,
+		}
+		if m.Perms&PermRead != 0 && m.Path != "[vvar]" && m.Path != "[vsyscall]" {
+			p.Filesz = p.Memsz
+		}
+		if m.Perms&PermRead != 0 {
+			p.Flags |= uint32(elf.PF_R)
+		}
+		if m.Perms&PermWrite != 0 {
+			p.Flags |= uint32(elf.PF_W)
+		}
+		if m.Perms&PermExec != 0 {
+			p.Flags |= uint32(elf.PF_X)
+		}
+		off += p.Filesz
+		loads = append(loads, p)
+	}
+	if err := binary.Write(w, le, loads); err != nil {
+		return err
+	}
+	pad := dataOff - uint64(ehdrSize+phdrSize*(1+len(ms))) - uint64(len(notes))
+	if _, err := w.Write(append(notes, make([]byte, pad)...)); err != nil {
+		return err
+	}
+	buf := make([]byte, searchChunkSize)
+	for _, p := range loads {
+		for a := p.Vaddr; a < p.Vaddr+p.Filesz; a += uint64(len(buf)) {
+			b := buf[:min(uint64(len(buf)), p.Vaddr+p.Filesz-a)]
+			if err := readMemory(r, a, b); err != nil {
+				// Memory that cannot be read, such as a
+				// mapping beyond the end of its file, is
+				// written as zeros.
+				clear(b)
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Appends an ELF note with the name "CORE" to b.
+func writeNote(b *bytes.Buffer, typ uint32, desc []byte) {
+	le := binary.LittleEndian
+	var hdr [12]byte
+	le.PutUint32(hdr[0:], 5)
+	le.PutUint32(hdr[4:], uint32(len(desc)))
+	le.PutUint32(hdr[8:], typ)
+	b.Write(hdr[:])
+	b.WriteString("CORE\x00\x00\x00\x00")
+	b.Write(desc)
+	b.Write(make([]byte, (4-len(desc)%4)%4))
+}
+
+// Returns the NT_FILE note describing the file mappings.
+func fileNote(ms []Mapping) []byte {
+	page := uint64(os.Getpagesize())
+	var files []Mapping
+	for _, m := range ms {
+		if strings.HasPrefix(m.Path, "/") {
+			files = append(files, m)
+		}
+	}
+	le := binary.LittleEndian
+	b := le.AppendUint64(nil, uint64(len(files)))
+	b = le.AppendUint64(b, page)
+	for _, m := range files {
+		b = le.AppendUint64(b, m.Start)
+		b = le.AppendUint64(b, m.End)
+		b = le.AppendUint64(b, m.Offset/page)
+	}
+	for _, m := range files {
+		b = append(append(b, m.Path...), 0)
+	}
+	return b
+}
+
+// The fields of /proc/pid/stat.
+type stat struct {
+	comm  string
+	state string
+	// Rest are the fields following the state.
+	rest []string
+}
+
+// Returns the i'th field following the state, or 0 if it cannot be
+// parsed.  Field 1 is the parent's process ID.
+func (s stat) field(i int) int {
+	if i-1 >= len(s.rest) {
+		return 0
+	}
+	n, _ := strconv.Atoi(s.rest[i-1])
+	return n
+}
+
+// Returns the fields of the stat file of a /proc/pid directory.
+func procStat(dir string) stat {
+	b, err := os.ReadFile(dir + "/stat")
+	if err != nil {
+		return stat{}
+	}
+	// The command name is in parentheses, and may contain spaces and
+	// parentheses.
+	s := string(b)
+	i, j := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if i < 0 || j < i {
+		return stat{}
+	}
+	fs := strings.Fields(s[j+1:])
+	if len(fs) == 0 {
+		return stat{comm: s[i+1 : j]}
+	}
+	return stat{comm: s[i+1 : j], state: fs[0], rest: fs[1:]}
+}
+
+// Returns the siginfo_t of the signal that stopped the tracee, as 32-bit
+// words; si_signo, si_errno, and si_code are the first three.
+func getSiginfo(pid int) ([32]int32, error) {
+	// A siginfo_t is 128 bytes.
+	var info [32]int32
+	_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_GETSIGINFO, uintptr(pid),
+		0, uintptr(unsafe.Pointer(&info[0])), 0, 0)
+	if e != 0 {
+		return info, e
+	}
+	return info, nil
+}
+
+// Returns the tracee's floating point registers, in the layout of the
+// NT_PRFPREG regset.
+func getFPRegs(pid int) ([]byte, error) {
+	buf := make([]byte, 1024)
+	n, err := getRegSet(pid, ntPrfpreg, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Sets the tracee's floating point registers, in the layout of the
+// NT_PRFPREG regset.
+func setFPRegs(pid int, fp []byte) error {
+	return setRegSet(pid, ntPrfpreg, fp)
+}
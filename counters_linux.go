@@ -0,0 +1,189 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"syscall"
+)
+
+var (
+	errNoCounters     = errors.New("ptrace: no counters requested")
+	errBadCounter     = errors.New("ptrace: unknown counter type")
+	errCountersClosed = errors.New("ptrace: counters are closed")
+)
+
+// A CounterType is a kind of event counted by Counters.
+type CounterType int
+
+const (
+	// Instructions counts retired instructions.
+	Instructions CounterType = iota
+	// Cycles counts CPU cycles.
+	Cycles
+	// CacheReferences counts last-level cache accesses.
+	CacheReferences
+	// CacheMisses counts last-level cache misses.
+	CacheMisses
+	// Branches counts retired branch instructions.
+	Branches
+	// BranchMisses counts mispredicted branches.
+	BranchMisses
+	// TaskClock counts the nanoseconds that the tracee ran.
+	TaskClock
+	// PageFaults counts page faults.
+	PageFaults
+	// ContextSwitches counts context switches.
+	ContextSwitches
+)
+
+var counterTypeNames = [...]string{
+	Instructions:    "instructions",
+	Cycles:          "cycles",
+	CacheReferences: "cache-references",
+	CacheMisses:     "cache-misses",
+	Branches:        "branches",
+	BranchMisses:    "branch-misses",
+	TaskClock:       "task-clock",
+	PageFaults:      "page-faults",
+	ContextSwitches: "context-switches",
+}
+
+func (c CounterType) String() string {
+	if c < 0 || int(c) >= len(counterTypeNames) {
+		return "unknown"
+	}
+	return counterTypeNames[c]
+}
+
+// The perf event types of PERF_TYPE_HARDWARE and PERF_TYPE_SOFTWARE.
+const (
+	perfTypeHardware = 0
+	perfTypeSoftware = 1
+)
+
+// The perf event type and config of each CounterType.
+var counterConfigs = [...]struct{ typ, config uint32 }{
+	Instructions:    {perfTypeHardware, 1},
+	Cycles:          {perfTypeHardware, 0},
+	CacheReferences: {perfTypeHardware, 2},
+	CacheMisses:     {perfTypeHardware, 3},
+	Branches:        {perfTypeHardware, 4},
+	BranchMisses:    {perfTypeHardware, 5},
+	TaskClock:       {perfTypeSoftware, 1},
+	PageFaults:      {perfTypeSoftware, 2},
+	ContextSwitches: {perfTypeSoftware, 3},
+}
+
+// Bits of perfEventAttr.ReadFormat.
+const (
+	perfFormatTotalTimeEnabled = 1 << 0
+	perfFormatTotalTimeRunning = 1 << 1
+	perfFormatGroup            = 1 << 3
+)
+
+// Counters are hardware and software performance counters of the
+// tracee's thread, opened by Tracee.Counters.  The counters run with
+// the tracee, at full speed, and count only its user-space execution.
+type Counters struct {
+	mu    sync.Mutex
+	types []CounterType
+	// Fds are the events, led by the first.
+	fds    []int
+	closed bool
+}
+
+// Counters opens perf counters of the given types for the tracee's
+// thread, which count from when they are opened.  A counter that the
+// processor or kernel does not support, for example a hardware counter
+// in a virtual machine without a virtual PMU, is an error, as is a
+// perf_event_paranoid setting that forbids the counters.
+func (t *Tracee) Counters(types ...CounterType) (*Counters, error) {
+	if len(types) == 0 {
+		return nil, errNoCounters
+	}
+	c := &Counters{types: append([]CounterType(nil), types...)}
+	group := -1
+	for _, typ := range types {
+		if typ < 0 || int(typ) >= len(counterConfigs) {
+			c.Close()
+			return nil, errBadCounter
+		}
+		cfg := counterConfigs[typ]
+		attr := perfEventAttr{
+			Type:       cfg.typ,
+			Config:     uint64(cfg.config),
+			ReadFormat: perfFormatGroup | perfFormatTotalTimeEnabled | perfFormatTotalTimeRunning,
+			Flags:      perfFlagExcludeKernel | perfFlagExcludeHV,
+		}
+		fd, err := perfEventOpen(&attr, t.proc.Pid, group)
+		if err != nil {
+			c.Close()
+			return nil, t.opError("perf_event_open", err)
+		}
+		if group < 0 {
+			group = fd
+		}
+		c.fds = append(c.fds, fd)
+	}
+	return c, nil
+}
+
+// Types returns the types of the counters, in the order of the values
+// returned by Read.
+func (c *Counters) Types() []CounterType {
+	return append([]CounterType(nil), c.types...)
+}
+
+// Read returns the counts, in the order of the types given to
+// Tracee.Counters.  The counts do not change while the tracee is
+// stopped, so when read at a stop, they are the counts at the stop.  If
+// the kernel multiplexed the counters with others, because there are
+// more than the processor has, the counts are scaled up to estimate the
+// full counts.
+func (c *Counters) Read() ([]uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errCountersClosed
+	}
+	// The group is read as nr, time_enabled, time_running, and the
+	// value of each event.
+	b := make([]byte, 8*(3+len(c.fds)))
+	n, err := syscall.Read(c.fds[0], b)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(b) {
+		return nil, syscall.EIO
+	}
+	enabled := binary.NativeEndian.Uint64(b[8:])
+	running := binary.NativeEndian.Uint64(b[16:])
+	vals := make([]uint64, len(c.fds))
+	for i := range vals {
+		v := binary.NativeEndian.Uint64(b[24+8*i:])
+		if running > 0 && running < enabled {
+			v = uint64(float64(v) * float64(enabled) / float64(running))
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// Close closes the counters.
+func (c *Counters) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errCountersClosed
+	}
+	var err error
+	// The group leader is closed last.
+	for i := len(c.fds) - 1; i >= 0; i-- {
+		if e := syscall.Close(c.fds[i]); err == nil {
+			err = e
+		}
+	}
+	c.fds, c.closed = nil, true
+	return err
+}
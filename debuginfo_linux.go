@@ -0,0 +1,202 @@
+package ptrace
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+var errNoDebugInfo = errors.New("ptrace: no debug information for pc")
+
+// Debug information for the tracee's executable.
+type debugInfo struct {
+	elf   *elf.File
+	dwarf *dwarf.Data // nil if the executable has no DWARF
+	// Bias is the difference between run-time and link-time
+	// addresses, which is non-zero for position independent
+	// executables.
+	bias uint64
+}
+
+// A function from the DWARF.
+type dwarfFunc struct {
+	name      string
+	low, high uint64 // link-time addresses
+	frameBase []byte // location expression, or nil
+	params    []dwarfParam
+}
+
+type dwarfParam struct {
+	name string
+	loc  []byte // location expression, or nil if not an expression
+}
+
+// A cache of the debug information for the tracee's executable, which
+// is dropped when the tracee calls execve.  It is charged to the tracee
+// as CacheMemory, by the size of the executable.
+type debugCache struct {
+	mu     sync.Mutex
+	info   *debugInfo
+	charge *memCharge
+}
+
+// Returns the debug information for the tracee's executable, loading it
+// if needed.
+func (t *Tracee) debugInfo() (*debugInfo, error) {
+	t.dbg.mu.Lock()
+	defer t.dbg.mu.Unlock()
+	if t.dbg.info != nil {
+		t.mem.touch(t.dbg.charge)
+		return t.dbg.info, nil
+	}
+	exe := "/proc/" + strconv.Itoa(t.proc.Pid) + "/exe"
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return nil, err
+	}
+	f, err := elf.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	info := &debugInfo{elf: f}
+	info.dwarf, _ = f.DWARF()
+	if info.bias, err = t.LoadBias(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	t.dbg.info = info
+	// The evicted file is not closed, since it may still be in use;
+	// it is closed when it is collected.
+	t.dbg.charge = t.mem.charge(CacheMemory, fi.Size(), func() {
+		t.dbg.mu.Lock()
+		defer t.dbg.mu.Unlock()
+		if t.dbg.info == info {
+			t.dbg.info, t.dbg.charge = nil, nil
+		}
+	})
+	return info, nil
+}
+
+// Drops the cached debug information when the tracee's image changes.
+// Called on the wait go routine.
+func (t *Tracee) observeDebugInfo(ev Event) {
+	if _, ok := ev.(ExecEvent); !ok {
+		return
+	}
+	t.dbg.mu.Lock()
+	defer t.dbg.mu.Unlock()
+	if t.dbg.info != nil {
+		t.dbg.info.elf.Close()
+		t.mem.release(t.dbg.charge)
+		t.dbg.info, t.dbg.charge = nil, nil
+	}
+}
+
+// LoadBias returns the load bias of the tracee's executable, f, as
+// opened from /proc/pid/exe: the amount added to its addresses when it
+// was loaded.  For a position independent executable, it is the address
+// of the executable's first mapping less the page-aligned address of its
+// first loadable segment; for any other, it is 0.
+func (t *Tracee) LoadBias(f *elf.File) (uint64, error) {
+	if f.Type != elf.ET_DYN {
+		return 0, nil
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat("/proc/"+strconv.Itoa(t.proc.Pid)+"/exe", &st); err != nil {
+		return 0, err
+	}
+	ms, err := t.Mappings()
+	if err != nil {
+		return 0, err
+	}
+	vaddr := ^uint64(0)
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && p.Vaddr < vaddr {
+			vaddr = p.Vaddr
+		}
+	}
+	pageSize := uint64(os.Getpagesize())
+	for _, m := range ms {
+		if m.Inode == st.Ino && m.Offset == 0 {
+			return m.Start - vaddr&^(pageSize-1), nil
+		}
+	}
+	return 0, errors.New("ptrace: executable is not mapped")
+}
+
+// Returns the function containing the run-time pc.
+func (d *debugInfo) funcForPC(pc uint64) (*dwarfFunc, error) {
+	if d.dwarf == nil {
+		return d.symbolForPC(pc)
+	}
+	pc -= d.bias
+	r := d.dwarf.Reader()
+	if _, err := r.SeekPC(pc); err != nil {
+		return d.symbolForPC(pc + d.bias)
+	}
+	// Depth is 1 among the children of the compilation unit, and 2
+	// among the children of the function, once it is found.
+	var fn *dwarfFunc
+	depth := 1
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			if depth--; depth == 0 || fn != nil {
+				break
+			}
+			continue
+		}
+		descend := false
+		switch {
+		case fn == nil && e.Tag == dwarf.TagSubprogram:
+			ranges, _ := d.dwarf.Ranges(e)
+			for _, rg := range ranges {
+				if rg[0] <= pc && pc < rg[1] {
+					fn = &dwarfFunc{low: rg[0], high: rg[1]}
+					fn.name, _ = e.Val(dwarf.AttrName).(string)
+					fn.frameBase, _ = e.Val(dwarf.AttrFrameBase).([]byte)
+					descend = true
+					break
+				}
+			}
+		case fn != nil && e.Tag == dwarf.TagFormalParameter:
+			var p dwarfParam
+			p.name, _ = e.Val(dwarf.AttrName).(string)
+			p.loc, _ = e.Val(dwarf.AttrLocation).([]byte)
+			fn.params = append(fn.params, p)
+		}
+		if e.Children {
+			if descend {
+				depth++
+			} else {
+				r.SkipChildren()
+			}
+		} else if descend {
+			break
+		}
+	}
+	if fn != nil {
+		return fn, nil
+	}
+	return d.symbolForPC(pc + d.bias)
+}
+
+// Returns the function containing the run-time pc from the symbol
+// table, without parameters.
+func (d *debugInfo) symbolForPC(pc uint64) (*dwarfFunc, error) {
+	pc -= d.bias
+	syms, _ := d.elf.Symbols()
+	for _, s := range syms {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC && s.Value <= pc && pc < s.Value+s.Size {
+			return &dwarfFunc{name: s.Name, low: s.Value, high: s.Value + s.Size}, nil
+		}
+	}
+	return nil, errNoDebugInfo
+}
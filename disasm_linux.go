@@ -0,0 +1,114 @@
+package ptrace
+
+import (
+	"errors"
+	"os"
+)
+
+var errShortInsn = errors.New("ptrace: instruction is truncated")
+
+// A Flow classifies the control flow of an Instruction.
+type Flow int
+
+const (
+	// FlowNone is an instruction that continues to the next.
+	FlowNone Flow = iota
+	// FlowCall is a call.
+	FlowCall
+	// FlowReturn is a return.
+	FlowReturn
+	// FlowJump is an unconditional jump.
+	FlowJump
+	// FlowBranch is a conditional jump.
+	FlowBranch
+)
+
+var flowNames = [...]string{
+	FlowNone:   "none",
+	FlowCall:   "call",
+	FlowReturn: "return",
+	FlowJump:   "jump",
+	FlowBranch: "branch",
+}
+
+func (f Flow) String() string {
+	if f < 0 || int(f) >= len(flowNames) {
+		return "unknown"
+	}
+	return flowNames[f]
+}
+
+// An Instruction is a machine instruction decoded from the tracee's
+// memory.
+type Instruction struct {
+	Addr uint64
+	// Bytes is the encoding of the instruction.
+	Bytes []byte
+	// Text is the instruction in GNU assembler syntax.
+	Text string
+	Flow Flow
+	// Target is the destination of a direct call, jump, or branch, or 0
+	// if the instruction has none, or its destination is in a register
+	// or memory.
+	Target uint64
+}
+
+// Disassemble decodes up to n instructions of the stopped tracee,
+// starting at addr.  The original code is decoded in place of
+// breakpoints.  Fewer than n instructions are returned if the code runs
+// into memory that cannot be read, or that does not decode; an error is
+// returned only if the first instruction cannot be read or decoded.
+// Instructions are decoded for amd64, 386, and arm64.
+func (t *Tracee) Disassemble(addr uintptr, n int) ([]Instruction, error) {
+	var insns []Instruction
+	err := t.Do(func(r Raw) error {
+		code, err := t.readCode(r, uint64(addr), n*maxInsnSize)
+		if err != nil {
+			return err
+		}
+		pc := uint64(addr)
+		for len(insns) < n && len(code) > 0 {
+			insn, err := decodeInsn(code, pc)
+			if err != nil {
+				if len(insns) == 0 {
+					return err
+				}
+				break
+			}
+			insns = append(insns, insn)
+			code = code[len(insn.Bytes):]
+			pc += uint64(len(insn.Bytes))
+		}
+		return nil
+	})
+	return insns, err
+}
+
+// Reads up to size bytes of code at addr, stopping at the first page
+// that cannot be read.  The original code is returned in place of
+// breakpoints.  Must be called on the tracer thread.
+func (t *Tracee) readCode(r Raw, addr uint64, size int) ([]byte, error) {
+	pageSize := uint64(os.Getpagesize())
+	code := make([]byte, 0, size)
+	for len(code) < size {
+		a := addr + uint64(len(code))
+		n := min(uint64(size-len(code)), pageSize-a%pageSize)
+		b := make([]byte, n)
+		if _, err := r.PeekData(uintptr(a), b); err != nil {
+			if len(code) == 0 {
+				return nil, err
+			}
+			break
+		}
+		code = append(code, b...)
+	}
+	end := addr + uint64(len(code))
+	for a, bp := range t.bps {
+		for i, b := range bp.orig {
+			if a+uint64(i) >= addr && a+uint64(i) < end {
+				code[a+uint64(i)-addr] = b
+			}
+		}
+	}
+	return code, nil
+}
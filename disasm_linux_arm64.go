@@ -0,0 +1,40 @@
+package ptrace
+
+import (
+	"golang.org/x/arch/arm64/arm64asm"
+)
+
+// Decodes the instruction at the start of code, which is at pc.
+func decodeInsn(code []byte, pc uint64) (Instruction, error) {
+	if len(code) < 4 {
+		return Instruction{}, errShortInsn
+	}
+	inst, err := arm64asm.Decode(code[:4])
+	if err != nil {
+		return Instruction{}, err
+	}
+	insn := Instruction{
+		Addr:  pc,
+		Bytes: code[:4],
+		Text:  arm64asm.GNUSyntax(inst),
+	}
+	switch inst.Op {
+	case arm64asm.BL, arm64asm.BLR:
+		insn.Flow = FlowCall
+	case arm64asm.RET:
+		insn.Flow = FlowReturn
+	case arm64asm.B, arm64asm.BR:
+		insn.Flow = FlowJump
+		if _, ok := inst.Args[0].(arm64asm.Cond); ok {
+			insn.Flow = FlowBranch
+		}
+	case arm64asm.CBZ, arm64asm.CBNZ, arm64asm.TBZ, arm64asm.TBNZ:
+		insn.Flow = FlowBranch
+	}
+	for _, a := range inst.Args {
+		if rel, ok := a.(arm64asm.PCRel); ok && insn.Flow != FlowNone {
+			insn.Target = pc + uint64(int64(rel))
+		}
+	}
+	return insn, nil
+}
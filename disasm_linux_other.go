@@ -0,0 +1,7 @@
+//go:build linux && !amd64 && !386 && !arm64
+
+package ptrace
+
+func decodeInsn(code []byte, pc uint64) (Instruction, error) {
+	return Instruction{}, errUnsupportedArch
+}
@@ -0,0 +1,40 @@
+//go:build linux && (amd64 || 386)
+
+package ptrace
+
+import (
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// Decodes the instruction at the start of code, which is at pc.
+func decodeInsn(code []byte, pc uint64) (Instruction, error) {
+	inst, err := x86asm.Decode(code, 8*int(ptrSize))
+	if err != nil {
+		return Instruction{}, err
+	}
+	insn := Instruction{
+		Addr:  pc,
+		Bytes: code[:inst.Len],
+		Text:  x86asm.GNUSyntax(inst, pc, nil),
+	}
+	switch inst.Op {
+	case x86asm.CALL, x86asm.LCALL:
+		insn.Flow = FlowCall
+	case x86asm.RET, x86asm.LRET, x86asm.IRET, x86asm.IRETD, x86asm.IRETQ:
+		insn.Flow = FlowReturn
+	case x86asm.JMP, x86asm.LJMP:
+		insn.Flow = FlowJump
+	case x86asm.JA, x86asm.JAE, x86asm.JB, x86asm.JBE, x86asm.JCXZ, x86asm.JE,
+		x86asm.JECXZ, x86asm.JG, x86asm.JGE, x86asm.JL, x86asm.JLE, x86asm.JNE,
+		x86asm.JNO, x86asm.JNP, x86asm.JNS, x86asm.JO, x86asm.JP, x86asm.JRCXZ,
+		x86asm.JS, x86asm.LOOP, x86asm.LOOPE, x86asm.LOOPNE:
+		insn.Flow = FlowBranch
+	}
+	if rel, ok := inst.Args[0].(x86asm.Rel); ok && insn.Flow != FlowNone {
+		insn.Target = pc + uint64(inst.Len) + uint64(int64(rel))
+		if ptrSize == 4 {
+			insn.Target = uint64(uint32(insn.Target))
+		}
+	}
+	return insn, nil
+}
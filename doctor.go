@@ -0,0 +1,87 @@
+package ptrace
+
+import (
+	"runtime"
+)
+
+// A Report describes which features of the package work in the current
+// environment.  It is produced by Doctor, and it can be marshaled as
+// JSON.
+type Report struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// Kernel is the kernel release, for example "6.1.0-13-amd64".
+	Kernel string `json:"kernel"`
+	// Checks are the results of the individual probes.
+	Checks []Check `json:"checks"`
+}
+
+// A Check is the result of probing the environment for a single
+// feature.
+type Check struct {
+	// Name identifies the feature, for example "yama" or "seccomp".
+	Name string `json:"name"`
+	// OK is whether the feature is expected to work.
+	OK bool `json:"ok"`
+	// Info is set for a check that is only informational, such as
+	// whether an optional privilege is held.  It does not affect the
+	// report's OK.
+	Info bool `json:"info,omitempty"`
+	// Detail explains the result.
+	Detail string `json:"detail,omitempty"`
+}
+
+// OK returns whether all checks in the report, other than informational
+// ones, passed.
+func (r *Report) OK() bool {
+	for _, c := range r.Checks {
+		if !c.OK && !c.Info {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns the named check and whether it is in the report.
+func (r *Report) Check(name string) (Check, bool) {
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Check{}, false
+}
+
+func (r *Report) add(name string, ok bool, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, OK: ok, Detail: detail})
+}
+
+// Adds an informational check.
+func (r *Report) info(name string, ok bool, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, OK: ok, Detail: detail, Info: true})
+}
+
+// Doctor probes the environment and reports which features of the
+// package will work.  Doctor may start and trace a short-lived child
+// process.
+func Doctor() *Report {
+	r := &Report{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	doctor(r)
+	return r
+}
+
+// Probes tracing a short-lived child process, if the given program
+// exists.
+func probeExec(r *Report, prog string) {
+	t, err := Exec(prog, []string{prog})
+	if err != nil {
+		r.add("exec", false, err.Error())
+		return
+	}
+	defer t.Close()
+	if _, ok := <-t.Events(); !ok {
+		r.add("exec", false, "no initial stop from "+prog)
+		return
+	}
+	r.add("exec", true, "traced "+prog)
+}
@@ -0,0 +1,33 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+func doctor(r *Report) {
+	r.Kernel, _ = syscall.Sysctl("kern.osrelease")
+	r.add("arch", true, "registers and memory require the tracee's Mach task port")
+	probeTaskPort(r, "/usr/bin/true")
+	probeExec(r, "/usr/bin/true")
+}
+
+// Probes whether the tracer can obtain a tracee's task port, which
+// memory, registers, and exceptions require, by reading the registers
+// of a traced program at its initial stop.
+func probeTaskPort(r *Report, prog string) {
+	t, err := Exec(prog, []string{prog})
+	if err != nil {
+		r.add("task_for_pid", false, err.Error())
+		return
+	}
+	defer t.Close()
+	if _, ok := <-t.Events(); !ok {
+		r.add("task_for_pid", false, "no initial stop from "+prog)
+		return
+	}
+	if _, err := t.GetRegs(); err != nil {
+		r.add("task_for_pid", false, err.Error())
+		return
+	}
+	r.add("task_for_pid", true, "read the registers of "+prog)
+}
@@ -0,0 +1,197 @@
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Capability numbers from <linux/capability.h>.
+const (
+	capSysPtrace = 19
+	capSysAdmin  = 21
+)
+
+func doctor(r *Report) {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err == nil {
+		r.Kernel = utsString(uts.Release[:])
+	}
+	switch runtime.GOARCH {
+	case "amd64", "386", "arm64":
+		r.add("arch", true, runtime.GOARCH+" is supported")
+	default:
+		r.add("arch", false, runtime.GOARCH+" has only basic support")
+	}
+	probeYama(r)
+	caps := effectiveCaps()
+	r.info("cap_sys_ptrace", caps&(1<<capSysPtrace) != 0, "needed to attach to non-child processes under yama")
+	r.info("cap_sys_admin", caps&(1<<capSysAdmin) != 0, "needed to suspend seccomp filters")
+	probeSeccomp(r)
+	probeProcessVM(r)
+	probePerf(r)
+	probeExec(r, "/bin/true")
+	probeSeize(r, "/bin/true")
+}
+
+// Returns whether the kernel release is older than Linux major.minor.
+// An unparsable release is assumed not to be older.
+func kernelBefore(release string, major, minor int) bool {
+	f := strings.SplitN(release, ".", 3)
+	if len(f) < 2 {
+		return false
+	}
+	maj, err := strconv.Atoi(f[0])
+	if err != nil {
+		return false
+	}
+	// The minor version may be followed by a suffix, as in "19-rc1".
+	end := strings.IndexFunc(f[1], func(c rune) bool { return c < '0' || c > '9' })
+	if end < 0 {
+		end = len(f[1])
+	}
+	mnr, err := strconv.Atoi(f[1][:end])
+	if err != nil {
+		return false
+	}
+	return maj < major || maj == major && mnr < minor
+}
+
+// Returns the detail of a failed check of a feature added in Linux
+// major.minor, noting if the kernel is older.
+func kernelDetail(r *Report, detail string, major, minor int) string {
+	if kernelBefore(r.Kernel, major, minor) {
+		detail += fmt.Sprintf(" (requires Linux %d.%d, have %s)", major, minor, r.Kernel)
+	}
+	return detail
+}
+
+// Probes PTRACE_SEIZE and PTRACE_PEEKSIGINFO by tracing a short-lived
+// child process, if the given program exists.
+func probeSeize(r *Report, prog string) {
+	t, err := Exec(prog, []string{prog}, WithSeize())
+	if err != nil {
+		r.add("ptrace_seize", false, kernelDetail(r, "PTRACE_SEIZE: "+err.Error(), 3, 4))
+		return
+	}
+	defer t.Close()
+	if _, ok := <-t.Events(); !ok {
+		r.add("ptrace_seize", false, "no initial stop from "+prog)
+		return
+	}
+	r.add("ptrace_seize", true, "PTRACE_SEIZE is available")
+	if _, err := t.PendingSignals(false); err != nil {
+		r.add("ptrace_peeksiginfo", false, kernelDetail(r, "PTRACE_PEEKSIGINFO: "+err.Error(), 3, 10))
+		return
+	}
+	r.add("ptrace_peeksiginfo", true, "PTRACE_PEEKSIGINFO is available")
+}
+
+func probeYama(r *Report) {
+	scope, ok := yamaScope()
+	if !ok {
+		r.add("yama", true, "yama is not enabled")
+		return
+	}
+	switch scope {
+	case 0:
+		r.add("yama", true, "ptrace_scope=0: any process with the same uid can be traced")
+	case 1:
+		r.add("yama", true, "ptrace_scope=1: only descendants can be traced without CAP_SYS_PTRACE")
+	case 2:
+		r.add("yama", false, "ptrace_scope=2: tracing requires CAP_SYS_PTRACE")
+	default:
+		r.add("yama", false, fmt.Sprintf("ptrace_scope=%d: tracing is disabled", scope))
+	}
+}
+
+// Returns the effective capability set of the current process.
+func effectiveCaps() uint64 {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v, ok := strings.CutPrefix(s.Text(), "CapEff:"); ok {
+			caps, _ := strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+			return caps
+		}
+	}
+	return 0
+}
+
+func probeSeccomp(r *Report) {
+	b, err := os.ReadFile("/proc/sys/kernel/seccomp/actions_avail")
+	if err != nil {
+		r.add("seccomp", false, "seccomp filters are not available")
+		return
+	}
+	actions := strings.Fields(string(b))
+	has := func(a string) bool {
+		for _, x := range actions {
+			if x == a {
+				return true
+			}
+		}
+		return false
+	}
+	r.add("seccomp", has("trace"), "actions: "+strings.Join(actions, " "))
+	// The notification backend continues system calls, with
+	// SECCOMP_USER_NOTIF_FLAG_CONTINUE, which was added after the
+	// notifications themselves.
+	switch {
+	case !has("user_notif"):
+		r.add("seccomp_user_notif", false, kernelDetail(r, "user_notif is not an available action", 5, 0))
+	case kernelBefore(r.Kernel, 5, 5):
+		r.add("seccomp_user_notif", false, kernelDetail(r, "SECCOMP_USER_NOTIF_FLAG_CONTINUE is not available", 5, 5))
+	default:
+		r.add("seccomp_user_notif", true, "needed for the seccomp notification backend")
+	}
+}
+
+func probeProcessVM(r *Report) {
+	src := []byte("probe")
+	dst := make([]byte, len(src))
+	local := syscall.Iovec{Base: &dst[0]}
+	local.SetLen(len(dst))
+	remote := syscall.Iovec{Base: &src[0]}
+	remote.SetLen(len(src))
+	_, _, e := syscall.Syscall6(sysProcessVMReadv, uintptr(os.Getpid()),
+		uintptr(unsafe.Pointer(&local)), 1, uintptr(unsafe.Pointer(&remote)), 1, 0)
+	runtime.KeepAlive(src)
+	runtime.KeepAlive(dst)
+	if e != 0 {
+		r.add("process_vm", false, kernelDetail(r, "process_vm_readv: "+e.Error(), 3, 2))
+		return
+	}
+	r.add("process_vm", bytes.Equal(src, dst), "process_vm_readv is available")
+}
+
+func probePerf(r *Report) {
+	b, err := os.ReadFile("/proc/sys/kernel/perf_event_paranoid")
+	if err != nil {
+		r.add("perf", false, "perf events are not available")
+		return
+	}
+	level, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	r.add("perf", level <= 2, fmt.Sprintf("perf_event_paranoid=%d", level))
+}
+
+func utsString[T int8 | uint8](b []T) string {
+	var s []byte
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		s = append(s, byte(c))
+	}
+	return string(s)
+}
@@ -0,0 +1,90 @@
+package ptrace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Dump writes n bytes of the stopped tracee's memory at addr to w in the
+// canonical format of hexdump -C: each line holds the address of its
+// first byte, 16 bytes in hexadecimal, and the bytes as ASCII, with
+// non-printable bytes shown as dots.  As with hexdump, a run of lines
+// identical to the one before it is written as a single "*", and the
+// last line holds the address after the dump.
+//
+// If the memory cannot be read in full, the bytes before the fault are
+// dumped, and the *PartialReadError is returned.
+func (t *Tracee) Dump(w io.Writer, addr uintptr, n int) error {
+	b := make([]byte, n)
+	err := t.Do(func(r Raw) error { return readMemory(r, uint64(addr), b) })
+	var perr *PartialReadError
+	switch {
+	case errors.As(err, &perr):
+		b = b[:perr.N]
+	case err != nil:
+		return err
+	}
+	if e := dumpHex(w, uint64(addr), b); e != nil {
+		return e
+	}
+	return err
+}
+
+// Writes b, which was read from addr, in the format of hexdump -C.
+func dumpHex(w io.Writer, addr uint64, b []byte) error {
+	width := 2 * int(ptrSize)
+	var line, prev []byte
+	squeezed := false
+	for off := 0; off < len(b); off += 16 {
+		row := b[off:min(off+16, len(b))]
+		if len(row) == 16 && bytes.Equal(row, prev) {
+			if !squeezed {
+				if _, err := io.WriteString(w, "*\n"); err != nil {
+					return err
+				}
+				squeezed = true
+			}
+			continue
+		}
+		prev, squeezed = row, false
+		line = appendAddr(line[:0], addr+uint64(off), width)
+		line = append(line, ' ', ' ')
+		for i := 0; i < 16; i++ {
+			if i < len(row) {
+				line = append(line, hexDigits[row[i]>>4], hexDigits[row[i]&0xf], ' ')
+			} else {
+				line = append(line, ' ', ' ', ' ')
+			}
+			if i == 7 {
+				line = append(line, ' ')
+			}
+		}
+		line = append(line, ' ', '|')
+		for _, c := range row {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			line = append(line, c)
+		}
+		line = append(line, '|', '\n')
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	line = appendAddr(line[:0], addr+uint64(len(b)), width)
+	_, err := w.Write(append(line, '\n'))
+	return err
+}
+
+const hexDigits = "0123456789abcdef"
+
+// Appends the address in hexadecimal, zero-padded to width digits.
+func appendAddr(b []byte, addr uint64, width int) []byte {
+	s := strconv.FormatUint(addr, 16)
+	for i := len(s); i < width; i++ {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
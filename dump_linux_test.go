@@ -0,0 +1,92 @@
+package ptrace
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDumpHex(t *testing.T) {
+	// A returns the address as it is written in the dump.
+	a := func(addr uint64) string { return fmt.Sprintf("%0*x", 2*ptrSize, addr) }
+	tests := []struct {
+		name string
+		addr uint64
+		b    []byte
+		want []string
+	}{
+		{
+			name: "empty",
+			addr: 0x1000,
+			want: []string{a(0x1000)},
+		},
+		{
+			name: "partial line",
+			addr: 0x1000,
+			b:    []byte("hello, world\n"),
+			want: []string{
+				a(0x1000) + "  68 65 6c 6c 6f 2c 20 77  6f 72 6c 64 0a           |hello, world.|",
+				a(0x100d),
+			},
+		},
+		{
+			name: "full lines",
+			addr: 0x20,
+			b:    []byte("0123456789abcdefABCDEFGHIJKLMNOP"),
+			want: []string{
+				a(0x20) + "  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|",
+				a(0x30) + "  41 42 43 44 45 46 47 48  49 4a 4b 4c 4d 4e 4f 50  |ABCDEFGHIJKLMNOP|",
+				a(0x40),
+			},
+		},
+		{
+			name: "non-printable",
+			b:    []byte{0x00, 0x1f, 0x20, 0x7e, 0x7f, 0xff},
+			want: []string{
+				a(0) + "  00 1f 20 7e 7f ff                                 |.. ~..|",
+				a(6),
+			},
+		},
+		{
+			name: "squeezed",
+			b:    append(make([]byte, 64), 'x'),
+			want: []string{
+				a(0) + "  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+				"*",
+				a(0x40) + "  78                                                |x|",
+				a(0x41),
+			},
+		},
+		{
+			name: "squeezed to the end",
+			b:    make([]byte, 48),
+			want: []string{
+				a(0) + "  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+				"*",
+				a(0x30),
+			},
+		},
+		{
+			name: "short line matching the one before",
+			b:    []byte("aaaaaaaaaaaaaaaaaaaa"),
+			want: []string{
+				a(0) + "  61 61 61 61 61 61 61 61  61 61 61 61 61 61 61 61  |aaaaaaaaaaaaaaaa|",
+				a(0x10) + "  61 61 61 61                                       |aaaa|",
+				a(0x14),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := dumpHex(&buf, test.addr, test.b); err != nil {
+				t.Fatalf("dumpHex: %v", err)
+			}
+			want := strings.Join(test.want, "\n") + "\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
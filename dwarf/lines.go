@@ -0,0 +1,153 @@
+// Package dwarf adds source-level stepping and breakpoints to a
+// ptrace.Tracee, using the DWARF line tables of its executable.
+package dwarf
+
+import (
+	"debug/dwarf"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eaburns/ptrace"
+)
+
+var (
+	errNoLine     = errors.New("dwarf: no line information for pc")
+	errNoFileLine = errors.New("dwarf: no code for file and line")
+)
+
+// Lines is the line table of a tracee's executable, relocated to its
+// run-time addresses.
+type Lines struct {
+	t *ptrace.Tracee
+	// Rows are sorted by address and do not overlap.
+	rows []row
+}
+
+// A row of the line table: the instructions in [lo, hi) are of the
+// line.
+type row struct {
+	lo, hi uint64
+	file   string
+	line   int
+	// Stmt is whether lo is the start of a statement.
+	stmt bool
+}
+
+// Reads the line tables of every compilation unit, adding bias to their
+// addresses.
+func readLines(d *dwarf.Data, bias uint64) (*Lines, error) {
+	var l Lines
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := d.LineReader(e)
+		if err != nil {
+			return nil, err
+		}
+		r.SkipChildren()
+		if lr == nil {
+			continue
+		}
+		var prev *dwarf.LineEntry
+		for {
+			var le dwarf.LineEntry
+			if err := lr.Next(&le); err != nil {
+				break
+			}
+			if prev != nil && le.Address > prev.Address {
+				l.rows = append(l.rows, row{
+					lo:   prev.Address + bias,
+					hi:   le.Address + bias,
+					file: prev.File.Name,
+					line: prev.Line,
+					stmt: prev.IsStmt,
+				})
+			}
+			if le.EndSequence {
+				prev = nil
+			} else {
+				prev = &le
+			}
+		}
+	}
+	sort.Slice(l.rows, func(i, j int) bool { return l.rows[i].lo < l.rows[j].lo })
+	return &l, nil
+}
+
+// Returns the index of the row containing pc, or -1.
+func (l *Lines) find(pc uint64) int {
+	i := sort.Search(len(l.rows), func(i int) bool { return l.rows[i].hi > pc })
+	if i == len(l.rows) || l.rows[i].lo > pc {
+		return -1
+	}
+	return i
+}
+
+// Line returns the source file and line of the instruction at the
+// run-time address pc.
+func (l *Lines) Line(pc uint64) (file string, line int, ok bool) {
+	i := l.find(pc)
+	if i < 0 {
+		return "", 0, false
+	}
+	return l.rows[i].file, l.rows[i].line, true
+}
+
+// Returns the range of the consecutive rows of the line of the row
+// containing pc.
+func (l *Lines) lineRange(pc uint64) (lo, hi uint64, ok bool) {
+	i := l.find(pc)
+	if i < 0 {
+		return 0, 0, false
+	}
+	same := func(j int) bool {
+		return l.rows[j].file == l.rows[i].file && l.rows[j].line == l.rows[i].line
+	}
+	j, k := i, i
+	for j > 0 && l.rows[j-1].hi == l.rows[j].lo && same(j-1) {
+		j--
+	}
+	for k < len(l.rows)-1 && l.rows[k].hi == l.rows[k+1].lo && same(k+1) {
+		k++
+	}
+	return l.rows[j].lo, l.rows[k].hi, true
+}
+
+// PCs returns the run-time addresses of the starts of the statements of
+// a source line, in increasing order.  The file is matched against the
+// paths of the line table as a path suffix, so it can be a base name.
+// If the line has no code, the next line of the file with code is used.
+func (l *Lines) PCs(file string, line int) []uint64 {
+	best := 0
+	var pcs []uint64
+	for _, r := range l.rows {
+		if !r.stmt || r.line < line || !matchFile(r.file, file) {
+			continue
+		}
+		switch {
+		case best == 0 || r.line < best:
+			best, pcs = r.line, []uint64{r.lo}
+		case r.line == best:
+			pcs = append(pcs, r.lo)
+		}
+	}
+	return pcs
+}
+
+// Returns whether path is name, or ends with it as its last elements.
+func matchFile(path, name string) bool {
+	path, name = filepath.Clean(path), filepath.Clean(name)
+	return path == name || strings.HasSuffix(path, string(filepath.Separator)+name)
+}
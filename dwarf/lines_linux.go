@@ -0,0 +1,97 @@
+package dwarf
+
+import (
+	"debug/elf"
+	"errors"
+	"strconv"
+
+	"github.com/eaburns/ptrace"
+)
+
+// The maximum number of single steps of StepSourceLine after leaving
+// the current line.
+const maxLineSteps = 1 << 24
+
+var errStepLimit = errors.New("dwarf: no source line reached")
+
+// Load reads the line tables of the stopped tracee's executable.  The
+// tables are not updated if the tracee calls execve.
+func Load(t *ptrace.Tracee) (*Lines, error) {
+	f, err := elf.Open("/proc/" + strconv.Itoa(t.Pid()) + "/exe")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	bias, err := t.LoadBias(f)
+	if err != nil {
+		return nil, err
+	}
+	l, err := readLines(d, bias)
+	if err != nil {
+		return nil, err
+	}
+	l.t = t
+	return l, nil
+}
+
+// StepSourceLine single-steps the stopped tracee until it reaches the
+// start of a statement of another source line, stepping into called
+// functions that have line information.  The instructions of the
+// current line are stepped with StepRange; code without line
+// information, like the PLT and shared libraries, is stepped through.
+// Stepping ends early, as with StepN, if the tracee stops for another
+// reason.
+func (l *Lines) StepSourceLine() error {
+	regs, err := l.t.GetRegs()
+	if err != nil {
+		return err
+	}
+	pc := regs.PC()
+	file, line, ok := l.Line(pc)
+	if !ok {
+		return errNoLine
+	}
+	lo, hi, _ := l.lineRange(pc)
+	if _, err := l.t.StepRange(uintptr(lo), uintptr(hi)); err != nil {
+		return err
+	}
+	if regs, err = l.t.GetRegs(); err != nil {
+		return err
+	}
+	if pc = regs.PC(); lo <= pc && pc < hi {
+		// The tracee stopped for another reason.
+		return nil
+	}
+	newLine := func(pc uint64) bool {
+		i := l.find(pc)
+		if i < 0 {
+			return false
+		}
+		r := l.rows[i]
+		return r.lo == pc && r.stmt && (r.file != file || r.line != line)
+	}
+	if newLine(pc) {
+		return nil
+	}
+	n, err := l.t.StepUntil(maxLineSteps, newLine)
+	if err == nil && n == maxLineSteps {
+		err = errStepLimit
+	}
+	return err
+}
+
+// BreakAtFileLine sets a breakpoint, as with Tracee.SetBreakpoint, at
+// the start of the first statement of a source line, and returns its
+// address.  The file and line are matched as with PCs.
+func (l *Lines) BreakAtFileLine(file string, line int) (uintptr, error) {
+	pcs := l.PCs(file, line)
+	if len(pcs) == 0 {
+		return 0, errNoFileLine
+	}
+	addr := uintptr(pcs[0])
+	return addr, l.t.SetBreakpoint(addr, nil)
+}
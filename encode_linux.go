@@ -0,0 +1,208 @@
+package ptrace
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// An EventEncoder writes events to an io.Writer as newline-delimited
+// JSON, one object per event, for tools such as jq.  Each object has the
+// fields:
+//
+//	time   the time the event was observed, in RFC 3339 format
+//	pid    the process ID of the tracee
+//	tid    the thread ID of the thread that the event is for
+//	kind   the kind of the event, such as "syscall_enter"
+//	name   the name of the system call, for system call events
+//	event  the event, with the fields of its type
+//
+// The kinds of a syscall.WaitStatus are "exited", "signaled", "stopped",
+// and "continued", and its event object holds the raw status and the
+// exit status or signal.  The encodings of the kinds and event fields
+// are stable.
+type EventEncoder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// An encoded event.
+type eventLine struct {
+	Time  time.Time `json:"time"`
+	Pid   int       `json:"pid"`
+	Tid   int       `json:"tid"`
+	Kind  string    `json:"kind"`
+	Name  string    `json:"name,omitempty"`
+	Event Event     `json:"event"`
+}
+
+// An encoded syscall.WaitStatus.
+type waitStatusLine struct {
+	Status     uint32         `json:"status"`
+	ExitStatus *int           `json:"exit_status,omitempty"`
+	Signal     syscall.Signal `json:"signal,omitempty"`
+	TrapCause  int            `json:"trap_cause,omitempty"`
+	CoreDump   bool           `json:"core_dump,omitempty"`
+}
+
+// NewEventEncoder returns an EventEncoder that writes to w.
+func NewEventEncoder(w io.Writer) *EventEncoder {
+	return &EventEncoder{enc: json.NewEncoder(w)}
+}
+
+// WithEventEncoder encodes the tracee's events with the EventEncoder.  As
+// with a Recorder, the events encoded are those observed by the wait go
+// routine.
+func WithEventEncoder(e *EventEncoder) Option {
+	return func(t *Tracee) {
+		t.observers = append(t.observers, func(ev Event) {
+			e.Encode(t.proc.Pid, ev)
+		})
+	}
+}
+
+// Encode writes the event of the tracee with process ID pid.  The event
+// is stamped with its own time, if it has one, or else the current
+// time.  A ThreadEvent, SessionEvent, SupervisorEvent, or Record is
+// encoded as the event that it holds, with its thread ID, process ID,
+// or time.  Encode returns the first error writing an event, after which
+// no more events are written.
+func (e *EventEncoder) Encode(pid int, ev Event) error {
+	l := eventLine{Pid: pid}
+	for {
+		switch w := ev.(type) {
+		case ThreadEvent:
+			l.Tid, ev = w.TID, w.Event
+			continue
+		case SessionEvent:
+			l.Time, l.Pid, ev = w.Time, w.Pid, w.Event
+			continue
+		case SupervisorEvent:
+			l.Pid, ev = w.Pid, w.Event
+			continue
+		case Record:
+			l.Time, l.Pid, ev = w.Time, w.Pid, w.Event
+			continue
+		}
+		break
+	}
+	if l.Tid == 0 {
+		l.Tid = l.Pid
+	}
+	if l.Time.IsZero() {
+		l.Time = eventTime(ev)
+	}
+	l.Kind, l.Event = eventKind(ev), ev
+	switch ev := ev.(type) {
+	case SyscallEnterEvent:
+		l.Name = ev.Name()
+	case SyscallExitEvent:
+		l.Name = ev.Name()
+	case SeccompEvent:
+		l.Name = ev.Name()
+	case syscall.WaitStatus:
+		ws := waitStatusLine{Status: uint32(ev)}
+		switch {
+		case ev.Exited():
+			code := ev.ExitStatus()
+			ws.ExitStatus = &code
+		case ev.Signaled():
+			ws.Signal, ws.CoreDump = ev.Signal(), ev.CoreDump()
+		case ev.Stopped():
+			ws.Signal = ev.StopSignal()
+			if ws.Signal == syscall.SIGTRAP {
+				ws.TrapCause = ev.TrapCause()
+			}
+		}
+		l.Event = ws
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = e.enc.Encode(&l)
+	}
+	return e.err
+}
+
+// Err returns the first error writing an event.
+func (e *EventEncoder) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Returns the time of the event, if it has one, or else the current
+// time.
+func eventTime(ev Event) time.Time {
+	switch ev := ev.(type) {
+	case SyscallEnterEvent:
+		return ev.Time
+	case SyscallExitEvent:
+		return ev.Time
+	case SeccompEvent:
+		return ev.Time
+	case LibraryCallEvent:
+		return ev.Time
+	case UsageEvent:
+		return ev.Time
+	case NetworkEvent:
+		return ev.Time
+	}
+	return time.Now()
+}
+
+// Returns the kind of the event, for an EventEncoder.
+func eventKind(ev Event) string {
+	switch ev := ev.(type) {
+	case syscall.WaitStatus:
+		switch {
+		case ev.Exited():
+			return "exited"
+		case ev.Signaled():
+			return "signaled"
+		case ev.Continued():
+			return "continued"
+		}
+		return "stopped"
+	case ExecEvent:
+		return "exec"
+	case PreExitEvent:
+		return "pre_exit"
+	case ForkEvent:
+		return "fork"
+	case CloneEvent:
+		return "clone"
+	case GroupStopEvent:
+		return "group_stop"
+	case SyscallEnterEvent:
+		return "syscall_enter"
+	case SyscallExitEvent:
+		return "syscall_exit"
+	case SeccompEvent:
+		return "seccomp"
+	case BreakpointEvent:
+		return "breakpoint"
+	case HWBreakpointEvent:
+		return "hw_breakpoint"
+	case LibraryLoadEvent:
+		return "library_load"
+	case LibraryUnloadEvent:
+		return "library_unload"
+	case LibraryCallEvent:
+		return "library_call"
+	case NamespaceChangeEvent:
+		return "namespace_change"
+	case RegionChangeEvent:
+		return "region_change"
+	case MemoryPressureEvent:
+		return "memory_pressure"
+	case UsageEvent:
+		return "usage"
+	case NetworkEvent:
+		return "network"
+	}
+	return "unknown"
+}
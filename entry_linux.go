@@ -0,0 +1,201 @@
+package ptrace
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// The auxiliary vector entry with the program's entry point.
+const atEntry = 9
+
+// WithStopAtEntry makes Exec return only once the tracee is stopped at
+// the entry point of its program, with its options applied.  The initial
+// stop, which follows the tracee's execve, is consumed, rather than sent
+// as the first event.  A dynamically linked program starts in its
+// dynamic loader, so the tracee is first run to the program's entry
+// point with a temporary breakpoint; the loader has then loaded the
+// program's libraries, but no code of the program itself has run.  The
+// first event is that of the stop after the tracee is next resumed,
+// except that, WithLibraryEvents, the libraries loaded at startup are
+// sent before Exec returns, and the events of ptrace event stops on the
+// way, such as the ForkEvents of children created by library
+// constructors, from which the tracee is continued, are sent first once
+// Exec returns.  If the tracee exits before it reaches its entry point,
+// Exec returns an *EntryExitError.
+func WithStopAtEntry() Option {
+	return func(t *Tracee) { t.entry = make(chan error, 1) }
+}
+
+// An EntryExitError is returned by Exec, WithStopAtEntry, if the tracee
+// exits before it reaches the entry point of its program, for example
+// because a library that it needs is missing.  It wraps ErrTraceeExited.
+type EntryExitError struct {
+	// Status is the tracee's exit status.
+	Status syscall.WaitStatus
+}
+
+func (e *EntryExitError) Error() string {
+	if e.Status.Signaled() {
+		return "tracee killed by " + e.Status.Signal().String() + " before its entry point"
+	}
+	return "tracee exited with status " + strconv.Itoa(e.Status.ExitStatus()) + " before its entry point"
+}
+
+func (e *EntryExitError) Unwrap() error { return ErrTraceeExited }
+
+// An entryBreakpoint is the temporary breakpoint at the entry point of
+// the tracee's program, and the instruction that it replaces.
+type entryBreakpoint struct {
+	addr uint64
+	orig []byte
+	// Events are the events of the stops on the way to the entry
+	// point, which are sent once Exec returns, since they may not fit
+	// in the events channel before then.
+	events []Event
+}
+
+// Inserts a breakpoint at the entry point of the tracee's program, and
+// continues the tracee to it, if it is not already there.  Must be
+// called on the tracer thread at the initial stop, while the wait go
+// routine is blocked handling it; the wait go routine handles the
+// tracee's stops until it reaches the breakpoint.
+func (t *Tracee) runToEntry() error {
+	pid := t.proc.Pid
+	entry, err := auxv("/proc/"+strconv.Itoa(pid)+"/auxv", atEntry)
+	if err != nil {
+		return err
+	}
+	r := Raw{t}
+	var regs syscall.PtraceRegs
+	if err := r.GetRegs(&regs); err != nil {
+		return err
+	}
+	if entry == 0 || regs.PC() == entry {
+		return nil
+	}
+	if breakpointInsn == nil {
+		return errUnsupportedArch
+	}
+	orig := make([]byte, len(breakpointInsn))
+	if _, err := r.PeekData(uintptr(entry), orig); err != nil {
+		return err
+	}
+	if _, err := r.PokeData(uintptr(entry), breakpointInsn); err != nil {
+		return err
+	}
+	if err := t.resume(Running, func() error { return ptraceCont(pid, 0) }); err != nil {
+		r.PokeData(uintptr(entry), orig)
+		return err
+	}
+	t.toEntry = &entryBreakpoint{addr: entry, orig: orig}
+	return nil
+}
+
+// Handles a stop of the tracee on its way to its entry point, and
+// returns nil.  Signals are passed on, the events of ptrace event stops
+// are kept, and the tracee is continued, until it stops at the entry
+// point's breakpoint, where its program counter is rewound and it
+// remains stopped, or at its exit, which ends the run with an
+// *EntryExitError.  Called on the wait go routine.
+func (t *Tracee) decodeToEntry(ws syscall.WaitStatus) Event {
+	sig := 0
+	switch {
+	case ws.TrapCause() == syscall.PTRACE_EVENT_EXIT:
+		var msg uint
+		t.runInternal("geteventmsg", func() (err error) {
+			msg, err = syscall.PtraceGetEventMsg(t.proc.Pid)
+			return err
+		})
+		// The tracee is continued to its exit, which is reaped, as
+		// usual, by the wait go routine.
+		t.atEntry(&EntryExitError{Status: syscall.WaitStatus(msg)})
+	case int(ws)>>16 != 0:
+		// A ptrace event stop, which has no signal to pass on.  A
+		// nil event means that the tracee has been resumed.
+		ev := t.decodeStop(ws)
+		if ev == nil {
+			return nil
+		}
+		t.toEntry.events = append(t.toEntry.events, ev)
+	case ws.StopSignal() != syscall.SIGTRAP:
+		sig = int(ws.StopSignal())
+	default:
+		var at bool
+		err := t.runInternal("stopatentry", func() error {
+			var err error
+			at, err = t.stopAtEntry()
+			return err
+		})
+		if err != nil || at {
+			t.atEntry(err)
+			return nil
+		}
+		sig = int(syscall.SIGTRAP)
+	}
+	err := t.runInternal("cont", func() error {
+		return t.resume(Running, func() error { return ptraceCont(t.proc.Pid, sig) })
+	})
+	if err != nil {
+		t.atEntry(err)
+	}
+	return nil
+}
+
+// Returns whether the tracee is stopped at the entry point's breakpoint,
+// in which case the breakpoint is removed and the program counter
+// rewound to the entry point.  Called on the tracer thread.
+func (t *Tracee) stopAtEntry() (bool, error) {
+	r := Raw{t}
+	var regs syscall.PtraceRegs
+	if err := r.GetRegs(&regs); err != nil {
+		return false, err
+	}
+	bp := t.toEntry
+	if breakpointAddr(regs.PC()) != bp.addr {
+		return false, nil
+	}
+	if _, err := r.PokeData(uintptr(bp.addr), bp.orig); err != nil {
+		return true, err
+	}
+	if regs.PC() != bp.addr {
+		regs.SetPC(bp.addr)
+		return true, r.SetRegs(&regs)
+	}
+	return true, nil
+}
+
+// Finishes running the tracee to its entry point, where it remains
+// stopped, with the result err, on which Exec returns.  Called on the
+// wait go routine.
+func (t *Tracee) atEntry(err error) {
+	bp := t.toEntry
+	t.toEntry = nil
+	if t.libs != nil {
+		t.setLoaderHook()
+		// The libraries loaded at startup are loaded by the time
+		// the tracee reaches its entry point.
+		if err == nil {
+			t.emitLibraries()
+		}
+	}
+	t.entry <- err
+	if bp != nil {
+		for _, ev := range bp.events {
+			t.emit(ev)
+		}
+	}
+}
+
+// Sends the library events for the libraries loaded by the time the
+// tracee reaches its entry point, which the loader hook, set after it
+// is reached, misses.  Called on the wait go routine.
+func (t *Tracee) emitLibraries() {
+	var evs []Event
+	t.runInternal("libraries", func() error {
+		evs = t.libraryEvents(Raw{t})
+		return nil
+	})
+	for _, ev := range evs {
+		t.emit(ev)
+	}
+}
@@ -0,0 +1,174 @@
+package ptrace
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// SyscallReturn splits the raw return value of a system call, as in a
+// SyscallExitEvent or returned by InjectSyscall, into its value and its
+// error.  A system call fails if its raw return value is in the range
+// -4095 to -1, in which case the value is -1 and the error is the
+// negated return value; otherwise the value is the raw return value and
+// the error is 0.
+func SyscallReturn(ret int64) (int64, syscall.Errno) {
+	if ret < 0 && ret >= -4095 {
+		return -1, syscall.Errno(-ret)
+	}
+	return ret, 0
+}
+
+// ErrnoName returns the symbolic name of the error number, such as
+// "ENOENT", or "errno_N" if it is unknown.  Error numbers with more than
+// one name, such as EAGAIN and EWOULDBLOCK, are given their first name
+// in errno.h.
+func ErrnoName(e syscall.Errno) string {
+	if name, ok := errnoNames[e]; ok {
+		return name
+	}
+	return "errno_" + strconv.Itoa(int(e))
+}
+
+// Returns the error of a raw system call return value, or nil if it
+// succeeded.
+func syscallErrno(ret uint64) error {
+	if _, errno := SyscallReturn(int64(ret)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// The names of the error numbers.  They are keyed by the constants of
+// package syscall, whose values differ between architectures.
+var errnoNames = map[syscall.Errno]string{
+	syscall.E2BIG:           "E2BIG",
+	syscall.EACCES:          "EACCES",
+	syscall.EADDRINUSE:      "EADDRINUSE",
+	syscall.EADDRNOTAVAIL:   "EADDRNOTAVAIL",
+	syscall.EADV:            "EADV",
+	syscall.EAFNOSUPPORT:    "EAFNOSUPPORT",
+	syscall.EAGAIN:          "EAGAIN",
+	syscall.EALREADY:        "EALREADY",
+	syscall.EBADE:           "EBADE",
+	syscall.EBADF:           "EBADF",
+	syscall.EBADFD:          "EBADFD",
+	syscall.EBADMSG:         "EBADMSG",
+	syscall.EBADR:           "EBADR",
+	syscall.EBADRQC:         "EBADRQC",
+	syscall.EBADSLT:         "EBADSLT",
+	syscall.EBFONT:          "EBFONT",
+	syscall.EBUSY:           "EBUSY",
+	syscall.ECANCELED:       "ECANCELED",
+	syscall.ECHILD:          "ECHILD",
+	syscall.ECHRNG:          "ECHRNG",
+	syscall.ECOMM:           "ECOMM",
+	syscall.ECONNABORTED:    "ECONNABORTED",
+	syscall.ECONNREFUSED:    "ECONNREFUSED",
+	syscall.ECONNRESET:      "ECONNRESET",
+	syscall.EDEADLK:         "EDEADLK",
+	syscall.EDESTADDRREQ:    "EDESTADDRREQ",
+	syscall.EDOM:            "EDOM",
+	syscall.EDOTDOT:         "EDOTDOT",
+	syscall.EDQUOT:          "EDQUOT",
+	syscall.EEXIST:          "EEXIST",
+	syscall.EFAULT:          "EFAULT",
+	syscall.EFBIG:           "EFBIG",
+	syscall.EHOSTDOWN:       "EHOSTDOWN",
+	syscall.EHOSTUNREACH:    "EHOSTUNREACH",
+	syscall.EIDRM:           "EIDRM",
+	syscall.EILSEQ:          "EILSEQ",
+	syscall.EINPROGRESS:     "EINPROGRESS",
+	syscall.EINTR:           "EINTR",
+	syscall.EINVAL:          "EINVAL",
+	syscall.EIO:             "EIO",
+	syscall.EISCONN:         "EISCONN",
+	syscall.EISDIR:          "EISDIR",
+	syscall.EISNAM:          "EISNAM",
+	syscall.EKEYEXPIRED:     "EKEYEXPIRED",
+	syscall.EKEYREJECTED:    "EKEYREJECTED",
+	syscall.EKEYREVOKED:     "EKEYREVOKED",
+	syscall.EL2HLT:          "EL2HLT",
+	syscall.EL2NSYNC:        "EL2NSYNC",
+	syscall.EL3HLT:          "EL3HLT",
+	syscall.EL3RST:          "EL3RST",
+	syscall.ELIBACC:         "ELIBACC",
+	syscall.ELIBBAD:         "ELIBBAD",
+	syscall.ELIBEXEC:        "ELIBEXEC",
+	syscall.ELIBMAX:         "ELIBMAX",
+	syscall.ELIBSCN:         "ELIBSCN",
+	syscall.ELNRNG:          "ELNRNG",
+	syscall.ELOOP:           "ELOOP",
+	syscall.EMEDIUMTYPE:     "EMEDIUMTYPE",
+	syscall.EMFILE:          "EMFILE",
+	syscall.EMLINK:          "EMLINK",
+	syscall.EMSGSIZE:        "EMSGSIZE",
+	syscall.EMULTIHOP:       "EMULTIHOP",
+	syscall.ENAMETOOLONG:    "ENAMETOOLONG",
+	syscall.ENAVAIL:         "ENAVAIL",
+	syscall.ENETDOWN:        "ENETDOWN",
+	syscall.ENETRESET:       "ENETRESET",
+	syscall.ENETUNREACH:     "ENETUNREACH",
+	syscall.ENFILE:          "ENFILE",
+	syscall.ENOANO:          "ENOANO",
+	syscall.ENOBUFS:         "ENOBUFS",
+	syscall.ENOCSI:          "ENOCSI",
+	syscall.ENODATA:         "ENODATA",
+	syscall.ENODEV:          "ENODEV",
+	syscall.ENOENT:          "ENOENT",
+	syscall.ENOEXEC:         "ENOEXEC",
+	syscall.ENOKEY:          "ENOKEY",
+	syscall.ENOLCK:          "ENOLCK",
+	syscall.ENOLINK:         "ENOLINK",
+	syscall.ENOMEDIUM:       "ENOMEDIUM",
+	syscall.ENOMEM:          "ENOMEM",
+	syscall.ENOMSG:          "ENOMSG",
+	syscall.ENONET:          "ENONET",
+	syscall.ENOPKG:          "ENOPKG",
+	syscall.ENOPROTOOPT:     "ENOPROTOOPT",
+	syscall.ENOSPC:          "ENOSPC",
+	syscall.ENOSR:           "ENOSR",
+	syscall.ENOSTR:          "ENOSTR",
+	syscall.ENOSYS:          "ENOSYS",
+	syscall.ENOTBLK:         "ENOTBLK",
+	syscall.ENOTCONN:        "ENOTCONN",
+	syscall.ENOTDIR:         "ENOTDIR",
+	syscall.ENOTEMPTY:       "ENOTEMPTY",
+	syscall.ENOTNAM:         "ENOTNAM",
+	syscall.ENOTRECOVERABLE: "ENOTRECOVERABLE",
+	syscall.ENOTSOCK:        "ENOTSOCK",
+	syscall.ENOTTY:          "ENOTTY",
+	syscall.ENOTUNIQ:        "ENOTUNIQ",
+	syscall.ENXIO:           "ENXIO",
+	syscall.EOPNOTSUPP:      "EOPNOTSUPP",
+	syscall.EOVERFLOW:       "EOVERFLOW",
+	syscall.EOWNERDEAD:      "EOWNERDEAD",
+	syscall.EPERM:           "EPERM",
+	syscall.EPFNOSUPPORT:    "EPFNOSUPPORT",
+	syscall.EPIPE:           "EPIPE",
+	syscall.EPROTO:          "EPROTO",
+	syscall.EPROTONOSUPPORT: "EPROTONOSUPPORT",
+	syscall.EPROTOTYPE:      "EPROTOTYPE",
+	syscall.ERANGE:          "ERANGE",
+	syscall.EREMCHG:         "EREMCHG",
+	syscall.EREMOTE:         "EREMOTE",
+	syscall.EREMOTEIO:       "EREMOTEIO",
+	syscall.ERESTART:        "ERESTART",
+	syscall.ERFKILL:         "ERFKILL",
+	syscall.EROFS:           "EROFS",
+	syscall.ESHUTDOWN:       "ESHUTDOWN",
+	syscall.ESOCKTNOSUPPORT: "ESOCKTNOSUPPORT",
+	syscall.ESPIPE:          "ESPIPE",
+	syscall.ESRCH:           "ESRCH",
+	syscall.ESRMNT:          "ESRMNT",
+	syscall.ESTALE:          "ESTALE",
+	syscall.ESTRPIPE:        "ESTRPIPE",
+	syscall.ETIME:           "ETIME",
+	syscall.ETIMEDOUT:       "ETIMEDOUT",
+	syscall.ETOOMANYREFS:    "ETOOMANYREFS",
+	syscall.ETXTBSY:         "ETXTBSY",
+	syscall.EUCLEAN:         "EUCLEAN",
+	syscall.EUNATCH:         "EUNATCH",
+	syscall.EUSERS:          "EUSERS",
+	syscall.EXDEV:           "EXDEV",
+	syscall.EXFULL:          "EXFULL",
+}
@@ -0,0 +1,56 @@
+package ptrace
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestSyscallReturn(t *testing.T) {
+	tests := []struct {
+		ret   int64
+		val   int64
+		errno syscall.Errno
+	}{
+		{0, 0, 0},
+		{42, 42, 0},
+		{-1, -1, syscall.EPERM},
+		{-int64(syscall.ENOENT), -1, syscall.ENOENT},
+		{-4095, -1, syscall.Errno(4095)},
+		// Below the error range, such as addresses returned by
+		// mmap in the upper half of the address space.
+		{-4096, -4096, 0},
+		{-1 << 63, -1 << 63, 0},
+	}
+	for _, test := range tests {
+		val, errno := SyscallReturn(test.ret)
+		if val != test.val || errno != test.errno {
+			t.Errorf("SyscallReturn(%d)=%d, %v, want %d, %v", test.ret, val, errno, test.val, test.errno)
+		}
+	}
+}
+
+func TestErrnoName(t *testing.T) {
+	tests := []struct {
+		errno syscall.Errno
+		want  string
+	}{
+		{syscall.ENOENT, "ENOENT"},
+		{syscall.EPERM, "EPERM"},
+		{syscall.EAGAIN, "EAGAIN"},
+		{syscall.Errno(4095), "errno_4095"},
+	}
+	for _, test := range tests {
+		if got := ErrnoName(test.errno); got != test.want {
+			t.Errorf("ErrnoName(%d)=%q, want %q", int(test.errno), got, test.want)
+		}
+	}
+}
+
+func TestSyscallExitErr(t *testing.T) {
+	if err := (SyscallExitEvent{Ret: 3}).Err(); err != nil {
+		t.Errorf("Err()=%v, want nil", err)
+	}
+	if err := (SyscallExitEvent{Ret: -2, Errno: syscall.ENOENT}).Err(); err != syscall.ENOENT {
+		t.Errorf("Err()=%v, want %v", err, syscall.ENOENT)
+	}
+}
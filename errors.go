@@ -0,0 +1,129 @@
+package ptrace
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+var (
+	// ErrTraceeExited is returned when a command is executed on a
+	// tracee that has already exited.  Once the exit has been
+	// observed, which happens before the exit event is sent, or once
+	// the Tracee is closed, every command returns ErrTraceeExited.
+	ErrTraceeExited = errors.New("tracee exited")
+
+	// ErrNotStopped is returned when a command that requires a
+	// stopped tracee is executed on a running tracee.
+	ErrNotStopped = errors.New("tracee not stopped")
+
+	// ErrNotAttached is returned when a command is executed on a
+	// tracee that has been detached.
+	ErrNotAttached = errors.New("tracee not attached")
+
+	// ErrPermission is returned when the tracer does not have
+	// permission to trace the tracee.
+	ErrPermission = errors.New("permission denied")
+
+	// ErrBroken is returned by every command once a command has
+	// panicked on the tracer thread, since the tracer's bookkeeping
+	// may be inconsistent, or once the tracer has failed to undo its
+	// own change to the tracee.  The tracee can still be closed.
+	ErrBroken = errors.New("tracer broken")
+
+	// ErrExited is the old name of ErrTraceeExited.
+	//
+	// Deprecated: Use ErrTraceeExited.
+	ErrExited = ErrTraceeExited
+)
+
+var (
+	errUnsupportedArch = errors.New("ptrace: not supported on " + runtime.GOARCH)
+	errBadSyscallArg   = errors.New("ptrace: system call argument index out of range")
+	errShortTransfer   = errors.New("ptrace: short tracee memory transfer")
+	errBadPolicy       = errors.New("ptrace: unknown close policy")
+)
+
+// A PartialReadError is returned by a read of tracee memory that reached
+// an address that cannot be read, such as an unmapped or guard page.
+// The bytes before the address were read, so that, for example, a memory
+// dumper can keep them and resume reading past the fault.  It is usually
+// wrapped in an *Error; use errors.As to retrieve it.
+type PartialReadError struct {
+	// Addr is the first address that was not read.
+	Addr uint64
+	// N is the number of bytes that were read, which may be zero.
+	N int
+	// Err is the underlying error, usually syscall.EFAULT or
+	// syscall.EIO.
+	Err error
+}
+
+func (e *PartialReadError) Error() string {
+	return "read fault at 0x" + strconv.FormatUint(e.Addr, 16) + " after " + strconv.Itoa(e.N) + " bytes: " + e.Err.Error()
+}
+
+func (e *PartialReadError) Unwrap() error { return e.Err }
+
+// An Error is returned when a command on a tracee fails.  Errors from
+// the underlying system calls are mapped onto ErrTraceeExited,
+// ErrNotStopped, ErrNotAttached, and ErrPermission, which can be tested
+// with errors.Is.  The system call error is still available with
+// errors.Is and errors.As.
+type Error struct {
+	// Op is the failed operation, for example "cont" or "singlestep".
+	Op string
+	// Pid is the process ID of the tracee.
+	Pid int
+	// Err is the underlying error, usually a syscall.Errno.
+	Err error
+
+	// The error from the package error set that corresponds
+	// to Err, or nil.
+	kind error
+}
+
+func (e *Error) Error() string {
+	return "ptrace " + e.Op + " " + strconv.Itoa(e.Pid) + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is the package error corresponding to the
+// underlying error.
+func (e *Error) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+// Wraps a system call error from a command in an *Error.  Other errors,
+// including those that are already an *Error, are returned unchanged.
+func (t *Tracee) opError(op string, err error) error {
+	// Errors are checked before declaring the targets of errors.As,
+	// which escape, so that commands that succeed do not allocate.
+	if err == nil {
+		return nil
+	}
+	var errno syscall.Errno
+	var perr *Error
+	if errors.As(err, &perr) || !errors.As(err, &errno) {
+		return err
+	}
+	e := &Error{Op: op, Pid: t.proc.Pid, Err: err}
+	switch errno {
+	case syscall.ESRCH:
+		// ESRCH means that the tracee does not exist, is not traced
+		// by this thread, or is not stopped.
+		switch t.State() {
+		case Exited:
+			e.kind = ErrTraceeExited
+		case Detached:
+			e.kind = ErrNotAttached
+		default:
+			e.kind = ErrNotStopped
+		}
+	case syscall.EPERM:
+		e.kind = ErrPermission
+	}
+	return e
+}
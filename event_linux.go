@@ -0,0 +1,160 @@
+package ptrace
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// The ptrace options set on every tracee at its initial stop.
+const defaultOptions = syscall.PTRACE_O_TRACEEXEC | syscall.PTRACE_O_TRACEEXIT
+
+// WithExitKill kills the tracee with SIGKILL if the tracer exits, even
+// if it crashes, using PTRACE_O_EXITKILL.  Otherwise, a tracee whose
+// tracer exits without closing it is detached, and keeps running.  The
+// option is set at the tracee's initial stop, and does not apply once
+// the tracee is detached.
+//
+// The option also applies when the tracer thread exits, so Close, with
+// DetachOnClose or StopOnClose, stops a running tracee that is not
+// seized with a SIGSTOP to detach it first.  If the tracee stops for
+// another reason before the SIGSTOP is delivered, the SIGSTOP remains
+// pending, and stops the tracee once it is detached; if it does not
+// stop within a second, it is killed.
+func WithExitKill() Option {
+	return func(t *Tracee) { t.exitKill = true }
+}
+
+// An ExecEvent is sent when the tracee stops after successfully calling
+// execve, once its new program image is loaded.
+type ExecEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Path is the path of the new executable.
+	Path string `json:"path"`
+}
+
+// A PreExitEvent is sent when the tracee is about to exit, while its
+// registers and memory can still be inspected.  The tracee must be
+// continued to finish exiting.
+type PreExitEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// ExitStatus is the wait status with which the tracee will exit.
+	ExitStatus syscall.WaitStatus `json:"exit_status"`
+}
+
+// Returns the ptrace options set at the tracee's initial stop.
+func (t *Tracee) initialOptions() int {
+	opts := defaultOptions
+	if t.seccomp != nil {
+		opts |= ptraceOTraceSeccomp
+	}
+	if t.exitKill {
+		opts |= ptraceOExitKill
+	}
+	if t.followForks {
+		opts |= followForkOptions
+	}
+	return opts
+}
+
+// Returns the event for a wait status, or nil if the stop was handled
+// internally and the tracee resumed.  Called on the wait go routine.
+func (t *Tracee) decode(ws syscall.WaitStatus) Event {
+	if !t.started && ws.Stopped() {
+		// The initial stop follows the execve of the tracee, before
+		// any options are set.
+		t.started = true
+		opts := t.initialOptions()
+		var err error
+		if t.seize != nil {
+			err = t.runInternal("seize", func() error { return t.seizeTracee(opts) })
+			t.seize <- err
+		} else {
+			err = t.runInternal("setoptions", func() error { return t.setOptions(opts) })
+		}
+		if t.seccomp != nil {
+			if err == nil {
+				err = t.installSeccomp()
+			}
+			t.seccomp.done <- err
+		}
+		if t.entry != nil {
+			// The initial stop is consumed, and the tracee is run
+			// to its entry point, if it is not already there.
+			if err == nil {
+				err = t.runInternal("stopatentry", t.runToEntry)
+			}
+			if err != nil || t.toEntry == nil {
+				t.atEntry(err)
+			}
+			return nil
+		}
+		if t.libs != nil {
+			t.setLoaderHook()
+		}
+	}
+	if t.toEntry != nil && ws.Stopped() {
+		return t.decodeToEntry(ws)
+	}
+	return t.decodeStop(ws)
+}
+
+// Returns the event for a wait status after the initial stop, or nil if
+// the stop was handled internally.  Called on the wait go routine.
+func (t *Tracee) decodeStop(ws syscall.WaitStatus) Event {
+	if t.finishStepOver(ws) {
+		return nil
+	}
+	switch {
+	case waitState(ws) == SyscallStopped:
+		return t.decodeSyscall(ws)
+	case ws.Stopped() && ws.TrapCause() == syscall.PTRACE_EVENT_EXEC:
+		t.resetBreakpoints()
+		if t.libs != nil {
+			t.setLoaderHook()
+		}
+		path, _ := os.Readlink("/proc/" + strconv.Itoa(t.proc.Pid) + "/exe")
+		return ExecEvent{Status: ws, Path: path}
+	case ws.Stopped() && t.groupStop(ws):
+		return GroupStopEvent{Status: ws, Signal: ws.StopSignal()}
+	case ws.Stopped() && ws.TrapCause() == syscall.PTRACE_EVENT_CLONE:
+		return t.decodeClone(ws)
+	case ws.Stopped() && (ws.TrapCause() == syscall.PTRACE_EVENT_FORK || ws.TrapCause() == syscall.PTRACE_EVENT_VFORK):
+		return t.decodeFork(ws)
+	case ws.Stopped() && ws.TrapCause() == syscall.PTRACE_EVENT_EXIT:
+		var msg uint
+		err := t.runInternal("geteventmsg", func() (err error) {
+			msg, err = syscall.PtraceGetEventMsg(t.proc.Pid)
+			return err
+		})
+		if err != nil {
+			return Event(ws)
+		}
+		return PreExitEvent{Status: ws, ExitStatus: syscall.WaitStatus(msg)}
+	case ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP && ws.TrapCause() == 0:
+		if ev, ok := t.decodeHWBreakpoint(ws); ok {
+			return ev
+		}
+		if ev, ok := t.decodeBreakpoint(ws); ok {
+			return ev
+		}
+	}
+	if t.signals != nil && t.applySignalPolicy(ws) {
+		return nil
+	}
+	return Event(ws)
+}
+
+// Returns whether an event other than a wait status is sent for a stop
+// of the tracee.  A SyscallEnterEvent of a seccomp notification is not,
+// since the tracee is blocked in the system call, not stopped.
+func isStopEvent(ev Event) bool {
+	switch ev := ev.(type) {
+	case SyscallEnterEvent:
+		return ev.Notification == nil
+	case SyscallExitEvent, SeccompEvent, ExecEvent, PreExitEvent, ForkEvent,
+		GroupStopEvent, BreakpointEvent, HWBreakpointEvent:
+		return true
+	}
+	return false
+}
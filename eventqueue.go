@@ -0,0 +1,90 @@
+package ptrace
+
+import (
+	"errors"
+	"sync"
+)
+
+// UnboundedEvents is the event buffer size, for WithEventBuffer, with
+// which events are queued without limit.
+const UnboundedEvents = -1
+
+// The default capacity of the events channel.
+const defaultEventBuffer = 1
+
+var errBadEventBuffer = errors.New("ptrace: negative event buffer size")
+
+// WithEventBuffer sets the capacity of the tracee's events channel to n
+// events.  The wait go routine blocks while the channel is full, so a
+// consumer that issues commands while events are arriving, for example
+// from a breakpoint's OnHit, may need a larger buffer.  If n is
+// UnboundedEvents, events that do not fit in the channel are queued
+// instead, and the wait go routine never blocks; the queue grows as long
+// as the consumer falls behind.  Exec and Attach fail if n is otherwise
+// negative.
+//
+// With a buffer of 0, Exec deadlocks if it is given both WithStopAtEntry
+// and WithLibraryEvents: the LibraryLoadEvent of the libraries loaded at
+// startup is sent before Exec returns, and no event can be received
+// until it does.  Those options need a buffer of at least 1, as by
+// default, or UnboundedEvents.
+func WithEventBuffer(n int) Option {
+	return func(t *Tracee) { t.eventBuffer = n }
+}
+
+// An eventQueue holds the events of an unbounded events channel until
+// they are forwarded to it.
+type eventQueue struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	evs    []Event
+	closed bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{}
+	q.cond.L = &q.mu
+	return q
+}
+
+func (q *eventQueue) push(ev Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.evs = append(q.evs, ev)
+	q.cond.Signal()
+}
+
+// Closes the queue.  The events already queued are still forwarded.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Signal()
+}
+
+// Forwards the queued events to the events channel, dropping them once
+// the tracee is closed, and closes the channel once the queue is closed
+// and empty.  Runs on its own go routine.
+func (t *Tracee) forwardEvents() {
+	q := t.queue
+	defer close(t.events)
+	for {
+		q.mu.Lock()
+		for len(q.evs) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.evs) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		ev := q.evs[0]
+		q.evs[0] = nil
+		q.evs = q.evs[1:]
+		q.mu.Unlock()
+		select {
+		case t.events <- ev:
+		case <-t.closing:
+		case <-t.killing:
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package ptrace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"syscall"
+)
+
+// A Fault makes matching system calls fail without executing them.
+type Fault struct {
+	// Name identifies the fault in the injector's counts.
+	Name string
+	// Syscalls are the names of the system calls that the fault
+	// matches.  If empty, the fault matches every system call.
+	Syscalls []string
+	// Port, if non-zero, restricts the fault to connect, bind, and
+	// sendto calls whose IPv4 or IPv6 socket address has this port.
+	Port int
+	// Match, if non-nil, must also return true for the fault to
+	// match.
+	Match func(SyscallEnterEvent) bool
+	// Every is the period of the fault: only every Every-th matching
+	// call fails.  If Every is 0 or 1, every matching call fails.
+	Every int
+	// Errno is the error returned by the failed system call.
+	Errno syscall.Errno
+}
+
+// A FaultInjector injects faults into the system calls of a tracee.
+// The first fault that matches a system call entry applies to it; if
+// the call is due to fail, it is skipped, and its exit is rewritten to
+// return the fault's Errno.
+type FaultInjector struct {
+	Faults []Fault
+
+	t *Tracee
+	// Pending is the errno to return at the exit of the skipped
+	// system call, or 0 if the current system call is not skipped.
+	pending syscall.Errno
+
+	// Matched and counts are the numbers of matching and of failed
+	// system calls of each fault, by index in Faults.
+	mu      sync.Mutex
+	matched map[int]int
+	counts  map[int]int
+}
+
+// WithFaults injects the FaultInjector's faults into the tracee.  The
+// faults apply to the system call stops of a tracee resumed with
+// Syscall; Run resumes the tracee this way until it exits.
+func WithFaults(fi *FaultInjector) Option {
+	return func(t *Tracee) {
+		fi.t = t
+		fi.matched = make(map[int]int)
+		fi.counts = make(map[int]int)
+		t.observers = append(t.observers, fi.observe)
+		t.exitErrnos = append(t.exitErrnos, fi.exitErrno)
+	}
+}
+
+var errNoTracee = errors.New("ptrace: fault injector is not attached to a tracee")
+
+// Run repeatedly resumes the tracee with Syscall, discarding its events,
+// until the tracee exits, and returns its exit status.  The signal of a
+// signal-delivery stop is delivered when the tracee is resumed from it.
+func (fi *FaultInjector) Run(ctx context.Context) (syscall.WaitStatus, error) {
+	if fi.t == nil {
+		return 0, errNoTracee
+	}
+	for {
+		ev, err := fi.t.NextEvent(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if ws, ok := ev.(syscall.WaitStatus); ok && (ws.Exited() || ws.Signaled()) {
+			return ws, nil
+		}
+		if !isStop(ev) {
+			continue
+		}
+		if err := fi.t.syscallFrom(ev); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Injected returns the number of system calls that failed because of
+// each fault, by name.  The counts of faults with the same name are
+// summed.
+func (fi *FaultInjector) Injected() map[string]int {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	m := make(map[string]int, len(fi.counts))
+	for i, n := range fi.counts {
+		m[fi.Faults[i].Name] += n
+	}
+	return m
+}
+
+// Called on the wait go routine.
+func (fi *FaultInjector) observe(ev Event) {
+	enter, ok := ev.(SyscallEnterEvent)
+	if !ok {
+		return
+	}
+	fi.pending = 0
+	i := fi.match(enter)
+	if i < 0 {
+		return
+	}
+	s, err := fi.t.syscallStop(fi.t.doInternal)
+	if err != nil || s.SetNr(-1) != nil {
+		return
+	}
+	fi.pending = fi.Faults[i].Errno
+	fi.mu.Lock()
+	fi.counts[i]++
+	fi.mu.Unlock()
+}
+
+// Returns the errno of the skipped system call, if any, to which its
+// exit is rewritten.  Called on the wait go routine.
+func (fi *FaultInjector) exitErrno() syscall.Errno {
+	errno := fi.pending
+	fi.pending = 0
+	return errno
+}
+
+// Returns the index of the fault to inject into the system call, or -1
+// if none is due.
+func (fi *FaultInjector) match(ev SyscallEnterEvent) int {
+	for i := range fi.Faults {
+		f := &fi.Faults[i]
+		if !f.matches(fi.t, ev) {
+			continue
+		}
+		fi.mu.Lock()
+		fi.matched[i]++
+		n := fi.matched[i]
+		fi.mu.Unlock()
+		if f.Every > 1 && n%f.Every != 0 {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
+
+func (f *Fault) matches(t *Tracee, ev SyscallEnterEvent) bool {
+	name := ev.Name()
+	if len(f.Syscalls) > 0 {
+		found := false
+		for _, s := range f.Syscalls {
+			if s == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Port != 0 {
+		port, ok := sockaddrPort(t, ev)
+		if !ok || port != f.Port {
+			return false
+		}
+	}
+	return f.Match == nil || f.Match(ev)
+}
+
+// Returns the port of the socket address argument of a connect, bind,
+// or sendto call, and whether it is an IPv4 or IPv6 address.
+func sockaddrPort(t *Tracee, ev SyscallEnterEvent) (int, bool) {
+	var addr, n uint64
+	switch ev.Name() {
+	case "connect", "bind":
+		addr, n = ev.Args[1], ev.Args[2]
+	case "sendto":
+		addr, n = ev.Args[4], ev.Args[5]
+	default:
+		return 0, false
+	}
+	// Both sockaddr_in and sockaddr_in6 begin with the family, in
+	// host order, followed by the port, in network order.
+	if addr == 0 || n < 4 {
+		return 0, false
+	}
+	var b [4]byte
+	if _, err := t.peekInternal(uintptr(addr), b[:]); err != nil {
+		return 0, false
+	}
+	switch binary.NativeEndian.Uint16(b[:2]) {
+	case syscall.AF_INET, syscall.AF_INET6:
+		return int(binary.BigEndian.Uint16(b[2:])), true
+	}
+	return 0, false
+}
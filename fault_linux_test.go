@@ -0,0 +1,73 @@
+package ptrace
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestFaultEveryCountsEachFault(t *testing.T) {
+	readNr := syscallNr(t, "read")
+	writeNr := syscallNr(t, "write")
+	// The faults have the same, empty, name, but each fails every
+	// second of its own matching calls.
+	fi := &FaultInjector{
+		Faults: []Fault{
+			{Syscalls: []string{"read"}, Every: 2, Errno: syscall.EIO},
+			{Syscalls: []string{"write"}, Every: 2, Errno: syscall.EIO},
+		},
+		matched: make(map[int]int),
+		counts:  make(map[int]int),
+	}
+	calls := []struct {
+		nr   int
+		want int
+	}{
+		{readNr, -1},
+		{writeNr, -1},
+		{readNr, 0},
+		{writeNr, 1},
+	}
+	for i, c := range calls {
+		if got := fi.match(SyscallEnterEvent{Nr: c.nr}); got != c.want {
+			t.Errorf("call %d: got fault %d, want %d", i, got, c.want)
+		}
+	}
+}
+
+func TestFaultExitErrno(t *testing.T) {
+	fi := &FaultInjector{
+		Faults: []Fault{{
+			Name:     "stdout",
+			Syscalls: []string{"write"},
+			Match:    func(ev SyscallEnterEvent) bool { return ev.Args[0] == 1 },
+			Errno:    syscall.EACCES,
+		}},
+	}
+	tr := execStopped(t, []string{"/bin/sh", "-c", "echo hello"}, WithFaults(fi))
+	defer tr.Close()
+	skipped := false
+	for {
+		if err := tr.Syscall(); err != nil {
+			t.Fatalf("Syscall: %v", err)
+		}
+		ev, ok := <-tr.Events()
+		if !ok {
+			t.Fatal("no write to stdout")
+		}
+		switch ev := ev.(type) {
+		case SyscallEnterEvent:
+			skipped = ev.Name() == "write" && ev.Args[0] == 1
+		case SyscallExitEvent:
+			if !skipped {
+				continue
+			}
+			if ev.Errno != syscall.EACCES || ev.Ret != -int64(syscall.EACCES) {
+				t.Errorf("exit: got %d (%v), want %d (%v)", ev.Ret, ev.Errno, -int64(syscall.EACCES), syscall.EACCES)
+			}
+			if n := fi.Injected()["stdout"]; n != 1 {
+				t.Errorf("Injected: got %d, want 1", n)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ptrace
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// An FdInfo describes an open file descriptor of the tracee.
+type FdInfo struct {
+	Fd int
+	// Path is the target of the descriptor's /proc/pid/fd link: the
+	// file's path, or a description such as "pipe:[1234]" or
+	// "socket:[5678]" for a file that has none.
+	Path string
+	// Flags are the file status flags, such as syscall.O_RDWR and
+	// syscall.O_APPEND, with which the file was opened.
+	Flags int
+	// Offset is the file offset.
+	Offset int64
+}
+
+// Fds returns the tracee's open file descriptors, sorted by number.  A
+// descriptor that is closed while they are read is omitted.
+func (t *Tracee) Fds() ([]FdInfo, error) {
+	dir := "/proc/" + strconv.Itoa(t.proc.Pid)
+	fds, err := listTasks(dir + "/fd")
+	if err != nil {
+		return nil, err
+	}
+	var infos []FdInfo
+	for _, fd := range fds {
+		n := strconv.Itoa(fd)
+		path, err := os.Readlink(dir + "/fd/" + n)
+		if err != nil {
+			continue
+		}
+		info := FdInfo{Fd: fd, Path: path}
+		if !readFdinfo(dir+"/fdinfo/"+n, &info) {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Reads the flags and offset of a /proc/pid/fdinfo file.  Lines have the
+// form "key:\tvalue", with the flags in octal.  Returns false if the file
+// cannot be read.
+func readFdinfo(path string, info *FdInfo) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case "pos":
+			info.Offset, _ = strconv.ParseInt(v, 10, 64)
+		case "flags":
+			flags, _ := strconv.ParseInt(v, 8, 64)
+			info.Flags = int(flags)
+		}
+	}
+	return s.Err() == nil
+}
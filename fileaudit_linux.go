@@ -0,0 +1,215 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A FileAccessMode is the way in which a file is accessed.
+type FileAccessMode int
+
+const (
+	// FileRead means the file is opened for reading.
+	FileRead FileAccessMode = iota
+	// FileWrite means the file is opened for writing.
+	FileWrite
+	// FileReadWrite means the file is opened for reading and writing.
+	FileReadWrite
+	// FileStat means the file's metadata is read, by stat or access.
+	FileStat
+	// FileUnlink means the file is removed, by unlink or rmdir.
+	FileUnlink
+)
+
+var fileAccessModeNames = [...]string{
+	FileRead:      "read",
+	FileWrite:     "write",
+	FileReadWrite: "read-write",
+	FileStat:      "stat",
+	FileUnlink:    "unlink",
+}
+
+func (m FileAccessMode) String() string {
+	if m < 0 || int(m) >= len(fileAccessModeNames) {
+		return "unknown"
+	}
+	return fileAccessModeNames[m]
+}
+
+// A FileAccess is an access of a file by a system call.
+type FileAccess struct {
+	// Time is when the system call was entered.
+	Time time.Time
+	// Pid is the process ID of the tracee.
+	Pid int
+	// Syscall is the name of the system call.
+	Syscall string
+	// Path is the absolute path of the file.  A relative path is
+	// resolved against the tracee's working directory, or the
+	// directory file descriptor argument, at the entry of the system
+	// call; if that fails, Path is the path argument as given.
+	Path string
+	Mode FileAccessMode
+	// Flags are the open flags, for a system call that opens the file.
+	Flags int
+	// Err is the syscall.Errno returned by the system call, or nil if
+	// it succeeded.
+	Err error
+}
+
+// A FileAudit records the files that one or more tracees resumed with
+// Syscall open, stat, and unlink.  Only the system calls that name a
+// file by path are recorded; for example, fstat is not, since its file
+// was recorded when it was opened.
+type FileAudit struct {
+	mu       sync.Mutex
+	accesses []FileAccess
+}
+
+// NewFileAudit returns a new FileAudit with no accesses recorded.
+func NewFileAudit() *FileAudit {
+	return &FileAudit{}
+}
+
+// The arguments of a system call that accesses a file by path.  Dirfd
+// and flags are argument indices, or -1 if the system call has no such
+// argument.
+type fileSyscall struct {
+	dirfd, path, flags int
+	mode               FileAccessMode
+	// Open is whether the system call opens the file, in which case
+	// the mode is determined by the flags.
+	open bool
+}
+
+// The system calls that access files by path, indexed by name.
+var fileSyscalls = map[string]fileSyscall{
+	"open":       {dirfd: -1, path: 0, flags: 1, open: true},
+	"openat":     {dirfd: 0, path: 1, flags: 2, open: true},
+	"openat2":    {dirfd: 0, path: 1, flags: 2, open: true},
+	"creat":      {dirfd: -1, path: 0, flags: -1, open: true},
+	"stat":       {dirfd: -1, path: 0, flags: -1, mode: FileStat},
+	"lstat":      {dirfd: -1, path: 0, flags: -1, mode: FileStat},
+	"stat64":     {dirfd: -1, path: 0, flags: -1, mode: FileStat},
+	"lstat64":    {dirfd: -1, path: 0, flags: -1, mode: FileStat},
+	"newfstatat": {dirfd: 0, path: 1, flags: -1, mode: FileStat},
+	"fstatat64":  {dirfd: 0, path: 1, flags: -1, mode: FileStat},
+	"statx":      {dirfd: 0, path: 1, flags: -1, mode: FileStat},
+	"access":     {dirfd: -1, path: 0, flags: -1, mode: FileStat},
+	"faccessat":  {dirfd: 0, path: 1, flags: -1, mode: FileStat},
+	"faccessat2": {dirfd: 0, path: 1, flags: -1, mode: FileStat},
+	"unlink":     {dirfd: -1, path: 0, flags: -1, mode: FileUnlink},
+	"unlinkat":   {dirfd: 0, path: 1, flags: -1, mode: FileUnlink},
+	"rmdir":      {dirfd: -1, path: 0, flags: -1, mode: FileUnlink},
+}
+
+// WithFileAudit records the tracee's file accesses with the FileAudit.
+func WithFileAudit(a *FileAudit) Option {
+	return func(t *Tracee) {
+		// The pending access is only accessed on the wait go
+		// routine.
+		var pending *FileAccess
+		pendingNr := -1
+		t.observers = append(t.observers, func(ev Event) {
+			switch ev := ev.(type) {
+			case SyscallEnterEvent:
+				pending, pendingNr = t.fileAccess(ev), ev.Nr
+			case SyscallExitEvent:
+				if pending == nil || ev.Nr != pendingNr {
+					return
+				}
+				pending.Err = ev.Err()
+				a.mu.Lock()
+				a.accesses = append(a.accesses, *pending)
+				a.mu.Unlock()
+				pending = nil
+			}
+		})
+	}
+}
+
+// Accesses returns the recorded accesses, in the order that their system
+// calls returned.
+func (a *FileAudit) Accesses() []FileAccess {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]FileAccess(nil), a.accesses...)
+}
+
+// Returns the access of the system call entry, or nil if it does not
+// access a file by path.  Called on the wait go routine.
+func (t *Tracee) fileAccess(ev SyscallEnterEvent) *FileAccess {
+	name := ev.Name()
+	fs, ok := fileSyscalls[name]
+	if !ok {
+		return nil
+	}
+	fa := &FileAccess{Time: ev.Time, Pid: t.proc.Pid, Syscall: name, Mode: fs.mode}
+	var path string
+	err := t.doInternal(func(r Raw) (err error) {
+		if path, err = readString(r, ev.Args[fs.path]); err != nil {
+			return err
+		}
+		switch {
+		case name == "creat":
+			fa.Flags = syscall.O_CREAT | syscall.O_WRONLY | syscall.O_TRUNC
+		case name == "openat2":
+			// The flags are the first field of struct open_how.
+			var b [8]byte
+			if _, err := r.PeekData(uintptr(ev.Args[fs.flags]), b[:]); err != nil {
+				return err
+			}
+			fa.Flags = int(binary.NativeEndian.Uint64(b[:]))
+		case fs.flags >= 0:
+			fa.Flags = int(int32(ev.Args[fs.flags]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	if fs.open {
+		switch fa.Flags & syscall.O_ACCMODE {
+		case syscall.O_WRONLY:
+			fa.Mode = FileWrite
+		case syscall.O_RDWR:
+			fa.Mode = FileReadWrite
+		default:
+			fa.Mode = FileRead
+		}
+	}
+	dirfd := atFdcwd
+	if fs.dirfd >= 0 {
+		dirfd = int(int32(ev.Args[fs.dirfd]))
+	}
+	fa.Path = t.resolvePath(dirfd, path)
+	return fa
+}
+
+// The dirfd argument that refers to the working directory.
+const atFdcwd = -100
+
+// Returns the absolute path of a path argument relative to the directory
+// file descriptor dirfd, or path itself if it cannot be resolved.  An
+// empty path, as with AT_EMPTY_PATH, refers to dirfd itself.
+func (t *Tracee) resolvePath(dirfd int, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	var dir string
+	var err error
+	if dirfd == atFdcwd {
+		dir, err = t.Cwd()
+	} else {
+		dir, err = os.Readlink("/proc/" + strconv.Itoa(t.proc.Pid) + "/fd/" + strconv.Itoa(dirfd))
+	}
+	if err != nil {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,76 @@
+package ptrace
+
+import (
+	"os"
+	"syscall"
+)
+
+// WithFollowForks traces the child processes that the tracee creates
+// with fork, vfork, or clone without CLONE_THREAD, and, in turn, their
+// children.  Each child is a new Tracee, reported by a ForkEvent, which
+// shares the tracer thread of the tracee.  Once the Tracee returned by
+// Exec is closed, which ends the thread, its descendants are detached,
+// and their commands fail with ErrTraceeExited.  A child that is closed
+// while it is running is detached at its next stop.
+func WithFollowForks() Option {
+	return func(t *Tracee) { t.followForks = true }
+}
+
+// A ForkEvent is sent when the tracee stops after creating a child
+// process, if it was created WithFollowForks.  The child starts with the
+// tracee's ClosePolicy, context, event buffer, and WithSyscallDecoding
+// limits, but none of its other options.  Its first event is a stop for
+// SIGSTOP, after which it must be continued.
+type ForkEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Pid is the process ID of the child.
+	Pid   int `json:"pid"`
+	child *Tracee
+}
+
+// Child returns the Tracee of the child, or nil if the event was read
+// from a recording.
+func (e ForkEvent) Child() *Tracee { return e.child }
+
+// The ptrace options that follow forks.
+const followForkOptions = syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK
+
+// Returns the event for a stop after a fork.  Called on the wait go
+// routine.
+func (t *Tracee) decodeFork(ws syscall.WaitStatus) Event {
+	var pid int
+	var options int
+	var seized bool
+	err := t.runInternal("geteventmsg", func() error {
+		msg, err := syscall.PtraceGetEventMsg(t.proc.Pid)
+		pid, options, seized = int(msg), t.options, t.seized
+		return err
+	})
+	if err != nil {
+		return Event(ws)
+	}
+	c := &Tracee{
+		err:       make(chan error, 1),
+		cmds:      t.cmds,
+		ctx:       t.ctx,
+		policy:    t.policy,
+		closing:   make(chan struct{}),
+		killing:   make(chan struct{}),
+		traceDone: t.traceDone,
+		waitDone:  make(chan struct{}),
+		owner:     t,
+
+		eventBuffer: t.eventBuffer,
+	}
+	// FindProcess does not fail on Unix.
+	c.proc, _ = os.FindProcess(pid)
+	c.mem.notify = c.trySend
+	c.init()
+	// The child inherits the tracee's ptrace options.
+	c.options, c.seized = options, seized
+	c.followForks, c.exitKill = t.followForks, t.exitKill
+	c.decodeLimits = t.decodeLimits
+	c.makeEvents()
+	go c.wait()
+	return ForkEvent{Status: ws, Pid: pid, child: c}
+}
@@ -0,0 +1,161 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"syscall"
+)
+
+// A Frame describes the innermost function of a stopped tracee.
+type Frame struct {
+	PC uint64
+	// ReturnAddress is the address to which the function returns.
+	ReturnAddress uint64
+	// FrameBase is the canonical frame address: the value of the
+	// stack pointer in the caller just before the call.
+	FrameBase uint64
+	// Function is the name of the function, or empty if it is not
+	// known.
+	Function string
+	// Entry is the address of the function's first instruction, or
+	// 0 if the function is not known.
+	Entry uint64
+	// Args are the function's parameters, if they are known from the
+	// executable's DWARF.
+	Args []Arg
+}
+
+// An Arg is a function parameter.
+type Arg struct {
+	Name string
+	// Value is the word-sized value of the parameter.  Larger
+	// parameters are truncated.
+	Value uint64
+	// OK is whether the value could be determined.
+	OK bool
+}
+
+// CurrentFrame returns the tracee's innermost frame: its return address
+// and frame base, and, when the executable has symbols, the enclosing
+// function, and when it has DWARF, its arguments.  It is much cheaper
+// than a full backtrace.
+//
+// At the first instruction of a function, for example at a
+// function-entry breakpoint, the frame is computed from the stack
+// pointer, and arguments are read from the calling convention's
+// registers.  Elsewhere, the frame is computed from the frame pointer,
+// so the result is only correct for code that maintains one.
+func (t *Tracee) CurrentFrame() (Frame, error) {
+	var f Frame
+	var regs syscall.PtraceRegs
+	if err := t.Do(func(r Raw) error { return r.GetRegs(&regs) }); err != nil {
+		return f, err
+	}
+	f.PC = regs.PC()
+	var fn *dwarfFunc
+	if info, err := t.debugInfo(); err == nil {
+		if fn, err = info.funcForPC(f.PC); err == nil {
+			f.Function = fn.name
+			f.Entry = fn.low + info.bias
+		}
+	}
+	atEntry := fn != nil && f.PC == f.Entry
+	err := t.Do(func(r Raw) (err error) {
+		f.ReturnAddress, f.FrameBase, err = frameRegs(r, &regs, atEntry)
+		if err != nil || fn == nil {
+			return err
+		}
+		var argRegs []uint64
+		if atEntry {
+			argRegs = entryArgRegs(&regs)
+		}
+		for i, p := range fn.params {
+			a := Arg{Name: p.name}
+			switch {
+			case i < len(argRegs):
+				a.Value, a.OK = argRegs[i], true
+			case !atEntry:
+				a.Value, a.OK = evalLocation(r, p.loc, fn.frameBase, f.FrameBase)
+			}
+			f.Args = append(f.Args, a)
+		}
+		return nil
+	})
+	return f, err
+}
+
+// DWARF location expression operations.
+const (
+	dwOpAddr         = 0x03
+	dwOpFbreg        = 0x91
+	dwOpCallFrameCFA = 0x9c
+)
+
+// Evaluates the simple location expressions emitted for parameters of
+// unoptimized code: a static address, or an offset from a frame base
+// that is the canonical frame address.  Returns the word at the
+// location, and whether the expression could be evaluated.
+func evalLocation(r Raw, loc, frameBase []byte, cfa uint64) (uint64, bool) {
+	if len(loc) == 0 {
+		return 0, false
+	}
+	var addr uint64
+	switch loc[0] {
+	case dwOpAddr:
+		if len(loc) != 1+int(ptrSize) {
+			return 0, false
+		}
+		if ptrSize == 4 {
+			addr = uint64(binary.NativeEndian.Uint32(loc[1:]))
+		} else {
+			addr = binary.NativeEndian.Uint64(loc[1:])
+		}
+	case dwOpFbreg:
+		if len(frameBase) != 1 || frameBase[0] != dwOpCallFrameCFA {
+			return 0, false
+		}
+		off, n := sleb128(loc[1:])
+		if n != len(loc)-1 {
+			return 0, false
+		}
+		addr = cfa + uint64(off)
+	default:
+		return 0, false
+	}
+	w, err := readWord(r, addr)
+	return w, err == nil
+}
+
+func sleb128(b []byte) (int64, int) {
+	var v int64
+	var shift uint
+	for i, c := range b {
+		v |= int64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			if shift < 64 && c&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// Reads a word, of the tracee's word size and byte order, from the
+// tracee.
+func readWord(r Raw, addr uint64) (uint64, error) {
+	return r.ReadPointer(addr)
+}
+
+// Writes a word, of the tracee's word size and byte order, to the
+// tracee.
+func writeWord(r Raw, addr, v uint64) error {
+	var b [ptrSize]byte
+	if ptrSize == 4 {
+		binary.NativeEndian.PutUint32(b[:], uint32(v))
+	} else {
+		binary.NativeEndian.PutUint64(b[:], v)
+	}
+	_, err := r.PokeData(uintptr(addr), b[:])
+	return err
+}
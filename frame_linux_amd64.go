@@ -0,0 +1,71 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// Returns the return address and canonical frame address of the
+// innermost frame.
+func frameRegs(r Raw, regs *syscall.PtraceRegs, atEntry bool) (ra, cfa uint64, err error) {
+	if atEntry {
+		ra, err = readWord(r, regs.Rsp)
+		return ra, regs.Rsp + 8, err
+	}
+	ra, err = readWord(r, regs.Rbp+8)
+	return ra, regs.Rbp + 16, err
+}
+
+// Returns the frame pointer, which points to the saved frame pointer of
+// the caller, followed by the return address.
+func framePointer(regs *syscall.PtraceRegs) uint64 {
+	return regs.Rbp
+}
+
+// Returns the integer argument registers of the System V calling
+// convention, valid at a function's first instruction.
+func entryArgRegs(regs *syscall.PtraceRegs) []uint64 {
+	return []uint64{regs.Rdi, regs.Rsi, regs.Rdx, regs.Rcx, regs.R8, regs.R9}
+}
+
+// Sets up the registers and stack to call fn with the System V calling
+// convention, returning to address 0.
+func setupCall(r Raw, regs *syscall.PtraceRegs, fn uint64, args []uint64) error {
+	var stack []uint64
+	if len(args) > 6 {
+		args, stack = args[:6], args[6:]
+	}
+	// Skip the red zone, and align the stack arguments to 16 bytes.
+	sp := (regs.Rsp - 256 - 8*uint64(len(stack))) &^ 15
+	for i, a := range stack {
+		if err := writeWord(r, sp+8*uint64(i), a); err != nil {
+			return err
+		}
+	}
+	sp -= 8
+	if err := writeWord(r, sp, 0); err != nil {
+		return err
+	}
+	argRegs := []*uint64{&regs.Rdi, &regs.Rsi, &regs.Rdx, &regs.Rcx, &regs.R8, &regs.R9}
+	for i, a := range args {
+		*argRegs[i] = a
+	}
+	regs.Rax = 0
+	regs.Orig_rax = ^uint64(0)
+	regs.Rsp = sp
+	regs.Rip = fn
+	return nil
+}
+
+// Returns the integer return value of a called function.
+func callRet(regs *syscall.PtraceRegs) uint64 {
+	return regs.Rax
+}
+
+// The breakpoint instruction, int3.
+var breakpointInsn = []byte{0xcc}
+
+// Returns the address of the breakpoint that stopped the tracee at pc.
+// The int3 instruction traps after it executes.
+func breakpointAddr(pc uint64) uint64 {
+	return pc - 1
+}
@@ -0,0 +1,61 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// Returns the return address and canonical frame address of the
+// innermost frame.
+func frameRegs(r Raw, regs *syscall.PtraceRegs, atEntry bool) (ra, cfa uint64, err error) {
+	if atEntry {
+		return regs.Regs[30], regs.Sp, nil
+	}
+	fp := regs.Regs[29]
+	ra, err = readWord(r, fp+8)
+	return ra, fp + 16, err
+}
+
+// Returns the frame pointer, which points to the saved frame pointer of
+// the caller, followed by the return address.
+func framePointer(regs *syscall.PtraceRegs) uint64 {
+	return regs.Regs[29]
+}
+
+// Returns the integer argument registers of the AAPCS64 calling
+// convention, valid at a function's first instruction.
+func entryArgRegs(regs *syscall.PtraceRegs) []uint64 {
+	return append([]uint64(nil), regs.Regs[:8]...)
+}
+
+// Sets up the registers and stack to call fn with the AAPCS64 calling
+// convention, returning to address 0.
+func setupCall(r Raw, regs *syscall.PtraceRegs, fn uint64, args []uint64) error {
+	var stack []uint64
+	if len(args) > 8 {
+		args, stack = args[:8], args[8:]
+	}
+	sp := (regs.Sp - 16 - 8*uint64(len(stack))) &^ 15
+	for i, a := range stack {
+		if err := writeWord(r, sp+8*uint64(i), a); err != nil {
+			return err
+		}
+	}
+	copy(regs.Regs[:8], args)
+	regs.Regs[30] = 0
+	regs.Sp = sp
+	regs.Pc = fn
+	return nil
+}
+
+// Returns the integer return value of a called function.
+func callRet(regs *syscall.PtraceRegs) uint64 {
+	return regs.Regs[0]
+}
+
+// The breakpoint instruction, brk #0.
+var breakpointInsn = []byte{0x00, 0x00, 0x20, 0xd4}
+
+// Returns the address of the breakpoint that stopped the tracee at pc.
+func breakpointAddr(pc uint64) uint64 {
+	return pc
+}
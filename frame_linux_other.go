@@ -0,0 +1,33 @@
+//go:build linux && !amd64 && !arm64
+
+package ptrace
+
+import (
+	"syscall"
+)
+
+func frameRegs(r Raw, regs *syscall.PtraceRegs, atEntry bool) (ra, cfa uint64, err error) {
+	return 0, 0, errUnsupportedArch
+}
+
+func framePointer(regs *syscall.PtraceRegs) uint64 {
+	return 0
+}
+
+func entryArgRegs(regs *syscall.PtraceRegs) []uint64 {
+	return nil
+}
+
+func setupCall(r Raw, regs *syscall.PtraceRegs, fn uint64, args []uint64) error {
+	return errUnsupportedArch
+}
+
+func callRet(regs *syscall.PtraceRegs) uint64 {
+	return 0
+}
+
+var breakpointInsn []byte
+
+func breakpointAddr(pc uint64) uint64 {
+	return pc
+}
@@ -0,0 +1,5 @@
+module github.com/eaburns/ptrace
+
+go 1.25.0
+
+require golang.org/x/arch v0.27.1-0.20260521044007-9c1a596a2c97
@@ -0,0 +1,177 @@
+// Package gosupport inspects the goroutines of a ptrace.Tracee that is
+// a Go program, using the DWARF and the pclntab of its executable to
+// find and decode the runtime's goroutine structures.
+package gosupport
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var (
+	errNotGo      = errors.New("gosupport: executable is not a Go program")
+	errNoRuntimeG = errors.New("gosupport: runtime types not found in DWARF")
+)
+
+// A Status is the scheduling status of a goroutine.
+type Status uint32
+
+// The statuses of the runtime.  A goroutine whose stack is being
+// scanned by the garbage collector also has the scan bit, 0x1000, set.
+const (
+	Idle      Status = 0
+	Runnable  Status = 1
+	Running   Status = 2
+	Syscall   Status = 3
+	Waiting   Status = 4
+	Dead      Status = 6
+	CopyStack Status = 8
+	Preempted Status = 9
+)
+
+// The bit of a status set while the goroutine's stack is scanned.
+const scanBit = 0x1000
+
+var statusNames = map[Status]string{
+	Idle:      "idle",
+	Runnable:  "runnable",
+	Running:   "running",
+	Syscall:   "syscall",
+	Waiting:   "waiting",
+	Dead:      "dead",
+	CopyStack: "copystack",
+	Preempted: "preempted",
+}
+
+func (s Status) String() string {
+	if n, ok := statusNames[s&^scanBit]; ok {
+		return n
+	}
+	return "status " + strconv.Itoa(int(s))
+}
+
+// A Goroutine is a goroutine of the tracee, as recorded by its runtime.
+type Goroutine struct {
+	ID     uint64
+	Status Status
+	// Addr is the address of the goroutine's runtime.g.
+	Addr uint64
+	// PC, SP, and BP are the registers saved in the goroutine's
+	// g.sched when it was last descheduled.  They are stale for a
+	// running goroutine.
+	PC, SP, BP uint64
+	// StackLo and StackHi bound the goroutine's stack.
+	StackLo, StackHi uint64
+	// StartPC is the entry of the goroutine's function, and GoPC is
+	// the PC of the go statement that created it.
+	StartPC, GoPC uint64
+}
+
+// A Frame is a frame of a goroutine's backtrace.
+type Frame struct {
+	PC uint64
+	// Function, File, and Line are from the executable's pclntab,
+	// and are empty if the PC is not in Go code.
+	Function string
+	File     string
+	Line     int
+}
+
+// The offsets of the fields of the runtime's structures that are read.
+type layout struct {
+	gID, gStatus, gSched, gStack, gStartPC, gGoPC int64
+	bufPC, bufSP, bufBP                           int64
+	stackLo, stackHi                              int64
+	// AllGs is the link-time address of runtime.allgs.
+	allgs uint64
+}
+
+// Reads the layout of the runtime's structures from the DWARF of an
+// executable with the given byte order.
+func readLayout(d *dwarf.Data, order binary.ByteOrder) (*layout, error) {
+	structs := map[string]*dwarf.StructType{
+		"runtime.g":     nil,
+		"runtime.gobuf": nil,
+		"runtime.stack": nil,
+	}
+	var l layout
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+		name, _ := e.Val(dwarf.AttrName).(string)
+		switch e.Tag {
+		case dwarf.TagStructType:
+			if s, ok := structs[name]; ok && s == nil {
+				t, err := d.Type(e.Offset)
+				if err != nil {
+					return nil, err
+				}
+				structs[name], _ = t.(*dwarf.StructType)
+			}
+		case dwarf.TagVariable:
+			loc, _ := e.Val(dwarf.AttrLocation).([]byte)
+			// The location is DW_OP_addr and an address.
+			if name == "runtime.allgs" && len(loc) == 9 && loc[0] == 0x03 {
+				l.allgs = order.Uint64(loc[1:])
+			}
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+		}
+	}
+	field := func(s *dwarf.StructType, name string) int64 {
+		if s == nil {
+			return -1
+		}
+		for _, f := range s.Field {
+			if f.Name == name {
+				return f.ByteOffset
+			}
+		}
+		return -1
+	}
+	g, buf, stk := structs["runtime.g"], structs["runtime.gobuf"], structs["runtime.stack"]
+	l.gID = field(g, "goid")
+	l.gStatus = field(g, "atomicstatus")
+	l.gSched = field(g, "sched")
+	l.gStack = field(g, "stack")
+	l.gStartPC = field(g, "startpc")
+	l.gGoPC = field(g, "gopc")
+	l.bufPC = field(buf, "pc")
+	l.bufSP = field(buf, "sp")
+	l.bufBP = field(buf, "bp")
+	l.stackLo = field(stk, "lo")
+	l.stackHi = field(stk, "hi")
+	for _, off := range []int64{l.gID, l.gStatus, l.gSched, l.gStack, l.bufPC, l.bufSP, l.stackLo, l.stackHi} {
+		if off < 0 {
+			return nil, errNoRuntimeG
+		}
+	}
+	if l.allgs == 0 {
+		return nil, errNoRuntimeG
+	}
+	return &l, nil
+}
+
+// Reads the symbol table of a Go executable from its pclntab.
+func readSymtab(f *elf.File) (*gosym.Table, error) {
+	pcln, text := f.Section(".gopclntab"), f.Section(".text")
+	if pcln == nil || text == nil {
+		return nil, errNotGo
+	}
+	b, err := pcln.Data()
+	if err != nil {
+		return nil, err
+	}
+	return gosym.NewTable(nil, gosym.NewLineTable(b, text.Addr))
+}
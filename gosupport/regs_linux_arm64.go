@@ -0,0 +1,13 @@
+package gosupport
+
+import (
+	"syscall"
+)
+
+func stackPointer(regs *syscall.PtraceRegs) uint64 {
+	return regs.Sp
+}
+
+func framePointer(regs *syscall.PtraceRegs) uint64 {
+	return regs.Regs[29]
+}
@@ -0,0 +1,16 @@
+//go:build linux && !amd64 && !arm64
+
+package gosupport
+
+import (
+	"syscall"
+)
+
+// Without the registers, the goroutine's saved registers are used.
+func stackPointer(regs *syscall.PtraceRegs) uint64 {
+	return 0
+}
+
+func framePointer(regs *syscall.PtraceRegs) uint64 {
+	return 0
+}
@@ -0,0 +1,191 @@
+package gosupport
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"encoding/binary"
+	"strconv"
+
+	"github.com/eaburns/ptrace"
+)
+
+// The maximum number of frames of a backtrace.
+const maxFrames = 256
+
+// A Runtime reads the goroutines of a tracee that is a Go program.
+type Runtime struct {
+	t      *ptrace.Tracee
+	layout *layout
+	symtab *gosym.Table
+	// Bias is the load bias of a position independent executable.
+	bias uint64
+	// Order is the byte order of the executable, and so of the
+	// runtime's structures.
+	order binary.ByteOrder
+}
+
+// Load reads the layout of the runtime's structures from the stopped
+// tracee's executable, which must be a 64-bit Go program with DWARF.
+// The layout is not updated if the tracee calls execve.
+func Load(t *ptrace.Tracee) (*Runtime, error) {
+	f, err := elf.Open("/proc/" + strconv.Itoa(t.Pid()) + "/exe")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if f.Class != elf.ELFCLASS64 {
+		return nil, errNotGo
+	}
+	symtab, err := readSymtab(f)
+	if err != nil {
+		return nil, err
+	}
+	d, err := f.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	l, err := readLayout(d, f.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+	bias, err := t.LoadBias(f)
+	if err != nil {
+		return nil, err
+	}
+	return &Runtime{t: t, layout: l, symtab: symtab, bias: bias, order: f.ByteOrder}, nil
+}
+
+// Goroutines returns the goroutines of the stopped tracee, from the
+// runtime's list of all goroutines, runtime.allgs.  Dead goroutines,
+// which the runtime keeps for reuse, are omitted.
+func (rt *Runtime) Goroutines() ([]Goroutine, error) {
+	var gs []Goroutine
+	err := rt.t.Do(func(r ptrace.Raw) error {
+		// A slice is its array, length, and capacity.
+		var hdr [16]byte
+		if _, err := r.PeekData(uintptr(rt.layout.allgs+rt.bias), hdr[:]); err != nil {
+			return err
+		}
+		array := rt.order.Uint64(hdr[:])
+		n := rt.order.Uint64(hdr[8:])
+		if n == 0 {
+			return nil
+		}
+		ptrs := make([]byte, 8*n)
+		if _, err := r.PeekData(uintptr(array), ptrs); err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			g, err := rt.readG(r, rt.order.Uint64(ptrs[8*i:]))
+			if err != nil {
+				return err
+			}
+			if g.Status != Dead {
+				gs = append(gs, g)
+			}
+		}
+		return nil
+	})
+	return gs, err
+}
+
+// Reads the runtime.g at addr.
+func (rt *Runtime) readG(r ptrace.Raw, addr uint64) (Goroutine, error) {
+	l := rt.layout
+	g := Goroutine{Addr: addr}
+	// Fields whose offsets are not known are left 0.
+	word := func(off int64) (uint64, error) {
+		if off < 0 {
+			return 0, nil
+		}
+		var b [8]byte
+		_, err := r.PeekData(uintptr(addr+uint64(off)), b[:])
+		return rt.order.Uint64(b[:]), err
+	}
+	// The offset of a field of a struct field, or -1 if it is not
+	// known.
+	at := func(base, off int64) int64 {
+		if off < 0 {
+			return -1
+		}
+		return base + off
+	}
+	var status uint64
+	for _, f := range []struct {
+		off int64
+		v   *uint64
+	}{
+		{l.gID, &g.ID},
+		{l.gStatus, &status},
+		{at(l.gSched, l.bufPC), &g.PC},
+		{at(l.gSched, l.bufSP), &g.SP},
+		{at(l.gSched, l.bufBP), &g.BP},
+		{at(l.gStack, l.stackLo), &g.StackLo},
+		{at(l.gStack, l.stackHi), &g.StackHi},
+		{l.gStartPC, &g.StartPC},
+		{l.gGoPC, &g.GoPC},
+	} {
+		v, err := word(f.off)
+		if err != nil {
+			return g, err
+		}
+		*f.v = v
+	}
+	// The status is a uint32.
+	g.Status = Status(uint32(status))
+	return g, nil
+}
+
+// Backtrace returns the frames of the goroutine's stack, innermost
+// first, by following the chain of frame pointers from its saved
+// registers.  For a running goroutine on the traced thread, the
+// thread's registers are used instead; for one running on another
+// thread, the backtrace is of where it was last descheduled, and may be
+// wrong.
+func (rt *Runtime) Backtrace(g Goroutine) ([]Frame, error) {
+	pc, fp := g.PC, g.BP
+	if g.Status&^scanBit == Running {
+		regs, err := rt.t.GetRegs()
+		if err != nil {
+			return nil, err
+		}
+		if sp := stackPointer(&regs); g.StackLo <= sp && sp < g.StackHi {
+			pc, fp = regs.PC(), framePointer(&regs)
+		}
+	}
+	frames := []Frame{rt.frame(pc, pc)}
+	err := rt.t.Do(func(r ptrace.Raw) error {
+		var b [16]byte
+		for fp != 0 && len(frames) < maxFrames {
+			if fp < g.StackLo || fp+16 > g.StackHi {
+				break
+			}
+			if _, err := r.PeekData(uintptr(fp), b[:]); err != nil {
+				return err
+			}
+			next, ra := rt.order.Uint64(b[:]), rt.order.Uint64(b[8:])
+			if ra == 0 {
+				break
+			}
+			// The return address may be the start of the next
+			// line, so the call is looked up one byte before it.
+			frames = append(frames, rt.frame(ra, ra-1))
+			if next <= fp {
+				break
+			}
+			fp = next
+		}
+		return nil
+	})
+	return frames, err
+}
+
+// Returns the frame at pc, symbolized at the address look.
+func (rt *Runtime) frame(pc, look uint64) Frame {
+	f := Frame{PC: pc}
+	file, line, fn := rt.symtab.PCToLine(look - rt.bias)
+	if fn != nil {
+		f.Function, f.File, f.Line = fn.Name, file, line
+	}
+	return f
+}
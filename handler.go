@@ -0,0 +1,74 @@
+package ptrace
+
+import "context"
+
+// An EventAction is what OnEvent does with the tracee after its handler
+// returns.
+type EventAction int
+
+const (
+	// EventContinue continues the tracee, as by Continue, but
+	// delivering the signal if the tracee stopped for its delivery.
+	EventContinue EventAction = iota
+	// EventStep single-steps the tracee, as by SingleStep.
+	EventStep
+	// EventStop leaves the tracee stopped, and returns from OnEvent.
+	EventStop
+	// EventDetach detaches the tracee, as by Detach, and returns from
+	// OnEvent.
+	EventDetach
+)
+
+var eventActionNames = [...]string{
+	EventContinue: "continue",
+	EventStep:     "step",
+	EventStop:     "stop",
+	EventDetach:   "detach",
+}
+
+func (a EventAction) String() string {
+	if a < 0 || int(a) >= len(eventActionNames) {
+		return "unknown"
+	}
+	return eventActionNames[a]
+}
+
+// OnEvent receives the tracee's events, calling h with each, and resumes
+// the tracee from each stop according to the action that h returns, so
+// that a tool need not write its own dispatch loop.  The action is
+// ignored for an event that is not a stop, such as the tracee's exit, a
+// MemoryPressureEvent, or a LibraryLoadEvent sent before the event of
+// the stop at which it was observed.  OnEvent returns nil when h returns
+// EventStop or EventDetach at a stop, or once the tracee exits, and
+// otherwise the error of the command that failed.  If ctx is done
+// first, ctx's error is returned.  The tracee must be running when
+// OnEvent is called, for example after Continue; a tracee that is
+// already stopped sends no events until it is resumed.
+func (t *Tracee) OnEvent(ctx context.Context, h func(Event) EventAction) error {
+	for {
+		ev, err := t.NextEvent(ctx)
+		if err == ErrTraceeExited {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		a := h(ev)
+		if !isStop(ev) {
+			continue
+		}
+		switch a {
+		case EventContinue:
+			err = t.continueFrom(ev)
+		case EventStep:
+			err = t.SingleStep()
+		case EventDetach:
+			return t.Detach()
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
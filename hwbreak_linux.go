@@ -0,0 +1,156 @@
+package ptrace
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	errNoDebugReg     = errors.New("ptrace: all hardware breakpoints are in use")
+	errNoHWBreakpoint = errors.New("ptrace: no hardware breakpoint at address")
+	errBadDebugReg    = errors.New("ptrace: no such debug register")
+)
+
+// The number of hardware breakpoint address registers, DR0 through DR3.
+const numHWBreakpoints = 4
+
+// A HWBreakpointEvent is sent when the tracee stops at a hardware
+// breakpoint set with SetHWBreakpoint.  The tracee remains stopped at
+// the breakpoint's address, and continuing it executes the instruction
+// there without stopping again.
+type HWBreakpointEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Addr is the address of the breakpoint.
+	Addr uint64 `json:"addr"`
+	// Slot is the debug register of the breakpoint, 0 through 3.
+	Slot int `json:"slot"`
+}
+
+// SetHWBreakpoint sets a hardware execution breakpoint at addr in the
+// stopped tracee, using one of the four x86 debug address registers,
+// and returns the index of the register.  Unlike the software
+// breakpoints used by WithLibraryCalls, hardware breakpoints do not
+// modify the tracee's code, so they can be set in text that is shared
+// or checksummed.  Setting a breakpoint at an address that already has
+// one returns its register.  Hardware breakpoints are cleared by execve.
+func (t *Tracee) SetHWBreakpoint(addr uintptr) (int, error) {
+	slot := -1
+	err := t.Do(func(r Raw) error {
+		dr7, err := peekDebugReg(r, 7)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < numHWBreakpoints; i++ {
+			if dr7&dr7Enable(i) == 0 {
+				if slot < 0 {
+					slot = i
+				}
+				continue
+			}
+			if a, err := peekDebugReg(r, i); err != nil {
+				return err
+			} else if a == uint64(addr) {
+				slot = i
+				return nil
+			}
+		}
+		if slot < 0 {
+			return errNoDebugReg
+		}
+		if err := pokeDebugReg(r, slot, uint64(addr)); err != nil {
+			return err
+		}
+		// The condition and length bits of the slot are left 0, which
+		// selects an execution breakpoint.
+		dr7 &^= 0xf << (16 + 4*slot)
+		return pokeDebugReg(r, 7, dr7|dr7Enable(slot))
+	})
+	if err != nil {
+		return -1, err
+	}
+	return slot, nil
+}
+
+// ClearHWBreakpoint clears the hardware breakpoint at addr in the
+// stopped tracee, freeing its debug register.
+func (t *Tracee) ClearHWBreakpoint(addr uintptr) error {
+	return t.Do(func(r Raw) error {
+		dr7, err := peekDebugReg(r, 7)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < numHWBreakpoints; i++ {
+			if dr7&dr7Enable(i) == 0 {
+				continue
+			}
+			if a, err := peekDebugReg(r, i); err != nil {
+				return err
+			} else if a == uint64(addr) {
+				return pokeDebugReg(r, 7, dr7&^dr7Enable(i))
+			}
+		}
+		return errNoHWBreakpoint
+	})
+}
+
+// Returns the local enable bit of a breakpoint slot in DR7.
+func dr7Enable(slot int) uint64 { return 1 << (2 * slot) }
+
+// Returns the event for a SIGTRAP stop at a hardware breakpoint, and
+// whether the stop was at one.  Called on the wait go routine.
+func (t *Tracee) decodeHWBreakpoint(ws syscall.WaitStatus) (Event, bool) {
+	if debugRegOffset < 0 {
+		return nil, false
+	}
+	var ev Event
+	found := false
+	t.runInternal("hwbreakpoint", func() error {
+		ev, found = t.hwBreakpointEvent(Raw{t}, ws)
+		return nil
+	})
+	return ev, found
+}
+
+// Returns the event for a SIGTRAP stop at a hardware breakpoint, and
+// whether the stop was at one.  The breakpoint's status bits in DR6 are
+// cleared.  Must be called on the tracer thread.
+func (t *Tracee) hwBreakpointEvent(r Raw, ws syscall.WaitStatus) (Event, bool) {
+	if debugRegOffset < 0 {
+		return nil, false
+	}
+	dr6, err := peekDebugReg(r, 6)
+	if err != nil {
+		return nil, false
+	}
+	for i := 0; i < numHWBreakpoints; i++ {
+		if dr6&(1<<i) == 0 {
+			continue
+		}
+		addr, err := peekDebugReg(r, i)
+		if err != nil {
+			return nil, false
+		}
+		pokeDebugReg(r, 6, dr6&^0xf)
+		return HWBreakpointEvent{Status: ws, Addr: addr, Slot: i}, true
+	}
+	return nil, false
+}
+
+// Reads the debug register DRi from the tracee's user area.
+func peekDebugReg(r Raw, i int) (uint64, error) {
+	off, err := DebugRegOffset(i)
+	if err != nil {
+		return 0, err
+	}
+	v, err := r.PeekUser(off)
+	return uint64(v), err
+}
+
+// Writes the debug register DRi in the tracee's user area.
+func pokeDebugReg(r Raw, i int, v uint64) error {
+	off, err := DebugRegOffset(i)
+	if err != nil {
+		return err
+	}
+	return r.PokeUser(off, uintptr(v))
+}
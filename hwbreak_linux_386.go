@@ -0,0 +1,4 @@
+package ptrace
+
+// The offset of u_debugreg in struct user.
+const debugRegOffset = 252
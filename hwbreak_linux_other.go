@@ -0,0 +1,6 @@
+//go:build linux && !amd64 && !386
+
+package ptrace
+
+// There are no x86 debug registers.
+const debugRegOffset = -1
@@ -0,0 +1,205 @@
+package ptrace
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+var (
+	errInjectInterrupted = errors.New("ptrace: tracee stopped before the injected system call completed")
+	errAtSyscallStop     = fmt.Errorf("%w: in a system call", ErrNotStopped)
+)
+
+// InjectSyscall makes the system call nr with the given arguments in the
+// stopped tracee, on its behalf, and returns the raw return value; a
+// failed system call returns a negated errno, as with SyscallExitEvent.
+// The system call instruction is written over the code at the tracee's
+// program counter and single-stepped, and the code and registers are
+// restored afterwards, so the tracee is not otherwise affected.  No
+// events are sent for the stops of the injection.
+//
+// The tracee must not be at a system call stop, at which the kernel is
+// part way through one of the tracee's own system calls: resuming it,
+// even for a single step, would complete that system call rather than
+// run the injected one.  ErrNotStopped is returned at a system call
+// stop.
+//
+// If the tracee stops for another reason before the system call
+// completes, for example on delivery of a signal, the tracee is
+// restored, the stop is sent on the events channel as usual, and an
+// error is returned.  Otherwise, the tracee is left in the state that
+// it was in before.
+func (t *Tracee) InjectSyscall(nr int, args ...uintptr) (uintptr, error) {
+	u := make([]uint64, len(args))
+	for i, a := range args {
+		u[i] = uint64(a)
+	}
+	var ret uint64
+	err := t.run("inject", func() (err error) {
+		ret, err = t.injectSyscallStopped(nr, u)
+		return err
+	})
+	return uintptr(ret), err
+}
+
+// Returns an error unless the tracee is stopped where code can be run in
+// it: at any stop but a system call stop.
+func (t *Tracee) requireInjectable() error {
+	if err := t.requireStopped(); err != nil {
+		return err
+	}
+	if t.State() == SyscallStopped {
+		return errAtSyscallStop
+	}
+	return nil
+}
+
+// Makes the system call nr in the stopped tracee, as InjectSyscall, and
+// returns its raw return value.  Must be called on the tracer thread.
+func (t *Tracee) injectSyscallStopped(nr int, args []uint64) (uint64, error) {
+	if err := t.requireInjectable(); err != nil {
+		return 0, err
+	}
+	prev := t.State()
+	stops := make(chan syscall.WaitStatus, 1)
+	intercept := func(ws syscall.WaitStatus) bool {
+		// The send must not block the wait go routine if this
+		// command has already returned.
+		select {
+		case stops <- ws:
+		default:
+		}
+		return ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP
+	}
+	if !t.intercept.CompareAndSwap(nil, &intercept) {
+		return 0, errStopBusy
+	}
+	defer t.intercept.Store(nil)
+	ret, err := t.injectSyscall(nr, args, func() (syscall.WaitStatus, error) {
+		err := t.resume(Running, func() error { return ptraceSingleStep(t.proc.Pid) })
+		if err != nil {
+			return 0, err
+		}
+		select {
+		case ws := <-stops:
+			return ws, nil
+		case <-t.waitDone:
+			return 0, ErrTraceeExited
+		}
+	})
+	if err == nil {
+		// The stop of the step was consumed, and the tracee is back
+		// where it was.
+		t.state.Store(int32(prev))
+	}
+	return ret, err
+}
+
+// Makes the system call nr in the stopped tracee, and returns its raw
+// return value.  Step must single-step the tracee and return the wait
+// status of the resulting stop.  Must be called on the tracer thread.
+func (t *Tracee) injectSyscall(nr int, args []uint64, step func() (syscall.WaitStatus, error)) (uint64, error) {
+	r := Raw{t}
+	var saved syscall.PtraceRegs
+	if err := r.GetRegs(&saved); err != nil {
+		return 0, err
+	}
+	regs := saved
+	if err := setSyscallRegs(&regs, nr, args); err != nil {
+		return 0, err
+	}
+	pc := uintptr(saved.PC())
+	code := make([]byte, len(syscallInsn))
+	if _, err := r.PeekData(pc, code); err != nil {
+		return 0, err
+	}
+	if _, err := r.PokeData(pc, syscallInsn); err != nil {
+		return 0, err
+	}
+	if err := r.SetRegs(&regs); err != nil {
+		r.PokeData(pc, code)
+		return 0, err
+	}
+	ws, err := step()
+	switch {
+	case err != nil:
+		r.PokeData(pc, code)
+		r.SetRegs(&saved)
+		return 0, err
+	case ws.Exited() || ws.Signaled():
+		return 0, ErrTraceeExited
+	}
+	if err := r.GetRegs(&regs); err != nil {
+		return 0, err
+	}
+	if _, err := r.PokeData(pc, code); err != nil {
+		return 0, err
+	}
+	if err := r.SetRegs(&saved); err != nil {
+		return 0, err
+	}
+	if regs.PC() != saved.PC()+uint64(len(syscallInsn)) {
+		return 0, errInjectInterrupted
+	}
+	return syscallRet(&regs), nil
+}
+
+// Makes the system call nr in the stopped tracee, and returns its raw
+// return value.  Called on the wait go routine, which waits for the
+// step itself, before any event for the stop is sent.
+func (t *Tracee) injectSyscallFromWait(nr int, args ...uint64) (uint64, error) {
+	var ret uint64
+	err := t.runInternal("inject", func() (err error) {
+		ret, err = t.injectSyscall(nr, args, func() (syscall.WaitStatus, error) {
+			t.invalidateStop()
+			if err := ptraceSingleStep(t.proc.Pid); err != nil {
+				return 0, err
+			}
+			ws, err := waitPid(t.proc.Pid)
+			if err != nil {
+				return 0, err
+			}
+			if !ws.Stopped() {
+				t.state.Store(int32(Exited))
+			}
+			return ws, nil
+		})
+		return err
+	})
+	return ret, err
+}
+
+// Mmap maps size bytes of anonymous, private memory into the stopped
+// tracee with the given protection, a combination of syscall.PROT_READ,
+// PROT_WRITE, and PROT_EXEC, and returns the address of the mapping.
+// The memory can be used to stage code or data in the tracee; it is
+// zeroed, and it remains mapped until Munmap is called.
+func (t *Tracee) Mmap(size uintptr, prot int) (uintptr, error) {
+	// On 32-bit architectures, mmap takes its arguments in memory;
+	// mmap2 takes them in registers.
+	nr, ok := SyscallNumber("mmap2")
+	if !ok {
+		nr, _ = SyscallNumber("mmap")
+	}
+	ret, err := t.InjectSyscall(nr, 0, size, uintptr(prot),
+		syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS, ^uintptr(0), 0)
+	if err != nil {
+		return 0, err
+	}
+	if err := syscallErrno(uint64(int64(int(ret)))); err != nil {
+		return 0, t.opError("mmap", err)
+	}
+	return ret, nil
+}
+
+// Munmap unmaps size bytes of the stopped tracee's memory at addr, which
+// is usually a mapping returned by Mmap.
+func (t *Tracee) Munmap(addr, size uintptr) error {
+	nr, _ := SyscallNumber("munmap")
+	ret, err := t.InjectSyscall(nr, addr, size)
+	if err != nil {
+		return err
+	}
+	return t.opError("munmap", syscallErrno(uint64(int64(int(ret)))))
+}
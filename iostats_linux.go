@@ -0,0 +1,187 @@
+package ptrace
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FdStats are I/O statistics for a file descriptor, derived from the
+// tracee's system call stops.
+type FdStats struct {
+	Fd int
+	// Path is the target of the descriptor, as reported by
+	// /proc/pid/fd; for example "/etc/passwd" or "socket:[1234]".
+	Path string
+	// Reads and Writes are the number of read and write operations.
+	Reads, Writes uint64
+	// ReadBytes and WriteBytes are the number of bytes transferred.
+	ReadBytes, WriteBytes uint64
+	// Errors is the number of operations that failed.
+	Errors uint64
+	// Latency is the distribution of operation latencies, measured
+	// from system call entry to exit.
+	Latency Histogram
+}
+
+// A Histogram is a distribution of durations.  Bucket 0 counts durations
+// under 1µs, and bucket i > 0 counts durations of at least 2^(i-1)µs and
+// under 2^iµs.  The last bucket also counts all longer durations.
+type Histogram [32]uint64
+
+// Add adds a duration to the histogram.
+func (h *Histogram) Add(d time.Duration) {
+	i := 0
+	for us := d.Microseconds(); us > 0 && i < len(h)-1; us >>= 1 {
+		i++
+	}
+	h[i]++
+}
+
+// Count returns the number of durations in the histogram.
+func (h *Histogram) Count() uint64 {
+	var n uint64
+	for _, c := range h {
+		n += c
+	}
+	return n
+}
+
+// WithIOStats enables per-file-descriptor I/O statistics, collected from
+// the system call stops of a tracee resumed with Syscall.
+func WithIOStats() Option {
+	return func(t *Tracee) {
+		t.io = &ioStats{t: t, paths: make(map[int]string), stats: make(map[fdKey]*FdStats)}
+		t.observers = append(t.observers, t.io.observe)
+	}
+}
+
+// IOStats returns I/O statistics for each file descriptor used by the
+// tracee, or nil if WithIOStats was not given.  Descriptor numbers that
+// were reused for different files are reported separately.
+func (t *Tracee) IOStats() []FdStats {
+	if t.io == nil {
+		return nil
+	}
+	t.io.mu.Lock()
+	defer t.io.mu.Unlock()
+	stats := make([]FdStats, 0, len(t.io.stats))
+	for _, s := range t.io.stats {
+		stats = append(stats, *s)
+	}
+	return stats
+}
+
+// IOStats returns the I/O statistics of each tracee of the session that
+// was created WithIOStats, as by Tracee.IOStats, by process ID.  The
+// statistics of a tracee remain available once it has exited.
+func (s *Session) IOStats() map[int][]FdStats {
+	s.mu.Lock()
+	tracees := make([]*Tracee, 0, len(s.tracees))
+	for t := range s.tracees {
+		tracees = append(tracees, t)
+	}
+	s.mu.Unlock()
+	stats := make(map[int][]FdStats)
+	for _, t := range tracees {
+		if st := t.IOStats(); st != nil {
+			stats[t.proc.Pid] = append(stats[t.proc.Pid], st...)
+		}
+	}
+	return stats
+}
+
+type fdKey struct {
+	fd   int
+	path string
+}
+
+type ioStats struct {
+	t *Tracee
+
+	mu sync.Mutex
+	// Paths caches the targets of the tracee's descriptors.
+	paths map[int]string
+	stats map[fdKey]*FdStats
+	// Enter is the pending system call entry.
+	enter SyscallEnterEvent
+}
+
+// The kind of I/O performed by system calls, indexed by name.
+var ioKinds = map[string]int{
+	"read": ioRead, "readv": ioRead, "pread64": ioRead, "preadv": ioRead,
+	"preadv2": ioRead, "recvfrom": ioRead, "recvmsg": ioRead,
+	"write": ioWrite, "writev": ioWrite, "pwrite64": ioWrite, "pwritev": ioWrite,
+	"pwritev2": ioWrite, "sendto": ioWrite, "sendmsg": ioWrite, "sendfile": ioWrite,
+	"sendfile64": ioWrite,
+}
+
+const (
+	ioNone = iota
+	ioRead
+	ioWrite
+)
+
+func (s *ioStats) observe(ev Event) {
+	switch ev := ev.(type) {
+	case ExecEvent:
+		s.mu.Lock()
+		clear(s.paths)
+		s.mu.Unlock()
+	case SyscallEnterEvent:
+		s.enter = ev
+	case SyscallExitEvent:
+		if ev.Nr < 0 || ev.Nr != s.enter.Nr {
+			return
+		}
+		s.exit(s.enter, ev)
+	}
+}
+
+func (s *ioStats) exit(enter SyscallEnterEvent, exit SyscallExitEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := enter.Name()
+	switch name {
+	case "close":
+		delete(s.paths, int(enter.Args[0]))
+		return
+	case "dup2", "dup3":
+		delete(s.paths, int(enter.Args[1]))
+		return
+	}
+	kind := ioKinds[name]
+	if kind == ioNone {
+		return
+	}
+	fd := int(enter.Args[0])
+	path, ok := s.paths[fd]
+	if !ok {
+		path, _ = os.Readlink("/proc/" + strconv.Itoa(s.t.proc.Pid) + "/fd/" + strconv.Itoa(fd))
+		s.paths[fd] = path
+	}
+	k := fdKey{fd: fd, path: path}
+	st := s.stats[k]
+	if st == nil {
+		st = &FdStats{Fd: fd, Path: path}
+		s.stats[k] = st
+	}
+	st.Latency.Add(exit.Time.Sub(enter.Time))
+	failed := exit.Errno != 0
+	if failed {
+		st.Errors++
+	}
+	switch kind {
+	case ioRead:
+		st.Reads++
+		if !failed {
+			st.ReadBytes += uint64(exit.Ret)
+		}
+	case ioWrite:
+		st.Writes++
+		if !failed {
+			st.WriteBytes += uint64(exit.Ret)
+		}
+	}
+}
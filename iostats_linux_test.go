@@ -0,0 +1,28 @@
+package ptrace
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSessionIOStats(t *testing.T) {
+	s := NewSession(10)
+	counted := fakeTracee(1)
+	counted.io = &ioStats{t: counted, stats: map[fdKey]*FdStats{
+		{fd: 3, path: "/etc/passwd"}: {Fd: 3, Path: "/etc/passwd", Reads: 2, ReadBytes: 100},
+	}}
+	uncounted := fakeTracee(2)
+	silent := fakeTracee(3)
+	silent.io = &ioStats{t: silent, stats: map[fdKey]*FdStats{
+		{fd: 1, path: "pipe:[1]"}: {Fd: 1, Path: "pipe:[1]", Writes: 1},
+	}}
+	s.observe(counted, 0)
+	s.observe(uncounted, 0)
+
+	want := map[int][]FdStats{
+		1: {{Fd: 3, Path: "/etc/passwd", Reads: 2, ReadBytes: 100}},
+	}
+	if got := s.IOStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package ptrace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// TraceInstructions single-steps the stopped tracee up to limit times,
+// as StepN does, and writes the program counter after each step to w,
+// returning the number of steps completed.  The trace is written in a
+// compact binary format, read by InstructionTraceReader: the first
+// program counter is an unsigned varint, and each following one is a
+// signed varint of its difference from the previous one, so that
+// straight-line code takes a byte per instruction.
+//
+// Stepping ends early, as with StepN, if the tracee stops for another
+// reason, or if writing to w fails, in which case the write error is
+// returned.
+func (t *Tracee) TraceInstructions(w io.Writer, limit uint64) (uint64, error) {
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+	var prev uint64
+	var werr error
+	first := true
+	n, err := t.StepUntil(limit, func(pc uint64) bool {
+		var m int
+		if first {
+			m = binary.PutUvarint(buf[:], pc)
+			first = false
+		} else {
+			m = binary.PutVarint(buf[:], int64(pc-prev))
+		}
+		prev = pc
+		_, werr = bw.Write(buf[:m])
+		return werr != nil
+	})
+	if werr == nil {
+		werr = bw.Flush()
+	}
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// An InstructionTraceReader reads the program counters of a trace
+// written by TraceInstructions.
+type InstructionTraceReader struct {
+	r     *bufio.Reader
+	prev  uint64
+	first bool
+}
+
+// NewInstructionTraceReader returns a reader of the trace in r.
+func NewInstructionTraceReader(r io.Reader) *InstructionTraceReader {
+	return &InstructionTraceReader{r: bufio.NewReader(r), first: true}
+}
+
+// Next returns the next program counter of the trace, or io.EOF at its
+// end.
+func (tr *InstructionTraceReader) Next() (uint64, error) {
+	if tr.first {
+		pc, err := binary.ReadUvarint(tr.r)
+		if err != nil {
+			return 0, err
+		}
+		tr.first = false
+		tr.prev = pc
+		return pc, nil
+	}
+	d, err := binary.ReadVarint(tr.r)
+	if err != nil {
+		return 0, err
+	}
+	tr.prev += uint64(d)
+	return tr.prev, nil
+}
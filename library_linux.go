@@ -0,0 +1,230 @@
+package ptrace
+
+import (
+	"debug/elf"
+	"errors"
+	"syscall"
+)
+
+var (
+	errNoDynamic    = errors.New("ptrace: executable is not dynamically linked")
+	errNoRDebug     = errors.New("ptrace: dynamic loader has not initialized r_debug")
+	errNoSymbol     = errors.New("ptrace: symbol not found in loaded objects")
+	errDlopenFailed = errors.New("ptrace: dlopen failed in the tracee")
+)
+
+// A Library is a shared object loaded in the tracee.
+type Library struct {
+	// Path is the path of the object, as recorded by the dynamic
+	// loader.
+	Path string `json:"path"`
+	// Base is the difference between the object's run-time and
+	// link-time addresses, which for shared objects is the address
+	// at which it is loaded.
+	Base uint64 `json:"base"`
+}
+
+// A LibraryLoadEvent is sent, with WithLibraryEvents, when the dynamic
+// loader has loaded shared objects into the tracee.  The tracee is not
+// stopped for the event.
+type LibraryLoadEvent struct {
+	Libraries []Library `json:"libraries"`
+}
+
+// A LibraryUnloadEvent is sent, with WithLibraryEvents, when the
+// dynamic loader has unloaded shared objects from the tracee.  The
+// tracee is not stopped for the event.
+type LibraryUnloadEvent struct {
+	Libraries []Library `json:"libraries"`
+}
+
+// Libraries returns the shared objects loaded in the stopped tracee, in
+// load order, from the dynamic loader's link_map list.  It returns an
+// error for a statically linked tracee, and at the initial stop, before
+// the dynamic loader has run.
+func (t *Tracee) Libraries() ([]Library, error) {
+	lms, err := t.linkMaps()
+	if err != nil {
+		return nil, err
+	}
+	var libs []Library
+	for _, l := range lms {
+		if l.Path != "" {
+			libs = append(libs, l)
+		}
+	}
+	return libs, nil
+}
+
+// Returns the address of the dynamic loader's struct r_debug, from the
+// DT_DEBUG entry of the executable's dynamic section.
+func (t *Tracee) rDebug(r Raw, info *debugInfo) (uint64, error) {
+	var dyn uint64
+	for _, p := range info.elf.Progs {
+		if p.Type == elf.PT_DYNAMIC {
+			dyn = p.Vaddr + info.bias
+			break
+		}
+	}
+	if dyn == 0 {
+		return 0, errNoDynamic
+	}
+	for ; ; dyn += 2 * ptrSize {
+		tag, err := readPtr(r, dyn)
+		if err != nil {
+			return 0, err
+		}
+		switch elf.DynTag(tag) {
+		case elf.DT_NULL:
+			return 0, errNoDynamic
+		case elf.DT_DEBUG:
+			addr, err := readPtr(r, dyn+ptrSize)
+			if err == nil && addr == 0 {
+				err = errNoRDebug
+			}
+			return addr, err
+		}
+	}
+}
+
+// Returns the tracee's loaded objects, in load order, by walking the
+// link_map list of the dynamic loader.  The first is usually the
+// executable, whose path is empty.
+func (t *Tracee) linkMaps() ([]Library, error) {
+	info, err := t.debugInfo()
+	if err != nil {
+		return nil, err
+	}
+	var libs []Library
+	err = t.Do(func(r Raw) (err error) {
+		libs, err = t.readLinkMaps(r, info)
+		return err
+	})
+	return libs, err
+}
+
+func (t *Tracee) readLinkMaps(r Raw, info *debugInfo) ([]Library, error) {
+	rdebug, err := t.rDebug(r, info)
+	if err != nil {
+		return nil, err
+	}
+	var libs []Library
+	// The r_map field follows the int r_version, which is padded to
+	// the size of a pointer.  Each link_map begins with l_addr,
+	// l_name, l_ld, and l_next.
+	lm, err := readPtr(r, rdebug+ptrSize)
+	for ; err == nil && lm != 0; lm, err = readPtr(r, lm+3*ptrSize) {
+		var l Library
+		if l.Base, err = readPtr(r, lm); err != nil {
+			return nil, err
+		}
+		name, err := readPtr(r, lm+ptrSize)
+		if err != nil {
+			return nil, err
+		}
+		if l.Path, err = readString(r, name); err != nil {
+			return nil, err
+		}
+		libs = append(libs, l)
+	}
+	return libs, err
+}
+
+// Returns the run-time address of the first definition of the named
+// dynamic symbol among the tracee's loaded shared objects.
+func (t *Tracee) lookupSymbol(name string) (uint64, error) {
+	lms, err := t.linkMaps()
+	if err != nil {
+		return 0, err
+	}
+	for _, l := range lms {
+		if l.Path == "" {
+			continue
+		}
+		f, err := elf.Open(l.Path)
+		if err != nil {
+			continue
+		}
+		syms, _ := f.DynamicSymbols()
+		f.Close()
+		for _, s := range syms {
+			if s.Name == name && s.Section != elf.SHN_UNDEF && s.Value != 0 {
+				return s.Value + l.Base, nil
+			}
+		}
+	}
+	return 0, errNoSymbol
+}
+
+// InjectLibrary loads the shared library at path into the stopped
+// tracee by calling dlopen in it, as with CallFunction, and returns the
+// handle returned by dlopen.  The path is interpreted by the tracee.
+// The tracee must be dynamically linked, and its dynamic loader must
+// have finished loading the libraries that provide dlopen, so
+// InjectLibrary fails at the initial stop of Exec.
+func (t *Tracee) InjectLibrary(path string) (uintptr, error) {
+	dlopen, err := t.lookupSymbol("dlopen")
+	if err != nil {
+		return 0, err
+	}
+	size := uintptr(len(path) + 1)
+	addr, err := t.Mmap(size, syscall.PROT_READ|syscall.PROT_WRITE)
+	if err != nil {
+		return 0, err
+	}
+	defer t.Munmap(addr, size)
+	if _, err := t.PokeData(addr, append([]byte(path), 0)); err != nil {
+		return 0, err
+	}
+	const rtldNow = 2
+	h, err := t.CallFunction(uintptr(dlopen), []uint64{uint64(addr), rtldNow})
+	if err != nil {
+		return 0, err
+	}
+	if h == 0 {
+		return 0, errDlopenFailed
+	}
+	return uintptr(h), nil
+}
+
+// Reads a pointer from the tracee.
+func readPtr(r Raw, addr uint64) (uint64, error) {
+	return r.ReadPointer(addr)
+}
+
+// The maximum length of a string read by readString.
+const maxStringSize = 4096
+
+// Reads a NUL-terminated string from the tracee, a word at a time, so
+// that the read does not cross into an unmapped page.
+func readString(r Raw, addr uint64) (string, error) {
+	return readStringLimit(r, addr, maxStringSize)
+}
+
+// Reads a NUL-terminated string from the tracee, as readString, of at
+// most max bytes.
+func readStringLimit(r Raw, addr uint64, max int) (string, error) {
+	if addr == 0 {
+		return "", nil
+	}
+	var s []byte
+	var b [ptrSize]byte
+	for len(s) < max {
+		// Align the first read, so that no word spans pages.
+		start := addr &^ (ptrSize - 1)
+		if _, err := r.PeekData(uintptr(start), b[:]); err != nil {
+			return "", err
+		}
+		for _, c := range b[addr-start:] {
+			if c == 0 {
+				return string(s), nil
+			}
+			s = append(s, c)
+		}
+		addr = start + ptrSize
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return string(s), nil
+}
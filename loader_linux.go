@@ -0,0 +1,212 @@
+package ptrace
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// WithLibraryEvents sends a LibraryLoadEvent or LibraryUnloadEvent
+// whenever the dynamic loader of the tracee finishes loading or
+// unloading shared objects, including the libraries loaded at startup.
+// The events are detected with a breakpoint on the loader's debug hook,
+// _dl_debug_state, which is stepped over transparently; the tracee is
+// resumed as it was before it reached the breakpoint.  Statically linked
+// tracees send no events.
+//
+// Libraries loaded or unloaded by a function called with CallFunction,
+// as by InjectLibrary, are reported only if the events channel has room
+// when the call reaches the hook; otherwise, they are reported with the
+// next change.
+func WithLibraryEvents() Option {
+	return func(t *Tracee) {
+		if t.libs == nil {
+			t.libs = &loaderHook{}
+		}
+		t.libs.events = true
+	}
+}
+
+// Tracks the libraries loaded by the dynamic loader, with a breakpoint
+// on its debug hook.  Only accessed on the tracer thread.
+type loaderHook struct {
+	// Known are the libraries loaded at the last consistent state.
+	known []Library
+	// Events is whether to send library events.
+	events bool
+	// Loaded, if non-nil, is called with each newly loaded library.
+	loaded func(Raw, Library)
+}
+
+// The auxiliary vector entry with the loader's base address.
+const atBase = 7
+
+// The r_state of a consistent link_map list in struct r_debug.
+const rtConsistent = 0
+
+// Sets the breakpoint on the debug hook of the dynamic loader of a new
+// program image, and forgets the libraries of the old one.  Called on
+// the wait go routine, at the initial stop and at each exec, once the
+// breakpoints of the old image are forgotten.
+func (t *Tracee) setLoaderHook() error {
+	if breakpointInsn == nil {
+		return errUnsupportedArch
+	}
+	dir := "/proc/" + strconv.Itoa(t.proc.Pid)
+	base, err := auxv(dir+"/auxv", atBase)
+	if err != nil || base == 0 {
+		// There is no dynamic loader.
+		return err
+	}
+	interp, err := interpreter(dir + "/exe")
+	if err != nil {
+		return err
+	}
+	f, err := elf.Open(interp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	syms, _ := f.DynamicSymbols()
+	if s, err := f.Symbols(); err == nil {
+		syms = append(syms, s...)
+	}
+	var addr uint64
+	for _, s := range syms {
+		if s.Name == "_dl_debug_state" && s.Value != 0 {
+			addr = base + s.Value
+			break
+		}
+	}
+	if addr == 0 {
+		return errNoSymbol
+	}
+	return t.doInternal(func(r Raw) error {
+		t.libs.known = nil
+		return t.setBreakpoint(r, &breakpoint{
+			addr: addr,
+			hit: func(r Raw, _ *syscall.PtraceRegs) ([]Event, bool) {
+				return t.libraryEvents(r), true
+			},
+		})
+	})
+}
+
+// Returns the library events for the link_map list, if it is in a
+// consistent state, and records its libraries as known.  Must be called
+// on the tracer thread.
+func (t *Tracee) libraryEvents(r Raw) []Event {
+	info, err := t.debugInfo()
+	if err != nil {
+		return nil
+	}
+	rdebug, err := t.rDebug(r, info)
+	if err != nil {
+		return nil
+	}
+	// The r_state field follows r_version, r_map, and r_brk.
+	if state, err := readPtr(r, rdebug+3*ptrSize); err != nil || uint32(state) != rtConsistent {
+		return nil
+	}
+	lms, err := t.readLinkMaps(r, info)
+	if err != nil {
+		return nil
+	}
+	var libs []Library
+	for _, l := range lms {
+		if l.Path != "" {
+			libs = append(libs, l)
+		}
+	}
+	loaded, unloaded := diffLibraries(t.libs.known, libs)
+	t.libs.known = libs
+	for _, l := range unloaded {
+		t.forgetBreakpoints(l.Path)
+	}
+	if t.libs.loaded != nil {
+		for _, l := range loaded {
+			t.libs.loaded(r, l)
+		}
+	}
+	if !t.libs.events {
+		return nil
+	}
+	var evs []Event
+	if len(unloaded) > 0 {
+		evs = append(evs, LibraryUnloadEvent{Libraries: unloaded})
+	}
+	if len(loaded) > 0 {
+		evs = append(evs, LibraryLoadEvent{Libraries: loaded})
+	}
+	return evs
+}
+
+// Returns the libraries in cur but not in old, and those in old but not
+// in cur.
+func diffLibraries(old, cur []Library) (added, removed []Library) {
+	in := func(l Library, ls []Library) bool {
+		for _, m := range ls {
+			if m == l {
+				return true
+			}
+		}
+		return false
+	}
+	for _, l := range cur {
+		if !in(l, old) {
+			added = append(added, l)
+		}
+	}
+	for _, l := range old {
+		if !in(l, cur) {
+			removed = append(removed, l)
+		}
+	}
+	return added, removed
+}
+
+// Returns the value of an entry of an auxiliary vector file, or 0 if
+// there is no such entry.
+func auxv(path string, tag uint64) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for ; len(b) >= int(2*ptrSize); b = b[2*ptrSize:] {
+		var k, v uint64
+		if ptrSize == 4 {
+			k = uint64(binary.NativeEndian.Uint32(b))
+			v = uint64(binary.NativeEndian.Uint32(b[4:]))
+		} else {
+			k = binary.NativeEndian.Uint64(b)
+			v = binary.NativeEndian.Uint64(b[8:])
+		}
+		if k == tag {
+			return v, nil
+		}
+	}
+	return 0, nil
+}
+
+// Returns the path of the program interpreter of an executable.
+func interpreter(exe string) (string, error) {
+	f, err := elf.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		b := make([]byte, p.Filesz)
+		if _, err := p.ReadAt(b, 0); err != nil {
+			return "", err
+		}
+		return string(bytes.TrimRight(b, "\x00")), nil
+	}
+	return "", errNoDynamic
+}
@@ -0,0 +1,156 @@
+package ptrace
+
+import (
+	"debug/elf"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// A LibraryCallEvent is sent, with WithLibraryCalls, when the tracee
+// calls a traced library function.  The tracee is not stopped for the
+// event.
+type LibraryCallEvent struct {
+	// Time is when the call was observed.
+	Time time.Time `json:"time"`
+	// Library is the path of the shared object defining the function.
+	Library string `json:"library"`
+	// Function is the name of the function.
+	Function string `json:"function"`
+	// Addr is the address of the function.
+	Addr uint64 `json:"addr"`
+	// Args are the integer argument registers at the call, in the
+	// order of the platform's C calling convention.
+	Args []uint64 `json:"args"`
+	// Decoded are the arguments formatted according to the function's
+	// prototype, if it is known; string arguments are read from the
+	// tracee.  Otherwise, Decoded is nil.
+	Decoded []string `json:"decoded"`
+}
+
+// WithLibraryCalls sends a LibraryCallEvent each time the tracee calls
+// one of the named functions of a shared library, as ltrace does.  A
+// breakpoint is set on each definition of the functions as the dynamic
+// loader loads the libraries that define them, including the libraries
+// loaded at startup, and the tracee is resumed as it was before it
+// reached the breakpoint.  Calls within a library that do not go through
+// its dynamic symbol, and calls in statically linked tracees, are not
+// reported.
+func WithLibraryCalls(funcs ...string) Option {
+	return func(t *Tracee) {
+		if t.libs == nil {
+			t.libs = &loaderHook{}
+		}
+		names := make(map[string]bool, len(funcs))
+		for _, f := range funcs {
+			names[f] = true
+		}
+		t.libs.loaded = func(r Raw, l Library) { t.traceLibraryCalls(r, l, names) }
+	}
+}
+
+// Sets breakpoints on the named functions defined by a newly loaded
+// library.  Must be called on the tracer thread.
+func (t *Tracee) traceLibraryCalls(r Raw, l Library, names map[string]bool) {
+	f, err := elf.Open(l.Path)
+	if err != nil {
+		return
+	}
+	syms, _ := f.DynamicSymbols()
+	f.Close()
+	for _, s := range syms {
+		if !names[s.Name] || s.Section == elf.SHN_UNDEF || s.Value == 0 || elf.ST_TYPE(s.Info) != elf.STT_FUNC {
+			continue
+		}
+		addr, lib, name := l.Base+s.Value, l.Path, s.Name
+		t.setBreakpoint(r, &breakpoint{
+			addr: addr,
+			lib:  lib,
+			hit: func(r Raw, regs *syscall.PtraceRegs) ([]Event, bool) {
+				args := entryArgRegs(regs)
+				return []Event{LibraryCallEvent{
+					Time:     time.Now(),
+					Library:  lib,
+					Function: name,
+					Addr:     addr,
+					Args:     args,
+					Decoded:  decodeLibraryArgs(r, name, args),
+				}}, true
+			},
+		})
+	}
+}
+
+// The argument kinds of library function prototypes: s is a string, d
+// is a signed integer, u is an unsigned integer, and p is a pointer.
+var libraryPrototypes = map[string]string{
+	"malloc":    "u",
+	"calloc":    "uu",
+	"realloc":   "pu",
+	"free":      "p",
+	"strlen":    "s",
+	"strdup":    "s",
+	"strcmp":    "ss",
+	"strncmp":   "ssu",
+	"strcpy":    "ps",
+	"strcat":    "ps",
+	"strchr":    "sd",
+	"strstr":    "ss",
+	"memcpy":    "ppu",
+	"memset":    "pdu",
+	"puts":      "s",
+	"printf":    "s",
+	"fopen":     "ss",
+	"fclose":    "p",
+	"open":      "sd",
+	"close":     "d",
+	"read":      "dpu",
+	"write":     "dpu",
+	"getenv":    "s",
+	"setenv":    "ssd",
+	"unlink":    "s",
+	"mkdir":     "sd",
+	"chdir":     "s",
+	"dlopen":    "sd",
+	"dlsym":     "ps",
+	"exit":      "d",
+	"sleep":     "u",
+	"atoi":      "s",
+	"strtol":    "spd",
+	"system":    "s",
+	"execve":    "spp",
+	"execvp":    "sp",
+	"socket":    "ddd",
+	"connect":   "dpu",
+	"setlocale": "ds",
+}
+
+// Returns the arguments of a call to the named library function,
+// formatted according to its prototype, or nil if it is unknown.
+func decodeLibraryArgs(r Raw, name string, args []uint64) []string {
+	proto, ok := libraryPrototypes[name]
+	if !ok || len(proto) > len(args) {
+		return nil
+	}
+	dec := make([]string, len(proto))
+	for i, k := range proto {
+		a := args[i]
+		switch k {
+		case 's':
+			if a == 0 {
+				dec[i] = "NULL"
+			} else if s, err := readString(r, a); err != nil {
+				dec[i] = "0x" + strconv.FormatUint(a, 16)
+			} else {
+				dec[i] = strconv.Quote(s)
+			}
+		case 'd':
+			dec[i] = strconv.Itoa(int(int32(a)))
+		case 'u':
+			dec[i] = strconv.FormatUint(a, 10)
+		default:
+			dec[i] = "0x" + strconv.FormatUint(a, 16)
+		}
+	}
+	return dec
+}
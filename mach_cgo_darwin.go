@@ -0,0 +1,292 @@
+//go:build cgo
+
+package ptrace
+
+/*
+#include <mach/mach.h>
+#include <mach/mach_error.h>
+#include <mach/mach_vm.h>
+#include <mach/ndr.h>
+#include <string.h>
+
+#if defined(__x86_64__)
+#define PTRACE_STATE_FLAVOR x86_THREAD_STATE64
+#define PTRACE_STATE_COUNT x86_THREAD_STATE64_COUNT
+#elif defined(__arm64__)
+#define PTRACE_STATE_FLAVOR ARM_THREAD_STATE64
+#define PTRACE_STATE_COUNT ARM_THREAD_STATE64_COUNT
+#endif
+
+// The exceptions that are reported.  EXC_SOFTWARE is not, since the
+// tracer receives signals from wait.
+#define PTRACE_EXC_MASK (EXC_MASK_BAD_ACCESS | EXC_MASK_BAD_INSTRUCTION | \
+	EXC_MASK_ARITHMETIC | EXC_MASK_BREAKPOINT)
+
+// The ID of a mach_exception_raw request, from <mach/mach_exc.defs>.
+#define PTRACE_EXC_RAW_ID 2405
+
+static kern_return_t ptrace_task_for_pid(int pid, task_t *task) {
+	return task_for_pid(mach_task_self(), pid, task);
+}
+
+static void ptrace_release(mach_port_t port) {
+	mach_port_deallocate(mach_task_self(), port);
+}
+
+static kern_return_t ptrace_vm_read(task_t task, mach_vm_address_t addr, void *out, mach_vm_size_t n) {
+	mach_vm_size_t got = 0;
+	kern_return_t kr = mach_vm_read_overwrite(task, addr, n, (mach_vm_address_t)out, &got);
+	if (kr == KERN_SUCCESS && got != n) {
+		kr = KERN_INVALID_ADDRESS;
+	}
+	return kr;
+}
+
+// Writes to the task's memory.  Memory that is not writable is made
+// writable, copied on write, and its protection restored afterward.
+static kern_return_t ptrace_vm_write(task_t task, mach_vm_address_t addr, void *data, mach_msg_type_number_t n) {
+	kern_return_t kr = mach_vm_write(task, addr, (vm_offset_t)data, n);
+	if (kr != KERN_PROTECTION_FAILURE) {
+		return kr;
+	}
+	mach_vm_address_t region = addr;
+	mach_vm_size_t size = 0;
+	vm_region_basic_info_data_64_t info;
+	mach_msg_type_number_t count = VM_REGION_BASIC_INFO_COUNT_64;
+	mach_port_t object = MACH_PORT_NULL;
+	kr = mach_vm_region(task, &region, &size, VM_REGION_BASIC_INFO_64,
+		(vm_region_info_t)&info, &count, &object);
+	if (kr != KERN_SUCCESS) {
+		return kr;
+	}
+	if (region > addr || addr + n > region + size) {
+		return KERN_PROTECTION_FAILURE;
+	}
+	kr = mach_vm_protect(task, addr, n, FALSE, VM_PROT_READ | VM_PROT_WRITE | VM_PROT_COPY);
+	if (kr != KERN_SUCCESS) {
+		return kr;
+	}
+	kr = mach_vm_write(task, addr, (vm_offset_t)data, n);
+	kern_return_t restore = mach_vm_protect(task, addr, n, FALSE, info.protection);
+	return kr != KERN_SUCCESS ? kr : restore;
+}
+
+// Returns the task's main thread, its first.
+static kern_return_t ptrace_main_thread(task_t task, thread_act_t *thread) {
+	thread_act_array_t threads;
+	mach_msg_type_number_t n;
+	kern_return_t kr = task_threads(task, &threads, &n);
+	if (kr != KERN_SUCCESS) {
+		return kr;
+	}
+	if (n == 0) {
+		kr = KERN_FAILURE;
+	} else {
+		*thread = threads[0];
+	}
+	for (mach_msg_type_number_t i = 1; i < n; i++) {
+		mach_port_deallocate(mach_task_self(), threads[i]);
+	}
+	vm_deallocate(mach_task_self(), (vm_address_t)threads, n * sizeof threads[0]);
+	return kr;
+}
+
+static kern_return_t ptrace_get_state(task_t task, void *state) {
+	thread_act_t thread;
+	kern_return_t kr = ptrace_main_thread(task, &thread);
+	if (kr != KERN_SUCCESS) {
+		return kr;
+	}
+	mach_msg_type_number_t count = PTRACE_STATE_COUNT;
+	kr = thread_get_state(thread, PTRACE_STATE_FLAVOR, (thread_state_t)state, &count);
+	mach_port_deallocate(mach_task_self(), thread);
+	return kr;
+}
+
+static kern_return_t ptrace_set_state(task_t task, void *state) {
+	thread_act_t thread;
+	kern_return_t kr = ptrace_main_thread(task, &thread);
+	if (kr != KERN_SUCCESS) {
+		return kr;
+	}
+	kr = thread_set_state(thread, PTRACE_STATE_FLAVOR, (thread_state_t)state, PTRACE_STATE_COUNT);
+	mach_port_deallocate(mach_task_self(), thread);
+	return kr;
+}
+
+// Allocates a port, and sets it as the task's exception port.
+static kern_return_t ptrace_exception_port(task_t task, mach_port_t *port) {
+	kern_return_t kr = mach_port_allocate(mach_task_self(), MACH_PORT_RIGHT_RECEIVE, port);
+	if (kr != KERN_SUCCESS) {
+		return kr;
+	}
+	kr = mach_port_insert_right(mach_task_self(), *port, *port, MACH_MSG_TYPE_MAKE_SEND);
+	if (kr == KERN_SUCCESS) {
+		kr = task_set_exception_ports(task, PTRACE_EXC_MASK, *port,
+			EXCEPTION_DEFAULT | MACH_EXCEPTION_CODES, THREAD_STATE_NONE);
+	}
+	if (kr != KERN_SUCCESS) {
+		mach_port_destroy(mach_task_self(), *port);
+	}
+	return kr;
+}
+
+static void ptrace_destroy_port(mach_port_t port) {
+	mach_port_destroy(mach_task_self(), port);
+}
+
+#pragma pack(push, 4)
+typedef struct {
+	mach_msg_header_t head;
+	mach_msg_body_t body;
+	mach_msg_port_descriptor_t thread;
+	mach_msg_port_descriptor_t task;
+	NDR_record_t ndr;
+	exception_type_t exception;
+	mach_msg_type_number_t code_count;
+	int64_t code[2];
+} ptrace_exc_request;
+
+typedef struct {
+	mach_msg_header_t head;
+	NDR_record_t ndr;
+	kern_return_t ret;
+} ptrace_exc_reply;
+#pragma pack(pop)
+
+typedef struct {
+	int exception;
+	int64_t code[2];
+	uint64_t thread;
+} ptrace_exception;
+
+// Receives a message on the exception port, waiting up to timeout
+// milliseconds, and declines it, so that the kernel delivers the
+// exception as a signal.  Sets exc->exception to 0 if the message was
+// not an exception.
+static kern_return_t ptrace_receive_exception(mach_port_t port, int timeout, ptrace_exception *exc) {
+	union {
+		ptrace_exc_request req;
+		char buf[1024];
+	} msg;
+	kern_return_t kr = mach_msg(&msg.req.head, MACH_RCV_MSG | MACH_RCV_TIMEOUT, 0, sizeof msg,
+		port, timeout, MACH_PORT_NULL);
+	if (kr != MACH_MSG_SUCCESS) {
+		return kr;
+	}
+	ptrace_exc_request *req = &msg.req;
+	exc->exception = 0;
+	if (req->head.msgh_id == PTRACE_EXC_RAW_ID) {
+		exc->exception = req->exception;
+		exc->code[0] = req->code_count > 0 ? req->code[0] : 0;
+		exc->code[1] = req->code_count > 1 ? req->code[1] : 0;
+		thread_identifier_info_data_t info;
+		mach_msg_type_number_t count = THREAD_IDENTIFIER_INFO_COUNT;
+		exc->thread = 0;
+		if (thread_info(req->thread.name, THREAD_IDENTIFIER_INFO, (thread_info_t)&info, &count) == KERN_SUCCESS) {
+			exc->thread = info.thread_id;
+		}
+		mach_port_deallocate(mach_task_self(), req->thread.name);
+		mach_port_deallocate(mach_task_self(), req->task.name);
+	}
+	ptrace_exc_reply reply;
+	memset(&reply, 0, sizeof reply);
+	reply.head.msgh_bits = MACH_MSGH_BITS(MACH_MSGH_BITS_REMOTE(req->head.msgh_bits), 0);
+	reply.head.msgh_size = sizeof reply;
+	reply.head.msgh_remote_port = req->head.msgh_remote_port;
+	reply.head.msgh_local_port = MACH_PORT_NULL;
+	reply.head.msgh_id = req->head.msgh_id + 100;
+	reply.ndr = NDR_record;
+	reply.ret = KERN_FAILURE;
+	return mach_msg(&reply.head, MACH_SEND_MSG, sizeof reply, 0, MACH_PORT_NULL,
+		MACH_MSG_TIMEOUT_NONE, MACH_PORT_NULL);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Returns an error for a failed Mach call, or nil if kr is
+// KERN_SUCCESS.
+func machError(op string, kr C.kern_return_t) error {
+	if kr == C.KERN_SUCCESS {
+		return nil
+	}
+	return fmt.Errorf("ptrace: %s: %s (%#x)", op, C.GoString(C.mach_error_string(C.mach_error_t(kr))), int(kr))
+}
+
+// Returns the task port of the process.  The kernel refuses it, with
+// KERN_FAILURE, to tracers without the debugging entitlement.
+func taskForPid(pid int) (machTask, error) {
+	var task C.task_t
+	switch kr := C.ptrace_task_for_pid(C.int(pid), &task); kr {
+	case C.KERN_SUCCESS:
+		return machTask(task), nil
+	case C.KERN_FAILURE:
+		return 0, fmt.Errorf("%w: %w", ErrEntitlement, machError("task_for_pid", kr))
+	default:
+		return 0, machError("task_for_pid", kr)
+	}
+}
+
+func releaseTask(task machTask) {
+	C.ptrace_release(C.mach_port_t(task))
+}
+
+func machVMRead(task machTask, addr uintptr, out []byte) error {
+	if len(out) == 0 {
+		return nil
+	}
+	kr := C.ptrace_vm_read(C.task_t(task), C.mach_vm_address_t(addr), unsafe.Pointer(&out[0]), C.mach_vm_size_t(len(out)))
+	return machError("mach_vm_read", kr)
+}
+
+func machWrite(task machTask, addr uintptr, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	kr := C.ptrace_vm_write(C.task_t(task), C.mach_vm_address_t(addr), unsafe.Pointer(&data[0]), C.mach_msg_type_number_t(len(data)))
+	return machError("mach_vm_write", kr)
+}
+
+func getThreadState(task machTask, regs *Regs) error {
+	return machError("thread_get_state", C.ptrace_get_state(C.task_t(task), unsafe.Pointer(regs)))
+}
+
+func setThreadState(task machTask, regs *Regs) error {
+	return machError("thread_set_state", C.ptrace_set_state(C.task_t(task), unsafe.Pointer(regs)))
+}
+
+func newExceptionPort(task machTask) (machPort, error) {
+	var port C.mach_port_t
+	if err := machError("task_set_exception_ports", C.ptrace_exception_port(C.task_t(task), &port)); err != nil {
+		return 0, err
+	}
+	return machPort(port), nil
+}
+
+// Receives an exception on the port, waiting up to timeout milliseconds,
+// and returns its event, and whether there was one.
+func receiveException(port machPort, timeout int) (MachExceptionEvent, bool, error) {
+	var exc C.ptrace_exception
+	switch kr := C.ptrace_receive_exception(C.mach_port_t(port), C.int(timeout), &exc); {
+	case kr == C.MACH_RCV_TIMED_OUT:
+		return MachExceptionEvent{}, false, nil
+	case kr != C.KERN_SUCCESS:
+		return MachExceptionEvent{}, false, machError("mach_msg", kr)
+	case exc.exception == 0:
+		return MachExceptionEvent{}, false, nil
+	}
+	return MachExceptionEvent{
+		Thread:    uint64(exc.thread),
+		Exception: MachException(exc.exception),
+		Codes:     [2]int64{int64(exc.code[0]), int64(exc.code[1])},
+	}, true, nil
+}
+
+func destroyPort(port machPort) {
+	C.ptrace_destroy_port(C.mach_port_t(port))
+}
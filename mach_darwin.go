@@ -0,0 +1,189 @@
+package ptrace
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// A MachException is the type of a Mach exception, from
+// <mach/exception_types.h>.
+type MachException int
+
+// The Mach exceptions reported by WithMachExceptions.
+const (
+	ExcBadAccess      MachException = 1
+	ExcBadInstruction MachException = 2
+	ExcArithmetic     MachException = 3
+	ExcBreakpoint     MachException = 6
+)
+
+var machExceptionNames = map[MachException]string{
+	ExcBadAccess:      "EXC_BAD_ACCESS",
+	ExcBadInstruction: "EXC_BAD_INSTRUCTION",
+	ExcArithmetic:     "EXC_ARITHMETIC",
+	ExcBreakpoint:     "EXC_BREAKPOINT",
+}
+
+func (e MachException) String() string {
+	if s, ok := machExceptionNames[e]; ok {
+		return s
+	}
+	return "EXC_" + strconv.Itoa(int(e))
+}
+
+// A MachExceptionEvent is sent, WithMachExceptions, when a thread of the
+// tracee raises a Mach exception.  The exception is then declined, so
+// that the kernel delivers it as the corresponding signal, such as
+// SIGSEGV for EXC_BAD_ACCESS, which stops the tracee as usual; the event
+// is sent before that stop, and carries the details that the signal
+// does not.  The tracee is not stopped for the event itself.
+type MachExceptionEvent struct {
+	// Thread is the system-wide ID of the thread that raised the
+	// exception.
+	Thread uint64 `json:"thread"`
+	// Exception is the type of the exception.
+	Exception MachException `json:"exception"`
+	// Codes are the exception's codes.  For EXC_BAD_ACCESS, Codes[0]
+	// is the kern_return_t of the fault, and Codes[1] is the faulting
+	// address.
+	Codes [2]int64 `json:"codes"`
+}
+
+var errNoCgo = errors.New("ptrace: Mach task ports require cgo")
+
+// WithMachExceptions installs an exception port on the tracee's task, on
+// which its Mach exceptions are received, and a MachExceptionEvent sent
+// for each.  It requires the tracee's task port, from task_for_pid; Exec
+// fails with an error wrapping ErrEntitlement if the tracer is not
+// entitled to it.  The port replaces any task exception ports of the
+// tracee for the reported exceptions.
+func WithMachExceptions() Option {
+	return func(t *Tracee) { t.machExceptions = true }
+}
+
+// Starts receiving the tracee's Mach exceptions, WithMachExceptions.
+// Must be called on the tracer thread at the initial stop.
+func (t *Tracee) startMachExceptions() error {
+	task, err := taskForPid(t.proc.Pid)
+	if err != nil {
+		return err
+	}
+	defer releaseTask(task)
+	port, err := newExceptionPort(task)
+	if err != nil {
+		return err
+	}
+	go t.receiveMachExceptions(port)
+	return nil
+}
+
+// How long a receive on the exception port waits before checking
+// whether the tracee is closed or has exited, in milliseconds.
+const machReceiveTimeout = 100
+
+// Sends an event for each exception received on the port, until the
+// tracee is closed or exits.
+func (t *Tracee) receiveMachExceptions(port machPort) {
+	defer destroyPort(port)
+	for {
+		select {
+		case <-t.closing:
+			return
+		case <-t.waitDone:
+			return
+		default:
+		}
+		ev, ok, err := receiveException(port, machReceiveTimeout)
+		if err != nil {
+			return
+		}
+		if ok {
+			t.trySend(ev)
+		}
+	}
+}
+
+// PeekData reads tracee memory at addr into out with
+// mach_vm_read_overwrite, returning the number of bytes read.  As on
+// Linux, reading fewer than len(out) bytes is an error, and if the read
+// reached memory that cannot be read, the error is a *PartialReadError,
+// and the bytes before it are read.  It requires the tracee's task port,
+// and fails with an error wrapping ErrEntitlement without it.
+func (t *Tracee) PeekData(addr uintptr, out []byte) (int, error) {
+	var n int
+	err := t.withTask("peekdata", func(task machTask) (err error) {
+		n, err = machRead(task, addr, out)
+		return err
+	})
+	return n, err
+}
+
+// PokeData writes data into tracee memory at addr with mach_vm_write,
+// returning the number of bytes written.  Memory that is not writable,
+// such as code, is made writable, copied on write, for the write, so
+// that breakpoints can be inserted.  It requires the tracee's task port.
+func (t *Tracee) PokeData(addr uintptr, data []byte) (int, error) {
+	err := t.withTask("pokedata", func(task machTask) error { return machWrite(task, addr, data) })
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// GetRegs returns the general purpose registers of the tracee's main
+// thread, with thread_get_state.  It requires the tracee's task port.
+func (t *Tracee) GetRegs() (Regs, error) {
+	var regs Regs
+	err := t.withTask("getregs", func(task machTask) error { return getThreadState(task, &regs) })
+	return regs, err
+}
+
+// SetRegs sets the general purpose registers of the tracee's main
+// thread, with thread_set_state.  It requires the tracee's task port.
+func (t *Tracee) SetRegs(regs Regs) error {
+	return t.withTask("setregs", func(task machTask) error { return setThreadState(task, &regs) })
+}
+
+// A machTask is a send right to a task port, and a machPort is a
+// receive right to a port of the tracer.
+type (
+	machTask uint32
+	machPort uint32
+)
+
+// Runs f on the tracer thread with the stopped tracee's task port.  The
+// port is not kept, since the tracer would otherwise hold it beyond the
+// tracee's lifetime.
+func (t *Tracee) withTask(op string, f func(machTask) error) error {
+	return t.run(op, func() error {
+		if err := t.requireStopped(); err != nil {
+			return err
+		}
+		task, err := taskForPid(t.proc.Pid)
+		if err != nil {
+			return err
+		}
+		defer releaseTask(task)
+		return f(task)
+	})
+}
+
+// Reads tracee memory.  If the memory cannot be read in one piece, it
+// is read a page at a time, up to the first page that cannot be read.
+func machRead(task machTask, addr uintptr, out []byte) (int, error) {
+	if machVMRead(task, addr, out) == nil {
+		return len(out), nil
+	}
+	page := uintptr(os.Getpagesize())
+	n := 0
+	for n < len(out) {
+		a := addr + uintptr(n)
+		end := min(len(out), n+int(page-a%page))
+		if err := machVMRead(task, a, out[n:end]); err != nil {
+			return n, &PartialReadError{Addr: uint64(a), N: n, Err: err}
+		}
+		n = end
+	}
+	return n, nil
+}
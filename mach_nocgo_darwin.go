@@ -0,0 +1,23 @@
+//go:build !cgo
+
+package ptrace
+
+func taskForPid(pid int) (machTask, error) { return 0, errNoCgo }
+
+func releaseTask(task machTask) {}
+
+func machVMRead(task machTask, addr uintptr, out []byte) error { return errNoCgo }
+
+func machWrite(task machTask, addr uintptr, data []byte) error { return errNoCgo }
+
+func getThreadState(task machTask, regs *Regs) error { return errNoCgo }
+
+func setThreadState(task machTask, regs *Regs) error { return errNoCgo }
+
+func newExceptionPort(task machTask) (machPort, error) { return 0, errNoCgo }
+
+func receiveException(port machPort, timeout int) (MachExceptionEvent, bool, error) {
+	return MachExceptionEvent{}, false, errNoCgo
+}
+
+func destroyPort(port machPort) {}
@@ -0,0 +1,169 @@
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+var errNotMapped = errors.New("ptrace: address is not mapped")
+
+// Perms are the access permissions of a memory mapping.
+type Perms uint8
+
+const (
+	PermRead Perms = 1 << iota
+	PermWrite
+	PermExec
+	// PermShared is set for shared mappings, and clear for private,
+	// copy-on-write mappings.
+	PermShared
+)
+
+// String returns the permissions in the format of /proc/pid/maps, for
+// example "r-xp".
+func (p Perms) String() string {
+	b := []byte("---p")
+	if p&PermRead != 0 {
+		b[0] = 'r'
+	}
+	if p&PermWrite != 0 {
+		b[1] = 'w'
+	}
+	if p&PermExec != 0 {
+		b[2] = 'x'
+	}
+	if p&PermShared != 0 {
+		b[3] = 's'
+	}
+	return string(b)
+}
+
+// A Mapping is a region of the tracee's address space, as reported by
+// /proc/pid/maps.
+type Mapping struct {
+	// Start and End are the bounds of the mapping; End is exclusive.
+	Start, End uint64
+	Perms      Perms
+	// Offset is the offset of the mapping in the mapped file.
+	Offset uint64
+	// Inode is the inode of the mapped file, or 0.
+	Inode uint64
+	// Path is the mapped file, a pseudo-path like "[heap]" or
+	// "[stack]", or empty for anonymous mappings.
+	Path string
+}
+
+// Contains returns whether the address is within the mapping.
+func (m Mapping) Contains(addr uint64) bool {
+	return m.Start <= addr && addr < m.End
+}
+
+// Mappings returns the tracee's memory mappings, sorted by address.
+func (t *Tracee) Mappings() ([]Mapping, error) {
+	return readMaps(t.proc.Pid)
+}
+
+// Parses the contents of /proc/pid/maps.  Lines have the form:
+//
+//	start-end perms offset dev inode path
+func parseMaps(b []byte) []Mapping {
+	var ms []Mapping
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) < 5 {
+			continue
+		}
+		start, end, _ := strings.Cut(f[0], "-")
+		var m Mapping
+		m.Start, _ = strconv.ParseUint(start, 16, 64)
+		m.End, _ = strconv.ParseUint(end, 16, 64)
+		for i, c := range []byte(f[1]) {
+			switch {
+			case i == 0 && c == 'r':
+				m.Perms |= PermRead
+			case i == 1 && c == 'w':
+				m.Perms |= PermWrite
+			case i == 2 && c == 'x':
+				m.Perms |= PermExec
+			case i == 3 && c == 's':
+				m.Perms |= PermShared
+			}
+		}
+		m.Offset, _ = strconv.ParseUint(f[2], 16, 64)
+		m.Inode, _ = strconv.ParseUint(f[4], 10, 64)
+		if len(f) > 5 {
+			m.Path = strings.Join(f[5:], " ")
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+// Protection returns the access permissions of the mapping of the
+// stopped tracee that contains addr, so that a tool can check a pointer
+// before it dereferences it.  A mapping with no access, such as a guard
+// page, has no permissions; an address that is not mapped at all is an
+// error.  The mappings are read once per stop, and cached until the
+// tracee is resumed.
+func (t *Tracee) Protection(addr uintptr) (Perms, error) {
+	var p Perms
+	err := t.Do(func(r Raw) error {
+		ms, err := t.stopMappings()
+		if err != nil {
+			return err
+		}
+		a := uint64(addr)
+		i := sort.Search(len(ms), func(i int) bool { return ms[i].End > a })
+		if i == len(ms) || !ms[i].Contains(a) {
+			return fmt.Errorf("%w: %#x", errNotMapped, a)
+		}
+		p = ms[i].Perms
+		return nil
+	})
+	return p, err
+}
+
+// Returns the mappings of the stopped tracee, reading them if they are
+// not cached for the current stop.  The cached mappings are charged to
+// the tracee as CacheMemory.  Must be called on the tracer thread.
+func (t *Tracee) stopMappings() ([]Mapping, error) {
+	if t.maps != nil && !t.mapsEvicted.Load() {
+		t.mem.touch(t.mapsCharge)
+		return t.maps, nil
+	}
+	ms, err := readMaps(t.proc.Pid)
+	if err != nil {
+		return nil, err
+	}
+	t.mem.release(t.mapsCharge)
+	t.mapsEvicted.Store(false)
+	t.maps = ms
+	t.mapsCharge = t.mem.charge(CacheMemory, mappingsSize(ms), func() { t.mapsEvicted.Store(true) })
+	return ms, nil
+}
+
+// Returns the approximate number of bytes held by the mappings.
+func mappingsSize(ms []Mapping) int64 {
+	n := int64(len(ms)) * int64(unsafe.Sizeof(Mapping{}))
+	for _, m := range ms {
+		n += int64(len(m.Path))
+	}
+	return n
+}
+
+// Returns the memory mappings of a process.
+func readMaps(pid int) ([]Mapping, error) {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/maps")
+	if err != nil {
+		return nil, err
+	}
+	return parseMaps(b), nil
+}
@@ -0,0 +1,167 @@
+package ptrace
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A MemoryKind classifies tracer-side memory that is held on behalf of a
+// tracee.
+type MemoryKind int
+
+const (
+	// CacheMemory is memory used by caches of tracee state: its
+	// memory mappings at the current stop, and the debug information
+	// of its executable.  It is evicted least recently used first.
+	CacheMemory MemoryKind = iota
+	// SnapshotMemory is memory used by snapshots of tracee state.  It
+	// is evicted oldest first.
+	SnapshotMemory
+	// BufferMemory is memory used by trace buffers, such as those of
+	// a ProcessorTrace.  It is never evicted.
+	BufferMemory
+)
+
+// MemoryUsage reports the tracer-side memory held on behalf of a tracee.
+type MemoryUsage struct {
+	// Limit is the memory limit in bytes, or 0 if there is no limit.
+	Limit int64 `json:"limit"`
+	// Total is the total number of bytes in use.
+	Total int64 `json:"total"`
+	// Cache, Snapshots, and Buffers are the number of bytes in use
+	// of each MemoryKind.
+	Cache     int64 `json:"cache"`
+	Snapshots int64 `json:"snapshots"`
+	Buffers   int64 `json:"buffers"`
+}
+
+// A MemoryPressureEvent is sent on the events channel when the memory
+// held on behalf of a tracee exceeds its limit.  Pressure events are
+// dropped if the events channel is full.
+type MemoryPressureEvent struct {
+	// Usage is the memory usage after eviction.
+	Usage MemoryUsage `json:"usage"`
+	// Evicted is the number of bytes evicted to relieve the pressure.
+	Evicted int64 `json:"evicted"`
+}
+
+// WithMemoryLimit limits the tracer-side memory held on behalf of the
+// tracee to the given number of bytes.  When the limit is exceeded,
+// evictable memory is released, and a MemoryPressureEvent is sent.
+func WithMemoryLimit(bytes int64) Option {
+	return func(t *Tracee) { t.mem.limit = bytes }
+}
+
+// MemoryUsage returns the tracer-side memory held on behalf of the tracee.
+func (t *Tracee) MemoryUsage() MemoryUsage {
+	t.mem.mu.Lock()
+	defer t.mem.mu.Unlock()
+	return t.mem.usage()
+}
+
+// A memAccount tracks the memory held on behalf of a tracee.
+type memAccount struct {
+	mu    sync.Mutex
+	limit int64
+	total int64
+	kinds [3]int64
+	// Lru holds the evictable *memCharges, least recently used at
+	// the front.
+	lru    list.List
+	notify func(Event)
+}
+
+// A memCharge is a block of memory charged to a memAccount.
+type memCharge struct {
+	kind     MemoryKind
+	size     int64
+	evict    func()
+	elem     *list.Element
+	released bool
+}
+
+// Charges size bytes of the given kind to the account, returning the
+// charge, which must eventually be released.  If evict is non-nil, the
+// memory is evictable: evict is called, without the account locked,
+// when the memory must be freed to satisfy the limit.  The charge is
+// already released when evict is called.
+func (a *memAccount) charge(kind MemoryKind, size int64, evict func()) *memCharge {
+	a.mu.Lock()
+	c := &memCharge{kind: kind, size: size, evict: evict}
+	a.total += size
+	a.kinds[kind] += size
+	if evict != nil {
+		c.elem = a.lru.PushBack(c)
+	}
+	if a.limit <= 0 || a.total <= a.limit {
+		a.mu.Unlock()
+		return c
+	}
+	var evicted []*memCharge
+	var n int64
+	for e := a.lru.Front(); e != nil && a.total > a.limit; {
+		next := e.Next()
+		if v := e.Value.(*memCharge); v != c {
+			a.remove(v)
+			evicted = append(evicted, v)
+			n += v.size
+		}
+		e = next
+	}
+	ev := MemoryPressureEvent{Usage: a.usage(), Evicted: n}
+	notify := a.notify
+	a.mu.Unlock()
+
+	for _, v := range evicted {
+		v.evict()
+	}
+	if notify != nil {
+		notify(ev)
+	}
+	return c
+}
+
+// Marks the charged memory as recently used.
+func (a *memAccount) touch(c *memCharge) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c.elem != nil {
+		a.lru.MoveToBack(c.elem)
+	}
+}
+
+// Releases the charge.  Releasing a charge more than once, or after it
+// was evicted, is harmless.
+func (a *memAccount) release(c *memCharge) {
+	if c == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.remove(c)
+}
+
+// Must be called with a.mu held.
+func (a *memAccount) remove(c *memCharge) {
+	if c.released {
+		return
+	}
+	a.total -= c.size
+	a.kinds[c.kind] -= c.size
+	if c.elem != nil {
+		a.lru.Remove(c.elem)
+		c.elem = nil
+	}
+	c.released = true
+}
+
+// Must be called with a.mu held.
+func (a *memAccount) usage() MemoryUsage {
+	return MemoryUsage{
+		Limit:     a.limit,
+		Total:     a.total,
+		Cache:     a.kinds[CacheMemory],
+		Snapshots: a.kinds[SnapshotMemory],
+		Buffers:   a.kinds[BufferMemory],
+	}
+}
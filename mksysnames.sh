@@ -0,0 +1,55 @@
+#!/bin/sh
+#
+# Generates the system call name tables, sysnames_linux_$GOARCH.go.
+# The tables for amd64, 386, arm64, and riscv64 are generated from the
+# Linux UAPI headers; the rest are generated from the syscall package.
+#
+# Usage: ./mksysnames.sh [include directory]
+#
+
+inc=${1:-/usr/include}
+asm=$inc/asm
+test -d $asm || asm=$inc/x86_64-linux-gnu/asm
+goroot=$(go env GOROOT)
+
+# Reads lines of "name number" on stdin, and writes the table for $1.
+table() {
+	{
+		echo "// Code generated by mksysnames.sh; DO NOT EDIT."
+		echo
+		echo "package ptrace"
+		echo
+		echo "var syscallNames = map[int]string{"
+		sort -k2 -n -u | awk '{ printf("\t%d: \"%s\",\n", $2, $1) }'
+		echo "}"
+	} > sysnames_linux_$1.go
+	gofmt -w sysnames_linux_$1.go
+}
+
+uapi() {
+	awk '$1 == "#define" && $2 ~ /^__NR(3264)?_/ && $3 ~ /^[0-9]+$/ {
+		name = $2
+		sub(/^__NR(3264)?_/, "", name)
+		if (name == "syscalls")
+			next
+		if (name == "fstatat")
+			name = "newfstatat"
+		print name, $3
+	}' "$@"
+}
+
+uapi $asm/unistd_64.h | table amd64
+uapi $asm/unistd_32.h | table 386
+uapi $inc/asm-generic/unistd.h | table arm64
+uapi $inc/asm-generic/unistd.h | table riscv64
+
+for f in $goroot/src/syscall/zsysnum_linux_*.go; do
+	arch=$(basename $f .go | sed 's/zsysnum_linux_//')
+	case $arch in
+	amd64 | 386 | arm64 | riscv64)
+		continue
+	esac
+	awk '$1 ~ /^SYS_/ && $2 == "=" && $3 ~ /^[0-9]+$/ {
+		print tolower(substr($1, 5)), $3
+	}' $f | table $arch
+done
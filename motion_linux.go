@@ -0,0 +1,96 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// StepOver single-steps the stopped tracee over one instruction,
+// treating a call as a single instruction: at a call, a temporary
+// breakpoint is set after it, and the tracee is continued until the
+// call returns to the current frame.  StepOver blocks until the tracee
+// stops, and, as with StepN, no event is sent for the final stop.
+//
+// If the tracee stops for another reason first, for example on delivery
+// of a signal or at a hardware breakpoint, the temporary breakpoint is
+// removed, the stop is sent on the events channel as usual, and an error
+// is returned.
+func (t *Tracee) StepOver() error {
+	var next, sp uint64
+	err := t.Do(func(r Raw) error {
+		var regs syscall.PtraceRegs
+		if err := r.GetRegs(&regs); err != nil {
+			return err
+		}
+		code, err := t.readCode(r, regs.PC(), maxInsnSize)
+		if err != nil {
+			return err
+		}
+		// Without breakpoints, calls are stepped into.
+		if insn, err := decodeInsn(code, regs.PC()); err == nil && insn.Flow == FlowCall && breakpointInsn != nil {
+			next, sp = regs.PC()+uint64(len(insn.Bytes)), stackPointer(&regs)
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		return err
+	case next == 0:
+		_, err := t.StepN(1)
+		return err
+	}
+	// A recursive call may reach the breakpoint in a deeper frame,
+	// whose stack pointer is below that of the call.
+	return t.runTo("stepover", next, func(regs *syscall.PtraceRegs) bool {
+		return stackPointer(regs) >= sp
+	})
+}
+
+// StepOut continues the stopped tracee until the current function
+// returns to its caller, with a temporary breakpoint at the return
+// address of the frame returned by CurrentFrame.  StepOut blocks until
+// the tracee stops, and no event is sent for the final stop.  As with
+// CurrentFrame, the frame is only correct at a function's first
+// instruction, or in code that maintains a frame pointer.
+//
+// If the tracee stops for another reason first, the temporary breakpoint
+// is removed, the stop is sent on the events channel as usual, and an
+// error is returned.
+func (t *Tracee) StepOut() error {
+	f, err := t.CurrentFrame()
+	if err != nil {
+		return err
+	}
+	return t.runTo("stepout", f.ReturnAddress, func(regs *syscall.PtraceRegs) bool {
+		return stackPointer(regs) >= f.FrameBase
+	})
+}
+
+// RunUntil continues the stopped tracee until it reaches addr, with a
+// one-shot breakpoint that is removed before RunUntil returns.  RunUntil
+// blocks until the tracee stops, and no event is sent for the stop at
+// addr.  If the tracee is already at addr, it runs until it reaches addr
+// again.
+//
+// If the tracee stops for another reason first, the breakpoint is
+// removed, the stop is sent on the events channel as usual, and an error
+// is returned.
+func (t *Tracee) RunUntil(addr uintptr) error {
+	return t.runTo("rununtil", uint64(addr), func(*syscall.PtraceRegs) bool { return true })
+}
+
+// Runs the stopped tracee to addr, as runToBreakpoint, in the named
+// command, and then sends the events of the stops on the way.
+func (t *Tracee) runTo(op string, addr uint64, done func(regs *syscall.PtraceRegs) bool) error {
+	var evs []Event
+	err := t.run(op, func() (err error) {
+		evs, err = t.runToBreakpoint(addr, done)
+		return err
+	})
+	for _, ev := range evs {
+		t.emit(ev)
+	}
+	return err
+}
+
+// The maximum length of an instruction.
+const maxInsnSize = 16
@@ -0,0 +1,209 @@
+package ptrace
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Namespaces identifies the Linux namespaces of a process by the inode
+// numbers of its /proc/pid/ns links.  A zero field means the namespace
+// type is not supported by the kernel.
+type Namespaces struct {
+	Cgroup uint64 `json:"cgroup"`
+	IPC    uint64 `json:"ipc"`
+	Mnt    uint64 `json:"mnt"`
+	Net    uint64 `json:"net"`
+	PID    uint64 `json:"pid"`
+	Time   uint64 `json:"time"`
+	User   uint64 `json:"user"`
+	UTS    uint64 `json:"uts"`
+}
+
+// A NamespaceChangeEvent is sent when the tracee changes its namespaces
+// with setns or unshare.  It is sent before the SyscallExitEvent of the
+// system call that caused the change.
+type NamespaceChangeEvent struct {
+	Old Namespaces `json:"old"`
+	New Namespaces `json:"new"`
+}
+
+// Namespaces returns the tracee's namespaces as of its last observed
+// change.  Changes are only observed at the system call stops of a
+// tracee resumed with Syscall.
+func (t *Tracee) Namespaces() Namespaces {
+	t.ns.mu.Lock()
+	defer t.ns.mu.Unlock()
+	if !t.ns.loaded {
+		t.ns.cur, _ = readNamespaces(t.proc.Pid)
+		t.ns.loaded = true
+	}
+	return t.ns.cur
+}
+
+// HostPath returns the path in the tracer's mount namespace that
+// corresponds to a path in the tracee's mount namespace, resolved
+// against the tracee's root directory and, if relative, its working
+// directory.  The result follows the tracee across chroot, setns, and
+// unshare.  Paths under /proc that name a process, including
+// /proc/self and /proc/thread-self, are translated from the tracee's
+// PID namespace to the tracer's.
+func (t *Tracee) HostPath(path string) string {
+	dir := "/proc/" + strconv.Itoa(t.proc.Pid)
+	if !filepath.IsAbs(path) {
+		return dir + "/cwd/" + filepath.Clean(path)
+	}
+	// Cleaning the path first keeps .. from escaping the root.
+	path = filepath.Clean(path)
+	if p, ok := t.hostProcPath(path); ok {
+		return p
+	}
+	return dir + "/root" + path
+}
+
+// Translates a cleaned, absolute path under /proc naming a process in
+// the tracee's PID namespace to the path of the process in the
+// tracer's.  Since /proc/self is resolved for the process that follows
+// the link, it is not looked up through the tracee's root.  Returns
+// false if the path does not name a process, or it is not found.
+func (t *Tracee) hostProcPath(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, "/proc/")
+	if !ok {
+		return "", false
+	}
+	name, rest, _ := strings.Cut(rest, "/")
+	if rest != "" {
+		rest = "/" + rest
+	}
+	pid := t.proc.Pid
+	switch name {
+	case "self":
+	case "thread-self":
+		rest = "/task/" + strconv.Itoa(pid) + rest
+	default:
+		nspid, err := strconv.Atoi(name)
+		if err != nil {
+			return "", false
+		}
+		if pid, ok = hostPid(t.proc.Pid, nspid); !ok {
+			return "", false
+		}
+	}
+	return "/proc/" + strconv.Itoa(pid) + rest, true
+}
+
+// Returns the PID in the tracer's PID namespace of the process with PID
+// nspid in the PID namespace of the process pid.  Processes in nested
+// namespaces, which are also visible there, are not found.
+func hostPid(pid, nspid int) (int, bool) {
+	if ids := readNSpid(pid); len(ids) > 0 && ids[len(ids)-1] == nspid {
+		return pid, true
+	}
+	ns, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/ns/pid")
+	if err != nil {
+		return 0, false
+	}
+	pids, err := listTasks("/proc")
+	if err != nil {
+		return 0, false
+	}
+	for _, p := range pids {
+		ids := readNSpid(p)
+		if len(ids) == 0 || ids[len(ids)-1] != nspid {
+			continue
+		}
+		if l, err := os.Readlink("/proc/" + strconv.Itoa(p) + "/ns/pid"); err == nil && l == ns {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// Returns the NSpid field of /proc/pid/status: the process's PIDs in
+// each PID namespace, outermost first.
+func readNSpid(pid int) []int {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/status")
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		f, ok := strings.CutPrefix(line, "NSpid:")
+		if !ok {
+			continue
+		}
+		var ids []int
+		for _, s := range strings.Fields(f) {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				return nil
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	return nil
+}
+
+type nsTracker struct {
+	mu     sync.Mutex
+	loaded bool
+	cur    Namespaces
+}
+
+// Observes the tracee's events, looking for namespace changes.  Called
+// on the wait go routine.
+func (t *Tracee) observeNamespaces(ev Event) {
+	// The first event is observed before the tracee can change its
+	// namespaces, so the initial namespaces are loaded then.
+	t.Namespaces()
+	exit, ok := ev.(SyscallExitEvent)
+	if !ok || exit.Ret != 0 {
+		return
+	}
+	switch exit.Name() {
+	case "setns", "unshare":
+	default:
+		return
+	}
+	old := t.Namespaces()
+	cur, err := readNamespaces(t.proc.Pid)
+	if err != nil || cur == old {
+		return
+	}
+	t.ns.mu.Lock()
+	t.ns.cur = cur
+	t.ns.mu.Unlock()
+	t.emit(NamespaceChangeEvent{Old: old, New: cur})
+}
+
+func readNamespaces(pid int) (Namespaces, error) {
+	var ns Namespaces
+	dir := "/proc/" + strconv.Itoa(pid) + "/ns/"
+	for _, n := range []struct {
+		name string
+		id   *uint64
+	}{
+		{"cgroup", &ns.Cgroup},
+		{"ipc", &ns.IPC},
+		{"mnt", &ns.Mnt},
+		{"net", &ns.Net},
+		{"pid", &ns.PID},
+		{"time", &ns.Time},
+		{"user", &ns.User},
+		{"uts", &ns.UTS},
+	} {
+		// Links have the form "type:[inode]".
+		l, err := os.Readlink(dir + n.name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Namespaces{}, err
+		}
+		_, inode, _ := strings.Cut(l, "[")
+		*n.id, _ = strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64)
+	}
+	return ns, nil
+}
@@ -0,0 +1,204 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A NetworkEvent is sent, with WithNetworkEvents, when the tracee
+// connects, binds, or accepts a socket, or sends a datagram to an
+// address.  It is sent before the SyscallExitEvent of the system call.
+type NetworkEvent struct {
+	// Time is when the system call exited.
+	Time time.Time
+	// Syscall is the name of the system call: connect, bind, accept,
+	// accept4, or sendto.
+	Syscall string
+	// Fd is the socket descriptor argument of the system call.
+	Fd int
+	// Addr is the address: the peer's for connect, accept, and
+	// sendto, and the local address for bind.  It is a *net.TCPAddr,
+	// *net.UDPAddr, or *net.UnixAddr, according to the socket's type.
+	Addr net.Addr
+	// Err is the syscall.Errno returned by the system call, or nil if
+	// it succeeded.
+	Err error
+}
+
+// MarshalJSON encodes the event with its address as a string, and its
+// network.
+func (e NetworkEvent) MarshalJSON() ([]byte, error) {
+	var errStr string
+	if e.Err != nil {
+		errStr = e.Err.Error()
+	}
+	return json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Syscall string    `json:"syscall"`
+		Fd      int       `json:"fd"`
+		Network string    `json:"network"`
+		Addr    string    `json:"addr"`
+		Err     string    `json:"err,omitempty"`
+	}{e.Time, e.Syscall, e.Fd, e.Addr.Network(), e.Addr.String(), errStr})
+}
+
+// WithNetworkEvents sends a NetworkEvent for each socket address passed
+// to or returned by the system calls of a tracee resumed with Syscall.
+// Calls with an address of a family other than AF_INET, AF_INET6, and
+// AF_UNIX, or with no address, such as sendto on a connected socket,
+// are not reported.
+func WithNetworkEvents() Option {
+	return func(t *Tracee) {
+		// The pending entry is only accessed on the wait go routine.
+		enter := SyscallEnterEvent{Nr: -1}
+		t.observers = append(t.observers, func(ev Event) {
+			switch ev := ev.(type) {
+			case SyscallEnterEvent:
+				enter = ev
+			case SyscallExitEvent:
+				if ev.Nr < 0 || ev.Nr != enter.Nr {
+					return
+				}
+				if nev, ok := t.networkEvent(enter, ev); ok {
+					t.emit(nev)
+				}
+				enter = SyscallEnterEvent{Nr: -1}
+			}
+		})
+	}
+}
+
+// The size of struct sockaddr_storage, which bounds the addresses read.
+const sockaddrStorageSize = 128
+
+// Returns the NetworkEvent for a system call, if there is one.  Called on
+// the wait go routine.
+func (t *Tracee) networkEvent(enter SyscallEnterEvent, exit SyscallExitEvent) (NetworkEvent, bool) {
+	var ptr, size uint64
+	failed := exit.Errno != 0
+	switch name := enter.Name(); name {
+	case "connect", "bind":
+		ptr, size = enter.Args[1], enter.Args[2]
+	case "sendto":
+		ptr, size = enter.Args[4], enter.Args[5]
+	case "accept", "accept4":
+		if failed || enter.Args[1] == 0 || enter.Args[2] == 0 {
+			return NetworkEvent{}, false
+		}
+		// The address length is returned through a pointer.
+		ptr = enter.Args[1]
+		err := t.doInternal(func(r Raw) error {
+			var b [4]byte
+			_, err := r.PeekData(uintptr(enter.Args[2]), b[:])
+			size = uint64(binary.NativeEndian.Uint32(b[:]))
+			return err
+		})
+		if err != nil {
+			return NetworkEvent{}, false
+		}
+	default:
+		return NetworkEvent{}, false
+	}
+	if ptr == 0 || size < 2 {
+		return NetworkEvent{}, false
+	}
+	if size > sockaddrStorageSize {
+		size = sockaddrStorageSize
+	}
+	b := make([]byte, size)
+	if err := t.doInternal(func(r Raw) error { _, err := r.PeekData(uintptr(ptr), b); return err }); err != nil {
+		return NetworkEvent{}, false
+	}
+	fd := int(int32(enter.Args[0]))
+	addr := decodeSockaddr(b, t.socketType(fd, enter.Name()))
+	if addr == nil {
+		return NetworkEvent{}, false
+	}
+	return NetworkEvent{Time: exit.Time, Syscall: enter.Name(), Fd: fd, Addr: addr, Err: exit.Err()}, true
+}
+
+// The numbers of the pidfd system calls, which are the same on every
+// architecture.
+const (
+	sysPidfdOpen  = 434
+	sysPidfdGetfd = 438
+)
+
+// Returns the type of the tracee's socket, such as syscall.SOCK_STREAM,
+// by duplicating its descriptor with pidfd_getfd.  If that fails, for
+// example on kernels before 5.6, the type is guessed from the system
+// call: datagram for sendto, and stream otherwise.
+func (t *Tracee) socketType(fd int, syscallName string) int {
+	guess := syscall.SOCK_STREAM
+	if syscallName == "sendto" {
+		guess = syscall.SOCK_DGRAM
+	}
+	pidfd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(t.proc.Pid), 0, 0)
+	if errno != 0 {
+		return guess
+	}
+	defer syscall.Close(int(pidfd))
+	sfd, _, errno := syscall.Syscall(sysPidfdGetfd, pidfd, uintptr(fd), 0)
+	if errno != 0 {
+		return guess
+	}
+	defer syscall.Close(int(sfd))
+	typ, err := syscall.GetsockoptInt(int(sfd), syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return guess
+	}
+	return typ
+}
+
+// Decodes a struct sockaddr of a socket of the type, or returns nil if
+// its family is not supported.
+func decodeSockaddr(b []byte, typ int) net.Addr {
+	switch binary.NativeEndian.Uint16(b) {
+	case syscall.AF_INET:
+		if len(b) < 8 {
+			return nil
+		}
+		ip := net.IP(append([]byte(nil), b[4:8]...))
+		return ipAddr(typ, ip, int(binary.BigEndian.Uint16(b[2:])), "")
+	case syscall.AF_INET6:
+		if len(b) < 28 {
+			return nil
+		}
+		ip := net.IP(append([]byte(nil), b[8:24]...))
+		var zone string
+		if id := binary.NativeEndian.Uint32(b[24:]); id != 0 {
+			zone = strconv.Itoa(int(id))
+		}
+		return ipAddr(typ, ip, int(binary.BigEndian.Uint16(b[2:])), zone)
+	case syscall.AF_UNIX:
+		name := string(b[2:])
+		if len(name) > 0 && name[0] == 0 {
+			// An abstract socket address, which is written with
+			// a leading @.
+			name = "@" + name[1:]
+		} else if i := strings.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		network := "unix"
+		switch typ {
+		case syscall.SOCK_DGRAM:
+			network = "unixgram"
+		case syscall.SOCK_SEQPACKET:
+			network = "unixpacket"
+		}
+		return &net.UnixAddr{Name: name, Net: network}
+	}
+	return nil
+}
+
+func ipAddr(typ int, ip net.IP, port int, zone string) net.Addr {
+	if typ == syscall.SOCK_DGRAM {
+		return &net.UDPAddr{IP: ip, Port: port, Zone: zone}
+	}
+	return &net.TCPAddr{IP: ip, Port: port, Zone: zone}
+}
@@ -0,0 +1,543 @@
+package ptrace
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+var (
+	errNoThread         = errors.New("ptrace: thread is not under non-stop control")
+	errThreadRunning    = errors.New("ptrace: thread is running")
+	errNonStopClosed    = errors.New("ptrace: non-stop control is closed")
+	errNonStopActive    = errors.New("ptrace: non-stop control is already active")
+	errNonStopTracedTID = errors.New("ptrace: thread is the traced thread")
+)
+
+// A ThreadEvent is an event of a thread under non-stop control.  Event
+// is a syscall.WaitStatus for a stop or an exit, a BreakpointEvent for a
+// stop at a breakpoint set by SetBreakpoint, or a CloneEvent.
+type ThreadEvent struct {
+	TID   int
+	Event Event
+}
+
+// A CloneEvent is sent when a thread under non-stop control starts a new
+// thread, which is put under non-stop control, running.  The thread
+// that started it keeps running.
+type CloneEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// NewTID is the TID of the new thread.
+	NewTID int `json:"new_tid"`
+}
+
+// NonStop controls the threads of the tracee's process other than the
+// traced thread individually, like gdb's non-stop mode: each can be
+// stopped, stepped, and resumed while the others keep running.
+type NonStop struct {
+	t      *Tracee
+	events chan ThreadEvent
+	// Closing is closed by Close, after which events are dropped.
+	closing chan struct{}
+
+	mu      sync.Mutex
+	threads map[int]*nonStopThread
+	closed  bool
+	// Waits are the wait go routines, one for each thread.
+	waits sync.WaitGroup
+}
+
+// A thread under non-stop control.  Its fields are guarded by the
+// NonStop's mu.
+type nonStopThread struct {
+	stopped bool
+	// Seized is whether the thread was attached with PTRACE_SEIZE.
+	// Threads started by the traced thread are attached as it is,
+	// and cannot be interrupted with PTRACE_INTERRUPT.
+	seized bool
+	// Interrupted is whether a SIGSTOP was sent to stop the thread,
+	// which is suppressed when it stops the thread.
+	interrupted bool
+	// Sig is the signal to deliver when the thread is resumed.
+	sig syscall.Signal
+	// Stepping is the breakpoint that the thread is stepping over, if
+	// any, which is reinserted once the step completes.
+	stepping *breakpoint
+	// Then is whether the thread continues after the step over.
+	then bool
+	// Fresh is whether the thread has just been cloned, and has not
+	// yet reported its initial stop.
+	fresh bool
+}
+
+// NonStop puts every thread of the stopped tracee's process but the
+// traced thread under non-stop control.  The threads are attached with
+// PTRACE_SEIZE, so they keep running, and threads started later, by any
+// thread, are attached too.  Threads held by StopAll are skipped.
+//
+// A thread that hits a breakpoint set by SetBreakpoint stops and sends
+// a BreakpointEvent, without evaluating the breakpoint's condition;
+// internal breakpoints are stepped over transparently.  While a thread
+// steps over a breakpoint, other threads running the same code may miss
+// it.  Close detaches the threads, and must be called before the
+// Tracee is detached.  Breakpoints should be cleared before Close, since
+// a detached thread that hits one is killed by the SIGTRAP.  Only one
+// NonStop can be active at a time.
+func (t *Tracee) NonStop() (*NonStop, error) {
+	ns := &NonStop{
+		t:       t,
+		events:  make(chan ThreadEvent, 1),
+		closing: make(chan struct{}),
+		threads: make(map[int]*nonStopThread),
+	}
+	err := t.run("nonstop", func() error {
+		if err := t.requireStopped(); err != nil {
+			return err
+		}
+		if t.nonStop != nil {
+			return errNonStopActive
+		}
+		if err := t.setOptions(syscall.PTRACE_O_TRACECLONE); err != nil {
+			return err
+		}
+		tids, err := listTasks("/proc/" + strconv.Itoa(t.proc.Pid) + "/task")
+		if err != nil {
+			return err
+		}
+		held := make(map[int]bool)
+		for _, tid := range t.held {
+			held[tid] = true
+		}
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		for _, tid := range tids {
+			if tid == t.proc.Pid || held[tid] {
+				continue
+			}
+			if err := ptrace(ptraceSeize, tid, 0, syscall.PTRACE_O_TRACECLONE); err != nil {
+				// The thread exited.
+				continue
+			}
+			ns.add(tid, true, false)
+		}
+		t.nonStop = ns
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// Events returns the channel of the events of the threads.  It is
+// closed by Close.  The threads' wait go routines block until their
+// events are received.
+func (ns *NonStop) Events() <-chan ThreadEvent {
+	return ns.events
+}
+
+// Threads returns the TIDs of the threads under non-stop control.
+func (ns *NonStop) Threads() []int {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	tids := make([]int, 0, len(ns.threads))
+	for tid := range ns.threads {
+		tids = append(tids, tid)
+	}
+	return tids
+}
+
+// Stopped returns whether the thread is stopped.
+func (ns *NonStop) Stopped(tid int) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	th, ok := ns.threads[tid]
+	return ok && th.stopped
+}
+
+// Stop interrupts the thread.  Stop returns once the interrupt is sent;
+// the stop is reported as a ThreadEvent.
+func (ns *NonStop) Stop(tid int) error {
+	return ns.control("stopthread", tid, func(th *nonStopThread) error {
+		return ns.interrupt(tid, th)
+	})
+}
+
+// Resume continues the stopped thread, delivering the signal that
+// stopped it, if any.  A thread stopped at a breakpoint is first stepped
+// over it.
+func (ns *NonStop) Resume(tid int) error {
+	return ns.control("resumethread", tid, func(th *nonStopThread) error {
+		return ns.resume(tid, th, false)
+	})
+}
+
+// Step single-steps the stopped thread.  The stop after the step is
+// reported as a ThreadEvent.
+func (ns *NonStop) Step(tid int) error {
+	return ns.control("stepthread", tid, func(th *nonStopThread) error {
+		return ns.resume(tid, th, true)
+	})
+}
+
+// GetRegs returns the registers of the stopped thread.
+func (ns *NonStop) GetRegs(tid int) (syscall.PtraceRegs, error) {
+	var regs syscall.PtraceRegs
+	err := ns.control("getregs", tid, func(th *nonStopThread) error {
+		if !th.stopped {
+			return errThreadRunning
+		}
+		return ptraceGetRegs(tid, &regs)
+	})
+	return regs, err
+}
+
+// SetRegs sets the registers of the stopped thread.
+func (ns *NonStop) SetRegs(tid int, regs syscall.PtraceRegs) error {
+	return ns.control("setregs", tid, func(th *nonStopThread) error {
+		if !th.stopped {
+			return errThreadRunning
+		}
+		return ptraceSetRegs(tid, &regs)
+	})
+}
+
+// Close detaches the threads, waits for their wait go routines to
+// return, and closes the events channel.  Running threads are
+// interrupted to detach them, and stopped threads are resumed, and then
+// interrupted.  Events that are not yet received are dropped.  Calling
+// Close more than once is harmless.
+func (ns *NonStop) Close() error {
+	ns.mu.Lock()
+	if ns.closed {
+		ns.mu.Unlock()
+		ns.waits.Wait()
+		return nil
+	}
+	ns.closed = true
+	close(ns.closing)
+	ns.mu.Unlock()
+	// The wait go routines detach the threads at their next stops.
+	// If the tracee has exited, so have the threads.
+	ns.t.runInternal("closenonstop", func() error {
+		if ns.t.nonStop == ns {
+			ns.t.nonStop = nil
+		}
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		for tid, th := range ns.threads {
+			if th.stopped {
+				ns.resume(tid, th, false)
+			}
+			ns.interrupt(tid, th)
+		}
+		return nil
+	})
+	ns.waits.Wait()
+	close(ns.events)
+	return nil
+}
+
+// Runs f on the tracer thread with the thread under non-stop control.
+func (ns *NonStop) control(op string, tid int, f func(*nonStopThread) error) error {
+	if tid == ns.t.proc.Pid {
+		return ns.t.opError(op, errNonStopTracedTID)
+	}
+	return ns.t.run(op, func() error {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		if ns.closed {
+			return errNonStopClosed
+		}
+		th, ok := ns.threads[tid]
+		if !ok {
+			return errNoThread
+		}
+		return f(th)
+	})
+}
+
+// Adds an attached thread and starts its wait go routine.  Must be
+// called on the tracer thread with mu held.
+func (ns *NonStop) add(tid int, seized, fresh bool) {
+	ns.threads[tid] = &nonStopThread{seized: seized, fresh: fresh}
+	ns.waits.Add(1)
+	go ns.wait(tid)
+}
+
+// Interrupts the running thread.  Must be called on the tracer thread
+// with mu held.
+func (ns *NonStop) interrupt(tid int, th *nonStopThread) error {
+	switch {
+	case th.stopped:
+		return nil
+	case th.seized:
+		return ptrace(ptraceInterrupt, tid, 0, 0)
+	}
+	th.interrupted = true
+	return syscall.Tgkill(ns.t.proc.Pid, tid, syscall.SIGSTOP)
+}
+
+// Resumes the stopped thread, continuing it or single-stepping it,
+// first stepping over the breakpoint at its program counter, if any.
+// Must be called on the tracer thread with mu held.
+func (ns *NonStop) resume(tid int, th *nonStopThread, step bool) error {
+	if !th.stopped {
+		return errThreadRunning
+	}
+	var regs syscall.PtraceRegs
+	if err := ptraceGetRegs(tid, &regs); err != nil {
+		return err
+	}
+	if bp, ok := ns.t.bps[regs.PC()]; ok {
+		// Memory is written through the stopped thread, since the
+		// traced thread may be running.
+		if _, err := ptracePoke(tid, uintptr(bp.addr), bp.orig); err != nil {
+			return err
+		}
+		th.stepping, th.then = bp, !step
+		step = true
+	}
+	var err error
+	if step {
+		err = ptrace(syscall.PTRACE_SINGLESTEP, tid, 0, uintptr(th.sig))
+	} else {
+		err = ptraceCont(tid, int(th.sig))
+	}
+	if err != nil {
+		ns.reinsert(tid, th)
+		return err
+	}
+	th.stopped, th.sig = false, 0
+	return nil
+}
+
+// Reinserts the breakpoint that the thread is stepping over, if it is
+// still set, writing through the stopped thread with TID tid.  Must be
+// called on the tracer thread with mu held.
+func (ns *NonStop) reinsert(tid int, th *nonStopThread) {
+	bp := th.stepping
+	th.stepping = nil
+	if bp == nil || ns.t.bps[bp.addr] != bp {
+		return
+	}
+	for _, other := range ns.threads {
+		if other.stepping == bp {
+			// The original code stays until the last step over
+			// it completes.
+			return
+		}
+	}
+	ptracePoke(tid, uintptr(bp.addr), breakpointInsn)
+}
+
+// Waits for the stops of the thread, and sends its events, until it
+// exits or is detached.
+func (ns *NonStop) wait(tid int) {
+	defer ns.waits.Done()
+	for {
+		ws, err := waitPid(tid)
+		if err != nil {
+			ns.remove(tid)
+			return
+		}
+		if ws.Exited() || ws.Signaled() {
+			ns.remove(tid)
+			ns.send(ThreadEvent{TID: tid, Event: ws})
+			return
+		}
+		ev, attached := ns.stopped(tid, ws)
+		if ev != nil {
+			ns.send(ThreadEvent{TID: tid, Event: ev})
+		}
+		if !attached {
+			return
+		}
+	}
+}
+
+// Sends an event, unless Close is called first.
+func (ns *NonStop) send(ev ThreadEvent) {
+	select {
+	case ns.events <- ev:
+	case <-ns.closing:
+	}
+}
+
+// Handles a stop of the thread.  Returns the event to send, if any, and
+// whether the thread is still attached.  Called on the thread's wait go
+// routine.
+func (ns *NonStop) stopped(tid int, ws syscall.WaitStatus) (ev Event, attached bool) {
+	attached = true
+	err := ns.t.runInternal("threadstop", func() error {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		th, ok := ns.threads[tid]
+		if !ok {
+			attached = false
+			return nil
+		}
+		th.stopped = true
+		stepped := th.stepping != nil
+		// Cont is whether to continue the thread after the stop.
+		cont := false
+		ns.reinsert(tid, th)
+		switch {
+		case th.fresh:
+			// The initial stop of a new thread: an event stop if
+			// it was seized, and a SIGSTOP otherwise.
+			th.fresh = false
+			if !th.seized {
+				// Its options are inherited from the traced
+				// thread.
+				syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE)
+			}
+			cont = true
+		case ws.StopSignal() == syscall.SIGTRAP && ws.TrapCause() == syscall.PTRACE_EVENT_CLONE:
+			// The new thread is attached automatically, and is
+			// added even if ns is closed, so that it is detached.
+			if msg, err := syscall.PtraceGetEventMsg(tid); err == nil {
+				if _, ok := ns.threads[int(msg)]; !ok {
+					ns.add(int(msg), th.seized, true)
+				}
+				ev = CloneEvent{Status: ws, NewTID: int(msg)}
+			}
+			cont = true
+		case int(ws)>>16 == ptraceEventStop:
+			ev = ws
+		case ws.StopSignal() == syscall.SIGTRAP && ws.TrapCause() == 0:
+			if stepped {
+				if cont = th.then; !cont {
+					ev = ws
+				}
+				break
+			}
+			ev = ns.trap(tid, ws)
+			cont = ev == nil
+		case ws.StopSignal() == syscall.SIGSTOP && th.interrupted:
+			th.interrupted = false
+			ev = ws
+		default:
+			// A signal-delivery stop.
+			th.sig = ws.StopSignal()
+			ev = ws
+		}
+		if ns.closed {
+			ptrace(syscall.PTRACE_DETACH, tid, 0, uintptr(th.sig))
+			delete(ns.threads, tid)
+			attached, ev = false, nil
+			return nil
+		}
+		if cont {
+			return ns.resume(tid, th, false)
+		}
+		return nil
+	})
+	if err != nil {
+		return ws, attached
+	}
+	return ev, attached
+}
+
+// Returns the event for a SIGTRAP stop of the thread that is not the end
+// of a step over a breakpoint, or nil if the thread hit an internal
+// breakpoint, and should be resumed.  The program counter of a thread
+// stopped at a breakpoint is rewound to the breakpoint's address.  Must
+// be called on the tracer thread with mu held.
+func (ns *NonStop) trap(tid int, ws syscall.WaitStatus) Event {
+	var regs syscall.PtraceRegs
+	if len(ns.t.bps) == 0 || ptraceGetRegs(tid, &regs) != nil {
+		return ws
+	}
+	if code, err := sigtrapCode(tid); err != nil || code == trapTrace {
+		return ws
+	}
+	addr := breakpointAddr(regs.PC())
+	bp, ok := ns.t.bps[addr]
+	if !ok {
+		return ws
+	}
+	if regs.PC() != addr {
+		regs.SetPC(addr)
+		if ptraceSetRegs(tid, &regs) != nil {
+			return ws
+		}
+	}
+	if !bp.user {
+		return nil
+	}
+	return BreakpointEvent{Status: ws, Addr: addr}
+}
+
+// Forgets a thread that exited, reinserting the breakpoint that it was
+// stepping over, if any, through another stopped thread.  If there is
+// none, the breakpoint is lost.  Called on the thread's wait go routine.
+func (ns *NonStop) remove(tid int) {
+	forget := func() error {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		th, ok := ns.threads[tid]
+		if !ok {
+			return nil
+		}
+		delete(ns.threads, tid)
+		if th.stepping == nil {
+			return nil
+		}
+		if ns.t.State().IsStopped() {
+			ns.reinsert(ns.t.proc.Pid, th)
+			return nil
+		}
+		for other, o := range ns.threads {
+			if o.stopped {
+				ns.reinsert(other, th)
+				break
+			}
+		}
+		return nil
+	}
+	if ns.t.runInternal("threadexit", forget) != nil {
+		// The tracee has exited, and its memory is gone.
+		ns.mu.Lock()
+		delete(ns.threads, tid)
+		ns.mu.Unlock()
+	}
+}
+
+// Handles a clone event stop of the traced thread, which is traced with
+// PTRACE_O_TRACECLONE once NonStop is called.  The new thread is put
+// under non-stop control, or detached if there is none, and the traced
+// thread is resumed as it was last resumed.  Returns the event to send,
+// or nil if the traced thread was resumed.  Called on the wait go
+// routine.
+func (t *Tracee) decodeClone(ws syscall.WaitStatus) Event {
+	resumed := false
+	t.runInternal("clone", func() error {
+		msg, err := syscall.PtraceGetEventMsg(t.proc.Pid)
+		if err != nil {
+			return err
+		}
+		if ns := t.nonStop; ns != nil {
+			ns.mu.Lock()
+			ns.add(int(msg), false, true)
+			ns.mu.Unlock()
+		} else {
+			// The new thread must report its initial stop before
+			// it can be detached.
+			if cws, err := waitPid(int(msg)); err == nil && cws.Stopped() {
+				ptraceDetach(int(msg))
+			}
+		}
+		if t.lastResume == nil {
+			return nil
+		}
+		err = t.resume(Running, t.overBreakpoint(t.lastResume, false))
+		resumed = err == nil
+		return err
+	})
+	if resumed {
+		return nil
+	}
+	return Event(ws)
+}
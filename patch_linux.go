@@ -0,0 +1,103 @@
+package ptrace
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+var errPatchSpansMappings = errors.New("ptrace: patch spans more than one mapping")
+
+// PatchText writes code into the stopped tracee's memory at addr, as a
+// debugger writes breakpoints or patched instructions.  Writes with
+// PokeData normally succeed even on read-only mappings, since the kernel
+// forces them, but some configurations refuse them, for example on a
+// sealed memfd or with a hardened kernel.  PatchText then writes through
+// /proc/pid/mem, and, if that also fails, makes the pages writable with
+// an injected mprotect, writes the code, and restores the pages'
+// protection.  The code must lie within a single mapping.
+func (t *Tracee) PatchText(addr uint64, code []byte) error {
+	return t.Do(func(r Raw) error { return t.patchText(r, addr, code) })
+}
+
+// Writes code to the tracee's memory, as PatchText.  Must be called on
+// the tracer thread.
+func (t *Tracee) patchText(r Raw, addr uint64, code []byte) error {
+	_, err := r.PokeData(uintptr(addr), code)
+	if err == nil || errors.Is(err, ErrNotStopped) || errors.Is(err, ErrTraceeExited) {
+		return err
+	}
+	if writeProcMem(r.Pid(), addr, code) == nil {
+		return nil
+	}
+	if e := t.patchProtected(r, addr, code); e != nil {
+		// The error of the usual write is the most informative.
+		return err
+	}
+	return nil
+}
+
+// Writes code to the tracee's memory through /proc/pid/mem.
+func writeProcMem(pid int, addr uint64, code []byte) error {
+	f, err := os.OpenFile("/proc/"+strconv.Itoa(pid)+"/mem", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteAt(code, int64(addr))
+	return err
+}
+
+// Writes code to the tracee's memory, having made the pages that it
+// spans writable with an injected mprotect, and restores their
+// protection afterward.
+func (t *Tracee) patchProtected(r Raw, addr uint64, code []byte) error {
+	ms, err := t.stopMappings()
+	if err != nil {
+		return err
+	}
+	var m *Mapping
+	for i := range ms {
+		if ms[i].Contains(addr) {
+			m = &ms[i]
+			break
+		}
+	}
+	end := addr + uint64(len(code))
+	if m == nil || end > m.End {
+		return errPatchSpansMappings
+	}
+	page := uint64(os.Getpagesize())
+	start := addr &^ (page - 1)
+	size := (end+page-1)&^(page-1) - start
+	prot := 0
+	if m.Perms&PermRead != 0 {
+		prot |= syscall.PROT_READ
+	}
+	if m.Perms&PermExec != 0 {
+		prot |= syscall.PROT_EXEC
+	}
+	if m.Perms&PermWrite != 0 {
+		prot |= syscall.PROT_WRITE
+	}
+	if err := t.mprotect(start, size, prot|syscall.PROT_WRITE); err != nil {
+		return err
+	}
+	_, err = r.PokeData(uintptr(addr), code)
+	if e := t.mprotect(start, size, prot); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Injects mprotect in the stopped tracee.  Must be called on the tracer
+// thread.
+func (t *Tracee) mprotect(addr, size uint64, prot int) error {
+	nr, _ := SyscallNumber("mprotect")
+	ret, err := t.injectSyscallStopped(nr, []uint64{addr, size, uint64(prot)})
+	if err != nil {
+		return err
+	}
+	return t.opError("mprotect", syscallErrno(ret))
+}
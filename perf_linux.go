@@ -0,0 +1,71 @@
+package ptrace
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// The prefix of struct perf_event_attr up to sample_max_stack, which is
+// PERF_ATTR_SIZE_VER5.  Later kernels accept it as is.
+type perfEventAttr struct {
+	Type             uint32
+	Size             uint32
+	Config           uint64
+	SamplePeriod     uint64
+	SampleType       uint64
+	ReadFormat       uint64
+	Flags            uint64
+	WakeupEvents     uint32
+	BPType           uint32
+	Config1          uint64
+	Config2          uint64
+	BranchSampleType uint64
+	SampleRegsUser   uint64
+	SampleStackUser  uint32
+	ClockID          int32
+	SampleRegsIntr   uint64
+	AuxWatermark     uint32
+	SampleMaxStack   uint16
+	_                uint16
+}
+
+// Bits of perfEventAttr.Flags.
+const (
+	perfFlagDisabled      = 1 << 0
+	perfFlagExcludeKernel = 1 << 5
+	perfFlagExcludeHV     = 1 << 6
+)
+
+// PERF_FLAG_FD_CLOEXEC.
+const perfFlagFDCloexec = 1 << 3
+
+// Opens a perf event counting or sampling the thread pid on any CPU, in
+// the group led by the event open as group, or in its own if group is
+// -1.
+func perfEventOpen(attr *perfEventAttr, pid, group int) (int, error) {
+	attr.Size = uint32(unsafe.Sizeof(*attr))
+	fd, _, e := syscall.Syscall6(syscall.SYS_PERF_EVENT_OPEN, uintptr(unsafe.Pointer(attr)),
+		uintptr(pid), ^uintptr(0), uintptr(group), perfFlagFDCloexec, 0)
+	if e != 0 {
+		return -1, e
+	}
+	return int(fd), nil
+}
+
+// Offsets of the fields of struct perf_event_mmap_page that describe the
+// data and AUX ring buffers.
+const (
+	perfDataHead   = 1024
+	perfDataTail   = 1032
+	perfDataOffset = 1040
+	perfDataSize   = 1048
+	perfAuxHead    = 1056
+	perfAuxTail    = 1064
+	perfAuxOffset  = 1072
+	perfAuxSize    = 1080
+)
+
+// Returns a pointer to a 64-bit field of a mapped perf_event_mmap_page.
+func perfField(page []byte, off int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&page[off]))
+}
@@ -0,0 +1,50 @@
+package ptrace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Returns Yama's ptrace_scope, and whether Yama is enabled.
+func yamaScope() (int, bool) {
+	b, err := os.ReadFile("/proc/sys/kernel/yama/ptrace_scope")
+	if err != nil {
+		return 0, false
+	}
+	scope, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return scope, true
+}
+
+// Converts EPERM into an error that wraps ErrPermission and explains
+// why tracing is not permitted, from Yama's ptrace_scope and whether the
+// tracer has CAP_SYS_PTRACE.  Traceme is whether the tracee requested
+// tracing with PTRACE_TRACEME, rather than being attached to.
+func permissionError(err error, traceme bool) error {
+	if !errors.Is(err, syscall.EPERM) {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %w", ErrPermission, explainPermission(traceme), err)
+}
+
+func explainPermission(traceme bool) string {
+	scope, yama := yamaScope()
+	capPtrace := effectiveCaps()&(1<<capSysPtrace) != 0
+	switch {
+	case yama && scope >= 3:
+		return fmt.Sprintf("yama ptrace_scope=%d disables tracing", scope)
+	case traceme:
+		return "the process is already traced"
+	case yama && scope == 2 && !capPtrace:
+		return "yama ptrace_scope=2 allows tracing only with CAP_SYS_PTRACE"
+	case yama && scope == 1 && !capPtrace:
+		return "yama ptrace_scope=1 allows tracing only descendants without CAP_SYS_PTRACE"
+	case !capPtrace:
+		return "the process belongs to another user, is not dumpable, or is already traced, and the tracer lacks CAP_SYS_PTRACE"
+	default:
+		return "the process is already traced, or a security module denied tracing"
+	}
+}
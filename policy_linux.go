@@ -0,0 +1,181 @@
+package ptrace
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// A Rule matches system call entries and determines what happens to
+// them.
+type Rule struct {
+	// Name identifies the rule in reports.
+	Name string
+	// Syscalls are the names of the system calls that the rule
+	// matches.  If empty, the rule matches every system call.
+	Syscalls []string
+	// Match, if non-nil, must also return true for the rule to match.
+	Match func(SyscallEnterEvent) bool
+	// Action is the action taken for a matching system call.
+	Action Action
+	// Errno is the error returned by the system call if Action is
+	// Deny, or ENOSYS if it is 0.
+	Errno syscall.Errno
+}
+
+// Returns the error returned by a system call denied by the rule.
+func (r *Rule) denyErrno() syscall.Errno {
+	if r.Errno == 0 {
+		return syscall.ENOSYS
+	}
+	return r.Errno
+}
+
+// Matches returns whether the rule matches the system call entry.
+func (r *Rule) Matches(ev SyscallEnterEvent) bool {
+	if len(r.Syscalls) > 0 {
+		name := ev.Name()
+		found := false
+		for _, s := range r.Syscalls {
+			if s == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.Match == nil || r.Match(ev)
+}
+
+// A Policy is an ordered list of rules.  The first rule that matches a
+// system call applies to it.
+type Policy struct {
+	Rules []Rule
+}
+
+// Evaluate returns the first rule that matches the system call entry,
+// and whether any rule matches.
+func (p *Policy) Evaluate(ev SyscallEnterEvent) (*Rule, bool) {
+	for i := range p.Rules {
+		if p.Rules[i].Matches(ev) {
+			return &p.Rules[i], true
+		}
+	}
+	return nil, false
+}
+
+// WithDryRun evaluates the policy against the system call entries of a
+// tracee resumed with Syscall, without denying or modifying anything.
+// Each rule that would have fired is recorded as a Verdict and written
+// to w as a line of JSON; the log can be read back with ReadVerdicts.
+// Write errors are ignored.
+func WithDryRun(p *Policy, w io.Writer) Option {
+	return func(t *Tracee) {
+		log := verdictLog(t, w)
+		t.observers = append(t.observers, func(ev Event) {
+			if enter, ok := ev.(SyscallEnterEvent); ok {
+				if r, ok := p.Evaluate(enter); ok {
+					log(r, enter)
+				}
+			}
+		})
+	}
+}
+
+// WithPolicy enforces the policy on the system call entries of a tracee
+// resumed with Syscall.  A system call matched by a Deny rule is
+// skipped, and fails with the rule's Errno, or ENOSYS if it is 0; one
+// matched by a Kill rule is skipped, and the tracee is killed.  If w is
+// non-nil, each rule that fires is recorded as a Verdict and written to
+// it, as by WithDryRun.  System calls reported by seccomp notification,
+// which do not stop the tracee, are recorded but not enforced.
+func WithPolicy(p *Policy, w io.Writer) Option {
+	return func(t *Tracee) {
+		log := func(*Rule, SyscallEnterEvent) {}
+		if w != nil {
+			log = verdictLog(t, w)
+		}
+		// Pending is the errno to return at the exit of the denied
+		// system call, or 0 if the current system call is not
+		// denied.  It is only accessed on the wait go routine.
+		var pending syscall.Errno
+		t.observers = append(t.observers, func(ev Event) {
+			enter, ok := ev.(SyscallEnterEvent)
+			if !ok {
+				return
+			}
+			pending = 0
+			r, ok := p.Evaluate(enter)
+			if !ok {
+				return
+			}
+			log(r, enter)
+			if r.Action == Allow || enter.Notification != nil {
+				return
+			}
+			s, err := t.syscallStop(t.doInternal)
+			if err != nil || s.SetNr(-1) != nil {
+				// The tracee cannot be stopped from executing the
+				// system call, so it is killed.
+				t.kill()
+				return
+			}
+			if r.Action == Kill {
+				t.kill()
+				return
+			}
+			pending = r.denyErrno()
+		})
+		t.exitErrnos = append(t.exitErrnos, func() syscall.Errno {
+			errno := pending
+			pending = 0
+			return errno
+		})
+	}
+}
+
+// Returns a function that writes the verdict of a rule firing on a
+// system call entry to w, as a line of JSON.  Called on the wait go
+// routine.
+func verdictLog(t *Tracee, w io.Writer) func(*Rule, SyscallEnterEvent) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(r *Rule, enter SyscallEnterEvent) {
+		v := Verdict{
+			Time:    enter.Time,
+			Pid:     t.proc.Pid,
+			Rule:    r.Name,
+			Action:  r.Action,
+			Syscall: enter.Name(),
+			Args:    t.verdictArgs(enter),
+		}
+		if r.Action == Deny {
+			v.Errno = r.denyErrno().Error()
+		}
+		mu.Lock()
+		enc.Encode(v)
+		mu.Unlock()
+	}
+}
+
+// Returns the arguments of a system call entry for its verdict, decoded
+// according to the system call's prototype, or in hexadecimal if it is
+// unknown.  Called on the wait go routine.
+func (t *Tracee) verdictArgs(enter SyscallEnterEvent) []string {
+	if enter.Decoded != nil {
+		return enter.Decoded
+	}
+	limits := DecodeLimits{MaxString: defaultMaxString, MaxElements: defaultMaxElements}
+	if dec := t.decodeSyscallEntry(enter, &limits); dec != nil {
+		return dec
+	}
+	args := make([]string, len(enter.Args))
+	for i, a := range enter.Args {
+		args[i] = "0x" + strconv.FormatUint(a, 16)
+	}
+	return args
+}
@@ -0,0 +1,70 @@
+package ptrace
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+func TestVerdictErrno(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{"deny", Rule{Action: Deny, Errno: syscall.EPERM}, syscall.EPERM.Error()},
+		{"deny without errno", Rule{Action: Deny}, syscall.ENOSYS.Error()},
+		{"allow", Rule{Action: Allow, Errno: syscall.EPERM}, ""},
+		{"kill", Rule{Action: Kill}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enter := SyscallEnterEvent{Nr: syscall.SYS_OPENAT, Decoded: []string{`"/etc/passwd"`}}
+			verdictLog(fakeTracee(1), &buf)(&test.rule, enter)
+			vs, err := ReadVerdicts(&buf)
+			if err != nil {
+				t.Fatalf("ReadVerdicts: %v", err)
+			}
+			if len(vs) != 1 {
+				t.Fatalf("got %d verdicts, want 1", len(vs))
+			}
+			if vs[0].Errno != test.want {
+				t.Errorf("got errno %q, want %q", vs[0].Errno, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDenyExitErrno(t *testing.T) {
+	p := &Policy{Rules: []Rule{{
+		Syscalls: []string{"write"},
+		Match:    func(ev SyscallEnterEvent) bool { return ev.Args[0] == 1 },
+		Action:   Deny,
+		Errno:    syscall.EPERM,
+	}}}
+	tr := execStopped(t, []string{"/bin/sh", "-c", "echo hello"}, WithPolicy(p, nil))
+	defer tr.Close()
+	denied := false
+	for {
+		if err := tr.Syscall(); err != nil {
+			t.Fatalf("Syscall: %v", err)
+		}
+		ev, ok := <-tr.Events()
+		if !ok {
+			t.Fatal("no write to stdout")
+		}
+		switch ev := ev.(type) {
+		case SyscallEnterEvent:
+			denied = ev.Name() == "write" && ev.Args[0] == 1
+		case SyscallExitEvent:
+			if !denied {
+				continue
+			}
+			if ev.Errno != syscall.EPERM || ev.Ret != -int64(syscall.EPERM) {
+				t.Errorf("exit: got %d (%v), want %d (%v)", ev.Ret, ev.Errno, -int64(syscall.EPERM), syscall.EPERM)
+			}
+			return
+		}
+	}
+}
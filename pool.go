@@ -0,0 +1,179 @@
+//go:build linux || darwin
+
+package ptrace
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+)
+
+var errPoolClosed = errors.New("ptrace: tracer pool closed")
+
+// A TracerPool is a fixed set of tracer threads shared by the tracees
+// created WithTracerPool.  Without a pool, each Tracee locks an OS thread
+// of its own, since the kernel accepts the ptrace requests for a tracee
+// only from the thread that attached to it; tracing hundreds of processes
+// then uses hundreds of threads.  With a pool, each tracee is assigned
+// the thread with the fewest tracees when it is created, and its
+// commands, and those of its children followed WithFollowForks, are run
+// on that thread, interleaved with those of the thread's other tracees.
+// (The wait go routine of each tracee still occupies a thread while it
+// is blocked waiting for the tracee to stop, but the runtime reuses the
+// thread once the tracee exits.)
+//
+// A TracerPool may be used from multiple go routines at once.
+type TracerPool struct {
+	mu      sync.Mutex
+	threads []*tracerThread
+	closed  bool
+	// Closing is closed by Close, ending the threads.
+	closing chan struct{}
+}
+
+// A tracerThread is a locked OS thread of a TracerPool.
+type tracerThread struct {
+	cmds chan func()
+	// Done is closed when the thread returns.
+	done chan struct{}
+	// Tracees is the number of open tracees assigned to the thread.
+	// It is guarded by the pool's mu.
+	tracees int
+}
+
+// NewTracerPool returns a pool of n tracer threads.  If n is not
+// positive, the pool has a single thread.
+func NewTracerPool(n int) *TracerPool {
+	if n <= 0 {
+		n = 1
+	}
+	p := &TracerPool{closing: make(chan struct{})}
+	for i := 0; i < n; i++ {
+		th := &tracerThread{cmds: make(chan func()), done: make(chan struct{})}
+		p.threads = append(p.threads, th)
+		go th.run(p.closing)
+	}
+	return p
+}
+
+// WithTracerPool runs the tracee's commands on a thread of the pool,
+// rather than on a thread of its own.  The tracee must be closed before
+// the pool.
+//
+// A command holds its thread until it returns, so the commands that run
+// the tracee and wait for it to stop again stall the other tracees on
+// the thread meanwhile: StepN, StepUntil, and StepRange; StepOver,
+// StepOut, and RunUntil; InjectSyscall, CallFunction, and Checkpoint.
+// Running a long step loop, or calling a function that blocks, in a
+// pooled tracee delays the commands of its neighbors.  Commands that
+// only resume the tracee, such as Continue, do not wait for it, nor does
+// running it to its entry point WithStopAtEntry, which is done from its
+// wait go routine.
+func WithTracerPool(p *TracerPool) Option {
+	return func(t *Tracee) { t.pool = p }
+}
+
+// Close ends the pool's threads, and waits for them to return.  Any
+// tracees of the pool that are still attached are detached, and their
+// commands fail with ErrTraceeExited.  Calling Close more than once is
+// harmless.
+func (p *TracerPool) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.closing)
+	}
+	p.mu.Unlock()
+	for _, th := range p.threads {
+		<-th.done
+	}
+	return nil
+}
+
+// Returns the thread with the fewest tracees, counting the tracee to
+// which it is assigned, or an error if the pool is closed.
+func (p *TracerPool) assign() (*tracerThread, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, errPoolClosed
+	}
+	th := p.threads[0]
+	for _, u := range p.threads[1:] {
+		if u.tracees < th.tracees {
+			th = u
+		}
+	}
+	th.tracees++
+	return th, nil
+}
+
+// Unassigns a tracee from its thread, once it is closed.
+func (p *TracerPool) release(th *tracerThread) {
+	p.mu.Lock()
+	th.tracees--
+	p.mu.Unlock()
+}
+
+// Runs the commands sent to the thread until closing is closed.
+func (th *tracerThread) run(closing <-chan struct{}) {
+	runtime.LockOSThread()
+	defer close(th.done)
+	for {
+		select {
+		case cmd := <-th.cmds:
+			runPooledCommand(cmd)
+		case <-closing:
+			// As for a tracee's own thread, returning with the OS
+			// thread locked terminates it, detaching its tracees.
+			return
+		}
+	}
+}
+
+// Runs a command on a pool thread.  Commands sent by run recover their
+// own panics, breaking their tracee; a panic in any other command is
+// recovered so that the thread, and the other tracees attached to it,
+// survive.
+func runPooledCommand(cmd func()) {
+	defer func() { recover() }()
+	cmd()
+}
+
+// Starts the process on a thread of the tracee's pool, assigning the
+// tracee to the thread, and starts the wait go routine.
+func (t *Tracee) startPooled(start func() (*os.Process, error)) error {
+	th, err := t.pool.assign()
+	if err != nil {
+		return err
+	}
+	t.thread = th
+	t.cmds, t.traceDone = th.cmds, th.done
+	done := make(chan error, 1)
+	cmd := func() {
+		p, err := start()
+		if err == nil {
+			t.proc = p
+			go t.wait()
+		}
+		done <- err
+	}
+	select {
+	case th.cmds <- cmd:
+		err = <-done
+	case <-th.done:
+		err = errPoolClosed
+	}
+	if err != nil {
+		t.pool.release(th)
+	}
+	return err
+}
+
+// Returns whether the tracee shares its tracer thread, with the tracee
+// that it was forked from or with the tracees of a pool, in which case
+// the thread does not end when the tracee is closed.
+func (t *Tracee) sharesThread() bool {
+	return t.owner != nil || t.pool != nil
+}
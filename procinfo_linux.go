@@ -0,0 +1,93 @@
+package ptrace
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A procCache caches the contents of the files of /proc/pid that only
+// change when the tracee executes a new program.
+type procCache struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+// Cmdline returns the tracee's command line arguments.  They are read
+// once per program that the tracee executes.
+func (t *Tracee) Cmdline() ([]string, error) {
+	s, err := t.procFile("cmdline", readProcFile)
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(s), nil
+}
+
+// Environ returns the tracee's environment, as it was when the tracee
+// executed its program, in the form "key=value".  Changes that the
+// program makes to its environment afterward are not reflected.  It is
+// read once per program that the tracee executes.
+func (t *Tracee) Environ() ([]string, error) {
+	s, err := t.procFile("environ", readProcFile)
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(s), nil
+}
+
+// ExePath returns the path of the tracee's executable.  It is read once
+// per program that the tracee executes.
+func (t *Tracee) ExePath() (string, error) {
+	return t.procFile("exe", os.Readlink)
+}
+
+// Cwd returns the tracee's current working directory.  Unlike the
+// other process metadata, it is read each time, since the tracee can
+// change it at any time.
+func (t *Tracee) Cwd() (string, error) {
+	return os.Readlink("/proc/" + strconv.Itoa(t.proc.Pid) + "/cwd")
+}
+
+// Returns the cached contents of the named file of /proc/pid, reading it
+// with read if it is not cached.
+func (t *Tracee) procFile(name string, read func(string) (string, error)) (string, error) {
+	t.procs.mu.Lock()
+	defer t.procs.mu.Unlock()
+	if s, ok := t.procs.files[name]; ok {
+		return s, nil
+	}
+	s, err := read("/proc/" + strconv.Itoa(t.proc.Pid) + "/" + name)
+	if err != nil {
+		return "", err
+	}
+	if t.procs.files == nil {
+		t.procs.files = make(map[string]string)
+	}
+	t.procs.files[name] = s
+	return s, nil
+}
+
+// Clears the cache when the tracee executes a new program.  Called on
+// the wait go routine.
+func (t *Tracee) observeProcInfo(ev Event) {
+	if _, ok := ev.(ExecEvent); !ok {
+		return
+	}
+	t.procs.mu.Lock()
+	defer t.procs.mu.Unlock()
+	t.procs.files = nil
+}
+
+func readProcFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
+
+// Splits a list of NUL-terminated strings.
+func splitNul(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\x00"), "\x00")
+}
@@ -0,0 +1,86 @@
+package ptrace
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A Proc is a process found by FindProcs.
+type Proc struct {
+	Pid int
+	// Comm is the command name, from /proc/pid/comm.  The kernel
+	// truncates it to 15 bytes.
+	Comm string
+	// Cmdline is the process's command line arguments.  It is empty
+	// for kernel threads.
+	Cmdline []string
+	// Exe is the path of the process's executable, or empty if it
+	// cannot be read, as for a process of another user.
+	Exe string
+}
+
+// FindProcs scans /proc for processes, and returns those for which match
+// returns true, sorted by process ID.  A process that exits during the
+// scan is omitted.  The tracer's own process is never returned.
+func FindProcs(match func(Proc) bool) ([]Proc, error) {
+	pids, err := listTasks("/proc")
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var ps []Proc
+	for _, pid := range pids {
+		if pid == self {
+			continue
+		}
+		p, ok := readProc(pid)
+		if ok && match(p) {
+			ps = append(ps, p)
+		}
+	}
+	return ps, nil
+}
+
+// FindProcsByName returns the processes, as by FindProcs, whose command
+// name, executable, or first command line argument is named name.  The
+// executable and argument match by their base name, or by their full
+// path if name contains a slash.  The command name matches if it is
+// name truncated as by the kernel.
+func FindProcsByName(name string) ([]Proc, error) {
+	comm := name
+	if len(comm) > 15 {
+		comm = comm[:15]
+	}
+	matchPath := func(p string) bool {
+		if p == "" {
+			return false
+		}
+		if strings.ContainsRune(name, '/') {
+			return p == name
+		}
+		return filepath.Base(p) == name
+	}
+	return FindProcs(func(p Proc) bool {
+		if !strings.ContainsRune(name, '/') && p.Comm == comm {
+			return true
+		}
+		return matchPath(p.Exe) || len(p.Cmdline) > 0 && matchPath(p.Cmdline[0])
+	})
+}
+
+// Reads a process's Proc, returning false if it exited.
+func readProc(pid int) (Proc, bool) {
+	dir := "/proc/" + strconv.Itoa(pid)
+	comm, err := os.ReadFile(dir + "/comm")
+	if err != nil {
+		return Proc{}, false
+	}
+	p := Proc{Pid: pid, Comm: strings.TrimSuffix(string(comm), "\n")}
+	if b, err := os.ReadFile(dir + "/cmdline"); err == nil {
+		p.Cmdline = splitNul(string(b))
+	}
+	p.Exe, _ = os.Readlink(dir + "/exe")
+	return p, true
+}
@@ -0,0 +1,388 @@
+package ptrace
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The maximum number of frames of a sampled stack.
+const maxProfileDepth = 64
+
+// A Profiler samples the call stacks of a running tracee at a fixed
+// period, by interrupting it as with Stop, reading its registers and
+// stack, and resuming it as it was resumed before.  It needs no
+// instrumentation of the tracee.  The samples are written as a profile
+// in the pprof format.
+//
+// Stacks are unwound with frame pointers, so frames of code that does
+// not maintain them are missed.  The tracee is not sampled while it is
+// stopped, or while another command is waiting for it to stop.  If the
+// tracee stops for another reason just as it is interrupted, the
+// interrupting SIGSTOP is reported as a separate stop once the tracee
+// is resumed, as with Stop.
+type Profiler struct {
+	t      *Tracee
+	period time.Duration
+	start  time.Time
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	samples map[string]*profileSample
+	// Mappings are the executable file mappings of the tracee, as of
+	// the last sample outside them.
+	mappings []Mapping
+	// Names are the functions of the sampled PCs of the executable,
+	// named while the tracee is alive, or empty if they are unknown.
+	names map[uint64]string
+	end   time.Time
+	// Err is the error that ended sampling, if any.
+	err error
+}
+
+type profileSample struct {
+	// Stack is the sampled PCs, innermost first.
+	stack []uint64
+	count int64
+}
+
+// The period of a Profiler if none is given.
+const defaultProfilePeriod = 10 * time.Millisecond
+
+// StartProfiler starts sampling the running tracee's stack every
+// period, or every 10ms if period is not positive, until the profiler
+// is stopped or the tracee exits.
+func (t *Tracee) StartProfiler(period time.Duration) *Profiler {
+	if period <= 0 {
+		period = defaultProfilePeriod
+	}
+	ctx, cancel := context.WithCancel(t.ctx)
+	p := &Profiler{
+		t:       t,
+		period:  period,
+		start:   time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		samples: make(map[string]*profileSample),
+		names:   make(map[uint64]string),
+	}
+	go p.run(ctx)
+	return p
+}
+
+func (p *Profiler) run(ctx context.Context) {
+	defer close(p.done)
+	tick := time.NewTicker(p.period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		if err := p.sample(ctx); err != nil {
+			p.mu.Lock()
+			if !errors.Is(err, ErrTraceeExited) && ctx.Err() == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Takes a sample of the tracee's stack, if it is running.
+func (p *Profiler) sample(ctx context.Context) error {
+	t := p.t
+	why, err := t.Stop(ctx)
+	switch {
+	case errors.Is(err, errStopBusy) || errors.Is(err, ErrNotAttached):
+		return nil
+	case err != nil:
+		return err
+	case why == StopExited:
+		return ErrTraceeExited
+	case why != StopRequested:
+		return nil
+	}
+	var stack []uint64
+	err = t.run("profile", func() error {
+		r := Raw{t}
+		var regs syscall.PtraceRegs
+		if err := r.GetRegs(&regs); err != nil {
+			return err
+		}
+		stack = callStack(r, &regs)
+		if t.lastResume == nil {
+			return t.resume(Running, t.overBreakpoint(func() error { return ptraceCont(t.proc.Pid, 0) }, false))
+		}
+		return t.resume(Running, t.lastResume)
+	})
+	if err != nil {
+		return err
+	}
+	p.symbolize(stack)
+	key := make([]byte, 0, 8*len(stack))
+	for _, pc := range stack {
+		key = binary.LittleEndian.AppendUint64(key, pc)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.samples[string(key)]
+	if s == nil {
+		s = &profileSample{stack: stack}
+		p.samples[string(key)] = s
+	}
+	s.count++
+	return nil
+}
+
+// Records the mappings and function names of newly sampled PCs, while
+// the tracee is alive to look them up.  Only the executable's functions
+// are named; those of shared libraries are left to pprof to symbolize
+// from the mapped files.
+func (p *Profiler) symbolize(stack []uint64) {
+	p.mu.Lock()
+	mappings := p.mappings
+	var pcs []uint64
+	for _, pc := range stack {
+		if _, ok := p.names[pc]; !ok {
+			pcs = append(pcs, pc)
+		}
+	}
+	p.mu.Unlock()
+	if len(pcs) == 0 {
+		return
+	}
+	refresh := false
+	for _, pc := range pcs {
+		if mappingOf(mappings, pc) < 0 {
+			refresh = true
+		}
+	}
+	if refresh {
+		ms, _ := p.t.Mappings()
+		mappings = mappings[:0:0]
+		for _, m := range ms {
+			if m.Perms&PermExec != 0 && m.Path != "" && !strings.HasPrefix(m.Path, "[") {
+				mappings = append(mappings, m)
+			}
+		}
+	}
+	info, _ := p.t.debugInfo()
+	exe, _ := os.Readlink("/proc/" + strconv.Itoa(p.t.proc.Pid) + "/exe")
+	names := make([]string, len(pcs))
+	for i, pc := range pcs {
+		j := mappingOf(mappings, pc)
+		if info == nil || j < 0 || mappings[j].Path != exe {
+			continue
+		}
+		if fn, err := info.funcForPC(pc); err == nil {
+			names[i] = fn.name
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mappings = mappings
+	for i, pc := range pcs {
+		p.names[pc] = names[i]
+	}
+}
+
+// Returns the index of the mapping containing addr, or -1.
+func mappingOf(ms []Mapping, addr uint64) int {
+	for i, m := range ms {
+		if m.Contains(addr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the PCs of the call stack, innermost first, by following the
+// chain of frame pointers.  The PCs of callers are the addresses of
+// their call instructions, one byte before the return address, so that
+// they symbolize to the call.  Must be called on the tracer thread.
+func callStack(r Raw, regs *syscall.PtraceRegs) []uint64 {
+	stack := []uint64{regs.PC()}
+	fp := framePointer(regs)
+	for fp != 0 && len(stack) < maxProfileDepth {
+		next, err := readWord(r, fp)
+		if err != nil {
+			break
+		}
+		ra, err := readWord(r, fp+8)
+		if err != nil || ra == 0 {
+			break
+		}
+		stack = append(stack, ra-1)
+		// The stack grows down, so callers' frames are above.
+		if next <= fp {
+			break
+		}
+		fp = next
+	}
+	return stack
+}
+
+// Stop stops sampling, and returns the error that stopped it early, if
+// any.  Stop waits for a sample that is in progress to finish.
+func (p *Profiler) Stop() error {
+	p.cancel()
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.end.IsZero() {
+		p.end = time.Now()
+	}
+	return p.err
+}
+
+// WriteProfile writes the samples taken so far to w as a gzipped pprof
+// profile.  Each sample has a count and an estimated CPU time, the
+// count times the period.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	end := p.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	var b profileBuffer
+	strs := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		i, ok := strs[s]
+		if !ok {
+			i = int64(len(strs))
+			strs[s] = i
+		}
+		return i
+	}
+	valueType := func(typ, unit string) profileBuffer {
+		var v profileBuffer
+		v.int(1, str(typ))
+		v.int(2, str(unit))
+		return v
+	}
+	b.message(1, valueType("samples", "count"))
+	b.message(1, valueType("cpu", "nanoseconds"))
+	for i, m := range p.mappings {
+		var mb profileBuffer
+		mb.uint(1, uint64(i+1))
+		mb.uint(2, m.Start)
+		mb.uint(3, m.End)
+		mb.uint(4, m.Offset)
+		mb.int(5, str(m.Path))
+		b.message(3, mb)
+	}
+
+	locs := make(map[uint64]uint64)
+	funcs := make(map[string]uint64)
+	location := func(pc uint64) uint64 {
+		if id, ok := locs[pc]; ok {
+			return id
+		}
+		id := uint64(len(locs) + 1)
+		locs[pc] = id
+		var lb profileBuffer
+		lb.uint(1, id)
+		lb.uint(2, uint64(mappingOf(p.mappings, pc)+1))
+		lb.uint(3, pc)
+		if name := p.names[pc]; name != "" {
+			fid, ok := funcs[name]
+			if !ok {
+				fid = uint64(len(funcs) + 1)
+				funcs[name] = fid
+				var fb profileBuffer
+				fb.uint(1, fid)
+				fb.int(2, str(name))
+				fb.int(3, str(name))
+				b.message(5, fb)
+			}
+			var line profileBuffer
+			line.uint(1, fid)
+			lb.message(4, line)
+		}
+		b.message(4, lb)
+		return id
+	}
+	for _, s := range p.samples {
+		ids := make([]uint64, len(s.stack))
+		for i, pc := range s.stack {
+			ids[i] = location(pc)
+		}
+		var sb profileBuffer
+		sb.packed(1, ids)
+		sb.packed(2, []uint64{uint64(s.count), uint64(s.count * int64(p.period))})
+		b.message(2, sb)
+	}
+
+	table := make([]string, len(strs))
+	for s, i := range strs {
+		table[i] = s
+	}
+	for _, s := range table {
+		b.bytes(6, []byte(s))
+	}
+	b.int(9, p.start.UnixNano())
+	b.int(10, int64(end.Sub(p.start)))
+	b.message(11, valueType("cpu", "nanoseconds"))
+	b.int(12, int64(p.period))
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(b); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// A profileBuffer encodes a protocol buffer message, as used by the
+// pprof format.
+type profileBuffer []byte
+
+func (b *profileBuffer) varint(v uint64) {
+	*b = binary.AppendUvarint(*b, v)
+}
+
+// Encodes a varint field, omitting it if it is zero.
+func (b *profileBuffer) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+func (b *profileBuffer) int(field int, v int64) {
+	b.uint(field, uint64(v))
+}
+
+// Encodes a length-delimited field.
+func (b *profileBuffer) bytes(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *profileBuffer) message(field int, m profileBuffer) {
+	b.bytes(field, m)
+}
+
+// Encodes a packed repeated varint field.
+func (b *profileBuffer) packed(field int, vs []uint64) {
+	var p profileBuffer
+	for _, v := range vs {
+		p.varint(v)
+	}
+	b.bytes(field, p)
+}
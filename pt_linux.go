@@ -0,0 +1,214 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	errNoProcessorTrace     = errors.New("ptrace: Intel Processor Trace is not available")
+	errProcessorTraceClosed = errors.New("ptrace: processor trace is closed")
+)
+
+// The file holding the dynamic perf event type of Intel PT.
+const ptTypePath = "/sys/bus/event_source/devices/intel_pt/type"
+
+// Bits of the Intel PT event config, which follow IA32_RTIT_CTL.
+const (
+	ptConfigTSC    = 1 << 10
+	ptConfigBranch = 1 << 13
+)
+
+// The default size of the AUX buffer of a ProcessorTrace.
+const ptDefaultSize = 4 << 20
+
+// The number of pages of the data buffer, which holds the records
+// describing the AUX buffer.  It must be a power of two.
+const ptDataPages = 8
+
+// PERF_RECORD_AUX and its PERF_AUX_FLAG_TRUNCATED flag.
+const (
+	perfRecordAux       = 11
+	perfAuxFlagTruncate = 1
+)
+
+// A ProcessorTrace is an Intel Processor Trace of the user-space control
+// flow of the tracee, started by Tracee.StartProcessorTrace.  The
+// processor writes the trace to a buffer shared with the tracer as the
+// tracee runs, without stopping it.  The trace is the raw packet stream,
+// which WriteTo copies out to be decoded offline, for example with
+// libipt's ptxed, given the tracee's executable and libraries at the
+// addresses reported by Mappings.
+type ProcessorTrace struct {
+	mu sync.Mutex
+	fd int
+	// Page is the perf_event_mmap_page followed by the data buffer.
+	page []byte
+	aux  []byte
+	// Truncated is set when the buffer filled.
+	truncated bool
+	// Charge is the buffers' charge to the tracee's memory account.
+	mem    *memAccount
+	charge *memCharge
+}
+
+// StartProcessorTrace starts an Intel Processor Trace of the tracee's
+// thread, into a buffer of at least size bytes; if size is 0, the
+// buffer is 4 MiB.  Only user-space execution is traced.  If the buffer
+// fills before WriteTo empties it, tracing stops and Truncated reports
+// true, so size should be large enough to hold the trace between calls
+// to WriteTo.  The buffers are charged to the tracee as BufferMemory
+// until Close.  An error is returned if the processor or kernel does not
+// support Intel PT, or if perf_event_paranoid forbids it.
+func (t *Tracee) StartProcessorTrace(size int) (*ProcessorTrace, error) {
+	typ, err := processorTraceType()
+	if err != nil {
+		return nil, err
+	}
+	pageSize := os.Getpagesize()
+	if size <= 0 {
+		size = ptDefaultSize
+	}
+	// The AUX buffer is a power of two pages.
+	auxSize := pageSize
+	for auxSize < size {
+		auxSize *= 2
+	}
+	attr := perfEventAttr{
+		Type:   typ,
+		Config: ptConfigTSC | ptConfigBranch,
+		Flags:  perfFlagExcludeKernel | perfFlagExcludeHV,
+	}
+	fd, err := perfEventOpen(&attr, t.proc.Pid, -1)
+	if err != nil {
+		return nil, t.opError("perf_event_open", err)
+	}
+	p := &ProcessorTrace{fd: fd}
+	dataSize := (1 + ptDataPages) * pageSize
+	p.page, err = syscall.Mmap(fd, 0, dataSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, t.opError("mmap", err)
+	}
+	// The AUX buffer is mapped after the data buffer, once its place
+	// is given in the control page.  It is mapped writable, so that the
+	// kernel does not overwrite data that has not been read.
+	atomic.StoreUint64(perfField(p.page, perfAuxOffset), uint64(dataSize))
+	atomic.StoreUint64(perfField(p.page, perfAuxSize), uint64(auxSize))
+	p.aux, err = syscall.Mmap(fd, int64(dataSize), auxSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		syscall.Munmap(p.page)
+		syscall.Close(fd)
+		return nil, t.opError("mmap", err)
+	}
+	p.mem, p.charge = &t.mem, t.mem.charge(BufferMemory, int64(dataSize+auxSize), nil)
+	return p, nil
+}
+
+// Returns the perf event type of Intel PT.
+func processorTraceType() (uint32, error) {
+	b, err := os.ReadFile(ptTypePath)
+	if err != nil {
+		return 0, errNoProcessorTrace
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	if err != nil {
+		return 0, errNoProcessorTrace
+	}
+	return uint32(n), nil
+}
+
+// WriteTo writes the trace collected since the last call to w, and frees
+// its space in the buffer.  It can be called while the tracee runs.
+func (p *ProcessorTrace) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.aux == nil {
+		return 0, errProcessorTraceClosed
+	}
+	p.readRecords()
+	head := atomic.LoadUint64(perfField(p.page, perfAuxHead))
+	tail := atomic.LoadUint64(perfField(p.page, perfAuxTail))
+	size := uint64(len(p.aux))
+	var total int64
+	for tail < head {
+		off := tail % size
+		end := off + head - tail
+		if end > size {
+			end = size
+		}
+		n, err := w.Write(p.aux[off:end])
+		tail += uint64(n)
+		total += int64(n)
+		if err != nil {
+			atomic.StoreUint64(perfField(p.page, perfAuxTail), tail)
+			return total, err
+		}
+	}
+	atomic.StoreUint64(perfField(p.page, perfAuxTail), tail)
+	return total, nil
+}
+
+// Consumes the records of the data buffer, noting whether the AUX buffer
+// filled.
+func (p *ProcessorTrace) readRecords() {
+	data := p.page[os.Getpagesize():]
+	size := uint64(len(data))
+	head := atomic.LoadUint64(perfField(p.page, perfDataHead))
+	tail := atomic.LoadUint64(perfField(p.page, perfDataTail))
+	// Records are 8-byte aligned, so their headers do not wrap.
+	for tail < head {
+		hdr := data[tail%size:]
+		typ := binary.NativeEndian.Uint32(hdr)
+		n := uint64(binary.NativeEndian.Uint16(hdr[6:]))
+		if n == 0 {
+			break
+		}
+		if typ == perfRecordAux {
+			// The flags follow the header, aux_offset, and
+			// aux_size.
+			var flags [8]byte
+			for i := range flags {
+				flags[i] = data[(tail+24+uint64(i))%size]
+			}
+			if binary.NativeEndian.Uint64(flags[:])&perfAuxFlagTruncate != 0 {
+				p.truncated = true
+			}
+		}
+		tail += n
+	}
+	atomic.StoreUint64(perfField(p.page, perfDataTail), head)
+}
+
+// Truncated returns whether the buffer filled, so that tracing stopped
+// and the trace written by WriteTo is incomplete.
+func (p *ProcessorTrace) Truncated() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.aux != nil {
+		p.readRecords()
+	}
+	return p.truncated
+}
+
+// Close stops the trace and frees its buffer.  Trace data that has not
+// been written by WriteTo is lost.
+func (p *ProcessorTrace) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.aux == nil {
+		return errProcessorTraceClosed
+	}
+	syscall.Munmap(p.aux)
+	syscall.Munmap(p.page)
+	p.aux, p.page = nil, nil
+	p.mem.release(p.charge)
+	return syscall.Close(p.fd)
+}
@@ -1,29 +1,153 @@
+//go:build linux || darwin
+
 // Package ptrace provides an interface to the ptrace system call.
+//
+// On Linux, the full interface is supported.  On Darwin, tracing is
+// implemented with the BSD ptrace requests that the kernel still
+// supports, and memory, registers, and exceptions with the tracee's Mach
+// task port; see ptrace_darwin.go for its limitations.
 package ptrace
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"syscall"
 )
 
-var (
-	// ErrExited is returned when a command is executed on a tracee
-	// that has already exited.
-	ErrExited = errors.New("tracee exited")
-)
-
 // An Event is sent on a Tracee's event channel whenever it changes state.
 type Event interface{}
 
+// A ClosePolicy determines what Close does with a tracee that has not
+// yet exited.
+type ClosePolicy int
+
+const (
+	// KillOnClose kills the tracee.  This is the default policy.
+	KillOnClose ClosePolicy = iota
+	// DetachOnClose detaches the tracee, allowing it to continue its
+	// execution normally.
+	DetachOnClose
+	// StopOnClose detaches the tracee, leaving it stopped as by
+	// SIGSTOP, so that another tracer can attach to it, or it can be
+	// resumed with SIGCONT.
+	StopOnClose
+)
+
+// An Option configures a Tracee created by Exec or Attach.
+type Option func(*Tracee)
+
+// WithClosePolicy sets the policy used by Close for a tracee that has not
+// yet exited.
+func WithClosePolicy(p ClosePolicy) Option {
+	return func(t *Tracee) { t.policy = p }
+}
+
+// WithContext sets a context for the tracee's commands.  Once the
+// context is done, commands that have not yet completed return the
+// context's error; the tracee itself is unaffected.  The commands that
+// the tracer issues itself, such as those handling the tracee's stops
+// and those of Close, are not cancelled by the context.
+func WithContext(ctx context.Context) Option {
+	return func(t *Tracee) { t.ctx = ctx }
+}
+
 // A Tracee is a process that is being traced.
+//
+// A Tracee's methods may be called from multiple go routines at once,
+// including concurrently with Close.  Commands are sent to the tracer
+// thread, which runs them one at a time.  The command channel is never
+// closed; once the tracee is closed, a command that has not been sent
+// returns ErrTraceeExited instead.
 type Tracee struct {
 	proc   *os.Process
 	events chan Event
 	err    chan error
+	// EventBuffer is the capacity of the events channel, or
+	// UnboundedEvents, in which case queue holds the events that are
+	// not yet sent on it.
+	eventBuffer int
+	queue       *eventQueue
+
+	cmds   chan func()
+	ctx    context.Context
+	policy ClosePolicy
+	mem    memAccount
+
+	// State holds the tracee's State.
+	state atomic.Int32
+	// Broken is the error of the first command that panicked on the
+	// tracer thread, or of the tracer failing to undo its own change
+	// to the tracee, if any.
+	broken atomic.Pointer[error]
+	// Observers are called by the wait go routine with each event
+	// before it is sent on the events channel.
+	observers []func(Event)
+	// Subs are the subscriptions of Subscribe.  SubsClosed is set once
+	// the wait go routine returns, and no more subscriptions are
+	// added.  Both are guarded by subsMu.
+	subsMu     sync.Mutex
+	subs       map[*subscription]bool
+	subsClosed bool
+	// Intercept, if non-nil, is called by the wait go routine with
+	// each wait status before it is decoded.  If it returns true, the
+	// status is consumed, and no event is sent for it.
+	intercept atomic.Pointer[func(syscall.WaitStatus) bool]
+
+	// LastResume is the function that last resumed the tracee, so
+	// that the tracee can be resumed the same way after a stop that
+	// is handled internally.  It is only accessed on the tracer thread.
+	lastResume func() error
+	// SignalResume resumes the tracee as Continue, SingleStep, or
+	// Syscall last did, delivering a signal, for a signal policy.  It
+	// is only accessed on the tracer thread.
+	signalResume func(sig syscall.Signal) error
+
+	// OsTracee holds operating system specific fields.
+	osTracee
+
+	// EventsMu guards closing the events channel against
+	// non-blocking sends from outside of the wait go routine.
+	eventsMu     sync.Mutex
+	eventsClosed bool
+
+	closeOnce sync.Once
+	closeErr  error
+	// ExitStatus is the tracee's exit status, if exited is true.  They
+	// are set by the wait go routine, and may be read once waitDone is
+	// closed.
+	exitStatus syscall.WaitStatus
+	exited     bool
+	// Closing is closed when Close is called.  Commands and events are
+	// no longer delivered once it is closed.
+	closing chan struct{}
+	// Killing is closed when the tracee is killed by Kill or Close.
+	// Events are no longer delivered once it is closed.
+	killing  chan struct{}
+	killOnce sync.Once
+
+	// TraceDone and waitDone are closed when the tracer and wait
+	// go routines return, respectively.
+	traceDone chan struct{}
+	waitDone  chan struct{}
+	// Owner, if non-nil, is the tracee whose tracer go routine, and
+	// its cmds and traceDone, this tracee shares, because it is a
+	// child process that was attached when the owner forked.
+	owner *Tracee
+	// Pool, if non-nil, is the pool whose thread, thread, runs the
+	// tracee's commands, for WithTracerPool.
+	pool   *TracerPool
+	thread *tracerThread
+}
 
-	cmds chan func()
+// Pid returns the process ID of the tracee.
+func (t *Tracee) Pid() int {
+	return t.proc.Pid
 }
 
 // Events returns the events channel for the tracee.
@@ -31,26 +155,105 @@ func (t *Tracee) Events() <-chan Event {
 	return t.events
 }
 
+// NextEvent returns the next event from the events channel, or an error
+// if the context is done before an event arrives.  If the events channel
+// is closed, ErrTraceeExited is returned.
+func (t *Tracee) NextEvent(ctx context.Context) (Event, error) {
+	select {
+	case ev, ok := <-t.events:
+		if !ok {
+			return nil, ErrTraceeExited
+		}
+		return ev, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // Exec executes a process with tracing enabled, returning the Tracee
-// or an error if an error occurs while executing the process.
-func Exec(name string, argv []string) (*Tracee, error) {
+// or an error if an error occurs while executing the process.  Name is
+// the path of the program, and argv is passed to it as is, so argv[0]
+// should be the program name; see ExecCommand.
+func Exec(name string, argv []string, opts ...Option) (*Tracee, error) {
+	t, err := newTracee(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = t.launch(func() (*os.Process, error) { return startProcess(name, argv) })
+	if err != nil {
+		return nil, err
+	}
+	if err := t.ready(); err != nil {
+		t.Kill()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Returns a new Tracee with the options applied, or an error if they
+// are invalid.
+func newTracee(opts []Option) (*Tracee, error) {
 	t := &Tracee{
-		events: make(chan Event, 1),
-		err:    make(chan error, 1),
-		cmds:   make(chan func()),
+		err:       make(chan error, 1),
+		cmds:      make(chan func()),
+		ctx:       context.Background(),
+		closing:   make(chan struct{}),
+		killing:   make(chan struct{}),
+		traceDone: make(chan struct{}),
+		waitDone:  make(chan struct{}),
+
+		eventBuffer: defaultEventBuffer,
+	}
+	t.mem.notify = t.trySend
+	t.init()
+	for _, opt := range opts {
+		opt(t)
+	}
+	if err := t.makeEvents(); err != nil {
+		return nil, err
 	}
+	return t, nil
+}
 
+// Starts tracing the process returned by start, on the tracer thread.
+func (t *Tracee) launch(start func() (*os.Process, error)) error {
+	var err error
+	if t.pool != nil {
+		err = t.startPooled(start)
+	} else {
+		err = t.start(start)
+	}
+	if err != nil && t.queue != nil {
+		t.queue.close()
+	}
+	return err
+}
+
+// ExecCommand executes a program with tracing enabled, as Exec, but
+// following the conventions of os/exec.Command: if name contains no path
+// separators, the program is found in the directories of PATH with
+// exec.LookPath, and the program is passed name followed by args, so
+// that its argv[0] is its name.
+func ExecCommand(name string, args []string, opts ...Option) (*Tracee, error) {
+	path := name
+	if filepath.Base(name) == name {
+		p, err := exec.LookPath(name)
+		if err != nil {
+			return nil, err
+		}
+		path = p
+	}
+	return Exec(path, append([]string{name}, args...), opts...)
+}
+
+// Starts the process on a new tracer thread, which runs the tracer go
+// routine, and starts the wait go routine.
+func (t *Tracee) start(start func() (*os.Process, error)) error {
 	err := make(chan error)
 	proc := make(chan *os.Process)
 	go func() {
 		runtime.LockOSThread()
-		p, e := os.StartProcess(name, argv, &os.ProcAttr{
-			Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
-			Sys: &syscall.SysProcAttr{
-				Ptrace:    true,
-				Pdeathsig: syscall.SIGCHLD,
-			},
-		})
+		p, e := start()
 		proc <- p
 		err <- e
 		if e != nil {
@@ -60,93 +263,490 @@ func Exec(name string, argv []string) (*Tracee, error) {
 		t.trace()
 	}()
 	t.proc = <-proc
-	return t, <-err
+	return <-err
+}
+
+// Makes the events channel, with the capacity of the event buffer, or
+// returns an error if the capacity is invalid.
+func (t *Tracee) makeEvents() error {
+	switch {
+	case t.eventBuffer == UnboundedEvents:
+		t.events = make(chan Event)
+		t.queue = newEventQueue()
+		go t.forwardEvents()
+	case t.eventBuffer < 0:
+		return errBadEventBuffer
+	default:
+		t.events = make(chan Event, t.eventBuffer)
+	}
+	return nil
 }
 
 // Detach detaches the tracee, allowing it to continue its execution normally.
 // No more tracing is performed, and no events are sent on the event channel
 // until the tracee exits.
 func (t *Tracee) Detach() error {
-	err := make(chan error, 1)
-	if t.do(func() { err <- syscall.PtraceDetach(t.proc.Pid) }) {
-		return <-err
+	err := t.run("detach", func() error {
+		return t.resume(Detached, func() error { return ptraceDetach(t.proc.Pid) })
+	})
+	if err == nil {
+		t.wakeWait()
 	}
-	return ErrExited
+	return err
+}
+
+// DetachWith ends the tracing of the stopped tracee according to the
+// policy p, as Close would: DetachOnClose detaches it, as Detach does;
+// StopOnClose detaches it, leaving it stopped as by SIGSTOP; and
+// KillOnClose kills it and waits for it to exit, discarding its
+// remaining events.  Unlike Close, DetachWith does not interrupt a
+// running tracee to detach it, and the tracee must still be closed.
+func (t *Tracee) DetachWith(p ClosePolicy) error {
+	switch p {
+	case KillOnClose:
+		t.kill()
+		<-t.waitDone
+		return nil
+	case DetachOnClose:
+		return t.Detach()
+	case StopOnClose:
+		return t.detachSignal(t.run, syscall.SIGSTOP)
+	}
+	return errBadPolicy
 }
 
 // SingleStep continues the tracee for one instruction.
 func (t *Tracee) SingleStep() error {
-	err := make(chan error, 1)
-	if t.do(func() { err <- syscall.PtraceSingleStep(t.proc.Pid) }) {
-		return <-err
-	}
-	return ErrExited
+	return t.run("singlestep", func() error {
+		step := func() error { return ptraceSingleStep(t.proc.Pid) }
+		t.signalResume = func(sig syscall.Signal) error {
+			return ptraceStepSignal(t.proc.Pid, int(sig))
+		}
+		return t.resume(Running, t.overBreakpoint(step, true))
+	})
 }
 
 // Continue makes the tracee execute unmanaged by the tracer.  Most
 // commands are not possible in this state, with the notable exception
 // of sending a syscall.SIGSTOP signal.
 func (t *Tracee) Continue() error {
-	err := make(chan error, 1)
 	const signum = 0
-	if t.do(func() { err <- syscall.PtraceCont(t.proc.Pid, signum) }) {
-		return <-err
+	return t.run("cont", func() error {
+		cont := func() error { return ptraceCont(t.proc.Pid, signum) }
+		t.signalResume = func(sig syscall.Signal) error { return ptraceCont(t.proc.Pid, int(sig)) }
+		return t.resume(Running, t.overBreakpoint(cont, false))
+	})
+}
+
+// SendSignal sends the given signal to the tracee.
+func (t *Tracee) SendSignal(sig syscall.Signal) error {
+	return t.run("kill", func() error {
+		if t.State() == Exited {
+			return ErrTraceeExited
+		}
+		return syscall.Kill(t.proc.Pid, sig)
+	})
+}
+
+// Kill kills the tracee with SIGKILL, waits for it to exit, and returns
+// its exit status.  The tracee's remaining events, including its exit,
+// are discarded, so it is reaped whether or not Events is drained, and
+// then it is closed, as by Close.  If the tracee has already exited, its
+// exit status is returned.  If an error is pending, it is returned.
+func (t *Tracee) Kill() (syscall.WaitStatus, error) {
+	t.kill()
+	<-t.waitDone
+	err := t.Close()
+	if !t.exited && err == nil {
+		err = ErrTraceeExited
 	}
-	return ErrExited
+	return t.exitStatus, err
 }
 
-// Kill sends the given signal to the tracee.
-func (t *Tracee) Kill(sig syscall.Signal) error {
-	err := make(chan error, 1)
-	if t.do(func() { err <- syscall.Kill(t.proc.Pid, sig) }) {
-		return <-err
+// Kills the tracee with SIGKILL.  Once it is killed, the wait go routine
+// discards its events, and continues it from the stops that it still
+// reports, such as at PTRACE_EVENT_EXIT, until it exits and is reaped.
+// The tracer thread must not exit before then.
+func (t *Tracee) kill() {
+	t.killOnce.Do(func() { close(t.killing) })
+	select {
+	case <-t.waitDone:
+		// The tracee has been reaped, so its process ID may have
+		// been reused.
+		return
+	default:
 	}
-	return ErrExited
+	// An error means the tracee has already exited.
+	t.proc.Kill()
 }
 
-// Sends the command to the tracer go routine.  Returns whether the command
-// was sent or not.  The command may not have been sent if the tracee exited.
-func (t *Tracee) do(f func()) bool {
-	if t.cmds != nil {
-		t.cmds <- f
-		return true
+// Continues the killed tracee from a stop.  The command is sent directly
+// to the tracer go routine, since it must run even if the tracer is
+// broken.  Called on the wait go routine.
+func (t *Tracee) continueKilled() {
+	done := make(chan struct{})
+	cont := func() {
+		defer close(done)
+		t.invalidateStop()
+		ptraceCont(t.proc.Pid, 0)
+	}
+	select {
+	case t.cmds <- cont:
+		<-done
+	case <-t.traceDone:
 	}
-	return false
 }
 
-// Close cleans up internal memory for managing the tracee.  If an error is
-// pending, it is returned.
-func (t *Tracee) Close() error {
-	var err error
+// Detaches the stopped tracee for Close, passing it sig.  It fails if
+// the tracee is not stopped.
+func (t *Tracee) detachStopped(sig syscall.Signal) error {
+	return t.detachSignal(t.runInternal, sig)
+}
+
+// Detaches the stopped tracee, passing it sig, with the command run by
+// run: run for the user's detach, and runInternal for Close's.
+func (t *Tracee) detachSignal(run func(string, func() error) error, sig syscall.Signal) error {
+	err := run("detach", func() error {
+		return t.resume(Detached, func() error { return ptraceDetachSignal(t.proc.Pid, int(sig)) })
+	})
+	if err == nil {
+		t.wakeWait()
+	}
+	return err
+}
+
+// Detaches the closed tracee from a stop, stopping it with SIGSTOP if its
+// ClosePolicy is StopOnClose.  A tracee with an owner is not detached
+// when it is closed, as others are, by the exit of the tracer thread,
+// which it shares, so it is detached at its next stop instead.  Called
+// on the wait go routine.
+func (t *Tracee) detachClosed() {
+	var sig syscall.Signal
+	if t.policy == StopOnClose {
+		sig = syscall.SIGSTOP
+	}
+	done := make(chan struct{})
+	detach := func() {
+		defer close(done)
+		ptraceDetachSignal(t.proc.Pid, int(sig))
+	}
+	select {
+	case t.cmds <- detach:
+		<-done
+	case <-t.traceDone:
+	}
+}
+
+// Returns whether Close has been called.
+func (t *Tracee) isClosing() bool {
 	select {
-	case err = <-t.err:
+	case <-t.closing:
+		return true
 	default:
-		err = nil
+		return false
 	}
-	close(t.err)
-	close(t.cmds)
-	t.cmds = nil
-	return err
+}
+
+// Runs the command on the tracer go routine and returns its error,
+// converted to an *Error for the named operation.  If the tracee's
+// context is done before the command completes, the context's error is
+// returned instead; the command may or may not have run.
+func (t *Tracee) run(op string, f func() error) error {
+	c := t.newCommand(op)
+	c.f = f
+	return t.dispatch(t.ctx, c)
+}
+
+// Runs the command as run, but regardless of the tracee's context, for
+// the commands that the tracer issues itself, such as those of the wait
+// go routine and of Close.  These must complete even once the context
+// is done, since the tracee's state depends on them, and their
+// closures are not left running after the call returns.
+func (t *Tracee) runInternal(op string, f func() error) error {
+	c := t.newCommand(op)
+	c.f = f
+	return t.dispatch(context.Background(), c)
+}
+
+// Runs the command as run, with the context ctx.
+func (t *Tracee) dispatch(ctx context.Context, c *command) error {
+	if err := t.do(ctx, c.exec); err != nil {
+		c.release()
+		return err
+	}
+	select {
+	case err := <-c.reply:
+		c.release()
+		return err
+	case <-ctx.Done():
+		// The command may yet run and reply, so it is not reused.
+		return ctx.Err()
+	}
+}
+
+// A command is a function to run on the tracer go routine, and its reply.
+// Commands are pooled, since every request to the tracee needs one, and
+// each is created with its exec method value and reply channel, so that
+// issuing one does not allocate.
+type command struct {
+	t     *Tracee
+	op    string
+	f     func() error
+	reply chan error
+	exec  func()
+	osCommand
+}
+
+var commands = sync.Pool{
+	New: func() interface{} {
+		c := &command{reply: make(chan error, 1)}
+		c.exec = c.run
+		return c
+	},
+}
+
+// Returns a command for the named operation from the pool.
+func (t *Tracee) newCommand(op string) *command {
+	c := commands.Get().(*command)
+	c.t, c.op = t, op
+	return c
+}
+
+// Runs the command and sends its error on the reply channel.  The
+// command must not be accessed after the reply is sent, since it may
+// have been reused.  Called on the tracer go routine.
+func (c *command) run() {
+	t, op := c.t, c.op
+	defer func() {
+		if r := recover(); r != nil {
+			c.reply <- t.breakTracer(op, r)
+		}
+	}()
+	err := c.call()
+	c.reply <- t.opError(op, err)
+}
+
+// Returns the command to the pool, once its reply has been received.
+func (c *command) release() {
+	c.t, c.f, c.osCommand = nil, nil, osCommand{}
+	commands.Put(c)
+}
+
+// Sends the command to the tracer go routine.  Returns ErrTraceeExited if
+// the tracee's exit has been observed or the tracee is closed, the error
+// of the panic that broke the tracer, or ctx's error if ctx is done
+// before the command is sent.
+func (t *Tracee) do(ctx context.Context, f func()) error {
+	if t.State() == Exited {
+		return ErrTraceeExited
+	}
+	if err := t.broken.Load(); err != nil {
+		return *err
+	}
+	// A done context is checked first, since the select below would
+	// choose at random if the tracer go routine is also ready.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case t.cmds <- f:
+		return nil
+	case <-t.closing:
+		return ErrTraceeExited
+	case <-t.traceDone:
+		return ErrTraceeExited
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close cleans up internal memory for managing the tracee, handling a
+// tracee that has not yet exited according to its ClosePolicy.  With
+// KillOnClose, Close blocks until the tracee has exited and its wait go
+// routine has returned, and its remaining events are discarded.  With
+// DetachOnClose and StopOnClose, a running seized tracee, or with
+// WithExitKill any running tracee, is first interrupted, since only a
+// stopped tracee can be detached, and Close does not wait for the wait
+// go routine, which reaps the detached process in the background when
+// it eventually exits.  Either way, unless the tracee shares its tracer
+// thread, Close waits for the tracer go routine to return.  If an error
+// is pending, it is returned.  Calling Close more than once is
+// harmless; subsequent calls return the same error as the first.
+func (t *Tracee) Close() error {
+	t.closeOnce.Do(func() {
+		switch t.policy {
+		case KillOnClose:
+			t.kill()
+			<-t.waitDone
+		case DetachOnClose, StopOnClose:
+			var sig syscall.Signal
+			if t.policy == StopOnClose {
+				sig = syscall.SIGSTOP
+			}
+			t.closeDetach(sig)
+		}
+		close(t.closing)
+		if t.pool != nil {
+			t.pool.release(t.thread)
+		}
+		if !t.sharesThread() {
+			<-t.traceDone
+		}
+		select {
+		case t.closeErr = <-t.err:
+		default:
+		}
+	})
+	return t.closeErr
 }
 
 func (t *Tracee) wait() {
-	defer close(t.events)
+	defer close(t.waitDone)
+	defer t.closeEvents()
+	defer t.closeSubs()
+	t.lockWait()
 	for {
-		state, err := t.proc.Wait()
+		ws, err := waitPid(t.proc.Pid)
+		if err != nil && t.State() == Detached {
+			// A detached tracee that is not a child of the
+			// tracer, such as one attached by Attach, can no
+			// longer be waited for.
+			return
+		}
 		if err != nil {
-			t.err <- err
+			// The tracee can no longer be observed, so it is
+			// treated as exited, and commands fail promptly.
+			t.state.Store(int32(Exited))
+			t.err <- os.NewSyscallError("wait4", err)
 			return
 		}
-		if state.Exited() {
-			t.events <- Event(state.Sys().(syscall.WaitStatus))
+		t.state.Store(int32(waitState(ws)))
+		if ws.Stopped() {
+			select {
+			case <-t.killing:
+				t.continueKilled()
+				continue
+			default:
+			}
+			if t.sharesThread() && t.isClosing() {
+				t.detachClosed()
+				continue
+			}
+		}
+		if f := t.intercept.Load(); f != nil && (*f)(ws) {
+			continue
+		}
+		if ws.Exited() || ws.Signaled() {
+			t.exitStatus, t.exited = ws, true
+		}
+		ev := t.decode(ws)
+		if ev == nil {
+			// The stop was handled internally, and the tracee
+			// has been resumed, or is to remain stopped
+			// without an event.
+			continue
+		}
+		if ws.Stopped() {
+			t.checkWatches()
+		}
+		t.emit(ev)
+		if ws.Exited() || ws.Signaled() {
 			return
 		}
-		t.events <- Event(state.Sys().(syscall.WaitStatus))
 	}
 }
 
+// Passes an event to the observers and the subscribers, and then sends
+// it.  Called on the wait go routine, or, for a stop consumed by an
+// intercept, by the command that consumed it, while the tracee remains
+// stopped.
+func (t *Tracee) emit(ev Event) {
+	for _, o := range t.observers {
+		o(ev)
+	}
+	t.publish(ev)
+	t.send(ev)
+}
+
+// Sends an event on the events channel, dropping it if the tracee is
+// closed.  The tracee is still waited on after it is closed, so that it
+// is reaped when it exits.
+func (t *Tracee) send(ev Event) {
+	if t.queue != nil {
+		t.queue.push(ev)
+		return
+	}
+	select {
+	case t.events <- ev:
+	case <-t.closing:
+	case <-t.killing:
+	}
+}
+
+// Sends an event on the events channel without blocking, dropping it if
+// the channel is full or closed.  Unlike send, it may be called from any
+// go routine.
+func (t *Tracee) trySend(ev Event) {
+	t.eventsMu.Lock()
+	defer t.eventsMu.Unlock()
+	if t.eventsClosed {
+		return
+	}
+	if t.queue != nil {
+		t.queue.push(ev)
+		return
+	}
+	select {
+	case t.events <- ev:
+	default:
+	}
+}
+
+func (t *Tracee) closeEvents() {
+	t.eventsMu.Lock()
+	defer t.eventsMu.Unlock()
+	t.eventsClosed = true
+	if t.queue != nil {
+		// The forwarding go routine closes the channel.
+		t.queue.close()
+		return
+	}
+	close(t.events)
+}
+
 func (t *Tracee) trace() {
-	for cmd := range t.cmds {
-		cmd()
+	defer close(t.traceDone)
+	for {
+		select {
+		case cmd := <-t.cmds:
+			t.runCommand(cmd)
+		case <-t.closing:
+			// Returning with the OS thread locked terminates the
+			// thread, which detaches the tracee if it is still
+			// attached.
+			return
+		}
 	}
 }
+
+// Runs a command on the tracer go routine.  A panic in the command is
+// recovered, so that the tracer thread, which the tracee is attached
+// to, survives, but it breaks the tracer.
+func (t *Tracee) runCommand(cmd func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.breakTracer("command", r)
+		}
+	}()
+	cmd()
+}
+
+// Records that a command panicked with r, or that the tracer failed to
+// undo its change to the tracee with the error r, returning the error
+// that every later command returns.  Called on the tracer go routine,
+// or on the wait go routine for a breakpoint condition or a tamper.
+func (t *Tracee) breakTracer(op string, r interface{}) error {
+	err := fmt.Errorf("ptrace %s %d: %w: %v", op, t.proc.Pid, ErrBroken, r)
+	t.broken.CompareAndSwap(nil, &err)
+	return err
+}
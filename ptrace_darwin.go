@@ -0,0 +1,152 @@
+package ptrace
+
+// Darwin support is built on the BSD ptrace requests, which Darwin still
+// supports for starting, stepping, continuing, and detaching a child.
+// Reading and writing tracee memory and thread state, and receiving
+// Mach exceptions, use the tracee's Mach task port from task_for_pid
+// (see mach_darwin.go), which is only granted to processes signed with
+// the com.apple.security.cs.debugger entitlement (or running as root),
+// and which requires cgo.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Requests from <sys/ptrace.h> that the syscall package does not export.
+const (
+	ptContinue = 7
+	ptStep     = 9
+	ptDetach   = 11
+)
+
+// ErrEntitlement is wrapped by errors returned when the kernel refuses a
+// ptrace request because the tracer lacks the debugging entitlement.
+var ErrEntitlement = errors.New("ptrace requires the com.apple.security.cs.debugger entitlement or root")
+
+// Darwin specific fields of a Tracee.
+type osTracee struct {
+	// MachExceptions is whether the tracee's Mach exceptions are
+	// received, for WithMachExceptions.
+	machExceptions bool
+}
+
+func (t *Tracee) init() {}
+
+// Starts receiving the tracee's Mach exceptions, if requested.
+func (t *Tracee) ready() error {
+	if !t.machExceptions {
+		return nil
+	}
+	return t.run("exceptions", t.startMachExceptions)
+}
+
+func (t *Tracee) overBreakpoint(f func() error, step bool) func() error { return f }
+
+// Interrupts the running tracee for Stop with SIGSTOP.  Darwin reports
+// no siginfo to the tracer, so its stop cannot be told from that of a
+// SIGSTOP sent otherwise.
+func (t *Tracee) interrupt() error { return syscall.Kill(t.proc.Pid, syscall.SIGSTOP) }
+
+// Returns whether the status is of a SIGSTOP stop, which may be the one
+// caused by interrupt.
+func (t *Tracee) isInterrupt(ws syscall.WaitStatus) bool {
+	return ws.Stopped() && ws.StopSignal() == syscall.SIGSTOP
+}
+
+func (t *Tracee) lockWait() {}
+
+func (t *Tracee) wakeWait() {}
+
+// Detaches the tracee for Close.  A running tracee is detached when the
+// tracer thread exits.
+func (t *Tracee) closeDetach(sig syscall.Signal) { t.detachStopped(sig) }
+
+func (t *Tracee) checkWatches() {}
+
+func (t *Tracee) invalidateStop() {}
+
+type osCommand struct{}
+
+func (c *command) call() error { return c.f() }
+
+// Starts the process with tracing enabled.  Must be called on the
+// tracer thread.
+func startProcess(name string, argv []string) (*os.Process, error) {
+	p, err := os.StartProcess(name, argv, &os.ProcAttr{
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Sys:   &syscall.SysProcAttr{Ptrace: true},
+	})
+	return p, entitlementError(err)
+}
+
+// Returns the event for a wait status.  Darwin reports no events other
+// than the wait status itself.
+func (t *Tracee) decode(ws syscall.WaitStatus) Event {
+	return Event(ws)
+}
+
+// Returns whether an event other than a wait status is sent for a stop
+// of the tracee.  None is: a MachExceptionEvent is sent before the stop
+// for the exception's signal.
+func isStopEvent(ev Event) bool {
+	return false
+}
+
+// Waits for the next change in the state of the tracee, as reported to
+// its tracer.
+func waitPid(pid int) (syscall.WaitStatus, error) {
+	var ws syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(pid, &ws, 0, nil)
+		if err != syscall.EINTR {
+			return ws, err
+		}
+	}
+}
+
+func ptraceDetach(pid int) error {
+	return entitlementError(syscall.PtraceDetach(pid))
+}
+
+func ptraceDetachSignal(pid int, signum int) error {
+	return ptrace(ptDetach, pid, 1, uintptr(signum))
+}
+
+// The address argument of 1 resumes the tracee where it stopped.
+func ptraceSingleStep(pid int) error {
+	return ptrace(ptStep, pid, 1, 0)
+}
+
+func ptraceStepSignal(pid int, signum int) error {
+	return ptrace(ptStep, pid, 1, uintptr(signum))
+}
+
+func ptraceCont(pid int, signum int) error {
+	return ptrace(ptContinue, pid, 1, uintptr(signum))
+}
+
+// Issues a ptrace request, retrying it if it is interrupted by a signal.
+func ptrace(req int, pid int, addr uintptr, data uintptr) error {
+	for {
+		_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(req), uintptr(pid), addr, data, 0, 0)
+		switch e {
+		case 0:
+			return nil
+		case syscall.EINTR:
+			continue
+		}
+		return entitlementError(e)
+	}
+}
+
+// Converts EPERM into an error that explains the entitlement
+// requirement.
+func entitlementError(err error) error {
+	if errors.Is(err, syscall.EPERM) {
+		return fmt.Errorf("%w: %w", ErrEntitlement, err)
+	}
+	return err
+}
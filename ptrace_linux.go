@@ -0,0 +1,144 @@
+package ptrace
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// Linux specific fields of a Tracee.
+type osTracee struct {
+	// Options are the ptrace options set on the tracee.  They are
+	// only accessed on the tracer thread.
+	options int
+	// SyscallNr is the number of the system call that the tracee
+	// last entered, or -1.  It is only accessed on the wait go routine.
+	syscallNr int
+	io        *ioStats
+	ns        nsTracker
+	tamper    *tamper
+	dbg       debugCache
+	procs     procCache
+	seccomp   *seccompFilter
+	libs      *loaderHook
+	// Bps are the breakpoints by address.  They are only accessed
+	// on the tracer thread.
+	bps map[uint64]*breakpoint
+	// Stepping is the pending step over a breakpoint, if any.
+	stepping atomic.Pointer[stepOver]
+	// Watches are the watched memory regions.  They are only accessed
+	// on the tracer thread.  NumWatches is their number, which the
+	// wait go routine checks before the round trip to check them.
+	watches    []*watch
+	numWatches atomic.Int32
+	// Started is set once the initial stop has been observed.  It is
+	// only accessed on the wait go routine.
+	started bool
+	// Held are the TIDs of the threads other than the traced thread
+	// that are stopped by StopAll.  They are only accessed on the tracer
+	// thread.
+	held []int
+	// NonStop is the active non-stop control, if any.  It is only
+	// accessed on the tracer thread.
+	nonStop *NonStop
+	// Seize, if non-nil, receives the result of seizing the tracee at
+	// its initial stop, for WithSeize.
+	seize chan error
+	// Entry, if non-nil, receives the result of running the tracee to
+	// its entry point from its initial stop, for WithStopAtEntry.
+	entry chan error
+	// ToEntry, if non-nil, is the breakpoint at the entry point to
+	// which the tracee is running.  It is only accessed on the wait go
+	// routine.
+	toEntry *entryBreakpoint
+	// Seized is whether the tracee is attached with PTRACE_SEIZE.  It
+	// is only accessed on the tracer thread.
+	seized bool
+	// Attached is whether the tracee was attached by Attach, rather
+	// than started as a child of the tracer, and waitTID is then the
+	// thread of its wait go routine, or 0 until it starts.
+	attached bool
+	waitTID  atomic.Int32
+	// Signals is the signal policy, if any.
+	signals SignalPolicy
+	// ExitKill is whether the tracee is killed if the tracer exits.
+	exitKill bool
+	// FollowForks is whether the tracee's children are traced.
+	followForks bool
+	// DecodeLimits, if non-nil, bound the decoding of system call
+	// arguments, for WithSyscallDecoding.
+	decodeLimits *DecodeLimits
+	// Sysemu is whether the tracee was last resumed to a system call
+	// stop with SysEmu rather than Syscall.  It is only accessed on the
+	// tracer thread.
+	sysemu bool
+	// Regs are the cached registers of the current stop, and maps,
+	// if non-nil, are its memory mappings.  They are only accessed on
+	// the tracer thread.
+	regs regsCache
+	maps []Mapping
+	// MapsCharge is the charge for maps, and mapsEvicted is set when
+	// it is evicted, from any go routine, so that maps is read again.
+	mapsCharge  *memCharge
+	mapsEvicted atomic.Bool
+	// SyscallEntry is the system call entry last decoded.  It is only
+	// accessed on the wait go routine.
+	syscallEntry syscallEntry
+	// ExitErrnos are called by the wait go routine at each system call
+	// exit stop, before its event is built.  Each returns the errno to
+	// which the return of the system call is rewritten, or 0.
+	exitErrnos []func() syscall.Errno
+}
+
+func (t *Tracee) init() {
+	t.syscallNr = -1
+	t.observers = append(t.observers, t.observeNamespaces, t.observeDebugInfo, t.observeProcInfo)
+}
+
+// Starts the process with tracing enabled.  Must be called on the
+// tracer thread.
+func startProcess(name string, argv []string) (*os.Process, error) {
+	p, err := os.StartProcess(name, argv, &os.ProcAttr{
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Sys: &syscall.SysProcAttr{
+			Ptrace:    true,
+			Pdeathsig: syscall.SIGCHLD,
+		},
+	})
+	return p, permissionError(err, true)
+}
+
+// Waits for the next change in the state of the tracee, as reported to
+// its tracer.  Unlike os.Process.Wait, which recent versions of Go
+// implement by waiting on a pidfd for the process to exit, it reports
+// the tracee's stops, and it passes __WALL, so that it also reports a
+// tracee that is a thread created by clone.
+func waitPid(pid int) (syscall.WaitStatus, error) {
+	var ws syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(pid, &ws, syscall.WALL, nil)
+		if err != syscall.EINTR {
+			return ws, err
+		}
+	}
+}
+
+func ptraceDetach(pid int) error {
+	return ptrace(syscall.PTRACE_DETACH, pid, 0, 0)
+}
+
+func ptraceDetachSignal(pid int, signum int) error {
+	return ptrace(syscall.PTRACE_DETACH, pid, 0, uintptr(signum))
+}
+
+func ptraceSingleStep(pid int) error {
+	return ptrace(syscall.PTRACE_SINGLESTEP, pid, 0, 0)
+}
+
+func ptraceStepSignal(pid int, signum int) error {
+	return ptrace(syscall.PTRACE_SINGLESTEP, pid, 0, uintptr(signum))
+}
+
+func ptraceCont(pid int, signum int) error {
+	return ptrace(syscall.PTRACE_CONT, pid, 0, uintptr(signum))
+}
@@ -0,0 +1,491 @@
+//go:build linux
+
+package ptrace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Commands that each require the tracee to be attached, and most a
+// stopped tracee.
+func testCommands(t *Tracee) map[string]func() error {
+	return map[string]func() error{
+		"GetRegs": func() error {
+			_, err := t.GetRegs()
+			return err
+		},
+		"PeekData": func() error {
+			_, err := t.PeekData(0, make([]byte, 8))
+			return err
+		},
+		"PokeData": func() error {
+			_, err := t.PokeData(0, make([]byte, 8))
+			return err
+		},
+		"PeekUser":   func() error { _, err := t.PeekUser(0); return err },
+		"Continue":   t.Continue,
+		"SingleStep": t.SingleStep,
+		"Syscall":    t.Syscall,
+		"SendSignal": func() error { return t.SendSignal(0) },
+		"Detach":     t.Detach,
+	}
+}
+
+// Returns whether err is one of the errors of a command that is racing
+// a change of the tracee's state.
+func isRaceError(err error) bool {
+	return err == nil ||
+		errors.Is(err, ErrNotStopped) ||
+		errors.Is(err, ErrNotAttached) ||
+		errors.Is(err, ErrTraceeExited) ||
+		errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.EFAULT) ||
+		errors.Is(err, syscall.ESRCH)
+}
+
+// Issues every command repeatedly, from several go routines, until stop
+// is closed, and reports errors other than those of a race.
+func hammer(tb testing.TB, t *Tracee, stop <-chan struct{}) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for name, cmd := range testCommands(t) {
+		if name == "Continue" || name == "SingleStep" || name == "Syscall" || name == "Detach" {
+			// Resuming the tracee would race the test's own
+			// control of it.
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := cmd(); !isRaceError(err) {
+					tb.Errorf("%s: unexpected error %v", name, err)
+					return
+				}
+			}
+		}()
+	}
+	return &wg
+}
+
+// Checks that every command returns want.
+func checkCommands(tb testing.TB, t *Tracee, want error) {
+	tb.Helper()
+	for name, cmd := range testCommands(t) {
+		if name == "SendSignal" && want == ErrNotAttached {
+			// A detached process can still be signaled.
+			continue
+		}
+		if err := cmd(); !errors.Is(err, want) {
+			tb.Errorf("%s: got %v, want %v", name, err, want)
+		}
+	}
+}
+
+// Executes a program that exits immediately once it is continued.
+func execTrue(tb testing.TB, opts ...Option) *Tracee {
+	tb.Helper()
+	return execStopped(tb, []string{"/bin/true"}, opts...)
+}
+
+// Executes a program, and receives its initial stop.
+func execStopped(tb testing.TB, argv []string, opts ...Option) *Tracee {
+	tb.Helper()
+	t, err := Exec(argv[0], argv, opts...)
+	if err != nil {
+		tb.Skipf("cannot trace: %v", err)
+	}
+	if _, ok := <-t.Events(); !ok {
+		tb.Fatal("no initial stop")
+	}
+	return t
+}
+
+// Continues the tracee from each stop until it exits.
+func runToExit(tb testing.TB, t *Tracee) {
+	tb.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := t.WaitExit(ctx); err != nil {
+		tb.Fatalf("WaitExit: %v", err)
+	}
+}
+
+// Waits for the detached tracee's exit to be observed.
+func waitExited(tb testing.TB, t *Tracee) {
+	tb.Helper()
+	select {
+	case <-t.waitDone:
+	case <-time.After(10 * time.Second):
+		tb.Fatal("exit not observed")
+	}
+}
+
+func TestCommandsAfterExit(t *testing.T) {
+	tr := execTrue(t)
+	defer tr.Close()
+	runToExit(t, tr)
+	checkCommands(t, tr, ErrTraceeExited)
+}
+
+func TestCommandsRacingExit(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		tr := execTrue(t)
+		stop := make(chan struct{})
+		wg := hammer(t, tr, stop)
+		runToExit(t, tr)
+		// Once the exit is observed, the result is deterministic,
+		// even for commands issued concurrently.
+		checkCommands(t, tr, ErrTraceeExited)
+		close(stop)
+		wg.Wait()
+		tr.Close()
+	}
+}
+
+func TestCommandsRacingDetach(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		tr := execTrue(t)
+		stop := make(chan struct{})
+		wg := hammer(t, tr, stop)
+		if err := tr.Detach(); err != nil {
+			t.Fatalf("Detach: %v", err)
+		}
+		close(stop)
+		wg.Wait()
+		// The detached tracee runs to its exit, which is still
+		// observed, since it is the tracer's child.
+		waitExited(t, tr)
+		checkCommands(t, tr, ErrTraceeExited)
+		tr.Close()
+	}
+}
+
+func TestCommandsRacingClose(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		tr := execTrue(t)
+		stop := make(chan struct{})
+		wg := hammer(t, tr, stop)
+		if err := tr.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		checkCommands(t, tr, ErrTraceeExited)
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// Exit, Detach, and Close in every order, checking the commands after
+// each.
+func TestExitDetachCloseOrders(t *testing.T) {
+	type step struct {
+		name string
+		// Do performs the step, given whether the tracee has
+		// already exited, and returns whether it has exited after.
+		do func(*testing.T, *Tracee, bool) bool
+	}
+	exit := step{"exit", func(t *testing.T, tr *Tracee, exited bool) bool {
+		syscall.Kill(tr.proc.Pid, syscall.SIGKILL)
+		if tr.State() == Detached || tr.isClosing() {
+			waitExited(t, tr)
+		} else {
+			// The killed tracee still stops at its exit, and must
+			// be continued from it.
+			for range tr.Events() {
+				tr.Continue()
+			}
+		}
+		return true
+	}}
+	detach := step{"detach", func(t *testing.T, tr *Tracee, exited bool) bool {
+		err := tr.Detach()
+		if exited && !errors.Is(err, ErrTraceeExited) {
+			t.Errorf("Detach after exit: got %v, want %v", err, ErrTraceeExited)
+		}
+		if !exited && err != nil {
+			t.Errorf("Detach: %v", err)
+		}
+		return exited
+	}}
+	closeStep := step{"close", func(t *testing.T, tr *Tracee, exited bool) bool {
+		tr.Close()
+		return exited
+	}}
+	orders := [][]step{
+		{exit, detach, closeStep},
+		{exit, closeStep, detach},
+		{detach, exit, closeStep},
+		{detach, closeStep, exit},
+		{closeStep, exit, detach},
+		{closeStep, detach, exit},
+	}
+	for _, order := range orders {
+		var name string
+		for _, s := range order {
+			name += "/" + s.name
+		}
+		t.Run(name[1:], func(t *testing.T) {
+			// The tracee sleeps, so that it does not exit
+			// until it is killed, even once it is detached.
+			tr := execStopped(t, []string{"/bin/sleep", "60"}, WithClosePolicy(DetachOnClose))
+			defer tr.Close()
+			exited, closed, detached := false, false, false
+			for _, s := range order {
+				exited = s.do(t, tr, exited || closed)
+				switch s.name {
+				case "close":
+					closed = true
+				case "detach":
+					detached = true
+				}
+				var want error
+				switch {
+				case exited || closed:
+					want = ErrTraceeExited
+				case detached:
+					want = ErrNotAttached
+				default:
+					continue
+				}
+				checkCommands(t, tr, want)
+			}
+		})
+	}
+}
+
+// The tracer's own commands, here those running the tracee to its entry
+// point, are not cancelled by the tracee's context; user commands are.
+func TestContextCancelsOnlyUserCommands(t *testing.T) {
+	t.Run("exec", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		tr, err := Exec("/bin/true", []string{"/bin/true"}, WithContext(ctx), WithStopAtEntry())
+		if err != nil {
+			t.Skipf("cannot trace: %v", err)
+		}
+		defer tr.Close()
+		if s := tr.State(); s != Stopped {
+			t.Errorf("state after Exec: got %v, want %v", s, Stopped)
+		}
+		if err := tr.Continue(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Continue: got %v, want %v", err, context.Canceled)
+		}
+	})
+	t.Run("tamper", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// The filter is called on the wait go routine between
+		// reading the tracee's buffer and substituting the
+		// filtered data.
+		filter := func(_ int, data []byte) []byte {
+			cancel()
+			return bytes.ToUpper(data)
+		}
+		tr := execStopped(t, []string{"/bin/sh", "-c", "echo hello >/dev/null"}, WithContext(ctx), WithWriteFilter(filter))
+		defer tr.Close()
+		for {
+			if err := tr.Syscall(); err != nil {
+				t.Fatalf("Syscall: %v", err)
+			}
+			ev, ok := <-tr.Events()
+			if !ok {
+				t.Fatal("no write")
+			}
+			enter, ok := ev.(SyscallEnterEvent)
+			if !ok || enter.Name() != "write" {
+				continue
+			}
+			b := make([]byte, enter.Args[2])
+			if _, err := tr.peekInternal(uintptr(enter.Args[1]), b); err != nil {
+				t.Fatalf("peek: %v", err)
+			}
+			if string(b) != "HELLO\n" {
+				t.Errorf("got %q written, want %q", b, "HELLO\n")
+			}
+			return
+		}
+	})
+	t.Run("nonstop close", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tr := execTrue(t, WithContext(ctx))
+		defer tr.Close()
+		ns, err := tr.NonStop()
+		if err != nil {
+			t.Fatalf("NonStop: %v", err)
+		}
+		cancel()
+		done := make(chan error, 1)
+		go func() { done <- ns.Close() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Close did not return")
+		}
+		active := true
+		tr.runInternal("nonstop", func() error {
+			active = tr.nonStop != nil
+			return nil
+		})
+		if active {
+			t.Error("NonStop still active after Close")
+		}
+	})
+}
+
+// A panic in a breakpoint condition breaks the tracer, as one in a
+// command does, rather than crashing the program.
+func TestConditionPanicBreaksTracer(t *testing.T) {
+	tr := execTrue(t)
+	defer tr.Close()
+	err := tr.run("breakpoint", func() error {
+		tr.evalCond(func(tr *Tracee) bool {
+			// The condition's commands run while it is evaluated.
+			if _, err := tr.GetRegs(); err != nil {
+				t.Errorf("GetRegs in condition: %v", err)
+			}
+			panic("condition panicked")
+		})
+		return nil
+	})
+	if !errors.Is(err, ErrBroken) {
+		t.Errorf("got %v, want %v", err, ErrBroken)
+	}
+}
+
+// A panic in a breakpoint condition called by the wait go routine, for a
+// breakpoint hit by Continue, breaks the tracer too.
+func TestWaitConditionPanicBreaksTracer(t *testing.T) {
+	tr := execTrue(t)
+	defer tr.Close()
+	entry, err := auxv("/proc/"+strconv.Itoa(tr.proc.Pid)+"/auxv", atEntry)
+	if err != nil || entry == 0 {
+		t.Skipf("no entry point: %v", err)
+	}
+	cond := func(*Tracee) bool { panic("condition panicked") }
+	if err := tr.SetBreakpoint(uintptr(entry), cond); err != nil {
+		t.Fatalf("SetBreakpoint: %v", err)
+	}
+	if err := tr.Continue(); err != nil {
+		t.Fatalf("Continue: %v", err)
+	}
+	select {
+	case ev := <-tr.Events():
+		if _, ok := ev.(BreakpointEvent); !ok {
+			t.Errorf("got event %#v, want a BreakpointEvent", ev)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no breakpoint stop")
+	}
+	if _, err := tr.GetRegs(); !errors.Is(err, ErrBroken) {
+		t.Errorf("GetRegs: got %v, want %v", err, ErrBroken)
+	}
+}
+
+// Returns the state letter of process pid from /proc/pid/stat, or 0 if
+// it cannot be read.
+func procState(pid int) byte {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0
+	}
+	// The state follows the command name, which is parenthesized.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 || i+2 >= len(b) {
+		return 0
+	}
+	return b[i+2]
+}
+
+// Waits for process pid to be in the given state.
+func waitProcState(tb testing.TB, pid int, want byte) {
+	tb.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for procState(pid) != want {
+		if time.Now().After(deadline) {
+			tb.Fatalf("process state %q, want %q", procState(pid), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDetachWith(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ClosePolicy
+		// State is the state of the process after DetachWith.
+		state byte
+	}{
+		{"detach", DetachOnClose, 'S'},
+		{"stop", StopOnClose, 'T'},
+		{"kill", KillOnClose, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := execStopped(t, []string{"/bin/sleep", "10"})
+			defer tr.Close()
+			pid := tr.Pid()
+			defer syscall.Kill(pid, syscall.SIGKILL)
+			if err := tr.DetachWith(test.policy); err != nil {
+				t.Fatalf("DetachWith: %v", err)
+			}
+			if test.policy == KillOnClose {
+				if s := tr.State(); s != Exited {
+					t.Errorf("state: got %v, want %v", s, Exited)
+				}
+				return
+			}
+			waitProcState(t, pid, test.state)
+		})
+	}
+	tr := execTrue(t)
+	defer tr.Close()
+	if err := tr.DetachWith(ClosePolicy(-1)); err != errBadPolicy {
+		t.Errorf("DetachWith(-1): got %v, want %v", err, errBadPolicy)
+	}
+}
+
+// A running tracee that is detached by Close is not killed by
+// PTRACE_O_EXITKILL when the tracer thread exits.
+func TestExitKillDetachOnClose(t *testing.T) {
+	tr := execStopped(t, []string{"/bin/sleep", "10"}, WithExitKill(), WithClosePolicy(DetachOnClose))
+	pid := tr.Pid()
+	defer syscall.Kill(pid, syscall.SIGKILL)
+	if err := tr.Continue(); err != nil {
+		t.Fatalf("Continue: %v", err)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if s := procState(pid); s != 'S' {
+		t.Errorf("process state after Close: got %q, want %q", s, 'S')
+	}
+}
+
+func TestBadEventBuffer(t *testing.T) {
+	for _, n := range []int{-2, -100} {
+		tr, err := Exec("/bin/true", []string{"/bin/true"}, WithEventBuffer(n))
+		if err == nil {
+			tr.Close()
+		}
+		if err != errBadEventBuffer {
+			t.Errorf("WithEventBuffer(%d): got %v, want %v", n, err, errBadEventBuffer)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package ptracetest provides a fake ptrace.Tracer, so that code written
+// against a Tracer can be tested without a traced process, or permission
+// to trace one.
+package ptracetest
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"github.com/eaburns/ptrace"
+)
+
+// A Stop is a scripted stop of a Fake.
+type Stop struct {
+	// Event is sent on the events channel for the stop.  If it is a
+	// syscall.WaitStatus for an exit, the fake tracee exits.
+	Event ptrace.Event
+	// Regs, if non-nil, are the registers at the stop.  Otherwise,
+	// the registers are unchanged from the previous stop.
+	Regs *syscall.PtraceRegs
+}
+
+// A Fake is a ptrace.Tracer whose stops are scripted.  Each command that
+// resumes it, Continue, SingleStep, or Syscall, advances it to its next
+// stop, whose event is sent immediately.  Once the script is exhausted,
+// resuming the fake makes it exit with status 0.  Its memory is sparse:
+// only the bytes set with SetMemory or written with PokeData exist, and
+// accessing any other fails with EIO.
+type Fake struct {
+	mu      sync.Mutex
+	stops   []Stop
+	events  chan ptrace.Event
+	state   ptrace.State
+	regs    syscall.PtraceRegs
+	mem     map[uintptr]byte
+	signals []syscall.Signal
+	closed  bool
+}
+
+var _ ptrace.Tracer = (*Fake)(nil)
+
+// NewFake returns a new Fake that follows the script of stops, starting
+// stopped at the first, as a tracee started by ptrace.Exec does.  If
+// there are no stops, the first is a SIGTRAP stop.
+func NewFake(stops ...Stop) *Fake {
+	if len(stops) == 0 {
+		stops = []Stop{{Event: stopStatus(syscall.SIGTRAP)}}
+	}
+	f := &Fake{
+		stops:  stops,
+		events: make(chan ptrace.Event, len(stops)+1),
+		mem:    make(map[uintptr]byte),
+	}
+	f.next()
+	return f
+}
+
+// SetMemory sets the fake's memory at addr to data.
+func (f *Fake) SetMemory(addr uintptr, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, b := range data {
+		f.mem[addr+uintptr(i)] = b
+	}
+}
+
+// Signals returns the signals sent to the fake by SendSignal.
+func (f *Fake) Signals() []syscall.Signal {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]syscall.Signal(nil), f.signals...)
+}
+
+// Events returns the events channel.
+func (f *Fake) Events() <-chan ptrace.Event {
+	return f.events
+}
+
+// NextEvent returns the next event, or ctx's error if ctx is done first.
+func (f *Fake) NextEvent(ctx context.Context) (ptrace.Event, error) {
+	select {
+	case ev, ok := <-f.events:
+		if !ok {
+			return nil, ptrace.ErrTraceeExited
+		}
+		return ev, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// State returns the fake's state.
+func (f *Fake) State() ptrace.State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// Continue advances the fake to its next stop.
+func (f *Fake) Continue() error { return f.resume() }
+
+// SingleStep advances the fake to its next stop.
+func (f *Fake) SingleStep() error { return f.resume() }
+
+// Syscall advances the fake to its next stop.
+func (f *Fake) Syscall() error { return f.resume() }
+
+// Stop returns ptrace.StopNatural, since the fake is never running.
+func (f *Fake) Stop(ctx context.Context) (ptrace.StopReason, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch f.state {
+	case ptrace.Exited:
+		return ptrace.StopExited, ptrace.ErrTraceeExited
+	case ptrace.Detached:
+		return ptrace.StopNatural, ptrace.ErrNotAttached
+	}
+	return ptrace.StopNatural, nil
+}
+
+// SendSignal records the signal.  SIGKILL makes the fake exit.
+func (f *Fake) SendSignal(sig syscall.Signal) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state == ptrace.Exited {
+		return ptrace.ErrTraceeExited
+	}
+	f.signals = append(f.signals, sig)
+	if sig == syscall.SIGKILL {
+		f.stops = []Stop{{Event: syscall.WaitStatus(sig)}}
+		f.next()
+	}
+	return nil
+}
+
+// Detach detaches the stopped fake.  It sends no more events.
+func (f *Fake) Detach() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.requireStopped(); err != nil {
+		return err
+	}
+	f.state = ptrace.Detached
+	return nil
+}
+
+// Close closes the events channel.
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.events)
+	}
+	return nil
+}
+
+// GetRegs returns the registers of the stopped fake.
+func (f *Fake) GetRegs() (syscall.PtraceRegs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.requireStopped(); err != nil {
+		return syscall.PtraceRegs{}, err
+	}
+	return f.regs, nil
+}
+
+// SetRegs sets the registers of the stopped fake.
+func (f *Fake) SetRegs(regs syscall.PtraceRegs) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.requireStopped(); err != nil {
+		return err
+	}
+	f.regs = regs
+	return nil
+}
+
+// PeekData reads the stopped fake's memory at addr into out, returning
+// the number of bytes read, up to the first byte that does not exist.
+func (f *Fake) PeekData(addr uintptr, out []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.requireStopped(); err != nil {
+		return 0, err
+	}
+	for i := range out {
+		b, ok := f.mem[addr+uintptr(i)]
+		if !ok {
+			return i, syscall.EIO
+		}
+		out[i] = b
+	}
+	return len(out), nil
+}
+
+// PokeData writes data into the stopped fake's memory at addr, returning
+// the number of bytes written, up to the first byte that does not exist.
+func (f *Fake) PokeData(addr uintptr, data []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.requireStopped(); err != nil {
+		return 0, err
+	}
+	for i, b := range data {
+		a := addr + uintptr(i)
+		if _, ok := f.mem[a]; !ok {
+			return i, syscall.EIO
+		}
+		f.mem[a] = b
+	}
+	return len(data), nil
+}
+
+func (f *Fake) resume() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.requireStopped(); err != nil {
+		return err
+	}
+	if len(f.stops) == 0 {
+		f.stops = []Stop{{Event: syscall.WaitStatus(0)}}
+	}
+	f.next()
+	return nil
+}
+
+// Moves to the next stop, and sends its event.  Must be called with mu
+// held.
+func (f *Fake) next() {
+	s := f.stops[0]
+	f.stops = f.stops[1:]
+	if s.Regs != nil {
+		f.regs = *s.Regs
+	}
+	f.state = ptrace.Stopped
+	if ws, ok := s.Event.(syscall.WaitStatus); ok && (ws.Exited() || ws.Signaled()) {
+		f.state = ptrace.Exited
+	}
+	if !f.closed {
+		f.events <- s.Event
+		if f.state == ptrace.Exited {
+			f.closed = true
+			close(f.events)
+		}
+	}
+}
+
+// Must be called with mu held.
+func (f *Fake) requireStopped() error {
+	switch f.state {
+	case ptrace.Exited:
+		return ptrace.ErrTraceeExited
+	case ptrace.Detached:
+		return ptrace.ErrNotAttached
+	}
+	return nil
+}
+
+// Returns the wait status of a stop by the signal.
+func stopStatus(sig syscall.Signal) syscall.WaitStatus {
+	return syscall.WaitStatus(0x7f | int(sig)<<8)
+}
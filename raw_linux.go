@@ -0,0 +1,325 @@
+package ptrace
+
+import (
+	"context"
+	"encoding/binary"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// The size of a pointer in the tracee, which must match the tracer.
+const ptrSize = uint64(unsafe.Sizeof(uintptr(0)))
+
+// A Raw issues ptrace requests directly on the tracer thread.  A Raw is
+// only valid during the call to Do that provided it.
+type Raw struct {
+	t *Tracee
+}
+
+// Do calls f on the tracer thread with a Raw for the tracee, and returns
+// the error returned by f.  A sequence of requests issued through the
+// Raw costs a single round trip to the tracer thread, which is much
+// cheaper than issuing them individually.
+func (t *Tracee) Do(f func(Raw) error) error {
+	c := t.newCommand("do")
+	c.raw = f
+	return t.dispatch(t.ctx, c)
+}
+
+// Calls f as Do, but regardless of the tracee's context, as runInternal.
+func (t *Tracee) doInternal(f func(Raw) error) error {
+	c := t.newCommand("do")
+	c.raw = f
+	return t.dispatch(context.Background(), c)
+}
+
+// Linux specific fields of a command.
+type osCommand struct {
+	// Raw, if non-nil, is called in place of f, with a Raw for the
+	// tracee, for Do.
+	raw func(Raw) error
+}
+
+// Calls the command's function.  Called on the tracer go routine.
+func (c *command) call() error {
+	if c.raw == nil {
+		return c.f()
+	}
+	if err := c.t.requireStopped(); err != nil {
+		return err
+	}
+	return c.raw(Raw{c.t})
+}
+
+// Pid returns the process ID of the tracee.
+func (r Raw) Pid() int {
+	return r.t.proc.Pid
+}
+
+// PeekData reads tracee memory at addr into out, returning the number
+// of bytes read.  Reading fewer than len(out) bytes is an error; if the
+// read reached memory that cannot be read, such as an unmapped page, the
+// error is a *PartialReadError, and the bytes before it are read.
+func (r Raw) PeekData(addr uintptr, out []byte) (int, error) {
+	n, err := ptracePeek(r.Pid(), addr, out)
+	switch {
+	case err == syscall.EIO || err == syscall.EFAULT:
+		err = &PartialReadError{Addr: uint64(addr) + uint64(n), N: n, Err: err}
+	case err == nil && n < len(out):
+		err = errShortTransfer
+	}
+	return n, r.t.opError("peekdata", err)
+}
+
+// PokeData writes data into tracee memory at addr, returning the number
+// of bytes written.  Writing fewer than len(data) bytes is an error.
+func (r Raw) PokeData(addr uintptr, data []byte) (int, error) {
+	n, err := ptracePoke(r.Pid(), addr, data)
+	if err == nil && n < len(data) {
+		err = errShortTransfer
+	}
+	return n, r.t.opError("pokedata", err)
+}
+
+// GetRegs reads the tracee's general purpose registers.  They are read
+// from the kernel once per stop, and cached until the tracee is resumed
+// or its registers are written, so reading them repeatedly at the same
+// stop is cheap.
+func (r Raw) GetRegs(regs *syscall.PtraceRegs) error {
+	c := &r.t.regs
+	if !c.valid {
+		if err := ptraceGetRegs(r.Pid(), &c.regs); err != nil {
+			return r.t.opError("getregs", err)
+		}
+		c.valid = true
+	}
+	*regs = c.regs
+	return nil
+}
+
+// SetRegs writes the tracee's general purpose registers.
+func (r Raw) SetRegs(regs *syscall.PtraceRegs) error {
+	// The kernel may adjust the registers written, such as the
+	// reserved flags bits, so they are read again.
+	r.t.invalidateRegs()
+	return r.t.opError("setregs", ptraceSetRegs(r.Pid(), regs))
+}
+
+// Reads the words of tracee memory at addr into out, as
+// syscall.PtracePeekData, but retrying requests interrupted by a signal.
+// Returns the number of bytes read before an error.
+func ptracePeek(pid int, addr uintptr, out []byte) (int, error) {
+	var word [ptrSize]byte
+	n := 0
+	off := addr % uintptr(ptrSize)
+	for len(out) > 0 {
+		// The word is read into a buffer, to keep it aligned.
+		if err := ptracePtr(syscall.PTRACE_PEEKDATA, pid, addr+uintptr(n)-off, unsafe.Pointer(&word[0])); err != nil {
+			return n, err
+		}
+		m := copy(out, word[off:])
+		n += m
+		out = out[m:]
+		off = 0
+	}
+	return n, nil
+}
+
+// Writes data into tracee memory at addr a word at a time, as
+// syscall.PtracePokeData, but retrying requests interrupted by a
+// signal.  A partial word at either end is merged with the memory
+// around it.  Returns the number of bytes written before an error.
+func ptracePoke(pid int, addr uintptr, data []byte) (int, error) {
+	var word [ptrSize]byte
+	n := 0
+	off := addr % uintptr(ptrSize)
+	for len(data) > 0 {
+		at := addr + uintptr(n) - off
+		if off != 0 || len(data) < len(word) {
+			if err := ptracePtr(syscall.PTRACE_PEEKDATA, pid, at, unsafe.Pointer(&word[0])); err != nil {
+				return n, err
+			}
+		}
+		m := copy(word[off:], data)
+		// The word is decoded, rather than loaded through a
+		// pointer, since the buffer may not be aligned.
+		var v uintptr
+		if ptrSize == 4 {
+			v = uintptr(binary.NativeEndian.Uint32(word[:]))
+		} else {
+			v = uintptr(binary.NativeEndian.Uint64(word[:]))
+		}
+		if err := ptrace(syscall.PTRACE_POKEDATA, pid, at, v); err != nil {
+			return n, err
+		}
+		n += m
+		data = data[m:]
+		off = 0
+	}
+	return n, nil
+}
+
+// PTRACE_GETREGS on x86, which the syscall package does not define on
+// every architecture.
+const ptraceGetRegsX86 = 12
+
+// Reads the general purpose registers, as syscall.PtraceGetRegs, but
+// retrying if interrupted by a signal.  They are read with
+// PTRACE_GETREGSET, which every architecture supports, except on amd64,
+// where PTRACE_GETREGS reads them in the layout of syscall.PtraceRegs
+// even from a 32-bit tracee.
+func ptraceGetRegs(pid int, regs *syscall.PtraceRegs) error {
+	if runtime.GOARCH == "amd64" {
+		return ptracePtr(ptraceGetRegsX86, pid, 0, unsafe.Pointer(regs))
+	}
+	iov := syscall.Iovec{Base: (*byte)(unsafe.Pointer(regs))}
+	iov.SetLen(int(unsafe.Sizeof(*regs)))
+	return ptracePtr(syscall.PTRACE_GETREGSET, pid, ntPrstatus, unsafe.Pointer(&iov))
+}
+
+// PTRACE_SETREGS on x86.
+const ptraceSetRegsX86 = 13
+
+// Writes the general purpose registers, as syscall.PtraceSetRegs, but
+// retrying if interrupted by a signal, and with the request that
+// ptraceGetRegs reads them with.
+func ptraceSetRegs(pid int, regs *syscall.PtraceRegs) error {
+	if runtime.GOARCH == "amd64" {
+		return ptracePtr(ptraceSetRegsX86, pid, 0, unsafe.Pointer(regs))
+	}
+	iov := syscall.Iovec{Base: (*byte)(unsafe.Pointer(regs))}
+	iov.SetLen(int(unsafe.Sizeof(*regs)))
+	return ptracePtr(syscall.PTRACE_SETREGSET, pid, ntPrstatus, unsafe.Pointer(&iov))
+}
+
+// The tracee's general purpose registers at its current stop, cached by
+// Raw.GetRegs.
+type regsCache struct {
+	valid bool
+	regs  syscall.PtraceRegs
+}
+
+// Discards the cached registers.  Must be called on the tracer thread
+// when the tracee's registers are written other than by Raw.SetRegs.
+func (t *Tracee) invalidateRegs() {
+	t.regs.valid = false
+}
+
+// Discards the state cached for the current stop: the registers and
+// the memory mappings.  Must be called on the tracer thread when the
+// tracee is resumed.
+func (t *Tracee) invalidateStop() {
+	t.invalidateRegs()
+	t.mem.release(t.mapsCharge)
+	t.maps, t.mapsCharge = nil, nil
+}
+
+// PeekUser reads the word at offset off in the tracee's user area,
+// struct user of <sys/user.h>, with PTRACE_PEEKUSER.  The offset must be
+// word-aligned.  The user area is not supported on every architecture;
+// notably, not on arm64 or riscv64, which use register sets instead.
+func (r Raw) PeekUser(off uintptr) (uintptr, error) {
+	var v uintptr
+	if err := ptracePtr(syscall.PTRACE_PEEKUSR, r.Pid(), off, unsafe.Pointer(&v)); err != nil {
+		return 0, r.t.opError("peekuser", err)
+	}
+	return v, nil
+}
+
+// PokeUser writes the word at offset off in the tracee's user area with
+// PTRACE_POKEUSER.  Only the general purpose and debug registers may be
+// written.
+func (r Raw) PokeUser(off, v uintptr) error {
+	r.t.invalidateRegs()
+	if err := ptrace(syscall.PTRACE_POKEUSR, r.Pid(), off, v); err != nil {
+		return r.t.opError("pokeuser", err)
+	}
+	return nil
+}
+
+// PeekData reads tracee memory at addr into out, returning the number
+// of bytes read.  Use Do to batch many reads.
+func (t *Tracee) PeekData(addr uintptr, out []byte) (int, error) {
+	var n int
+	err := t.Do(func(r Raw) (err error) {
+		n, err = r.PeekData(addr, out)
+		return err
+	})
+	return n, err
+}
+
+// PokeData writes data into tracee memory at addr, returning the number
+// of bytes written.  Use Do to batch many writes.
+func (t *Tracee) PokeData(addr uintptr, data []byte) (int, error) {
+	var n int
+	err := t.Do(func(r Raw) (err error) {
+		n, err = r.PokeData(addr, data)
+		return err
+	})
+	return n, err
+}
+
+// Reads tracee memory as PeekData, but regardless of the tracee's
+// context, as doInternal, for the tracer's own reads.
+func (t *Tracee) peekInternal(addr uintptr, out []byte) (int, error) {
+	var n int
+	err := t.doInternal(func(r Raw) (err error) {
+		n, err = r.PeekData(addr, out)
+		return err
+	})
+	return n, err
+}
+
+// Writes tracee memory as PokeData, but regardless of the tracee's
+// context, as doInternal, for the tracer's own writes.
+func (t *Tracee) pokeInternal(addr uintptr, data []byte) (int, error) {
+	var n int
+	err := t.doInternal(func(r Raw) (err error) {
+		n, err = r.PokeData(addr, data)
+		return err
+	})
+	return n, err
+}
+
+// GetRegs returns the tracee's general purpose registers.
+func (t *Tracee) GetRegs() (syscall.PtraceRegs, error) {
+	var regs syscall.PtraceRegs
+	err := t.Do(func(r Raw) error { return r.GetRegs(&regs) })
+	return regs, err
+}
+
+// SetRegs sets the tracee's general purpose registers.
+func (t *Tracee) SetRegs(regs syscall.PtraceRegs) error {
+	return t.Do(func(r Raw) error { return r.SetRegs(&regs) })
+}
+
+// PeekUser reads the word at offset off in the tracee's user area.  Use
+// Do to batch many reads.
+func (t *Tracee) PeekUser(off uintptr) (uintptr, error) {
+	var v uintptr
+	err := t.Do(func(r Raw) (err error) {
+		v, err = r.PeekUser(off)
+		return err
+	})
+	return v, err
+}
+
+// PokeUser writes the word at offset off in the tracee's user area.  Use
+// Do to batch many writes.
+func (t *Tracee) PokeUser(off, v uintptr) error {
+	return t.Do(func(r Raw) error { return r.PokeUser(off, v) })
+}
+
+// DebugRegOffset returns the offset in the user area of the debug
+// register DRi, u_debugreg[i] of struct user, for PeekUser and PokeUser.
+// It fails on architectures other than 386 and amd64.
+func DebugRegOffset(i int) (uintptr, error) {
+	if debugRegOffset < 0 {
+		return 0, errUnsupportedArch
+	}
+	if i < 0 || i > 7 {
+		return 0, errBadDebugReg
+	}
+	return uintptr(debugRegOffset + i*int(unsafe.Sizeof(uintptr(0)))), nil
+}
@@ -0,0 +1,289 @@
+package ptrace
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errBadRecording = errors.New("ptrace: not a recording for " + runtime.GOARCH)
+
+// The magic string that begins a recording.
+const recordingMagic = "ptrace recording 1"
+
+func init() {
+	for _, ev := range []Event{
+		syscall.WaitStatus(0),
+		ExecEvent{},
+		PreExitEvent{},
+		ForkEvent{},
+		SyscallEnterEvent{},
+		SyscallExitEvent{},
+		SeccompEvent{},
+		GroupStopEvent{},
+		ThreadEvent{},
+		CloneEvent{},
+		NamespaceChangeEvent{},
+		LibraryLoadEvent{},
+		LibraryUnloadEvent{},
+		LibraryCallEvent{},
+		BreakpointEvent{},
+		HWBreakpointEvent{},
+		RegionChangeEvent{},
+		MemoryPressureEvent{},
+		UsageEvent{},
+		NetworkEvent{},
+	} {
+		gob.Register(ev)
+	}
+	// The concrete types of the interface fields of NetworkEvent.
+	for _, v := range []interface{}{
+		&net.TCPAddr{},
+		&net.UDPAddr{},
+		&net.UnixAddr{},
+		syscall.Errno(0),
+	} {
+		gob.Register(v)
+	}
+}
+
+// A Record is an event in a recording.
+type Record struct {
+	// Seq is the record's sequence number in the recording, starting
+	// at 1.
+	Seq uint64
+	// Time is when the event was observed.
+	Time time.Time
+	// Pid is the process ID of the tracee.
+	Pid int
+	Event
+	// Regs are the tracee's registers, if the tracee was stopped for
+	// the event.
+	Regs *syscall.PtraceRegs
+}
+
+type recordingHeader struct {
+	Magic string
+	Arch  string
+}
+
+// A Recorder writes the events of one or more tracees to a recording,
+// with the tracees' registers at each stop, so that they can be
+// analyzed offline with a Replayer.  As with a Session, the events
+// recorded are those observed by the tracees' wait go routines.
+type Recorder struct {
+	mu     sync.Mutex
+	enc    *gob.Encoder
+	redact *Redactor
+	seq    uint64
+	err    error
+}
+
+// NewRecorder returns a Recorder that writes to w.  If redact is
+// non-nil, paths and memory contents in the recorded events are
+// redacted.  To encrypt the recording, w can be a writer returned by
+// NewEncryptedWriter.
+func NewRecorder(w io.Writer, redact *Redactor) *Recorder {
+	rec := &Recorder{enc: gob.NewEncoder(w), redact: redact}
+	rec.err = rec.enc.Encode(recordingHeader{Magic: recordingMagic, Arch: runtime.GOARCH})
+	return rec
+}
+
+// WithRecorder records the tracee's events with the Recorder.
+func WithRecorder(rec *Recorder) Option {
+	return func(t *Tracee) {
+		t.observers = append(t.observers, func(ev Event) {
+			rec.observe(t, ev)
+		})
+	}
+}
+
+// Err returns the first error writing the recording, after which no
+// more events are recorded.
+func (rec *Recorder) Err() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.err
+}
+
+// Called on the tracee's wait go routine.
+func (rec *Recorder) observe(t *Tracee, ev Event) {
+	r := Record{Time: time.Now(), Pid: t.proc.Pid, Event: rec.redact.event(ev)}
+	if t.State().IsStopped() {
+		// The registers are cached for the stop, so reading them
+		// here costs nothing more for a command that reads them
+		// at the same stop.
+		var regs syscall.PtraceRegs
+		if t.doInternal(func(r Raw) error { return r.GetRegs(&regs) }) == nil {
+			r.Regs = &regs
+		}
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err != nil {
+		return
+	}
+	rec.seq++
+	r.Seq = rec.seq
+	rec.err = rec.enc.Encode(&r)
+}
+
+// Returns a copy of the event with its paths and memory contents
+// redacted: the paths of executables, libraries, and Unix sockets, the
+// decoded arguments of system and library calls, and the contents of
+// watched regions.  The IP addresses and ports of a NetworkEvent, and
+// the namespace identifiers of a NamespaceChangeEvent, are left in the
+// clear.
+func (r *Redactor) event(ev Event) Event {
+	if r == nil {
+		return ev
+	}
+	libs := func(ls []Library) []Library {
+		out := make([]Library, len(ls))
+		for i, l := range ls {
+			out[i] = Library{Path: r.Path(l.Path), Base: l.Base}
+		}
+		return out
+	}
+	switch e := ev.(type) {
+	case ExecEvent:
+		e.Path = r.Path(e.Path)
+		return e
+	case SyscallEnterEvent:
+		e.Decoded = r.decoded(e.Decoded)
+		return e
+	case SyscallExitEvent:
+		e.Decoded = r.decoded(e.Decoded)
+		return e
+	case NetworkEvent:
+		if a, ok := e.Addr.(*net.UnixAddr); ok {
+			e.Addr = &net.UnixAddr{Name: r.Path(a.Name), Net: a.Net}
+		}
+		return e
+	case LibraryLoadEvent:
+		e.Libraries = libs(e.Libraries)
+		return e
+	case LibraryUnloadEvent:
+		e.Libraries = libs(e.Libraries)
+		return e
+	case LibraryCallEvent:
+		e.Library = r.Path(e.Library)
+		e.Decoded = r.decoded(e.Decoded)
+		return e
+	case RegionChangeEvent:
+		cs := make([]MemoryChange, len(e.Changes))
+		for i, c := range e.Changes {
+			cs[i] = MemoryChange{Offset: c.Offset, Old: r.Data(c.Old), New: r.Data(c.New)}
+		}
+		e.Changes = cs
+		return e
+	}
+	return ev
+}
+
+// Returns a copy of decoded arguments, with those that are quoted strings
+// matching a redacted path replaced by Redacted, and the others
+// redacted as data.  A string truncated by the decoding limits is
+// matched as it is.
+func (r *Redactor) decoded(ds []string) []string {
+	if ds == nil {
+		return nil
+	}
+	out := make([]string, len(ds))
+	for i, d := range ds {
+		if s, err := strconv.Unquote(strings.TrimSuffix(d, "...")); err == nil && r.Path(s) == Redacted {
+			out[i] = Redacted
+			continue
+		}
+		out[i] = string(r.Data([]byte(d)))
+	}
+	return out
+}
+
+// A Replayer reads the events of a recording written by a Recorder.
+type Replayer struct {
+	dec    *gob.Decoder
+	once   sync.Once
+	events chan Event
+	err    error
+}
+
+// NewReplayer returns a Replayer that reads a recording from r, which
+// can be a reader returned by NewDecryptedReader.  It returns an error
+// if the recording was not made on the same architecture.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	p := &Replayer{dec: gob.NewDecoder(r)}
+	var hdr recordingHeader
+	if err := p.dec.Decode(&hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != recordingMagic || hdr.Arch != runtime.GOARCH {
+		return nil, errBadRecording
+	}
+	return p, nil
+}
+
+// Next returns the next record of the recording, or io.EOF at its end.
+// Next must not be used along with Events or NextEvent.
+func (p *Replayer) Next() (Record, error) {
+	var r Record
+	err := p.dec.Decode(&r)
+	return r, err
+}
+
+// Events returns a channel on which the recorded events are sent, in
+// the order they were recorded, as by the events channel of the Tracee
+// that they were recorded from.  The channel is closed at the end of
+// the recording, after which Err returns the error that ended it, if
+// any.
+func (p *Replayer) Events() <-chan Event {
+	p.once.Do(func() {
+		p.events = make(chan Event, 1)
+		go func() {
+			defer close(p.events)
+			for {
+				r, err := p.Next()
+				if err != nil {
+					if err != io.EOF {
+						p.err = err
+					}
+					return
+				}
+				p.events <- r.Event
+			}
+		}()
+	})
+	return p.events
+}
+
+// NextEvent returns the next recorded event, or ErrTraceeExited at the
+// end of the recording, as Tracee.NextEvent does once the tracee has
+// exited.
+func (p *Replayer) NextEvent(ctx context.Context) (Event, error) {
+	select {
+	case ev, ok := <-p.Events():
+		if !ok {
+			if p.err != nil {
+				return nil, p.err
+			}
+			return nil, ErrTraceeExited
+		}
+		return ev, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Err returns the error that ended the recording early, once the events
+// channel is closed.
+func (p *Replayer) Err() error {
+	return p.err
+}
@@ -0,0 +1,173 @@
+package ptrace
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Events of every type that a tracee sends, for round trips through a
+// recording.
+func sampleEvents() []Event {
+	now := time.Unix(1700000000, 42).UTC()
+	stopped := syscall.WaitStatus(0x57f) // SIGTRAP
+	return []Event{
+		stopped,
+		ExecEvent{Status: stopped, Path: "/bin/true"},
+		PreExitEvent{Status: stopped, ExitStatus: 1 << 8},
+		ForkEvent{Status: stopped, Pid: 42},
+		SyscallEnterEvent{Status: stopped, Time: now, Nr: 1, Args: [6]uint64{1, 2}, Decoded: []string{"1", `"x"`}},
+		SyscallExitEvent{Status: stopped, Time: now, Nr: 1, Ret: -2, Errno: syscall.ENOENT, Decoded: []string{`"/x"`}},
+		SeccompEvent{Status: stopped, Time: now, Nr: 2},
+		GroupStopEvent{Status: 0x137f, Signal: syscall.SIGSTOP},
+		ThreadEvent{TID: 43, Event: CloneEvent{Status: stopped, NewTID: 44}},
+		CloneEvent{Status: stopped, NewTID: 44},
+		NamespaceChangeEvent{Old: Namespaces{Net: 1}, New: Namespaces{Net: 2}},
+		LibraryLoadEvent{Libraries: []Library{{Path: "/lib/libc.so.6", Base: 0x7f0000000000}}},
+		LibraryUnloadEvent{Libraries: []Library{{Path: "/lib/libm.so.6", Base: 0x7f1000000000}}},
+		LibraryCallEvent{Time: now, Library: "/lib/libc.so.6", Function: "puts", Addr: 0x1000, Args: []uint64{0x2000}, Decoded: []string{`"hi"`}},
+		BreakpointEvent{Status: stopped, Addr: 0x1000},
+		HWBreakpointEvent{Status: stopped, Addr: 0x1000, Slot: 1},
+		RegionChangeEvent{Addr: 0x3000, Changes: []MemoryChange{{Offset: 4, Old: []byte{1}, New: []byte{2}}}},
+		MemoryPressureEvent{Evicted: 4096},
+		UsageEvent{Time: now, Usage: Usage{RSS: 1024}},
+		NetworkEvent{Time: now, Syscall: "connect", Fd: 3, Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80}, Err: syscall.ECONNREFUSED},
+	}
+}
+
+// Types named like events that are not sent by a tracee.
+var notTraceeEvents = map[string]bool{
+	"Event":              true,
+	"SessionEvent":       true,
+	"SupervisorEvent":    true,
+	"MachExceptionEvent": true,
+}
+
+func TestRecordAllEvents(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, ev := range sampleEvents() {
+		covered[reflect.TypeOf(ev).Name()] = true
+	}
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range f.Decls {
+			g, ok := d.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range g.Specs {
+				n := s.(*ast.TypeSpec).Name.Name
+				if ast.IsExported(n) && strings.HasSuffix(n, "Event") && !covered[n] && !notTraceeEvents[n] {
+					t.Errorf("%s: %s has no sample event", name, n)
+				}
+			}
+		}
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf, nil)
+	tr := fakeTracee(1)
+	evs := sampleEvents()
+	for _, ev := range evs {
+		rec.observe(tr, ev)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	p, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatalf("NewReplayer: %v", err)
+	}
+	for i, want := range evs {
+		r, err := p.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i+1, err)
+		}
+		if r.Seq != uint64(i+1) || r.Pid != 1 {
+			t.Errorf("record %d: got Seq %d, Pid %d, want Seq %d, Pid 1", i+1, r.Seq, r.Pid, i+1)
+		}
+		if !reflect.DeepEqual(r.Event, want) {
+			t.Errorf("record %d: got %#v, want %#v", i+1, r.Event, want)
+		}
+	}
+}
+
+func TestRedactEvent(t *testing.T) {
+	r := &Redactor{Paths: []string{"/secret/*"}, Bytes: [][]byte{[]byte("hunter2")}}
+	tests := []struct {
+		name     string
+		ev, want Event
+	}{
+		{
+			"exec",
+			ExecEvent{Path: "/secret/bin"},
+			ExecEvent{Path: Redacted},
+		},
+		{
+			"syscall enter",
+			SyscallEnterEvent{Nr: 2, Decoded: []string{`"/secret/key"`, `"/etc/hosts"`, "0x0"}},
+			SyscallEnterEvent{Nr: 2, Decoded: []string{Redacted, `"/etc/hosts"`, "0x0"}},
+		},
+		{
+			"truncated path",
+			SyscallEnterEvent{Decoded: []string{`"/secret/lo"...`}},
+			SyscallEnterEvent{Decoded: []string{Redacted}},
+		},
+		{
+			"syscall exit",
+			SyscallExitEvent{Decoded: []string{"3", `"pw=hunter2"`}},
+			SyscallExitEvent{Decoded: []string{"3", "\"pw=\x00\x00\x00\x00\x00\x00\x00\""}},
+		},
+		{
+			"unix socket",
+			NetworkEvent{Syscall: "connect", Addr: &net.UnixAddr{Name: "/secret/sock", Net: "unix"}},
+			NetworkEvent{Syscall: "connect", Addr: &net.UnixAddr{Name: Redacted, Net: "unix"}},
+		},
+		{
+			"tcp",
+			NetworkEvent{Syscall: "connect", Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}},
+			NetworkEvent{Syscall: "connect", Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}},
+		},
+		{
+			"library call",
+			LibraryCallEvent{Library: "/secret/lib.so", Decoded: []string{`"/secret/x"`}},
+			LibraryCallEvent{Library: Redacted, Decoded: []string{Redacted}},
+		},
+		{
+			"region change",
+			RegionChangeEvent{Changes: []MemoryChange{{Old: []byte("hunter1"), New: []byte("hunter2")}}},
+			RegionChangeEvent{Changes: []MemoryChange{{Old: []byte("hunter1"), New: make([]byte, 7)}}},
+		},
+	}
+	for _, test := range tests {
+		if got := r.event(test.ev); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ptrace
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var errBadRegister = errors.New("ptrace: no such register")
+
+// RegisterNames returns the names of the general purpose registers of
+// the architecture, as accepted by GetRegister and SetRegister, in the
+// order of the fields of syscall.PtraceRegs: "rax" and "rip" on amd64,
+// "x0" and "pc" on arm64, and "a0" on riscv64, for example.  It is
+// empty on architectures whose registers are not named.
+func RegisterNames() []string {
+	return append([]string(nil), registerNames...)
+}
+
+// GetRegister returns the value of the stopped tracee's general purpose
+// register with the given name, which is case insensitive.  Besides the
+// names of RegisterNames, "pc", "sp", and "fp" name the program counter,
+// stack pointer, and frame pointer on every supported architecture.
+// The registers of 386 are zero-extended.
+func (t *Tracee) GetRegister(name string) (uint64, error) {
+	i, err := RegisterIndex(name)
+	if err != nil {
+		return 0, err
+	}
+	regs, err := t.GetRegs()
+	if err != nil {
+		return 0, err
+	}
+	return RegisterValue(&regs, i), nil
+}
+
+// SetRegister sets the stopped tracee's general purpose register with
+// the given name.  The registers of 386 are truncated to 32 bits.
+func (t *Tracee) SetRegister(name string, v uint64) error {
+	i, err := RegisterIndex(name)
+	if err != nil {
+		return err
+	}
+	return t.Do(func(r Raw) error {
+		var regs syscall.PtraceRegs
+		if err := r.GetRegs(&regs); err != nil {
+			return err
+		}
+		SetRegisterValue(&regs, i, v)
+		return r.SetRegs(&regs)
+	})
+}
+
+// RegisterValue returns the ith register of RegisterNames in regs, such
+// as registers returned by GetRegs or recorded in a snapshot.
+func RegisterValue(regs *syscall.PtraceRegs, i int) uint64 {
+	p := registerPointer(regs, i)
+	if ptrSize == 4 {
+		return uint64(*(*uint32)(p))
+	}
+	return *(*uint64)(p)
+}
+
+// SetRegisterValue sets the ith register of RegisterNames in regs.
+func SetRegisterValue(regs *syscall.PtraceRegs, i int, v uint64) {
+	p := registerPointer(regs, i)
+	if ptrSize == 4 {
+		*(*uint32)(p) = uint32(v)
+	} else {
+		*(*uint64)(p) = v
+	}
+}
+
+// RegisterIndex returns the index in RegisterNames of the register with
+// the given name, or of the register that it is another name for, for
+// RegisterValue and SetRegisterValue.
+func RegisterIndex(name string) (int, error) {
+	if len(registerNames) == 0 {
+		return 0, errUnsupportedArch
+	}
+	name = strings.ToLower(name)
+	if n, ok := registerAliases[name]; ok {
+		name = n
+	}
+	for i, n := range registerNames {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, errBadRegister
+}
+
+// Returns a pointer to the ith register in regs.  The fields of
+// syscall.PtraceRegs are words on every architecture with register
+// names, so the ith register is the ith word.
+func registerPointer(regs *syscall.PtraceRegs, i int) unsafe.Pointer {
+	if i < 0 || i >= len(registerNames) {
+		panic("ptrace: register index out of range")
+	}
+	return unsafe.Add(unsafe.Pointer(regs), i*int(ptrSize))
+}
@@ -0,0 +1,18 @@
+package ptrace
+
+// Regs are the general purpose registers of a thread, as in
+// x86_thread_state64_t of <mach/i386/_structs.h>.
+type Regs struct {
+	Rax, Rbx, Rcx, Rdx uint64
+	Rdi, Rsi, Rbp, Rsp uint64
+	R8, R9, R10, R11   uint64
+	R12, R13, R14, R15 uint64
+	Rip, Rflags        uint64
+	Cs, Fs, Gs         uint64
+}
+
+// PC returns the program counter.
+func (r *Regs) PC() uint64 { return r.Rip }
+
+// SetPC sets the program counter.
+func (r *Regs) SetPC(pc uint64) { r.Rip = pc }
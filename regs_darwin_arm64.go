@@ -0,0 +1,20 @@
+package ptrace
+
+// Regs are the general purpose registers of a thread, as in
+// arm_thread_state64_t of <mach/arm/_structs.h>.  On systems with
+// pointer authentication, Fp, Lr, Sp, and Pc may be signed.
+type Regs struct {
+	X    [29]uint64
+	Fp   uint64
+	Lr   uint64
+	Sp   uint64
+	Pc   uint64
+	Cpsr uint32
+	Pad  uint32
+}
+
+// PC returns the program counter.
+func (r *Regs) PC() uint64 { return r.Pc }
+
+// SetPC sets the program counter.
+func (r *Regs) SetPC(pc uint64) { r.Pc = pc }
@@ -0,0 +1,97 @@
+package ptrace
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Register set note types, from <linux/elf.h>, for GetRegSet and
+// SetRegSet.  Each is supported only on its own architecture, except
+// NTPrstatus and NTPrfpreg, which are supported on every architecture.
+const (
+	// NTPrstatus is the general purpose registers, in the layout of
+	// syscall.PtraceRegs.
+	NTPrstatus = ntPrstatus
+	// NTPrfpreg is the floating point registers.
+	NTPrfpreg = ntPrfpreg
+	// NTX86XState is the x86 XSAVE area, which holds the extended
+	// state, such as the AVX registers.
+	NTX86XState = 0x202
+	// NTARMTLS is the arm64 thread pointer, TPIDR_EL0.
+	NTARMTLS = 0x401
+	// NTARMHWBreak and NTARMHWWatch are the arm64 hardware breakpoint
+	// and watchpoint registers.
+	NTARMHWBreak = 0x402
+	NTARMHWWatch = 0x403
+	// NTARMSystemCall is the arm64 system call number.
+	NTARMSystemCall = 0x404
+	// NTARMSVE is the arm64 Scalable Vector Extension registers.
+	NTARMSVE = 0x405
+	// NTRISCVVector is the riscv64 vector registers.
+	NTRISCVVector = 0x901
+)
+
+// GetRegSet reads the tracee's register set of the note type nt, such as
+// NTX86XState, into buf with PTRACE_GETREGSET, and returns the number of
+// bytes read.  A register set larger than buf is truncated.
+func (r Raw) GetRegSet(nt int, buf []byte) (int, error) {
+	n, err := getRegSet(r.Pid(), nt, buf)
+	return n, r.t.opError("getregset", err)
+}
+
+// SetRegSet writes the tracee's register set of the note type nt from
+// buf with PTRACE_SETREGSET.  Some register sets may be written in part,
+// by a buf shorter than the register set.
+func (r Raw) SetRegSet(nt int, buf []byte) error {
+	if nt == NTPrstatus {
+		r.t.invalidateRegs()
+	}
+	return r.t.opError("setregset", setRegSet(r.Pid(), nt, buf))
+}
+
+// GetRegSet reads the stopped tracee's register set of the note type nt
+// into buf, and returns the number of bytes read.  It gives access to
+// the registers that the package does not otherwise model.
+func (t *Tracee) GetRegSet(nt int, buf []byte) (int, error) {
+	var n int
+	err := t.Do(func(r Raw) (err error) {
+		n, err = r.GetRegSet(nt, buf)
+		return err
+	})
+	return n, err
+}
+
+// SetRegSet writes the stopped tracee's register set of the note type
+// nt from buf.
+func (t *Tracee) SetRegSet(nt int, buf []byte) error {
+	return t.Do(func(r Raw) error { return r.SetRegSet(nt, buf) })
+}
+
+func getRegSet(pid, nt int, buf []byte) (int, error) {
+	iov := regSetIovec(buf)
+	_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_GETREGSET, uintptr(pid),
+		uintptr(nt), uintptr(unsafe.Pointer(&iov)), 0, 0)
+	if e != 0 {
+		return 0, e
+	}
+	return int(iov.Len), nil
+}
+
+func setRegSet(pid, nt int, buf []byte) error {
+	iov := regSetIovec(buf)
+	_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_SETREGSET, uintptr(pid),
+		uintptr(nt), uintptr(unsafe.Pointer(&iov)), 0, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+func regSetIovec(buf []byte) syscall.Iovec {
+	var iov syscall.Iovec
+	if len(buf) > 0 {
+		iov.Base = &buf[0]
+		iov.SetLen(len(buf))
+	}
+	return iov
+}
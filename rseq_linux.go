@@ -0,0 +1,126 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+)
+
+// PTRACE_GET_RSEQ_CONFIGURATION from <linux/ptrace.h>.
+const ptraceGetRseqConfiguration = 0x420f
+
+// An RseqConfig is the restartable sequences registration of a thread,
+// made with the rseq system call, as glibc 2.35 and later does for every
+// thread.
+type RseqConfig struct {
+	// Addr is the address of the thread's struct rseq, or 0 if the
+	// thread has not registered one.
+	Addr uint64 `json:"addr"`
+	// Size is the registered size of the struct rseq.
+	Size uint32 `json:"size"`
+	// Signature is the value that must precede the abort handler of
+	// each critical section.
+	Signature uint32 `json:"signature"`
+	Flags     uint32 `json:"flags"`
+}
+
+// An RseqCriticalSection is a restartable sequence critical section,
+// struct rseq_cs.  If a thread is preempted, migrated, or signaled while
+// its program counter is in the section, the kernel moves it to the
+// abort handler, so a breakpoint or single step within the section
+// makes the section abort, and retry, forever.
+type RseqCriticalSection struct {
+	Version uint32 `json:"version"`
+	Flags   uint32 `json:"flags"`
+	// Start is the address of the first instruction of the section,
+	// and End is the address of its commit instruction.
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	// Abort is the address of the abort handler.
+	Abort uint64 `json:"abort"`
+}
+
+// Contains returns whether the address is within the critical section.
+func (cs RseqCriticalSection) Contains(addr uint64) bool {
+	return addr >= cs.Start && addr < cs.End
+}
+
+// RseqConfig returns the restartable sequences registration of the
+// stopped tracee.  It requires Linux 5.13.
+func (t *Tracee) RseqConfig() (RseqConfig, error) {
+	var c RseqConfig
+	err := t.Do(func(r Raw) error {
+		var err error
+		c, err = rseqConfig(r.Pid())
+		return err
+	})
+	return c, err
+}
+
+// RseqCriticalSection returns the restartable sequence critical section
+// that the stopped tracee is in, and whether it is in one.  The kernel
+// only knows of a critical section while a thread is executing it, so a
+// debugger should check before single-stepping, or before setting a
+// breakpoint at the tracee's program counter, and instead set a
+// breakpoint at the section's end or abort handler and continue.
+func (t *Tracee) RseqCriticalSection() (RseqCriticalSection, bool, error) {
+	var cs RseqCriticalSection
+	var in bool
+	err := t.Do(func(r Raw) error {
+		c, err := rseqConfig(r.Pid())
+		if err != nil || c.Addr == 0 {
+			return err
+		}
+		// The rseq_cs field of struct rseq is a 64-bit pointer at
+		// offset 8, on every architecture.
+		var b [32]byte
+		if err := readMemory(r, c.Addr+8, b[:8]); err != nil {
+			return err
+		}
+		addr := binary.NativeEndian.Uint64(b[:8])
+		if addr == 0 {
+			return nil
+		}
+		if err := readMemory(r, addr, b[:]); err != nil {
+			return err
+		}
+		cs = RseqCriticalSection{
+			Version: binary.NativeEndian.Uint32(b[0:]),
+			Flags:   binary.NativeEndian.Uint32(b[4:]),
+			Start:   binary.NativeEndian.Uint64(b[8:]),
+			Abort:   binary.NativeEndian.Uint64(b[24:]),
+		}
+		cs.End = cs.Start + binary.NativeEndian.Uint64(b[16:])
+		var regs syscall.PtraceRegs
+		if err := r.GetRegs(&regs); err != nil {
+			return err
+		}
+		// The rseq_cs field is not cleared when the section commits,
+		// so the program counter must be checked.
+		in = cs.Contains(regs.PC())
+		return nil
+	})
+	if !in {
+		cs = RseqCriticalSection{}
+	}
+	return cs, in, err
+}
+
+// Struct ptrace_rseq_configuration.
+type rseqConfiguration struct {
+	addr      uint64
+	size      uint32
+	signature uint32
+	flags     uint32
+	_         uint32
+}
+
+func rseqConfig(pid int) (RseqConfig, error) {
+	var c rseqConfiguration
+	_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, ptraceGetRseqConfiguration, uintptr(pid),
+		unsafe.Sizeof(c), uintptr(unsafe.Pointer(&c)), 0, 0)
+	if e != 0 {
+		return RseqConfig{}, e
+	}
+	return RseqConfig{Addr: c.addr, Size: c.size, Signature: c.signature, Flags: c.flags}, nil
+}
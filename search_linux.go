@@ -0,0 +1,82 @@
+package ptrace
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errBadMask = errors.New("ptrace: search mask and pattern lengths differ")
+
+// The size of the chunks in which Search reads tracee memory.
+const searchChunkSize = 1 << 20
+
+// Search returns the addresses in the stopped tracee's readable mappings
+// at which pattern occurs, in address order.  If mask is non-nil, it
+// must be the length of pattern, and only the bits set in mask are
+// compared, so a 0 byte in mask is a wildcard.  Memory is read in large
+// chunks, with process_vm_readv where available, and mappings that
+// cannot be read are skipped.
+func (t *Tracee) Search(pattern, mask []byte) ([]uintptr, error) {
+	if mask != nil && len(mask) != len(pattern) {
+		return nil, errBadMask
+	}
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	ms, err := t.Mappings()
+	if err != nil {
+		return nil, t.opError("search", err)
+	}
+	var addrs []uintptr
+	err = t.Do(func(r Raw) error {
+		buf := make([]byte, searchChunkSize+len(pattern)-1)
+		for _, m := range ms {
+			if m.Perms&PermRead == 0 {
+				continue
+			}
+			// Consecutive chunks overlap by len(pattern)-1 bytes,
+			// so that matches spanning chunks are found.
+			for a := m.Start; a < m.End; a += searchChunkSize {
+				b := buf[:min(uint64(len(buf)), m.End-a)]
+				if len(b) < len(pattern) {
+					break
+				}
+				if err := readMemory(r, a, b); err != nil {
+					break
+				}
+				for _, i := range matchPattern(b, pattern, mask) {
+					if i < searchChunkSize {
+						addrs = append(addrs, uintptr(a)+uintptr(i))
+					}
+				}
+			}
+		}
+		return nil
+	})
+	return addrs, err
+}
+
+// Returns the offsets in b at which pattern matches under mask.
+func matchPattern(b, pattern, mask []byte) []int {
+	var offs []int
+	if mask == nil {
+		for i := 0; ; {
+			j := bytes.Index(b[i:], pattern)
+			if j < 0 {
+				return offs
+			}
+			offs = append(offs, i+j)
+			i += j + 1
+		}
+	}
+next:
+	for i := 0; i+len(pattern) <= len(b); i++ {
+		for j, p := range pattern {
+			if (b[i+j]^p)&mask[j] != 0 {
+				continue next
+			}
+		}
+		offs = append(offs, i)
+	}
+	return offs
+}
@@ -0,0 +1,87 @@
+package ptrace
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		name             string
+		b, pattern, mask []byte
+		want             []int
+	}{
+		{
+			name:    "unmasked",
+			b:       []byte("abcabcab"),
+			pattern: []byte("abc"),
+			want:    []int{0, 3},
+		},
+		{
+			name:    "unmasked overlapping",
+			b:       []byte("aaaa"),
+			pattern: []byte("aa"),
+			want:    []int{0, 1, 2},
+		},
+		{
+			name:    "unmasked none",
+			b:       []byte("abcabc"),
+			pattern: []byte("abd"),
+		},
+		{
+			name:    "full mask",
+			b:       []byte("abcabcab"),
+			pattern: []byte("abc"),
+			mask:    []byte{0xff, 0xff, 0xff},
+			want:    []int{0, 3},
+		},
+		{
+			name:    "wildcard byte",
+			b:       []byte("axcaycazd"),
+			pattern: []byte("a?c"),
+			mask:    []byte{0xff, 0, 0xff},
+			want:    []int{0, 3},
+		},
+		{
+			name:    "all wildcards",
+			b:       []byte("abcd"),
+			pattern: []byte("??"),
+			mask:    []byte{0, 0},
+			want:    []int{0, 1, 2},
+		},
+		{
+			name:    "partial bits",
+			b:       []byte{0x12, 0x34, 0x1f, 0x34, 0x22, 0x34},
+			pattern: []byte{0x10, 0x34},
+			mask:    []byte{0xf0, 0xff},
+			want:    []int{0, 2},
+		},
+		{
+			name:    "match at the end",
+			b:       []byte("xxab"),
+			pattern: []byte("ab"),
+			mask:    []byte{0xff, 0xff},
+			want:    []int{2},
+		},
+		{
+			name:    "pattern longer than b",
+			b:       []byte("ab"),
+			pattern: []byte("abc"),
+			mask:    []byte{0, 0, 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := matchPattern(test.b, test.pattern, test.mask)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSearchBadMask(t *testing.T) {
+	if _, err := fakeTracee(1).Search([]byte("abc"), []byte{0xff}); err != errBadMask {
+		t.Errorf("got %v, want %v", err, errBadMask)
+	}
+}
@@ -0,0 +1,245 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"time"
+)
+
+// A SeccompEvent is sent when the tracee stops on entry to a system call
+// selected by WithSeccomp.  It is a system call stop: SyscallStop may
+// be used to change or skip the system call, and resuming the tracee
+// with Syscall reports the system call's exit.
+type SeccompEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Time is when the stop was observed.
+	Time time.Time `json:"time"`
+	// Nr is the system call number.
+	Nr int `json:"nr"`
+	// Args are the system call arguments.
+	Args [6]uint64 `json:"args"`
+}
+
+// Name returns the name of the system call.
+func (e SeccompEvent) Name() string { return SyscallName(e.Nr) }
+
+// WithSeccomp installs a seccomp filter in the tracee, before its first
+// instruction executes, that stops it with a SeccompEvent on entry to
+// the named system calls.  When the tracee is resumed with Continue,
+// other system calls run without stopping, which is much cheaper than
+// stopping at every system call with Syscall.  Names that are not
+// system calls on the current architecture are ignored.
+//
+// Installing the filter sets the tracee's no_new_privs attribute, so
+// executing set-user-ID programs does not grant privileges.  The
+// filter, like the attribute, is inherited by children and preserved
+// across execve.  If the filter cannot be installed, Exec fails.
+func WithSeccomp(syscalls ...string) Option {
+	return func(t *Tracee) {
+		sc := t.seccompFilter()
+		sc.nrs = append(sc.nrs, syscallNumbers(syscalls)...)
+	}
+}
+
+type seccompFilter struct {
+	// Nrs are the system calls that stop the tracee, and notifyNrs
+	// are those that are sent to the listener, for
+	// WithSeccompNotify.
+	nrs, notifyNrs []int
+	// Done receives the result of installing the filter.
+	done chan error
+}
+
+// Returns the tracee's seccomp filter, creating it if there is none.
+func (t *Tracee) seccompFilter() *seccompFilter {
+	if t.seccomp == nil {
+		t.seccomp = &seccompFilter{done: make(chan error, 1)}
+	}
+	return t.seccomp
+}
+
+// Returns the numbers of the named system calls, ignoring names that are
+// not system calls on the current architecture.
+func syscallNumbers(names []string) []int {
+	var nrs []int
+	for _, name := range names {
+		if nr, ok := SyscallNumber(name); ok {
+			nrs = append(nrs, nr)
+		}
+	}
+	return nrs
+}
+
+// Constants from <linux/filter.h>, <linux/seccomp.h>, and
+// <linux/prctl.h>.
+const (
+	bpfLdWAbs = 0x20
+	bpfJeqK   = 0x15
+	bpfRetK   = 0x06
+
+	seccompSetModeFilter = 1
+	seccompRetUserNotif  = 0x7fc00000
+	seccompRetTrace      = 0x7ff00000
+	seccompRetAllow      = 0x7fff0000
+	seccompDataNr        = 0
+	seccompDataArch      = 4
+
+	prSetNoNewPrivs = 38
+
+	ptraceOTraceSeccomp = 0x80
+)
+
+var (
+	errSeccompTooMany = errors.New("ptrace: too many system calls for the seccomp filter")
+	errNoSeccomp      = errors.New("ptrace: seccomp is not supported on this architecture")
+)
+
+// Returns the BPF program of the filter as an array of struct
+// sock_filter.  System calls of other architectures are allowed.
+func (sc *seccompFilter) program() ([]byte, error) {
+	n, m := len(sc.nrs), len(sc.notifyNrs)
+	if n+m > 254 {
+		return nil, errSeccompTooMany
+	}
+	var prog []byte
+	ins := func(code uint16, jt, jf uint8, k uint32) {
+		prog = binary.NativeEndian.AppendUint16(prog, code)
+		prog = append(prog, jt, jf)
+		prog = binary.NativeEndian.AppendUint32(prog, k)
+	}
+	ins(bpfLdWAbs, 0, 0, seccompDataArch)
+	ins(bpfJeqK, 1, 0, auditArch)
+	ins(bpfRetK, 0, 0, seccompRetAllow)
+	ins(bpfLdWAbs, 0, 0, seccompDataNr)
+	for i, nr := range sc.nrs {
+		ins(bpfJeqK, uint8(n-i+m), 0, uint32(nr))
+	}
+	for i, nr := range sc.notifyNrs {
+		ins(bpfJeqK, uint8(m-i+1), 0, uint32(nr))
+	}
+	ins(bpfRetK, 0, 0, seccompRetAllow)
+	ins(bpfRetK, 0, 0, seccompRetTrace)
+	if m > 0 {
+		ins(bpfRetK, 0, 0, seccompRetUserNotif)
+	}
+	return prog, nil
+}
+
+// Installs the seccomp filter at the initial stop, by writing it below
+// the stack pointer and making the tracee call prctl and seccomp.  Called
+// on the wait go routine.
+func (t *Tracee) installSeccomp() error {
+	if syscallInsn == nil {
+		return errNoSeccomp
+	}
+	prog, err := t.seccomp.program()
+	if err != nil {
+		return err
+	}
+	// Struct sock_fprog is the number of instructions followed by a
+	// pointer to them.
+	buf := make([]byte, 2*ptrSize, 2*ptrSize+uint64(len(prog)))
+	binary.NativeEndian.PutUint16(buf, uint16(len(prog)/8))
+	buf = append(buf, prog...)
+
+	// The program is written below the stack pointer, and the memory
+	// that it clobbers is restored once the filter is installed.
+	var addr uintptr
+	var orig []byte
+	err = t.doInternal(func(r Raw) error {
+		var regs syscall.PtraceRegs
+		if err := r.GetRegs(&regs); err != nil {
+			return err
+		}
+		// Stay well clear of any red zone below the stack pointer.
+		addr = (uintptr(stackPointer(&regs)) - 512 - uintptr(len(buf))) &^ 15
+		ptr := addr + uintptr(2*ptrSize)
+		if ptrSize == 8 {
+			binary.NativeEndian.PutUint64(buf[ptrSize:], uint64(ptr))
+		} else {
+			binary.NativeEndian.PutUint32(buf[ptrSize:], uint32(ptr))
+		}
+		orig = make([]byte, len(buf))
+		if _, err := r.PeekData(addr, orig); err != nil {
+			return err
+		}
+		_, err := r.PokeData(addr, buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	listener, err := t.setSeccompFilter(addr)
+	restore := t.doInternal(func(r Raw) error {
+		_, err := r.PokeData(addr, orig)
+		return err
+	})
+	if err == nil {
+		err = restore
+	}
+	if err != nil || listener < 0 {
+		return err
+	}
+	return t.listenSeccomp(listener)
+}
+
+// Makes the tracee call prctl and seccomp to install the filter program
+// whose struct sock_fprog is at addr.  Returns the descriptor of the
+// filter's notification listener, or -1 if there is none.  Called on
+// the wait go routine.
+func (t *Tracee) setSeccompFilter(addr uintptr) (int, error) {
+	prctl, _ := SyscallNumber("prctl")
+	ret, err := t.injectSyscallFromWait(prctl, prSetNoNewPrivs, 1, 0, 0, 0)
+	if err == nil {
+		err = syscallErrno(ret)
+	}
+	if err != nil {
+		return -1, err
+	}
+	seccomp, _ := SyscallNumber("seccomp")
+	var flags uint64
+	if len(t.seccomp.notifyNrs) > 0 {
+		flags = seccompFilterFlagNewListener
+	}
+	ret, err = t.injectSyscallFromWait(seccomp, seccompSetModeFilter, flags, uint64(addr))
+	if err == nil {
+		err = syscallErrno(ret)
+	}
+	if err != nil || flags == 0 {
+		return -1, err
+	}
+	return int(ret), nil
+}
+
+// Waits for the tracee to be seized, with WithSeize, for the seccomp
+// filter to be installed, if any, and for the tracee to reach its entry
+// point, with WithStopAtEntry, at the initial stop.
+func (t *Tracee) ready() error {
+	for _, done := range []chan error{t.seize, t.seccompDone(), t.entry} {
+		if done == nil {
+			continue
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-t.waitDone:
+			if done == t.entry && t.exited {
+				return &EntryExitError{Status: t.exitStatus}
+			}
+			return ErrTraceeExited
+		}
+	}
+	return nil
+}
+
+// Returns the channel of the result of installing the seccomp filter,
+// or nil if there is none.
+func (t *Tracee) seccompDone() chan error {
+	if t.seccomp == nil {
+		return nil
+	}
+	return t.seccomp.done
+}
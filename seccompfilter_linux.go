@@ -0,0 +1,161 @@
+package ptrace
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// PTRACE_SECCOMP_GET_FILTER from <linux/ptrace.h>.
+const ptraceSeccompGetFilter = 0x420c
+
+// A BPFInstruction is an instruction of a classic BPF program, struct
+// sock_filter, as used by seccomp filters.
+type BPFInstruction struct {
+	Code uint16 `json:"code"`
+	// Jt and Jf are the offsets of the next instruction, after this
+	// one, if a conditional jump is true or false.
+	Jt uint8  `json:"jt"`
+	Jf uint8  `json:"jf"`
+	K  uint32 `json:"k"`
+}
+
+// SeccompFilters returns the programs of the seccomp filters installed
+// in the stopped tracee, most recently installed first, which is the
+// order in which the kernel runs them.  A system call is allowed only if
+// every filter allows it.  Reading the filters requires CAP_SYS_ADMIN,
+// and the tracer must not itself be confined by seccomp.
+func (t *Tracee) SeccompFilters() ([][]BPFInstruction, error) {
+	var filters [][]BPFInstruction
+	err := t.Do(func(r Raw) error {
+		for i := 0; ; i++ {
+			n, err := seccompGetFilter(r.Pid(), i, nil)
+			// EINVAL means that the tracee has no filters.
+			if err == syscall.ENOENT || i == 0 && err == syscall.EINVAL {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			prog := make([]BPFInstruction, n)
+			if _, err := seccompGetFilter(r.Pid(), i, prog); err != nil {
+				return err
+			}
+			filters = append(filters, prog)
+		}
+	})
+	return filters, err
+}
+
+// Issues PTRACE_SECCOMP_GET_FILTER for the ith filter, and returns its
+// number of instructions.  If prog is empty, only the number is returned;
+// otherwise, prog must have room for the instructions.
+func seccompGetFilter(pid, i int, prog []BPFInstruction) (int, error) {
+	var data uintptr
+	if len(prog) > 0 {
+		data = uintptr(unsafe.Pointer(&prog[0]))
+	}
+	n, _, e := syscall.Syscall6(syscall.SYS_PTRACE, ptraceSeccompGetFilter, uintptr(pid), uintptr(i), data, 0, 0)
+	if e != 0 {
+		return 0, e
+	}
+	return int(n), nil
+}
+
+// String returns the instruction in the assembly syntax of the kernel's
+// bpf_asm, with conditional jumps written with their offsets, such as
+// "jeq #0x3c jt 1 jf 0".
+func (in BPFInstruction) String() string {
+	switch in.Code & 0x07 {
+	case 0x00: // BPF_LD
+		return "ld" + bpfSize(in.Code) + " " + bpfLoadOperand(in.Code, in.K)
+	case 0x01: // BPF_LDX
+		if in.Code&0xe0 == 0xa0 { // BPF_MSH
+			return fmt.Sprintf("ldxb 4*([%d]&0xf)", in.K)
+		}
+		return "ldx " + bpfLoadOperand(in.Code, in.K)
+	case 0x02: // BPF_ST
+		return fmt.Sprintf("st M[%d]", in.K)
+	case 0x03: // BPF_STX
+		return fmt.Sprintf("stx M[%d]", in.K)
+	case 0x04: // BPF_ALU
+		op := in.Code & 0xf0
+		if op == 0x80 { // BPF_NEG
+			return "neg"
+		}
+		name := bpfALUNames[op>>4]
+		if name == "" {
+			break
+		}
+		return name + " " + bpfSource(in.Code, in.K)
+	case 0x05: // BPF_JMP
+		op := in.Code & 0xf0
+		if op == 0x00 { // BPF_JA
+			return fmt.Sprintf("ja %d", in.K)
+		}
+		name := bpfJumpNames[op>>4]
+		if name == "" {
+			break
+		}
+		return fmt.Sprintf("%s %s jt %d jf %d", name, bpfSource(in.Code, in.K), in.Jt, in.Jf)
+	case 0x06: // BPF_RET
+		switch in.Code & 0x18 {
+		case 0x00:
+			return fmt.Sprintf("ret #%#x", in.K)
+		case 0x08:
+			return "ret x"
+		case 0x10:
+			return "ret a"
+		}
+	case 0x07: // BPF_MISC
+		switch in.Code & 0xf8 {
+		case 0x00:
+			return "tax"
+		case 0x80:
+			return "txa"
+		}
+	}
+	return fmt.Sprintf("unknown %#04x %d %d %#x", in.Code, in.Jt, in.Jf, in.K)
+}
+
+var (
+	bpfALUNames  = [...]string{"add", "sub", "mul", "div", "or", "and", "lsh", "rsh", "", "mod", "xor", "", "", "", "", ""}
+	bpfJumpNames = [...]string{"", "jeq", "jgt", "jge", "jset", "", "", "", "", "", "", "", "", "", "", ""}
+)
+
+// Returns the suffix of a load of a word, half word, or byte.
+func bpfSize(code uint16) string {
+	switch code & 0x18 {
+	case 0x08:
+		return "h"
+	case 0x10:
+		return "b"
+	}
+	return ""
+}
+
+// Returns the operand of a load instruction by its addressing mode.
+func bpfLoadOperand(code uint16, k uint32) string {
+	switch code & 0xe0 {
+	case 0x00: // BPF_IMM
+		return fmt.Sprintf("#%#x", k)
+	case 0x20: // BPF_ABS
+		return fmt.Sprintf("[%d]", k)
+	case 0x40: // BPF_IND
+		return fmt.Sprintf("[x + %d]", k)
+	case 0x60: // BPF_MEM
+		return fmt.Sprintf("M[%d]", k)
+	case 0x80: // BPF_LEN
+		return "#len"
+	}
+	return fmt.Sprintf("?%#x", k)
+}
+
+// Returns the source operand of an ALU or jump instruction: the constant
+// k, or the index register.
+func bpfSource(code uint16, k uint32) string {
+	if code&0x08 != 0 { // BPF_X
+		return "x"
+	}
+	return fmt.Sprintf("#%#x", k)
+}
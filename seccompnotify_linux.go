@@ -0,0 +1,252 @@
+package ptrace
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// WithSeccompNotify installs a seccomp filter in the tracee, as
+// WithSeccomp, that blocks it in the kernel on entry to the named system
+// calls and notifies the tracer, rather than stopping it.  Each
+// notification is sent as a SyscallEnterEvent whose Notification is
+// non-nil, and the tracee's calling thread stays blocked until the
+// tracer responds to it, by continuing the system call or by returning
+// a result in its place.  The tracee is never stopped, so there is
+// no ptrace overhead, and it must be resumed with Continue; registers
+// cannot be read or written, and SyscallStop cannot be used, but the
+// memory of the calling process can be read with the notification's
+// ReadMemory.
+//
+// Notifications are sent on the events channel by a separate go
+// routine; they are not passed to observers, such as a Recorder.  The
+// filter is inherited by children, whose system calls are also
+// notified, with their own process IDs.  Once the tracee is closed,
+// its notifications are continued, until it exits.
+//
+// WithSeccompNotify may be combined with WithSeccomp; a system call
+// named by both stops the tracee.  It requires Linux 5.6.
+func WithSeccompNotify(syscalls ...string) Option {
+	return func(t *Tracee) {
+		sc := t.seccompFilter()
+		sc.notifyNrs = append(sc.notifyNrs, syscallNumbers(syscalls)...)
+	}
+}
+
+// A SeccompNotification is a system call of a tracee created
+// WithSeccompNotify that is blocked awaiting the tracer's response.
+// Exactly one of its methods Continue, Return, and Fail must be called
+// to unblock the tracee.
+type SeccompNotification struct {
+	// ID identifies the notification to the kernel.
+	ID uint64 `json:"id"`
+	// Pid is the thread ID of the thread that made the system call,
+	// which may be a child of the tracee.
+	Pid int `json:"pid"`
+	t   *Tracee
+	f   *os.File
+}
+
+// Continue lets the kernel execute the system call, as if the filter had
+// allowed it.  Since the tracee is not stopped, its arguments may have
+// changed since they were sent, so Continue must not be used to enforce
+// a policy on pointer arguments.
+func (n *SeccompNotification) Continue() error {
+	return n.respond(0, 0, seccompUserNotifFlagContinue)
+}
+
+// Return makes the system call return v without it being executed.
+func (n *SeccompNotification) Return(v int64) error {
+	return n.respond(v, 0, 0)
+}
+
+// Fail makes the system call fail with the error without it being
+// executed.
+func (n *SeccompNotification) Fail(errno syscall.Errno) error {
+	return n.respond(0, errno, 0)
+}
+
+// Valid returns whether the system call is still blocked awaiting a
+// response.  It is not if the thread that made it was killed.  Reading
+// the tracee's memory, and then checking Valid, ensures that the memory
+// read was that of the thread making the call.
+func (n *SeccompNotification) Valid() bool {
+	id := n.ID
+	return n.ioctl(seccompIoctlNotifIDValid, unsafe.Pointer(&id)) == nil
+}
+
+// ReadMemory reads the memory of the process that made the system call
+// at addr into b, for example to read a path argument, with
+// process_vm_readv.  A read that faults fails with a *PartialReadError.
+func (n *SeccompNotification) ReadMemory(addr uint64, b []byte) error {
+	return n.t.opError("readmemory", vmRead(n.Pid, addr, b))
+}
+
+func (n *SeccompNotification) respond(val int64, errno syscall.Errno, flags uint32) error {
+	resp := seccompNotifResp{id: n.ID, val: val, error: -int32(errno), flags: flags}
+	return n.t.opError("seccomp_notify", n.ioctl(seccompIoctlNotifSend, unsafe.Pointer(&resp)))
+}
+
+func (n *SeccompNotification) ioctl(req uintptr, arg unsafe.Pointer) error {
+	return seccompIoctl(n.f, req, arg)
+}
+
+// Constants from <linux/seccomp.h>.  The ioctl requests have the generic
+// encoding, which is that of every architecture that supports seccomp.
+const (
+	seccompFilterFlagNewListener = 1 << 3
+	seccompUserNotifFlagContinue = 1 << 0
+
+	seccompIoctlNotifRecv    = 0xc0502100
+	seccompIoctlNotifSend    = 0xc0182101
+	seccompIoctlNotifIDValid = 0x40082102
+)
+
+// Struct seccomp_notif, which includes struct seccomp_data.
+type seccompNotif struct {
+	id    uint64
+	pid   uint32
+	flags uint32
+	nr    int32
+	arch  uint32
+	ip    uint64
+	args  [6]uint64
+}
+
+// Struct seccomp_notif_resp.
+type seccompNotifResp struct {
+	id    uint64
+	val   int64
+	error int32
+	flags uint32
+}
+
+func seccompIoctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		for {
+			_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+			if errno != syscall.EINTR {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Takes the seccomp listener, the descriptor fd in the tracee, into the
+// tracer with pidfd_getfd, closes it in the tracee, and starts receiving
+// notifications from it.  Called on the wait go routine at the initial
+// stop.
+func (t *Tracee) listenSeccomp(fd int) error {
+	pidfd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(t.proc.Pid), 0, 0)
+	if errno != 0 {
+		return os.NewSyscallError("pidfd_open", errno)
+	}
+	lfd, _, errno := syscall.Syscall(sysPidfdGetfd, pidfd, uintptr(fd), 0)
+	syscall.Close(int(pidfd))
+	if errno != 0 {
+		return os.NewSyscallError("pidfd_getfd", errno)
+	}
+	closeNr, _ := SyscallNumber("close")
+	if _, err := t.injectSyscallFromWait(closeNr, uint64(fd)); err != nil {
+		syscall.Close(int(lfd))
+		return err
+	}
+	syscall.CloseOnExec(int(lfd))
+	// The descriptor must be non-blocking to be polled by the runtime.
+	if err := syscall.SetNonblock(int(lfd), true); err != nil {
+		syscall.Close(int(lfd))
+		return err
+	}
+	go t.receiveSeccomp(os.NewFile(lfd, "seccomp"))
+	return nil
+}
+
+// Sends the notifications of the listener f until no process uses the
+// filter, or f cannot be read.
+func (t *Tracee) receiveSeccomp(f *os.File) {
+	defer f.Close()
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return
+	}
+	for {
+		// SECCOMP_IOCTL_NOTIF_RECV blocks regardless of O_NONBLOCK, so
+		// the listener is polled before it is read.
+		var hup bool
+		err := rc.Read(func(fd uintptr) bool {
+			fds := []pollFd{{fd: int32(fd), events: pollIn}}
+			var ts syscall.Timespec
+			_, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), 1, uintptr(unsafe.Pointer(&ts)), 0, 0, 0)
+			if errno == syscall.EINTR {
+				return false
+			}
+			hup = errno != 0 || fds[0].revents&pollHup != 0
+			return hup || fds[0].revents&pollIn != 0
+		})
+		if err != nil || hup {
+			return
+		}
+		var n seccompNotif
+		if err := seccompIoctl(f, seccompIoctlNotifRecv, unsafe.Pointer(&n)); err != nil {
+			if err == syscall.ENOENT {
+				// The thread was killed before the notification
+				// was received.
+				continue
+			}
+			return
+		}
+		note := &SeccompNotification{ID: n.id, Pid: int(n.pid), t: t, f: f}
+		ev := SyscallEnterEvent{Time: time.Now(), Nr: int(n.nr), Args: n.args, Notification: note}
+		if !t.sendNotification(ev) {
+			note.Continue()
+		}
+	}
+}
+
+// Struct pollfd and its events, from <poll.h>.
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+const (
+	pollIn  = 0x1
+	pollHup = 0x10
+)
+
+// Sends a notification on the events channel, blocking until it is
+// received, and returns whether it was sent.  It is not sent if the
+// tracee is closed or killed.  Unlike send, it may be called from any go
+// routine.
+func (t *Tracee) sendNotification(ev Event) bool {
+	t.eventsMu.Lock()
+	defer t.eventsMu.Unlock()
+	if t.eventsClosed {
+		return false
+	}
+	if t.queue != nil {
+		t.queue.push(ev)
+		return true
+	}
+	select {
+	case t.events <- ev:
+		return true
+	case <-t.closing:
+	case <-t.killing:
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package ptrace
+
+import "syscall"
+
+// PTRACE_O_SUSPEND_SECCOMP from <linux/ptrace.h>.
+const ptraceOSuspendSeccomp = 0x200000
+
+// SuspendSeccomp suspends, or with false resumes, the seccomp protections
+// of the stopped tracee, using PTRACE_O_SUSPEND_SECCOMP.  While they are
+// suspended, the tracee's system calls are not checked against its
+// seccomp filters, including the filter of WithSeccomp, so that the
+// tracer can inject system calls, or make inferior calls, that the
+// tracee's own filters would otherwise deny or kill it for.  Suspending
+// requires CAP_SYS_ADMIN, and the tracer must not itself be confined by
+// seccomp.  The setting applies to children traced WithFollowForks,
+// from when they are created.
+func (t *Tracee) SuspendSeccomp(suspend bool) error {
+	return t.run("suspendseccomp", func() error {
+		if err := t.requireStopped(); err != nil {
+			return err
+		}
+		opts := t.options &^ ptraceOSuspendSeccomp
+		if suspend {
+			opts |= ptraceOSuspendSeccomp
+		}
+		if err := syscall.PtraceSetOptions(t.proc.Pid, opts); err != nil {
+			return err
+		}
+		t.options = opts
+		return nil
+	})
+}
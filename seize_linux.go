@@ -0,0 +1,153 @@
+package ptrace
+
+import (
+	"errors"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	errNotSeized       = errors.New("ptrace: tracee is not attached with PTRACE_SEIZE")
+	errNotGroupStopped = errors.New("ptrace: tracee is not in a group-stop")
+	errSeizeTimeout    = errors.New("ptrace: tracee did not stop to be seized")
+)
+
+// PTRACE_LISTEN, which the syscall package does not define.
+const ptraceListen = 0x4208
+
+// How long to wait for the tracee to stop before it is seized.
+const seizeTimeout = time.Second
+
+// A GroupStopEvent is sent when the tracee stops along with the rest of
+// its thread group, because a stopping signal was delivered to the
+// group, as when a job is stopped from the shell.  The tracee's State
+// is GroupStopped.  Continuing it resumes it regardless of job control;
+// a tracee attached with WithSeize can Listen instead.
+type GroupStopEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Signal is the stopping signal: SIGSTOP, SIGTSTP, SIGTTIN, or
+	// SIGTTOU.
+	Signal syscall.Signal `json:"signal"`
+}
+
+// WithSeize attaches the tracee with PTRACE_SEIZE, instead of as a child
+// that requested tracing.  A seized tracee reports its group-stops as
+// distinct from the delivery of the stopping signal, and can Listen at
+// them.  The tracee is seized at its initial stop: it is detached into
+// a group-stop, so that it does not run untraced, seized, and then
+// continued with SIGCONT, which is suppressed, leaving it at the same
+// point.
+func WithSeize() Option {
+	return func(t *Tracee) { t.seize = make(chan error, 1) }
+}
+
+// Listen restarts the tracee from a group-stop without resuming it: it
+// remains stopped, as job control requires, but its next event is
+// reported, such as its being continued by SIGCONT.  The tracee's State
+// is Listening until then, and commands that require a stopped tracee
+// fail.  The tracee must be attached with WithSeize.
+func (t *Tracee) Listen() error {
+	return t.run("listen", func() error {
+		if !t.seized {
+			return errNotSeized
+		}
+		if s := t.State(); s != GroupStopped {
+			if s == Exited {
+				return ErrTraceeExited
+			}
+			return errNotGroupStopped
+		}
+		return t.resume(Listening, func() error { return ptrace(ptraceListen, t.proc.Pid, 0, 0) })
+	})
+}
+
+// Re-attaches the tracee at its initial stop with PTRACE_SEIZE and the
+// given options.  Must be called on the tracer thread, while the wait go
+// routine is handling the initial stop.
+func (t *Tracee) seizeTracee(opts int) error {
+	pid := t.proc.Pid
+	if err := syscall.Kill(pid, syscall.SIGSTOP); err != nil {
+		return err
+	}
+	if err := ptraceDetach(pid); err != nil {
+		return err
+	}
+	dir := "/proc/" + strconv.Itoa(pid)
+	deadline := time.Now().Add(seizeTimeout)
+	for procStat(dir).state != "T" {
+		if time.Now().After(deadline) {
+			return errSeizeTimeout
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := ptrace(ptraceSeize, pid, 0, uintptr(opts)); err != nil {
+		return permissionError(err, false)
+	}
+	t.options, t.seized = opts, true
+	// The seized tracee reports its group-stop, which SIGCONT ends.
+	// The SIGCONT is then delivered before the tracee runs, and is
+	// suppressed.
+	ws, err := waitStop(pid)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Kill(pid, syscall.SIGCONT); err != nil {
+		return err
+	}
+	for ws.StopSignal() != syscall.SIGCONT || int(ws)>>16 != 0 {
+		if err := ptraceCont(pid, 0); err != nil {
+			return err
+		}
+		if ws, err = waitStop(pid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waits for the next stop of the tracee on the tracer thread.  Must only
+// be called while the wait go routine is blocked handling a stop.
+func waitStop(pid int) (syscall.WaitStatus, error) {
+	ws, err := waitPid(pid)
+	if err != nil {
+		return ws, err
+	}
+	if !ws.Stopped() {
+		return ws, ErrTraceeExited
+	}
+	return ws, nil
+}
+
+// Returns whether the stop is a group-stop, updating the tracee's state
+// if it is.  A group-stop of a seized tracee is a PTRACE_EVENT_STOP with
+// the stopping signal.  Otherwise, it looks like the delivery of the
+// stopping signal, but has no siginfo.  Called on the wait go routine.
+func (t *Tracee) groupStop(ws syscall.WaitStatus) bool {
+	switch ws.StopSignal() {
+	case syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU:
+	default:
+		return false
+	}
+	if int(ws)>>16 == ptraceEventStop {
+		return true
+	}
+	if int(ws)>>16 != 0 {
+		return false
+	}
+	var err error
+	t.runInternal("getsiginfo", func() error {
+		if t.seized {
+			// Signal-delivery stops of a seized tracee are never
+			// group-stops.
+			return nil
+		}
+		_, err = getSiginfo(t.proc.Pid)
+		return nil
+	})
+	if err != syscall.EINVAL {
+		return false
+	}
+	t.state.Store(int32(GroupStopped))
+	return true
+}
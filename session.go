@@ -0,0 +1,97 @@
+package ptrace
+
+import (
+	"sync"
+	"time"
+)
+
+// A Session merges the events of several tracees, for example the
+// threads or children of a traced program, into a single stream.
+//
+// The merged stream is ordered as follows.  Every event is assigned a
+// sequence number, and a time, when it is observed by its tracee's wait
+// go routine, before it is sent on the tracee's own events channel.
+// Sequence numbers start at 1 and increase by 1 with each event
+// observed by any tracee of the session, and events are delivered in
+// sequence order.  Consequently, the events of each tracee are
+// delivered in the order that they were observed, and events of
+// different tracees are delivered in the order that they were observed
+// by the tracer, which need not be the order in which the kernel
+// generated them.  If the consumer falls behind and the session's
+// buffer is full, events are dropped rather than blocking the tracees;
+// a dropped event leaves a gap in the sequence numbers.
+//
+// Events that are not observed by the wait go routine, such as
+// MemoryPressureEvents, are not part of the session.
+type Session struct {
+	mu     sync.Mutex
+	seq    uint64
+	events chan SessionEvent
+	closed bool
+	// Tracees are the tracees of the session that have had an event,
+	// whose statistics are retrieved from it, such as by IOStats.
+	tracees map[*Tracee]bool
+}
+
+// A SessionEvent is an event of one of the tracees in a Session.
+type SessionEvent struct {
+	// Seq is the event's sequence number in the session.
+	Seq uint64
+	// Time is when the event was observed.
+	Time time.Time
+	// Pid is the process ID of the tracee.
+	Pid int
+	Event
+}
+
+// NewSession returns a new Session that buffers up to n undelivered
+// events.
+func NewSession(n int) *Session {
+	return &Session{events: make(chan SessionEvent, n)}
+}
+
+// WithSession adds the tracee to the session.
+func WithSession(s *Session) Option {
+	return func(t *Tracee) {
+		t.observers = append(t.observers, func(ev Event) {
+			s.observe(t, ev)
+		})
+	}
+}
+
+// Events returns the session's merged events channel.  It is closed by
+// Close.
+func (s *Session) Events() <-chan SessionEvent {
+	return s.events
+}
+
+// Close closes the session's events channel.  Events observed after
+// Close are discarded.
+func (s *Session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+// Called on the tracee's wait go routine.  Numbering and sending under
+// the lock makes the delivery order match the sequence order.
+func (s *Session) observe(t *Tracee, ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tracees == nil {
+		s.tracees = make(map[*Tracee]bool)
+	}
+	s.tracees[t] = true
+	if s.closed {
+		return
+	}
+	s.seq++
+	sev := SessionEvent{Seq: s.seq, Time: time.Now(), Pid: t.proc.Pid, Event: ev}
+	select {
+	case s.events <- sev:
+	default:
+	}
+}
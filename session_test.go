@@ -0,0 +1,109 @@
+//go:build linux || darwin
+
+package ptrace
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+// Returns a tracee with only a process ID, to observe events for.
+func fakeTracee(pid int) *Tracee {
+	return &Tracee{proc: &os.Process{Pid: pid}}
+}
+
+func TestSessionPerTraceeOrder(t *testing.T) {
+	const tracees, events = 8, 1000
+	s := NewSession(tracees * events)
+	var wg sync.WaitGroup
+	for pid := 1; pid <= tracees; pid++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr := fakeTracee(pid)
+			for i := 0; i < events; i++ {
+				s.observe(tr, i)
+			}
+		}()
+	}
+	wg.Wait()
+	s.Close()
+
+	next := make(map[int]int)
+	var seq uint64
+	var prev SessionEvent
+	for ev := range s.Events() {
+		seq++
+		if ev.Seq != seq {
+			t.Fatalf("got sequence number %d, want %d", ev.Seq, seq)
+		}
+		if ev.Time.Before(prev.Time) {
+			t.Errorf("event %d observed at %v, before event %d at %v", ev.Seq, ev.Time, prev.Seq, prev.Time)
+		}
+		if i := ev.Event.(int); i != next[ev.Pid] {
+			t.Fatalf("tracee %d: got event %d, want %d", ev.Pid, i, next[ev.Pid])
+		}
+		next[ev.Pid]++
+		prev = ev
+	}
+	if seq != tracees*events {
+		t.Errorf("got %d events, want %d", seq, tracees*events)
+	}
+}
+
+func TestSessionOverflowGaps(t *testing.T) {
+	tests := []struct {
+		name string
+		// Buffer is the session's buffer size, and batches are the
+		// numbers of events observed before each drain of the
+		// buffer.
+		buffer  int
+		batches []int
+		want    []uint64
+	}{
+		{name: "no overflow", buffer: 4, batches: []int{3, 2}, want: []uint64{1, 2, 3, 4, 5}},
+		{name: "overflow", buffer: 2, batches: []int{5, 1}, want: []uint64{1, 2, 6}},
+		{name: "repeated overflow", buffer: 1, batches: []int{3, 3, 1}, want: []uint64{1, 4, 7}},
+		{name: "full buffer", buffer: 3, batches: []int{3, 3}, want: []uint64{1, 2, 3, 4, 5, 6}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSession(test.buffer)
+			tr := fakeTracee(1)
+			var got []uint64
+			for _, n := range test.batches {
+				for i := 0; i < n; i++ {
+					s.observe(tr, i)
+				}
+				for len(s.Events()) > 0 {
+					got = append(got, (<-s.Events()).Seq)
+				}
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got sequence numbers %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got sequence numbers %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	s := NewSession(4)
+	tr := fakeTracee(1)
+	s.observe(tr, 0)
+	s.Close()
+	s.observe(tr, 1)
+	s.Close()
+	var n int
+	for range s.Events() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d events, want 1", n)
+	}
+}
@@ -0,0 +1,106 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+)
+
+// PTRACE_PEEKSIGINFO, which the syscall package does not define, and
+// its flag to read the process's queue rather than the thread's.
+const (
+	ptracePeekSiginfo       = 0x4209
+	ptracePeekSiginfoShared = 1
+)
+
+// The size of a siginfo_t, and the number read per PTRACE_PEEKSIGINFO.
+const (
+	siginfoSize  = 128
+	siginfoBatch = 32
+)
+
+// A Siginfo describes a signal, as recorded in its siginfo_t.
+type Siginfo struct {
+	Signo syscall.Signal
+	Errno int32
+	// Code is the si_code, which tells how the signal was sent; for
+	// example, SI_USER (0) for kill, SI_QUEUE (-1) for sigqueue, and
+	// SI_TKILL (-6) for tgkill.
+	Code int32
+	// Pid and Uid are the process ID and user ID of the sender of a
+	// signal sent by kill, sigqueue, or tgkill.
+	Pid int32
+	Uid uint32
+	// Addr is the faulting address of SIGSEGV, SIGBUS, SIGILL, and
+	// SIGFPE.
+	Addr uint64
+	// Raw is the siginfo_t, in the tracee's byte order.
+	Raw [siginfoSize]byte
+}
+
+// PendingSignals returns the signals queued for the stopped tracee, in
+// the order they will be delivered, without dequeuing them.  If shared
+// is true, the signals queued for the whole process are returned;
+// otherwise, those queued for the traced thread.
+func (t *Tracee) PendingSignals(shared bool) ([]Siginfo, error) {
+	var sigs []Siginfo
+	err := t.Do(func(r Raw) error {
+		// The argument is struct ptrace_peeksiginfo_args.
+		var args struct {
+			off   uint64
+			flags uint32
+			nr    int32
+		}
+		if shared {
+			args.flags = ptracePeekSiginfoShared
+		}
+		args.nr = siginfoBatch
+		buf := make([]byte, siginfoBatch*siginfoSize)
+		for {
+			n, _, e := syscall.Syscall6(syscall.SYS_PTRACE, ptracePeekSiginfo, uintptr(r.Pid()),
+				uintptr(unsafe.Pointer(&args)), uintptr(unsafe.Pointer(&buf[0])), 0, 0)
+			if e != 0 {
+				return e
+			}
+			for i := 0; i < int(n); i++ {
+				sigs = append(sigs, decodeSiginfo(buf[i*siginfoSize:(i+1)*siginfoSize]))
+			}
+			if int(n) < siginfoBatch {
+				return nil
+			}
+			args.off += uint64(n)
+		}
+	})
+	return sigs, err
+}
+
+// Decodes a siginfo_t.
+func decodeSiginfo(b []byte) Siginfo {
+	var si Siginfo
+	copy(si.Raw[:], b)
+	ne := binary.NativeEndian
+	si.Signo = syscall.Signal(ne.Uint32(b[0:]))
+	si.Errno = int32(ne.Uint32(b[4:]))
+	si.Code = int32(ne.Uint32(b[8:]))
+	// The union of the fields that depend on the signal follows,
+	// aligned to a pointer.
+	u := (12 + ptrSize - 1) &^ (ptrSize - 1)
+	switch si.Signo {
+	case syscall.SIGSEGV, syscall.SIGBUS, syscall.SIGILL, syscall.SIGFPE:
+		if si.Code > 0 {
+			if ptrSize == 4 {
+				si.Addr = uint64(ne.Uint32(b[u:]))
+			} else {
+				si.Addr = ne.Uint64(b[u:])
+			}
+			return si
+		}
+	}
+	// Signals sent by a process have si_code <= 0, except SIGCHLD,
+	// which has the child's ID in the same place.
+	if si.Code <= 0 || si.Signo == syscall.SIGCHLD {
+		si.Pid = int32(ne.Uint32(b[u:]))
+		si.Uid = ne.Uint32(b[u+4:])
+	}
+	return si
+}
@@ -0,0 +1,62 @@
+package ptrace
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// PTRACE_GETSIGMASK and PTRACE_SETSIGMASK, which the syscall package
+// does not define.
+const (
+	ptraceGetSigMask = 0x420a
+	ptraceSetSigMask = 0x420b
+)
+
+// A SigSet is a set of signals, as the kernel's sigset_t: signal n is
+// bit n-1.
+type SigSet uint64
+
+// Has returns whether the signal is in the set.
+func (s SigSet) Has(sig syscall.Signal) bool {
+	return sig > 0 && sig <= 64 && s&(1<<(sig-1)) != 0
+}
+
+// Add adds the signal to the set.
+func (s *SigSet) Add(sig syscall.Signal) {
+	if sig > 0 && sig <= 64 {
+		*s |= 1 << (sig - 1)
+	}
+}
+
+// Remove removes the signal from the set.
+func (s *SigSet) Remove(sig syscall.Signal) {
+	if sig > 0 && sig <= 64 {
+		*s &^= 1 << (sig - 1)
+	}
+}
+
+// GetSigMask returns the set of signals blocked by the stopped tracee.
+func (t *Tracee) GetSigMask() (SigSet, error) {
+	var s SigSet
+	err := t.Do(func(r Raw) error { return sigMask(r.Pid(), ptraceGetSigMask, &s) })
+	return s, err
+}
+
+// SetSigMask sets the set of signals blocked by the stopped tracee.
+// SIGKILL and SIGSTOP cannot be blocked, and are removed from the set
+// by the kernel.  A debugger can unblock signals temporarily, for
+// example for the duration of an inferior call, by restoring the mask
+// returned by GetSigMask afterward.
+func (t *Tracee) SetSigMask(s SigSet) error {
+	return t.Do(func(r Raw) error { return sigMask(r.Pid(), ptraceSetSigMask, &s) })
+}
+
+// Issues PTRACE_GETSIGMASK or PTRACE_SETSIGMASK with the set.
+func sigMask(pid, req int, s *SigSet) error {
+	_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(req), uintptr(pid),
+		unsafe.Sizeof(*s), uintptr(unsafe.Pointer(s)), 0, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
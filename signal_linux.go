@@ -0,0 +1,86 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// A SignalAction determines what happens when a signal is delivered to
+// the tracee.
+type SignalAction int
+
+const (
+	// SignalStop sends the signal-delivery stop as an event, as for
+	// signals without a policy.  The signal is discarded when the
+	// tracee is resumed.
+	SignalStop SignalAction = iota
+	// SignalPass delivers the signal to the tracee and resumes it,
+	// without sending an event.
+	SignalPass
+	// SignalIgnore discards the signal and resumes the tracee, without
+	// sending an event.
+	SignalIgnore
+)
+
+var signalActionNames = [...]string{
+	SignalStop:   "stop",
+	SignalPass:   "pass",
+	SignalIgnore: "ignore",
+}
+
+func (a SignalAction) String() string {
+	if a < 0 || int(a) >= len(signalActionNames) {
+		return "unknown"
+	}
+	return signalActionNames[a]
+}
+
+// A SignalPolicy maps signals to the actions taken when they are
+// delivered to the tracee.  Signals that are not in the map stop the
+// tracee.
+type SignalPolicy map[syscall.Signal]SignalAction
+
+// WithSignalPolicy handles the signal-delivery stops of the tracee
+// according to the policy.  A passed or ignored signal resumes the
+// tracee as it was last resumed by Continue, SingleStep, or Syscall;
+// before the tracee is first resumed, and while a command such as Stop
+// is waiting for the tracee to stop, every signal stops it.  SIGTRAP,
+// which is also caused by breakpoints and steps, always stops the
+// tracee, as do group-stops.
+func WithSignalPolicy(p SignalPolicy) Option {
+	policy := make(SignalPolicy, len(p))
+	for sig, a := range p {
+		policy[sig] = a
+	}
+	return func(t *Tracee) { t.signals = policy }
+}
+
+// Handles a signal-delivery stop according to the signal policy.
+// Returns whether the tracee was resumed.  Called on the wait go
+// routine.
+func (t *Tracee) applySignalPolicy(ws syscall.WaitStatus) bool {
+	sig := ws.StopSignal()
+	if waitState(ws) != Stopped || int(ws)>>16 != 0 || sig == syscall.SIGTRAP {
+		return false
+	}
+	a := t.signals[sig]
+	if a == SignalStop || t.intercept.Load() != nil {
+		return false
+	}
+	if a == SignalIgnore {
+		sig = 0
+	}
+	resumed := false
+	t.runInternal("signalpolicy", func() error {
+		if t.signalResume == nil {
+			return nil
+		}
+		// The signal is delivered only once, so the tracee is still
+		// resumed by lastResume after a later stop.
+		last := t.lastResume
+		err := t.resume(Running, func() error { return t.signalResume(sig) })
+		t.lastResume = last
+		resumed = err == nil
+		return err
+	})
+	return resumed
+}
@@ -0,0 +1,265 @@
+package ptrace
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	errSnapshotEvicted = errors.New("ptrace: snapshot was evicted")
+	errBadRegion       = errors.New("ptrace: snapshot region size out of range")
+)
+
+// The largest region that SnapshotMemory copies.  Larger writable
+// mappings, such as address space reserved by sanitizers, are skipped
+// when all mappings are copied.
+const maxSnapshotRegion = 1 << 30
+
+// A Region is a range of the tracee's address space.
+type Region struct {
+	Addr uint64
+	Size uint64
+}
+
+// End returns the exclusive end address of the region.
+func (r Region) End() uint64 { return r.Addr + r.Size }
+
+// Region returns the address range of the mapping.
+func (m Mapping) Region() Region {
+	return Region{Addr: m.Start, Size: m.End - m.Start}
+}
+
+// A Snapshot is a copy of regions of the tracee's memory taken at a
+// stop.
+type Snapshot struct {
+	// Time is when the snapshot was taken.
+	Time time.Time
+	mem  *memAccount
+	// Mu guards the fields below, which are cleared when the snapshot
+	// is evicted.
+	mu      sync.Mutex
+	regions []snapRegion
+	evicted bool
+	charge  *memCharge
+}
+
+type snapRegion struct {
+	Region
+	data []byte
+}
+
+// SnapshotMemory copies the given regions of the stopped tracee's
+// memory, or, if none are given, all of its writable mappings.  The
+// copy is charged to the tracee as SnapshotMemory, and it may be
+// evicted, oldest first, under a memory limit; Release releases it
+// early.  Each given region must be at most 1GiB, and must not wrap
+// around the end of the address space.
+func (t *Tracee) SnapshotMemory(regions ...Region) (*Snapshot, error) {
+	all := len(regions) == 0
+	if all {
+		ms, err := t.Mappings()
+		if err != nil {
+			return nil, t.opError("snapshot", err)
+		}
+		for _, m := range ms {
+			if m.Perms&PermWrite != 0 && m.Perms&PermRead != 0 && m.End-m.Start <= maxSnapshotRegion {
+				regions = append(regions, m.Region())
+			}
+		}
+	}
+	// The sizes are checked here, since a failed allocation on the
+	// tracer thread would break the tracer.
+	for _, reg := range regions {
+		if reg.Size > maxSnapshotRegion || reg.End() < reg.Addr {
+			return nil, errBadRegion
+		}
+	}
+	s := &Snapshot{Time: time.Now(), mem: &t.mem}
+	err := t.Do(func(r Raw) error {
+		for _, reg := range regions {
+			data := make([]byte, reg.Size)
+			if err := readMemory(r, reg.Addr, data); err != nil {
+				if !all {
+					return err
+				}
+				// Writable mappings, such as guard pages
+				// and device memory, may not be readable,
+				// in whole or in part.
+				var perr *PartialReadError
+				if !errors.As(err, &perr) || perr.N == 0 {
+					continue
+				}
+				reg.Size, data = uint64(perr.N), data[:perr.N]
+			}
+			s.regions = append(s.regions, snapRegion{Region: reg, data: data})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, reg := range s.regions {
+		size += int64(reg.Size)
+	}
+	s.charge = t.mem.charge(SnapshotMemory, size, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.regions, s.evicted = nil, true
+	})
+	return s, nil
+}
+
+// Regions returns the regions copied by the snapshot, or nil if it was
+// evicted or released.
+func (s *Snapshot) Regions() []Region {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rs []Region
+	for _, reg := range s.regions {
+		rs = append(rs, reg.Region)
+	}
+	return rs
+}
+
+// Bytes returns the snapshot's copy of the region, or nil if the region
+// is not within a single copied region.  The returned slice must not be
+// modified.
+func (s *Snapshot) Bytes(r Region) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, reg := range s.regions {
+		if reg.Addr <= r.Addr && r.End() <= reg.End() {
+			off := r.Addr - reg.Addr
+			return reg.data[off : off+r.Size]
+		}
+	}
+	return nil
+}
+
+// Diff returns the ranges of bytes that differ between the snapshot and
+// other, in address order.  Only memory copied by both snapshots is
+// compared.  An error is returned if either snapshot was evicted or
+// released.
+func (s *Snapshot) Diff(other *Snapshot) ([]Region, error) {
+	a, err := s.lockedRegions()
+	if err != nil {
+		return nil, err
+	}
+	b, err := other.lockedRegions()
+	if err != nil {
+		return nil, err
+	}
+	var diffs []Region
+	for _, x := range a {
+		for _, y := range b {
+			lo, hi := max(x.Addr, y.Addr), min(x.End(), y.End())
+			if lo >= hi {
+				continue
+			}
+			xd, yd := x.data[lo-x.Addr:hi-x.Addr], y.data[lo-y.Addr:hi-y.Addr]
+			for _, c := range diffBytes(xd, yd) {
+				diffs = append(diffs, Region{Addr: lo + uint64(c.Offset), Size: uint64(len(c.New))})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// Returns the snapshot's regions, which are not modified once taken, or
+// an error if it was evicted.
+func (s *Snapshot) lockedRegions() ([]snapRegion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.evicted {
+		return nil, errSnapshotEvicted
+	}
+	return s.regions, nil
+}
+
+// Release releases the memory of the snapshot.  The snapshot can no
+// longer be used.
+func (s *Snapshot) Release() {
+	s.mu.Lock()
+	s.regions, s.evicted = nil, true
+	c := s.charge
+	s.mu.Unlock()
+	s.mem.release(c)
+}
+
+// Reads tracee memory at addr into b, with process_vm_readv if it is
+// available, and otherwise a word at a time with PeekData.  Must be
+// called on the tracer thread.
+func readMemory(r Raw, addr uint64, b []byte) error {
+	err := vmRead(r.Pid(), addr, b)
+	var perr *PartialReadError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &perr):
+		return r.t.opError("readmemory", err)
+	}
+	_, err = r.PeekData(uintptr(addr), b)
+	return err
+}
+
+// Writes b to tracee memory at addr, with process_vm_writev if it is
+// available, and otherwise a word at a time with PokeData.  Unlike
+// PokeData, process_vm_writev cannot write to read-only mappings.  Must
+// be called on the tracer thread.
+func writeMemory(r Raw, addr uint64, b []byte) error {
+	_, err := vmWrite(r.Pid(), addr, b)
+	switch err {
+	case nil:
+		return nil
+	case syscall.EFAULT:
+		return r.t.opError("writememory", err)
+	}
+	_, err = r.PokeData(uintptr(addr), b)
+	return err
+}
+
+// Reads the memory of process pid at addr into b with process_vm_readv.
+// A read that faults returns a *PartialReadError.
+func vmRead(pid int, addr uint64, b []byte) error {
+	n, err := processVM(sysProcessVMReadv, pid, addr, b)
+	if err == syscall.EFAULT {
+		return &PartialReadError{Addr: addr + uint64(n), N: n, Err: err}
+	}
+	return err
+}
+
+// Writes b to the memory of process pid at addr with process_vm_writev,
+// and returns the number of bytes written.  A partial write returns
+// EFAULT.
+func vmWrite(pid int, addr uint64, b []byte) (int, error) {
+	return processVM(sysProcessVMWritev, pid, addr, b)
+}
+
+// Transfers b with process_vm_readv or process_vm_writev, and returns the
+// number of bytes transferred.
+func processVM(trap uintptr, pid int, addr uint64, b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	local := syscall.Iovec{Base: &b[0]}
+	local.SetLen(len(b))
+	// The remote address is not a pointer in the tracer, so it cannot
+	// be stored in a syscall.Iovec.
+	remote := [2]uintptr{uintptr(addr), uintptr(len(b))}
+	n, _, e := syscall.Syscall6(trap, uintptr(pid),
+		uintptr(unsafe.Pointer(&local)), 1, uintptr(unsafe.Pointer(&remote[0])), 1, 0)
+	runtime.KeepAlive(b)
+	switch {
+	case e != 0:
+		return 0, e
+	case int(n) != len(b):
+		// Part of the range is not mapped.
+		return int(n), syscall.EFAULT
+	}
+	return int(n), nil
+}
@@ -0,0 +1,112 @@
+package ptrace
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Returns a snapshot of the given contents, keyed by address.
+func testSnapshot(contents map[uint64]string) *Snapshot {
+	s := &Snapshot{}
+	for addr, data := range contents {
+		s.regions = append(s.regions, snapRegion{
+			Region: Region{Addr: addr, Size: uint64(len(data))},
+			data:   []byte(data),
+		})
+	}
+	// Snapshots copy mappings in address order.
+	sort.Slice(s.regions, func(i, j int) bool { return s.regions[i].Addr < s.regions[j].Addr })
+	return s
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b map[uint64]string
+		want []Region
+	}{
+		{
+			name: "same",
+			a:    map[uint64]string{0x1000: "abcdef"},
+			b:    map[uint64]string{0x1000: "abcdef"},
+		},
+		{
+			name: "runs",
+			a:    map[uint64]string{0x1000: "abcdef"},
+			b:    map[uint64]string{0x1000: "xbcyzf"},
+			want: []Region{{Addr: 0x1000, Size: 1}, {Addr: 0x1003, Size: 2}},
+		},
+		{
+			name: "all differ",
+			a:    map[uint64]string{0x1000: "abc"},
+			b:    map[uint64]string{0x1000: "xyz"},
+			want: []Region{{Addr: 0x1000, Size: 3}},
+		},
+		{
+			name: "disjoint",
+			a:    map[uint64]string{0x1000: "abc"},
+			b:    map[uint64]string{0x2000: "xyz"},
+		},
+		{
+			name: "only the overlap is compared",
+			a:    map[uint64]string{0x1000: "abcdef"},
+			b:    map[uint64]string{0x1004: "eXgh"},
+			want: []Region{{Addr: 0x1005, Size: 1}},
+		},
+		{
+			name: "one region spanning several",
+			a:    map[uint64]string{0x1000: "ab", 0x1004: "ef"},
+			b:    map[uint64]string{0x1000: "aBcdEf"},
+			want: []Region{{Addr: 0x1001, Size: 1}, {Addr: 0x1004, Size: 1}},
+		},
+		{
+			name: "address order",
+			a:    map[uint64]string{0x3000: "a", 0x1000: "b", 0x2000: "c"},
+			b:    map[uint64]string{0x1000: "B", 0x2000: "C", 0x3000: "A"},
+			want: []Region{{Addr: 0x1000, Size: 1}, {Addr: 0x2000, Size: 1}, {Addr: 0x3000, Size: 1}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := testSnapshot(test.a).Diff(testSnapshot(test.b))
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotDiffEvicted(t *testing.T) {
+	live := testSnapshot(map[uint64]string{0x1000: "abc"})
+	evicted := &Snapshot{evicted: true}
+	if _, err := live.Diff(evicted); err != errSnapshotEvicted {
+		t.Errorf("live.Diff(evicted)=%v, want %v", err, errSnapshotEvicted)
+	}
+	if _, err := evicted.Diff(live); err != errSnapshotEvicted {
+		t.Errorf("evicted.Diff(live)=%v, want %v", err, errSnapshotEvicted)
+	}
+}
+
+func TestSnapshotBytes(t *testing.T) {
+	s := testSnapshot(map[uint64]string{0x1000: "abcdef", 0x2000: "xyz"})
+	tests := []struct {
+		r    Region
+		want []byte
+	}{
+		{Region{Addr: 0x1000, Size: 6}, []byte("abcdef")},
+		{Region{Addr: 0x1002, Size: 2}, []byte("cd")},
+		{Region{Addr: 0x2001, Size: 2}, []byte("yz")},
+		{Region{Addr: 0x1004, Size: 4}, nil},
+		{Region{Addr: 0x1fff, Size: 2}, nil},
+		{Region{Addr: 0x3000, Size: 1}, nil},
+	}
+	for _, test := range tests {
+		if got := s.Bytes(test.r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Bytes(%+v)=%q, want %q", test.r, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// A State is a stage in the lifecycle of a tracee.
+type State int32
+
+const (
+	// Running is the state of a tracee that is executing.
+	Running State = iota
+	// Stopped is the state of a tracee that is stopped for the tracer,
+	// for example after a single step or on signal delivery.
+	Stopped
+	// SyscallStopped is the state of a tracee that is stopped at a
+	// system call entry or exit.
+	SyscallStopped
+	// GroupStopped is the state of a tracee that is stopped along
+	// with the rest of its thread group, for example by SIGSTOP.
+	GroupStopped
+	// Detached is the state of a tracee that is no longer traced, but
+	// has not yet exited.
+	Detached
+	// Exited is the state of a tracee that has exited or was killed
+	// by a signal.
+	Exited
+	// Listening is the state of a tracee in a group-stop that was
+	// restarted by Listen.  It remains stopped, but does not accept
+	// commands.
+	Listening
+	// Broken is the state of a tracee that has not exited, but whose
+	// tracer panicked in a command, or failed to undo its own change
+	// to the tracee.  Every command returns ErrBroken.
+	Broken
+)
+
+var stateNames = [...]string{
+	Running:        "running",
+	Stopped:        "stopped",
+	SyscallStopped: "syscall-stopped",
+	GroupStopped:   "group-stopped",
+	Detached:       "detached",
+	Exited:         "exited",
+	Listening:      "listening",
+	Broken:         "broken",
+}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// IsStopped returns whether the state is one of the stopped states, in
+// which the tracee accepts commands.
+func (s State) IsStopped() bool {
+	return s == Stopped || s == SyscallStopped || s == GroupStopped
+}
+
+// State returns the current state of the tracee, as last observed by
+// the tracer.  The state is updated before the corresponding event is
+// sent on the events channel.
+func (t *Tracee) State() State {
+	s := State(t.state.Load())
+	if s != Exited && t.broken.Load() != nil {
+		return Broken
+	}
+	return s
+}
+
+// PTRACE_EVENT_STOP, reported in the high bits of the wait status for
+// group-stops of tracees attached with PTRACE_SEIZE, with the stopping
+// signal, and for their other stops, such as by PTRACE_INTERRUPT, with
+// SIGTRAP.
+const ptraceEventStop = 0x80
+
+// PTRACE_EVENT_SECCOMP, reported for stops requested by a seccomp
+// filter.  They are system call stops.
+const ptraceEventSeccomp = 7
+
+// Returns the state of a tracee that reported the wait status.
+func waitState(ws syscall.WaitStatus) State {
+	switch {
+	case ws.Exited() || ws.Signaled():
+		return Exited
+	case ws.Continued():
+		return Running
+	case ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP|0x80:
+		return SyscallStopped
+	case ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP && int(ws)>>16 == ptraceEventSeccomp:
+		return SyscallStopped
+	case ws.Stopped() && int(ws)>>16 == ptraceEventStop && ws.StopSignal() != syscall.SIGTRAP:
+		return GroupStopped
+	default:
+		return Stopped
+	}
+}
+
+// Returns an error if the tracee is not in a stopped state.
+func (t *Tracee) requireStopped() error {
+	switch s := t.State(); {
+	case s == Exited:
+		return ErrTraceeExited
+	case s == Detached:
+		return ErrNotAttached
+	case !s.IsStopped():
+		return ErrNotStopped
+	}
+	return nil
+}
+
+// Transitions a stopped tracee to the given state and calls f, which
+// should resume or detach the tracee.  The state is changed before
+// calling f, since the wait go routine may observe the next stop as
+// soon as the tracee is resumed.  If f fails, the previous state is
+// restored, unless the wait go routine has since changed it.
+func (t *Tracee) resume(s State, f func() error) error {
+	if err := t.requireStopped(); err != nil {
+		return err
+	}
+	prev := t.state.Swap(int32(s))
+	t.lastResume = f
+	err := f()
+	// The state cached for the stop is discarded after f, rather than
+	// before, since f may read the registers to step over a breakpoint.
+	t.invalidateStop()
+	if err != nil {
+		t.state.CompareAndSwap(int32(s), prev)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// StepN single-steps the tracee n times, returning the number of steps
+// completed.  The steps are performed on the tracer thread, and no
+// events are sent for the intermediate stops, which makes StepN much
+// faster than calling SingleStep n times.  A breakpoint at the program
+// counter is stepped over.
+//
+// Stepping ends early if the tracee stops for a reason other than the
+// single step, for example on delivery of a signal, in which case the
+// stop is sent on the events channel as usual.  If the tracee exits,
+// ErrTraceeExited is returned along with the number of steps completed.
+func (t *Tracee) StepN(n uint64) (uint64, error) {
+	return t.StepUntil(n, nil)
+}
+
+// StepUntil is like StepN, but after each step it calls stop with the
+// tracee's program counter, and it ends stepping early if stop returns
+// true.  If stop is nil, StepUntil is equivalent to StepN.
+func (t *Tracee) StepUntil(n uint64, stop func(pc uint64) bool) (uint64, error) {
+	var steps uint64
+	err := t.run("singlestep", func() error {
+		stops := make(chan syscall.WaitStatus, 1)
+		intercept := func(ws syscall.WaitStatus) bool {
+			// The send must not block the wait go routine
+			// if this command has already returned.
+			select {
+			case stops <- ws:
+			default:
+			}
+			return isStepStop(ws)
+		}
+		if !t.intercept.CompareAndSwap(nil, &intercept) {
+			return errStopBusy
+		}
+		defer t.intercept.Store(nil)
+
+		step := func() (syscall.WaitStatus, error) {
+			err := t.resume(Running, func() error { return ptraceSingleStep(t.proc.Pid) })
+			if err != nil {
+				return 0, err
+			}
+			select {
+			case ws := <-stops:
+				return ws, nil
+			case <-t.waitDone:
+				return 0, ErrTraceeExited
+			}
+		}
+		var regs syscall.PtraceRegs
+		for steps < n {
+			if err := t.ctx.Err(); err != nil {
+				return err
+			}
+			var ws syscall.WaitStatus
+			var err error
+			if bp := t.breakpointAtPC(Raw{t}); bp != nil {
+				ws, err = t.stepOverBreakpoint(Raw{t}, bp, step)
+			} else {
+				ws, err = step()
+			}
+			switch {
+			case err != nil:
+				return err
+			case ws.Exited() || ws.Signaled():
+				return ErrTraceeExited
+			case !isStepStop(ws):
+				return nil
+			}
+			steps++
+			if stop == nil {
+				continue
+			}
+			if err := (Raw{t}).GetRegs(&regs); err != nil {
+				return err
+			}
+			if stop(regs.PC()) {
+				return nil
+			}
+		}
+		return nil
+	})
+	return steps, err
+}
+
+// Returns whether the status is of the stop after a single step: a
+// plain SIGTRAP stop, rather than a PTRACE_EVENT stop, such as at exec
+// or exit, which also reports SIGTRAP, but is sent as usual.
+func isStepStop(ws syscall.WaitStatus) bool {
+	return ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP && int(ws)>>16 == 0
+}
+
+// StepRange single-steps the tracee while its program counter is within
+// [start, end), as StepUntil does, and returns the number of steps
+// completed.  Calls out of the range are stepped into.  Stepping ends
+// early, as with StepN, if the tracee stops for another reason.
+func (t *Tracee) StepRange(start, end uintptr) (uint64, error) {
+	return t.StepUntil(^uint64(0), func(pc uint64) bool {
+		return pc < uint64(start) || pc >= uint64(end)
+	})
+}
@@ -0,0 +1,116 @@
+package ptrace
+
+import (
+	"context"
+	"errors"
+	"syscall"
+)
+
+// A StopReason classifies the stop that ends a call to Stop.
+type StopReason int
+
+const (
+	// StopRequested means the tracee stopped because of the
+	// interrupt sent by Stop.  No event is sent for the stop.
+	StopRequested StopReason = iota
+	// StopNatural means the tracee stopped for another reason, for
+	// example at a breakpoint, before the interrupt was delivered.
+	// The stop's event is sent on the events channel as usual, and
+	// the interrupt remains pending; it is reported as a separate
+	// stop once the tracee is resumed.
+	StopNatural
+	// StopExited means the tracee exited before it stopped.
+	StopExited
+)
+
+var stopReasonNames = [...]string{
+	StopRequested: "requested",
+	StopNatural:   "natural",
+	StopExited:    "exited",
+}
+
+func (r StopReason) String() string {
+	if r < 0 || int(r) >= len(stopReasonNames) {
+		return "unknown"
+	}
+	return stopReasonNames[r]
+}
+
+var errStopBusy = errors.New("ptrace: another command is waiting for the tracee to stop")
+
+// Stop interrupts a running tracee, and waits for it to stop.  A seized
+// tracee is interrupted with PTRACE_INTERRUPT, and any other with
+// SIGSTOP.  The returned StopReason tells whether the tracee stopped
+// because of the interrupt; only that stop is consumed by Stop.  If the
+// tracee is already stopped, Stop returns StopNatural without
+// interrupting it.  If ctx is done before the tracee stops, ctx's error
+// is returned, and the stop is reported on the events channel when it
+// happens.
+func (t *Tracee) Stop(ctx context.Context) (StopReason, error) {
+	return t.stop(ctx, t.run)
+}
+
+// Stops the tracee as Stop, sending the interrupt with run, which is
+// runInternal when Close stops the tracee, so that the tracee's context
+// does not cancel it.
+func (t *Tracee) stop(ctx context.Context, run func(string, func() error) error) (StopReason, error) {
+	type stop struct {
+		ws syscall.WaitStatus
+		// Interrupt is whether the stop is the one caused by
+		// the interrupt, which is consumed.
+		interrupt bool
+	}
+	stops := make(chan stop, 1)
+	intercept := func(ws syscall.WaitStatus) bool {
+		s := stop{ws: ws, interrupt: t.isInterrupt(ws)}
+		// The send must not block the wait go routine if Stop
+		// has already returned.
+		select {
+		case stops <- s:
+		default:
+		}
+		return s.interrupt
+	}
+	// The intercept is installed before the state is checked, so that
+	// a stop after the check is received.
+	if !t.intercept.CompareAndSwap(nil, &intercept) {
+		return StopNatural, errStopBusy
+	}
+	defer t.intercept.Store(nil)
+	switch s := t.State(); {
+	case s == Exited:
+		return StopExited, ErrTraceeExited
+	case s == Detached:
+		return StopNatural, ErrNotAttached
+	case s.IsStopped():
+		return StopNatural, nil
+	}
+	err := run("interrupt", func() error {
+		if t.State() == Exited {
+			return ErrTraceeExited
+		}
+		return t.interrupt()
+	})
+	if err != nil {
+		return StopNatural, err
+	}
+	for {
+		select {
+		case s := <-stops:
+			switch {
+			case s.ws.Exited() || s.ws.Signaled():
+				return StopExited, nil
+			case s.interrupt:
+				return StopRequested, nil
+			case !s.ws.Stopped():
+				continue
+			default:
+				return StopNatural, nil
+			}
+		case <-t.waitDone:
+			return StopExited, nil
+		case <-ctx.Done():
+			return StopNatural, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package ptrace
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The si_code of a signal sent by sigqueue, and the si_value with which
+// Stop queues its SIGSTOP, to tell its stop from one of a SIGSTOP sent
+// otherwise.
+const (
+	siQueue   = -1
+	stopValue = 0x70747374
+)
+
+// Interrupts the running tracee for Stop: with PTRACE_INTERRUPT if it is
+// seized, and otherwise with a SIGSTOP queued with stopValue.  Called on
+// the tracer thread.
+func (t *Tracee) interrupt() error {
+	if t.seized {
+		return ptrace(ptraceInterrupt, t.proc.Pid, 0, 0)
+	}
+	var info [siginfoSize]byte
+	ne := binary.NativeEndian
+	ne.PutUint32(info[0:], uint32(syscall.SIGSTOP))
+	code := int32(siQueue)
+	ne.PutUint32(info[8:], uint32(code))
+	u := (12 + ptrSize - 1) &^ (ptrSize - 1)
+	ne.PutUint32(info[u:], uint32(os.Getpid()))
+	ne.PutUint32(info[u+4:], uint32(os.Getuid()))
+	ne.PutUint32(info[u+8:], stopValue)
+	_, _, e := syscall.Syscall(syscall.SYS_RT_SIGQUEUEINFO, uintptr(t.proc.Pid), uintptr(syscall.SIGSTOP),
+		uintptr(unsafe.Pointer(&info[0])))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// Returns whether the status is of the stop caused by interrupt: the
+// PTRACE_EVENT_STOP of PTRACE_INTERRUPT, which reports SIGTRAP, or the
+// delivery of the queued SIGSTOP.  Seized is read on the tracer thread,
+// as groupStop does.  Called on the wait go routine.
+func (t *Tracee) isInterrupt(ws syscall.WaitStatus) bool {
+	if !ws.Stopped() {
+		return false
+	}
+	interrupt := false
+	t.runInternal("getsiginfo", func() error {
+		switch {
+		case t.seized:
+			interrupt = ws.StopSignal() == syscall.SIGTRAP && int(ws)>>16 == ptraceEventStop
+			return nil
+		case ws.StopSignal() != syscall.SIGSTOP || int(ws)>>16 != 0:
+			return nil
+		}
+		info, err := getSiginfo(t.proc.Pid)
+		if err != nil {
+			return nil
+		}
+		si := decodeSiginfo((*[siginfoSize]byte)(unsafe.Pointer(&info[0]))[:])
+		u := (12 + ptrSize - 1) &^ (ptrSize - 1)
+		interrupt = si.Code == siQueue && int(si.Pid) == os.Getpid() &&
+			binary.NativeEndian.Uint32(si.Raw[u+8:]) == stopValue
+		return nil
+	})
+	return interrupt
+}
+
+// How long Close waits for a running tracee to stop to be detached.
+const closeStopTimeout = time.Second
+
+// Detaches the tracee for Close.  A running tracee cannot be detached,
+// so a seized tracee is first stopped, as by Stop; its interrupt does not
+// outlive the detach, as a SIGSTOP would.  Any other running tracee is
+// detached when the tracer thread exits, unless it would then be killed,
+// WithExitKill, in which case it too is stopped, with a SIGSTOP.
+func (t *Tracee) closeDetach(sig syscall.Signal) {
+	if t.detachStopped(sig) == nil {
+		return
+	}
+	var seized bool
+	t.runInternal("seized", func() error {
+		seized = t.seized
+		return nil
+	})
+	if !seized && !t.exitKill {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeStopTimeout)
+	defer cancel()
+	// The stop may be one that the tracee is resumed from internally,
+	// so the detach is retried until it succeeds.
+	for ctx.Err() == nil {
+		if _, err := t.stop(ctx, t.runInternal); err != nil || t.detachStopped(sig) == nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ptrace
+
+import "sync"
+
+// The buffer size of a subscription's channel.
+const subscriptionBuffer = 16
+
+// A subscription is a channel of events from Subscribe.
+type subscription struct {
+	events chan Event
+	// Done is closed when the subscription is canceled.
+	done chan struct{}
+	once sync.Once
+	// Mu is held while sending on events, and guards closing it.
+	mu     sync.Mutex
+	closed bool
+}
+
+// Subscribe returns a new channel that receives every event that the
+// wait go routine sends on the tracee's events channel, and a function
+// that cancels the subscription, closing the channel.  Each subscriber
+// receives its own copy of the events, so a logger and a debugger, for
+// example, can observe the same tracee without taking events from each
+// other.  An event is sent to the subscribers before it is sent on the
+// events channel, and, as with the events channel, the tracee waits for
+// each subscriber to receive it, so a subscriber must keep receiving
+// until it cancels.  The channel is closed once the tracee exits or is
+// closed.  Events that are not observed by the wait go routine, such as
+// MemoryPressureEvents, are not sent to subscribers.
+func (t *Tracee) Subscribe() (<-chan Event, func()) {
+	s := &subscription{
+		events: make(chan Event, subscriptionBuffer),
+		done:   make(chan struct{}),
+	}
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+	if t.subsClosed {
+		close(s.events)
+		return s.events, func() {}
+	}
+	if t.subs == nil {
+		t.subs = make(map[*subscription]bool)
+	}
+	t.subs[s] = true
+	cancel := func() {
+		t.subsMu.Lock()
+		delete(t.subs, s)
+		t.subsMu.Unlock()
+		s.cancel()
+	}
+	return s.events, cancel
+}
+
+// Sends the event to each subscriber.  Called on the wait go routine.
+func (t *Tracee) publish(ev Event) {
+	t.subsMu.Lock()
+	subs := make([]*subscription, 0, len(t.subs))
+	for s := range t.subs {
+		subs = append(subs, s)
+	}
+	t.subsMu.Unlock()
+	for _, s := range subs {
+		s.mu.Lock()
+		if !s.closed {
+			select {
+			case s.events <- ev:
+			case <-s.done:
+			case <-t.closing:
+			case <-t.killing:
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Cancels every subscription.  Called by the wait go routine when it
+// returns.
+func (t *Tracee) closeSubs() {
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+	t.subsClosed = true
+	for s := range t.subs {
+		s.cancel()
+	}
+	t.subs = nil
+}
+
+// Closes the subscription's channel.  A send in progress is interrupted
+// before the channel is closed.
+func (s *subscription) cancel() {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		close(s.events)
+	})
+}
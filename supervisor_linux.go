@@ -0,0 +1,317 @@
+package ptrace
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var errSupervisorClosed = errors.New("ptrace: supervisor is closed")
+
+// A Supervisor owns several tracees, for example the processes of a
+// process tree, receives their events, and merges them into a single
+// stream, each labeled with its tracee.  Once a tracee is added to a
+// Supervisor, its events must only be received from the Supervisor.  The
+// children of a tracee created WithFollowForks are added as they are
+// forked.
+type Supervisor struct {
+	events chan SupervisorEvent
+	// Closing is closed by Close, after which events are dropped.
+	closing chan struct{}
+
+	mu      sync.Mutex
+	tracees map[int]*Tracee
+	// Parents are the process IDs of the parents of the tracees that
+	// were added by a ForkEvent.  When a tracee is removed, its
+	// children are given its parent.
+	parents map[int]int
+	// Exited are the removed tracees that own a tracer thread.  They
+	// are not closed until Close, since closing them detaches the
+	// children that share their tracer thread.
+	exited []*Tracee
+	closed bool
+	// Forwards are the go routines forwarding the tracees' events,
+	// one for each tracee.
+	forwards sync.WaitGroup
+}
+
+// A SupervisorEvent is an event of one of the tracees of a Supervisor.
+type SupervisorEvent struct {
+	// Pid is the process ID of the tracee.
+	Pid    int
+	Tracee *Tracee
+	Event
+}
+
+// NewSupervisor returns a new Supervisor with no tracees.
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		events:  make(chan SupervisorEvent),
+		closing: make(chan struct{}),
+		tracees: make(map[int]*Tracee),
+		parents: make(map[int]int),
+	}
+}
+
+// Exec starts a new tracee, as by Exec, and adds it to the supervisor.
+func (s *Supervisor) Exec(name string, argv []string, opts ...Option) (*Tracee, error) {
+	t, err := Exec(name, argv, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Add(t); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Add adds the tracee to the supervisor, which receives its events from
+// then on.  The tracee is removed once its events channel is closed.
+func (s *Supervisor) Add(t *Tracee) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSupervisorClosed
+	}
+	s.add(t)
+	return nil
+}
+
+// Must be called with mu held.
+func (s *Supervisor) add(t *Tracee) {
+	s.tracees[t.proc.Pid] = t
+	s.forwards.Add(1)
+	go s.forward(t)
+}
+
+// Adds the child of a ForkEvent of the tracee with process ID ppid, or
+// closes it if the supervisor is closed.
+func (s *Supervisor) adopt(ppid int, ev ForkEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		ev.child.Close()
+		return
+	}
+	s.parents[ev.Pid] = ppid
+	s.add(ev.child)
+}
+
+// Removes the tracee, closing it if it does not own a tracer thread.
+func (s *Supervisor) remove(t *Tracee) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pid := t.proc.Pid
+	if s.tracees[pid] != t {
+		return
+	}
+	delete(s.tracees, pid)
+	ppid, ok := s.parents[pid]
+	for c, p := range s.parents {
+		if p != pid {
+			continue
+		}
+		if ok {
+			s.parents[c] = ppid
+		} else {
+			delete(s.parents, c)
+		}
+	}
+	delete(s.parents, pid)
+	if t.owner == nil {
+		s.exited = append(s.exited, t)
+	} else {
+		go t.Close()
+	}
+}
+
+// Events returns the merged events channel of the supervisor's tracees.
+// It is closed by Close.  As with a tracee's own events channel, each
+// tracee blocks until its events are received.
+func (s *Supervisor) Events() <-chan SupervisorEvent {
+	return s.events
+}
+
+// Tracee returns the supervisor's tracee with the process ID, or nil if
+// there is none.
+func (s *Supervisor) Tracee(pid int) *Tracee {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tracees[pid]
+}
+
+// Tracees returns the supervisor's tracees.
+func (s *Supervisor) Tracees() []*Tracee {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts := make([]*Tracee, 0, len(s.tracees))
+	for _, t := range s.tracees {
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+// A ProcessTree is a tracee of a Supervisor and its descendants.
+type ProcessTree struct {
+	// Pid is the process ID of the tracee.
+	Pid    int
+	Tracee *Tracee
+	// Children are the trees of the tracee's children, in order of
+	// process ID.
+	Children []*ProcessTree
+}
+
+// Tree returns the trees of the supervisor's tracees, in order of
+// process ID.  The tree grows with each ForkEvent, and shrinks with each
+// exit, both of which are sent on the events channel.  The children of
+// a tracee that exits become the children of its parent, or roots if it
+// has none.
+func (s *Supervisor) Tree() []*ProcessTree {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := make(map[int]*ProcessTree, len(s.tracees))
+	for pid, t := range s.tracees {
+		nodes[pid] = &ProcessTree{Pid: pid, Tracee: t}
+	}
+	var roots []*ProcessTree
+	for pid, n := range nodes {
+		if p, ok := nodes[s.parents[pid]]; ok {
+			p.Children = append(p.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	for _, n := range nodes {
+		sortTrees(n.Children)
+	}
+	sortTrees(roots)
+	return roots
+}
+
+func sortTrees(ts []*ProcessTree) {
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Pid < ts[j].Pid })
+}
+
+// DetachAll detaches each of the supervisor's tracees, as by Detach.
+// Each must be stopped.  All of the tracees are detached, even if some
+// fail, and the first error is returned.
+func (s *Supervisor) DetachAll() error {
+	return allTracees(s.Tracees(), func(t *Tracee) error { return t.Detach() })
+}
+
+// KillAll kills each of the supervisor's tracees, as by Kill, which also
+// closes them.  The first error is returned.
+func (s *Supervisor) KillAll() error {
+	ts := s.owned()
+	// Every tracee is reaped before any is closed, since closing a
+	// tracee detaches the children that share its tracer thread.
+	for _, t := range ts {
+		t.kill()
+	}
+	for _, t := range ts {
+		<-t.waitDone
+	}
+	return allTracees(ts, func(t *Tracee) error {
+		_, err := t.Kill()
+		return err
+	})
+}
+
+// SetOptionsAll adds the ptrace options to each of the supervisor's
+// tracees, as by SetOptions.  Each must be stopped.  The first error is
+// returned.
+func (s *Supervisor) SetOptionsAll(opts int) error {
+	return allTracees(s.Tracees(), func(t *Tracee) error { return t.SetOptions(opts) })
+}
+
+// Close closes each of the supervisor's tracees, as by Close, and then
+// closes the events channel.  Events that are not yet received are
+// dropped.  The first error is returned.  Calling Close more than once
+// is harmless.
+func (s *Supervisor) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.forwards.Wait()
+		return nil
+	}
+	s.closed = true
+	close(s.closing)
+	s.mu.Unlock()
+	// The tracees that share a tracer thread are closed before its
+	// owner, which detaches any that remain attached.
+	var owners, shared []*Tracee
+	for _, t := range s.owned() {
+		if t.owner == nil {
+			owners = append(owners, t)
+		} else {
+			shared = append(shared, t)
+		}
+	}
+	closeTracee := func(t *Tracee) error { return t.Close() }
+	err := allTracees(shared, closeTracee)
+	if e := allTracees(owners, closeTracee); err == nil {
+		err = e
+	}
+	s.forwards.Wait()
+	close(s.events)
+	return err
+}
+
+// Returns the tracees, including those that have exited, but are not
+// yet closed.
+func (s *Supervisor) owned() []*Tracee {
+	ts := s.Tracees()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(ts, s.exited...)
+}
+
+// Calls f concurrently with each tracee, and returns the first error.
+func allTracees(ts []*Tracee, f func(*Tracee) error) error {
+	errs := make([]error, len(ts))
+	var wg sync.WaitGroup
+	for i, t := range ts {
+		wg.Add(1)
+		go func(i int, t *Tracee) {
+			defer wg.Done()
+			errs[i] = f(t)
+		}(i, t)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forwards the tracee's events until its events channel is closed, and
+// then removes it, or until Close is called.  Runs on its own go routine.
+func (s *Supervisor) forward(t *Tracee) {
+	defer s.forwards.Done()
+	pid := t.proc.Pid
+	for {
+		select {
+		case ev, ok := <-t.Events():
+			if !ok {
+				s.remove(t)
+				return
+			}
+			if fe, ok := ev.(ForkEvent); ok {
+				s.adopt(pid, fe)
+			}
+			select {
+			case s.events <- SupervisorEvent{Pid: pid, Tracee: t, Event: ev}:
+			case <-s.closing:
+				return
+			}
+		case <-s.closing:
+			// A closed tracee's events channel is not closed
+			// until it exits, which a detached tracee need not do.
+			return
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package ptrace
+
+// System call numbers that the syscall package does not define.
+const (
+	sysProcessVMReadv  = 270
+	sysProcessVMWritev = 271
+)
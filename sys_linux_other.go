@@ -0,0 +1,10 @@
+//go:build linux && !amd64 && !arm64 && !386
+
+package ptrace
+
+// System call numbers that the syscall package does not define.  They
+// are not known for this architecture, so the calls fail with ENOSYS.
+const (
+	sysProcessVMReadv  = ^uintptr(0)
+	sysProcessVMWritev = ^uintptr(0)
+)
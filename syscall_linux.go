@@ -0,0 +1,240 @@
+package ptrace
+
+import (
+	"errors"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var errForkOptions = errors.New("ptrace: fork tracing options are not supported")
+
+// A SyscallEnterEvent is sent when the tracee stops on entry to a system
+// call after Syscall.
+type SyscallEnterEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Time is when the stop was observed.
+	Time time.Time `json:"time"`
+	// Nr is the system call number.
+	Nr int `json:"nr"`
+	// Args are the system call arguments.
+	Args [6]uint64 `json:"args"`
+	// Decoded are the arguments formatted according to their types,
+	// with WithSyscallDecoding, or nil if the system call is not
+	// decoded.
+	Decoded []string `json:"decoded,omitempty"`
+	// Notification, if non-nil, is the seccomp notification of the
+	// system call, with WithSeccompNotify; the tracee is not stopped.
+	Notification *SeccompNotification `json:"notification,omitempty"`
+}
+
+// Name returns the name of the system call.
+func (e SyscallEnterEvent) Name() string { return SyscallName(e.Nr) }
+
+// A SyscallExitEvent is sent when the tracee stops on exit from a system
+// call after Syscall.
+type SyscallExitEvent struct {
+	Status syscall.WaitStatus `json:"status"`
+	// Time is when the stop was observed.
+	Time time.Time `json:"time"`
+	// Nr is the system call number from the corresponding entry, or
+	// -1 if the entry was not observed.
+	Nr int `json:"nr"`
+	// Ret is the raw return value of the system call.
+	Ret int64 `json:"ret"`
+	// Errno is the error of the system call, from SyscallReturn, or 0
+	// if it succeeded.
+	Errno syscall.Errno `json:"errno,omitempty"`
+	// Decoded are the arguments of the system call, with WithSyscallDecoding,
+	// including those filled in by the kernel, or nil if the system call
+	// is not decoded.
+	Decoded []string `json:"decoded,omitempty"`
+}
+
+// Name returns the name of the system call.
+func (e SyscallExitEvent) Name() string { return SyscallName(e.Nr) }
+
+// Err returns the error of the system call, or nil if it succeeded.
+func (e SyscallExitEvent) Err() error {
+	if e.Errno == 0 {
+		return nil
+	}
+	return e.Errno
+}
+
+//go:generate sh mksysnames.sh
+
+// SyscallName returns the name of the system call with the given number
+// on the current architecture, or "syscall_N" if it is unknown.
+func SyscallName(nr int) string {
+	if name, ok := syscallNames[nr]; ok {
+		return name
+	}
+	return "syscall_" + strconv.Itoa(nr)
+}
+
+// SyscallNumber returns the number of the named system call on the
+// current architecture, and whether it exists.
+func SyscallNumber(name string) (int, bool) {
+	for nr, n := range syscallNames {
+		if n == name {
+			return nr, true
+		}
+	}
+	return -1, false
+}
+
+// Syscall continues the tracee until its next system call entry or exit,
+// at which a SyscallEnterEvent or SyscallExitEvent is sent.
+func (t *Tracee) Syscall() error {
+	return t.run("syscall", func() error { return t.resumeSyscall(0) })
+}
+
+// Resumes the tracee from the stop of the event, as by Syscall, but
+// delivering the signal of a signal-delivery stop.
+func (t *Tracee) syscallFrom(ev Event) error {
+	sig, _ := signalStop(ev)
+	return t.run("syscall", func() error { return t.resumeSyscall(sig) })
+}
+
+// Resumes the tracee until its next system call stop, delivering sig if
+// it is non-zero.  The signal is delivered only once, so the tracee is
+// resumed as by Syscall after a later stop.  Called on the tracer
+// thread.
+func (t *Tracee) resumeSyscall(sig syscall.Signal) error {
+	sysc := func(sig syscall.Signal) func() error {
+		return func() error {
+			if err := t.setOptions(syscall.PTRACE_O_TRACESYSGOOD); err != nil {
+				return err
+			}
+			t.sysemu = false
+			return ptrace(syscall.PTRACE_SYSCALL, t.proc.Pid, 0, uintptr(sig))
+		}
+	}
+	t.signalResume = func(sig syscall.Signal) error {
+		return ptrace(syscall.PTRACE_SYSCALL, t.proc.Pid, 0, uintptr(sig))
+	}
+	if sig == 0 {
+		return t.resume(Running, t.overBreakpoint(sysc(0), false))
+	}
+	err := t.resume(Running, sysc(sig))
+	t.lastResume = t.overBreakpoint(sysc(0), false)
+	return err
+}
+
+// SetOptions adds the ptrace options, PTRACE_O_* flags, to those set on
+// the stopped tracee.  Options that the package sets itself, such as
+// PTRACE_O_TRACEEXEC, are never cleared.  The options that attach the
+// tracee's new child processes, PTRACE_O_TRACEFORK and
+// PTRACE_O_TRACEVFORK, are not supported; use WithFollowForks instead.
+func (t *Tracee) SetOptions(opts int) error {
+	return t.run("setoptions", func() error {
+		if opts&(syscall.PTRACE_O_TRACEFORK|syscall.PTRACE_O_TRACEVFORK) != 0 {
+			return errForkOptions
+		}
+		if err := t.requireStopped(); err != nil {
+			return err
+		}
+		return t.setOptions(opts)
+	})
+}
+
+// Adds to the ptrace options set on the tracee.  Must be called on the
+// tracer thread while the tracee is stopped.
+func (t *Tracee) setOptions(opts int) error {
+	if t.options&opts == opts {
+		return nil
+	}
+	if err := syscall.PtraceSetOptions(t.proc.Pid, t.options|opts); err != nil {
+		return err
+	}
+	t.options |= opts
+	return nil
+}
+
+// Returns the event for a syscall-stop.  Called on the wait go routine.
+func (t *Tracee) decodeSyscall(ws syscall.WaitStatus) Event {
+	now := time.Now()
+	var info syscallInfo
+	err := t.runInternal("get_syscall_info", func() error { return getSyscallInfo(t.proc.Pid, &info) })
+	if err != nil {
+		return Event(ws)
+	}
+	switch info.op {
+	case syscallInfoEntry:
+		ev := SyscallEnterEvent{Status: ws, Time: now, Nr: int(info.data[0])}
+		copy(ev.Args[:], info.data[1:7])
+		t.syscallNr = ev.Nr
+		if t.decodeLimits != nil {
+			ev.Decoded = t.decodeSyscallEntry(ev, t.decodeLimits)
+			t.syscallEntry = syscallEntry{args: ev.Args, decoded: ev.Decoded}
+		}
+		return ev
+	case syscallInfoSeccomp:
+		ev := SeccompEvent{Status: ws, Time: now, Nr: int(info.data[0])}
+		copy(ev.Args[:], info.data[1:7])
+		t.syscallNr = ev.Nr
+		return ev
+	case syscallInfoExit:
+		ev := SyscallExitEvent{Status: ws, Time: now, Nr: t.syscallNr, Ret: int64(info.data[0])}
+		if errno := t.exitErrno(); errno != 0 {
+			ev.Ret = -int64(errno)
+		}
+		_, ev.Errno = SyscallReturn(ev.Ret)
+		t.syscallNr = -1
+		if t.decodeLimits != nil {
+			ev.Decoded = t.decodeSyscallExit(ev, t.syscallEntry)
+			t.syscallEntry = syscallEntry{}
+		}
+		return ev
+	}
+	return Event(ws)
+}
+
+// Calls the exitErrnos at a system call exit stop, and rewrites the
+// return of the system call to the last non-zero errno, if any.
+// Returns the errno, or 0 if the return is not rewritten.  Called on
+// the wait go routine.
+func (t *Tracee) exitErrno() syscall.Errno {
+	var errno syscall.Errno
+	for _, f := range t.exitErrnos {
+		if e := f(); e != 0 {
+			errno = e
+		}
+	}
+	if errno == 0 {
+		return 0
+	}
+	s, err := t.syscallStop(t.doInternal)
+	if err != nil || s.SetErrno(errno) != nil {
+		return 0
+	}
+	return errno
+}
+
+const (
+	ptraceGetSyscallInfo = 0x420e
+
+	syscallInfoEntry   = 1
+	syscallInfoExit    = 2
+	syscallInfoSeccomp = 3
+)
+
+// Struct ptrace_syscall_info from <linux/ptrace.h>.  For an entry stop,
+// data holds the system call number followed by its arguments; for an
+// exit stop, it holds the return value followed by the is_error flag;
+// for a seccomp stop, it holds the same as for an entry stop, followed
+// by the filter's SECCOMP_RET_DATA.
+type syscallInfo struct {
+	op   uint8
+	_    [3]uint8
+	arch uint32
+	ip   uint64
+	sp   uint64
+	data [8]uint64
+}
+
+func getSyscallInfo(pid int, info *syscallInfo) error {
+	return ptracePtr(ptraceGetSyscallInfo, pid, unsafe.Sizeof(*info), unsafe.Pointer(info))
+}
@@ -0,0 +1,132 @@
+package ptrace
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A SyscallCount is the summary of the calls of one system call.
+type SyscallCount struct {
+	Nr   int
+	Name string
+	// Calls is the number of completed calls, and Errors is the number
+	// of those that failed.
+	Calls, Errors uint64
+	// Time is the cumulative time from the entries of the calls to
+	// their exits, as observed by the tracer.
+	Time time.Duration
+}
+
+// A SyscallCounter counts the system calls of one or more tracees
+// resumed with Syscall, like strace -c.  A call is counted at its exit;
+// calls whose entries were not observed are not counted.  The times are
+// measured between the entry and exit stops, so they include the cost
+// of the stops themselves.
+type SyscallCounter struct {
+	mu     sync.Mutex
+	counts map[int]*SyscallCount
+}
+
+// NewSyscallCounter returns a new SyscallCounter with no calls counted.
+func NewSyscallCounter() *SyscallCounter {
+	return &SyscallCounter{counts: make(map[int]*SyscallCount)}
+}
+
+// WithSyscallCounter counts the tracee's system calls with the
+// SyscallCounter.
+func WithSyscallCounter(c *SyscallCounter) Option {
+	return func(t *Tracee) {
+		// The pending entry is only accessed on the wait go routine.
+		enter := SyscallEnterEvent{Nr: -1}
+		t.observers = append(t.observers, func(ev Event) {
+			switch ev := ev.(type) {
+			case SyscallEnterEvent:
+				enter = ev
+			case SyscallExitEvent:
+				if ev.Nr < 0 || ev.Nr != enter.Nr {
+					return
+				}
+				c.add(ev.Nr, ev.Time.Sub(enter.Time), ev.Errno != 0)
+				enter = SyscallEnterEvent{Nr: -1}
+			}
+		})
+	}
+}
+
+func (c *SyscallCounter) add(nr int, d time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sc, ok := c.counts[nr]
+	if !ok {
+		sc = &SyscallCount{Nr: nr, Name: SyscallName(nr)}
+		c.counts[nr] = sc
+	}
+	sc.Calls++
+	if failed {
+		sc.Errors++
+	}
+	sc.Time += d
+}
+
+// Counts returns the counts of the system calls that were called, in
+// decreasing order of time, as in the summary written by WriteTo.
+func (c *SyscallCounter) Counts() []SyscallCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make([]SyscallCount, 0, len(c.counts))
+	for _, sc := range c.counts {
+		counts = append(counts, *sc)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Time != counts[j].Time {
+			return counts[i].Time > counts[j].Time
+		}
+		if counts[i].Calls != counts[j].Calls {
+			return counts[i].Calls > counts[j].Calls
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// WriteTo writes a summary table of the counts to w, in the format of
+// strace -c: for each system call, its percentage of the total time,
+// its time in seconds and microseconds per call, and its numbers of
+// calls and errors, followed by the totals.
+func (c *SyscallCounter) WriteTo(w io.Writer) (int64, error) {
+	counts := c.Counts()
+	var total SyscallCount
+	for _, sc := range counts {
+		total.Calls += sc.Calls
+		total.Errors += sc.Errors
+		total.Time += sc.Time
+	}
+	var b bytes.Buffer
+	const rule = "------ ----------- ----------- --------- --------- ----------------\n"
+	fmt.Fprintf(&b, "%6s %11s %11s %9s %9s %s\n", "% time", "seconds", "usecs/call", "calls", "errors", "syscall")
+	b.WriteString(rule)
+	for _, sc := range counts {
+		var pct float64
+		if total.Time > 0 {
+			pct = 100 * float64(sc.Time) / float64(total.Time)
+		}
+		perCall := sc.Time.Microseconds() / int64(sc.Calls)
+		fmt.Fprintf(&b, "%6.2f %11.6f %11d %9d %9s %s\n", pct, sc.Time.Seconds(), perCall, sc.Calls, errorCount(sc.Errors), sc.Name)
+	}
+	b.WriteString(rule)
+	fmt.Fprintf(&b, "%6.2f %11.6f %11s %9d %9s %s\n", 100.0, total.Time.Seconds(), "", total.Calls, errorCount(total.Errors), "total")
+	return b.WriteTo(w)
+}
+
+// Returns the number of errors for a summary table, which is blank if
+// there are none.
+func errorCount(n uint64) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,353 @@
+package ptrace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DecodeLimits bound the tracee memory read to decode the arguments of a
+// system call.
+type DecodeLimits struct {
+	// MaxString is the maximum number of bytes of a string or buffer
+	// that are shown; longer ones are truncated and followed by
+	// "...".  Zero means 32.
+	MaxString int
+	// MaxElements is the maximum number of elements of an array, such
+	// as the iovecs of writev, that are shown.  Zero means 16.
+	MaxElements int
+}
+
+// The default DecodeLimits, as strace's.
+const (
+	defaultMaxString   = 32
+	defaultMaxElements = 16
+)
+
+// WithSyscallDecoding formats the arguments of the system calls of a
+// tracee resumed with Syscall, in the Decoded fields of the
+// SyscallEnterEvents and SyscallExitEvents, reading the strings,
+// buffers, and structures that they point to from the tracee, within
+// the limits.  Arguments that the kernel fills in, such as the struct
+// stat of fstat or the buffer of read, are decoded at the exit, and are
+// shown as pointers at the entry and if the system call fails.
+func WithSyscallDecoding(limits DecodeLimits) Option {
+	if limits.MaxString <= 0 {
+		limits.MaxString = defaultMaxString
+	}
+	if limits.MaxElements <= 0 {
+		limits.MaxElements = defaultMaxElements
+	}
+	return func(t *Tracee) { t.decodeLimits = &limits }
+}
+
+// The argument kinds of system call prototypes:
+//
+//	d  a signed integer
+//	u  an unsigned integer
+//	x  an integer shown in hexadecimal, such as flags
+//	p  a pointer
+//	s  a string
+//	b  a buffer, whose length is the next argument
+//	B  a buffer that is filled in, whose length is the return value
+//	t  a struct timespec
+//	T  a struct timespec that is filled in
+//	S  a struct stat that is filled in
+//	v  an array of struct iovec, whose length is the next argument
+//	V  an array of struct iovec that is filled in, with as many bytes
+//	   as the return value
+//	m  a struct msghdr
+//	M  a struct msghdr that is filled in
+//
+// Upper case kinds are decoded at the exit of a system call.
+var syscallPrototypes = map[string]string{
+	"read":            "dBu",
+	"write":           "dbu",
+	"pread64":         "dBud",
+	"pwrite64":        "dbud",
+	"readv":           "dVd",
+	"writev":          "dvd",
+	"preadv":          "dVdd",
+	"pwritev":         "dvdd",
+	"open":            "sxx",
+	"openat":          "dsxx",
+	"creat":           "sx",
+	"close":           "d",
+	"stat":            "sS",
+	"lstat":           "sS",
+	"fstat":           "dS",
+	"newfstatat":      "dsSx",
+	"stat64":          "sS",
+	"lstat64":         "sS",
+	"fstat64":         "dS",
+	"fstatat64":       "dsSx",
+	"access":          "sx",
+	"faccessat":       "dsx",
+	"unlink":          "s",
+	"unlinkat":        "dsx",
+	"mkdir":           "sx",
+	"mkdirat":         "dsx",
+	"rmdir":           "s",
+	"chdir":           "s",
+	"rename":          "ss",
+	"renameat":        "dsds",
+	"readlink":        "sBu",
+	"readlinkat":      "dsBu",
+	"execve":          "spp",
+	"nanosleep":       "tT",
+	"clock_nanosleep": "dxtT",
+	"clock_gettime":   "dT",
+	"sendmsg":         "dmx",
+	"recvmsg":         "dMx",
+	"sendto":          "dbuxpu",
+	"recvfrom":        "dBuxpp",
+	"dup":             "d",
+	"dup2":            "dd",
+	"dup3":            "ddx",
+	"exit":            "d",
+	"exit_group":      "d",
+	"kill":            "dd",
+	"getpid":          "",
+}
+
+// The state of the system call that the tracee last entered, for
+// decoding its exit.  It is only accessed on the wait go routine.
+type syscallEntry struct {
+	args    [6]uint64
+	decoded []string
+}
+
+// Returns the arguments of a system call entry, formatted according to
+// its prototype within the limits, or nil if it is unknown.  Called on
+// the wait go routine.
+func (t *Tracee) decodeSyscallEntry(ev SyscallEnterEvent, limits *DecodeLimits) []string {
+	proto, ok := syscallPrototypes[ev.Name()]
+	if !ok {
+		return nil
+	}
+	dec := make([]string, len(proto))
+	t.doInternal(func(r Raw) error {
+		d := argDecoder{r: r, limits: limits, name: ev.Name(), args: ev.Args}
+		for i, k := range proto {
+			dec[i] = d.arg(i, k, 0, false)
+		}
+		return nil
+	})
+	return dec
+}
+
+// Returns the arguments of a system call at its exit, with those that
+// were filled in by the kernel decoded, or nil if the prototype of the
+// system call is unknown.  Called on the wait go routine.
+func (t *Tracee) decodeSyscallExit(ev SyscallExitEvent, entry syscallEntry) []string {
+	proto, ok := syscallPrototypes[ev.Name()]
+	if !ok || entry.decoded == nil {
+		return nil
+	}
+	dec := append([]string(nil), entry.decoded...)
+	if ev.Errno != 0 {
+		return dec
+	}
+	t.doInternal(func(r Raw) error {
+		d := argDecoder{r: r, limits: t.decodeLimits, name: ev.Name(), args: entry.args}
+		for i, k := range proto {
+			if k >= 'A' && k <= 'Z' {
+				dec[i] = d.arg(i, k, ev.Ret, true)
+			}
+		}
+		return nil
+	})
+	return dec
+}
+
+// An argDecoder formats the arguments of a system call.
+type argDecoder struct {
+	r      Raw
+	limits *DecodeLimits
+	name   string
+	args   [6]uint64
+}
+
+// Formats argument i of kind k.  Ret is the return value of the system
+// call, if exit is true; otherwise, arguments that are filled in by the
+// kernel are formatted as pointers.
+func (d argDecoder) arg(i int, k rune, ret int64, exit bool) string {
+	a := d.args[i]
+	if a == 0 && k != 'd' && k != 'u' && k != 'x' {
+		return "NULL"
+	}
+	if k >= 'A' && k <= 'Z' && !exit {
+		return pointer(a)
+	}
+	var next uint64
+	if i+1 < len(d.args) {
+		next = d.args[i+1]
+	}
+	switch k {
+	case 'd':
+		return strconv.Itoa(int(int32(a)))
+	case 'u':
+		return strconv.FormatUint(a, 10)
+	case 'x':
+		return "0x" + strconv.FormatUint(a, 16)
+	case 's':
+		return d.string(a)
+	case 'b':
+		return d.buffer(a, next)
+	case 'B':
+		return d.buffer(a, uint64(ret))
+	case 't', 'T':
+		return d.timespec(a)
+	case 'S':
+		return d.stat(a)
+	case 'v':
+		return d.iovecs(a, next, ^uint64(0))
+	case 'V':
+		return d.iovecs(a, next, uint64(ret))
+	case 'm':
+		return d.msghdr(a, ^uint64(0))
+	case 'M':
+		return d.msghdr(a, uint64(ret))
+	}
+	return pointer(a)
+}
+
+func pointer(a uint64) string {
+	return "0x" + strconv.FormatUint(a, 16)
+}
+
+// Formats the NUL-terminated string at addr.
+func (d argDecoder) string(addr uint64) string {
+	s, err := readStringLimit(d.r, addr, d.limits.MaxString+1)
+	if err != nil {
+		return pointer(addr)
+	}
+	if len(s) > d.limits.MaxString {
+		return strconv.Quote(s[:d.limits.MaxString]) + "..."
+	}
+	return strconv.Quote(s)
+}
+
+// Formats the n-byte buffer at addr.
+func (d argDecoder) buffer(addr, n uint64) string {
+	trunc := n > uint64(d.limits.MaxString)
+	if trunc {
+		n = uint64(d.limits.MaxString)
+	}
+	b := make([]byte, n)
+	if _, err := d.r.PeekData(uintptr(addr), b); err != nil {
+		return pointer(addr)
+	}
+	if trunc {
+		return strconv.Quote(string(b)) + "..."
+	}
+	return strconv.Quote(string(b))
+}
+
+// Reads n words at addr.
+func (d argDecoder) words(addr uint64, n int) ([]uint64, error) {
+	b := make([]byte, n*int(ptrSize))
+	if _, err := d.r.PeekData(uintptr(addr), b); err != nil {
+		return nil, err
+	}
+	ws := make([]uint64, n)
+	for i := range ws {
+		if ptrSize == 4 {
+			ws[i] = uint64(binary.NativeEndian.Uint32(b[4*i:]))
+		} else {
+			ws[i] = binary.NativeEndian.Uint64(b[8*i:])
+		}
+	}
+	return ws, nil
+}
+
+// Formats the struct timespec at addr, which has two word-sized fields.
+func (d argDecoder) timespec(addr uint64) string {
+	ws, err := d.words(addr, 2)
+	if err != nil {
+		return pointer(addr)
+	}
+	sec, nsec := int64(ws[0]), int64(ws[1])
+	if ptrSize == 4 {
+		sec, nsec = int64(int32(ws[0])), int64(int32(ws[1]))
+	}
+	return fmt.Sprintf("{tv_sec=%d, tv_nsec=%d}", sec, nsec)
+}
+
+// Formats the struct stat at addr.  On 32-bit architectures, only the
+// struct stat64 of the system calls with the 64 suffix is decoded, as
+// syscall.Stat_t.
+func (d argDecoder) stat(addr uint64) string {
+	if ptrSize == 4 && !strings.Contains(d.name, "64") {
+		return pointer(addr)
+	}
+	var st syscall.Stat_t
+	b := make([]byte, binary.Size(&st))
+	if _, err := d.r.PeekData(uintptr(addr), b); err != nil {
+		return pointer(addr)
+	}
+	if err := binary.Read(bytes.NewReader(b), binary.NativeEndian, &st); err != nil {
+		return pointer(addr)
+	}
+	mtime := time.Unix(int64(st.Mtim.Sec), int64(st.Mtim.Nsec)).UTC()
+	return fmt.Sprintf("{st_dev=%d, st_ino=%d, st_mode=%#o, st_nlink=%d, st_uid=%d, st_gid=%d, st_size=%d, st_mtime=%s}",
+		st.Dev, st.Ino, st.Mode, st.Nlink, st.Uid, st.Gid, st.Size, mtime.Format(time.RFC3339Nano))
+}
+
+// Formats the array of n struct iovecs at addr, showing at most max
+// bytes of their data.
+func (d argDecoder) iovecs(addr, n, max uint64) string {
+	var s strings.Builder
+	s.WriteByte('[')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			s.WriteString(", ")
+		}
+		if i == uint64(d.limits.MaxElements) {
+			s.WriteString("...")
+			break
+		}
+		ws, err := d.words(addr+2*ptrSize*i, 2)
+		if err != nil {
+			s.WriteString(pointer(addr + 2*ptrSize*i))
+			break
+		}
+		base, size := ws[0], ws[1]
+		data := size
+		if data > max {
+			data = max
+		}
+		max -= data
+		fmt.Fprintf(&s, "{iov_base=%s, iov_len=%d}", d.buffer(base, data), size)
+	}
+	s.WriteByte(']')
+	return s.String()
+}
+
+// Formats the struct msghdr at addr, showing at most max bytes of the
+// data of its iovecs.  Its fields are word-sized and word-aligned.
+func (d argDecoder) msghdr(addr, max uint64) string {
+	ws, err := d.words(addr, 7)
+	if err != nil {
+		return pointer(addr)
+	}
+	name, namelen, iov, iovlen, controllen, flags := ws[0], uint32(ws[1]), ws[2], ws[3], ws[5], int32(ws[6])
+	nameStr := "NULL"
+	if name != 0 {
+		nameStr = pointer(name)
+		if namelen > 0 && namelen <= sockaddrStorageSize {
+			b := make([]byte, namelen)
+			if _, err := d.r.PeekData(uintptr(name), b); err == nil && len(b) >= 2 {
+				if a := decodeSockaddr(b, syscall.SOCK_STREAM); a != nil {
+					nameStr = strconv.Quote(a.String())
+				}
+			}
+		}
+	}
+	return fmt.Sprintf("{msg_name=%s, msg_namelen=%d, msg_iov=%s, msg_iovlen=%d, msg_controllen=%d, msg_flags=%#x}",
+		nameStr, namelen, d.iovecs(iov, iovlen, max), iovlen, controllen, flags)
+}
@@ -0,0 +1,34 @@
+package ptrace
+
+import "syscall"
+
+// PTRACE_SYSEMU from <linux/ptrace.h>.
+const ptraceSysemu = 31
+
+// SysEmu continues the tracee until its next system call entry, at which
+// a SyscallEnterEvent is sent, as with Syscall, but the kernel does not
+// execute the system call, and there is no exit stop.  The tracer
+// emulates the system call instead: it applies the system call's
+// effects itself, for example with PokeData, and sets its return value
+// with SyscallStop.SetReturn or SetErrno at the entry stop, before
+// resuming the tracee.  If the return value is not set, the system call
+// returns whatever is in the return register at the entry: -ENOSYS on
+// x86, and the first argument on arm64.
+//
+// SysEmu is supported on 386, amd64, and arm64.
+func (t *Tracee) SysEmu() error {
+	return t.run("sysemu", func() error {
+		if !hasSysemu {
+			return errUnsupportedArch
+		}
+		emu := func() error {
+			if err := t.setOptions(syscall.PTRACE_O_TRACESYSGOOD); err != nil {
+				return err
+			}
+			t.sysemu = true
+			return ptrace(ptraceSysemu, t.proc.Pid, 0, 0)
+		}
+		t.signalResume = func(sig syscall.Signal) error { return ptrace(ptraceSysemu, t.proc.Pid, 0, uintptr(sig)) }
+		return t.resume(Running, t.overBreakpoint(emu, false))
+	})
+}
@@ -0,0 +1,90 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// Sets the system call number at a syscall-entry stop.
+func setSyscallNr(pid int, regs *syscall.PtraceRegs, nr int) error {
+	regs.Orig_eax = int32(nr)
+	return nil
+}
+
+// Sets the ith system call argument at a syscall-entry stop.
+func setSyscallArg(regs *syscall.PtraceRegs, i int, v uint64) error {
+	switch i {
+	case 0:
+		regs.Ebx = int32(v)
+	case 1:
+		regs.Ecx = int32(v)
+	case 2:
+		regs.Edx = int32(v)
+	case 3:
+		regs.Esi = int32(v)
+	case 4:
+		regs.Edi = int32(v)
+	case 5:
+		regs.Ebp = int32(v)
+	default:
+		return errBadSyscallArg
+	}
+	return nil
+}
+
+// Sets the system call return value at a syscall-exit stop.
+func setSyscallRet(regs *syscall.PtraceRegs, v uint64) error {
+	regs.Eax = int32(v)
+	return nil
+}
+
+// The instruction that makes a system call, and the AUDIT_ARCH value
+// that identifies i386 system calls to seccomp filters.
+var (
+	syscallInsn        = []byte{0xcd, 0x80}
+	auditArch   uint32 = 0x40000003
+)
+
+// Sets the registers to make the system call nr with the given
+// arguments when syscallInsn is executed.
+func setSyscallRegs(regs *syscall.PtraceRegs, nr int, args []uint64) error {
+	regs.Eax = int32(nr)
+	regs.Orig_eax = -1
+	for i, v := range args {
+		if err := setSyscallArg(regs, i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the raw return value of a system call made by syscallInsn.
+func syscallRet(regs *syscall.PtraceRegs) uint64 {
+	return uint64(int64(regs.Eax))
+}
+
+// Returns the stack pointer.
+func stackPointer(regs *syscall.PtraceRegs) uint64 {
+	return uint64(uint32(regs.Esp))
+}
+
+// Whether PTRACE_SYSEMU is supported on this architecture.
+const hasSysemu = true
+
+// Returns the thread pointer.  It is the base of the GS segment, which
+// is not in the registers.
+func threadPointer(r Raw) (uint64, error) {
+	return 0, errUnsupportedArch
+}
+
+const dtvOffset = 0
+
+// The names of the fields of syscall.PtraceRegs, in order, and other
+// names of some of them.
+var (
+	registerNames = []string{
+		"ebx", "ecx", "edx", "esi", "edi", "ebp", "eax", "ds",
+		"es", "fs", "gs", "orig_eax", "eip", "cs", "eflags", "esp",
+		"ss",
+	}
+	registerAliases = map[string]string{"pc": "eip", "sp": "esp", "fp": "ebp"}
+)
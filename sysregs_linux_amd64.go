@@ -0,0 +1,96 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// Sets the system call number at a syscall-entry stop.
+func setSyscallNr(pid int, regs *syscall.PtraceRegs, nr int) error {
+	regs.Orig_rax = uint64(nr)
+	return nil
+}
+
+// Sets the ith system call argument at a syscall-entry stop.
+func setSyscallArg(regs *syscall.PtraceRegs, i int, v uint64) error {
+	switch i {
+	case 0:
+		regs.Rdi = v
+	case 1:
+		regs.Rsi = v
+	case 2:
+		regs.Rdx = v
+	case 3:
+		regs.R10 = v
+	case 4:
+		regs.R8 = v
+	case 5:
+		regs.R9 = v
+	default:
+		return errBadSyscallArg
+	}
+	return nil
+}
+
+// Sets the system call return value at a syscall-exit stop.
+func setSyscallRet(regs *syscall.PtraceRegs, v uint64) error {
+	regs.Rax = v
+	return nil
+}
+
+// The instruction that makes a system call, and the AUDIT_ARCH value
+// that identifies x86-64 system calls to seccomp filters.
+var (
+	syscallInsn        = []byte{0x0f, 0x05}
+	auditArch   uint32 = 0xc000003e
+)
+
+// Sets the registers to make the system call nr with the given
+// arguments when syscallInsn is executed.
+func setSyscallRegs(regs *syscall.PtraceRegs, nr int, args []uint64) error {
+	regs.Rax = uint64(nr)
+	regs.Orig_rax = ^uint64(0)
+	for i, v := range args {
+		if err := setSyscallArg(regs, i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the raw return value of a system call made by syscallInsn.
+func syscallRet(regs *syscall.PtraceRegs) uint64 {
+	return regs.Rax
+}
+
+// Returns the stack pointer.
+func stackPointer(regs *syscall.PtraceRegs) uint64 {
+	return regs.Rsp
+}
+
+// Whether PTRACE_SYSEMU is supported on this architecture.
+const hasSysemu = true
+
+// Returns the thread pointer, the FS base.
+func threadPointer(r Raw) (uint64, error) {
+	var regs syscall.PtraceRegs
+	if err := r.GetRegs(&regs); err != nil {
+		return 0, err
+	}
+	return regs.Fs_base, nil
+}
+
+// The offset from the thread pointer of glibc's pointer to the dynamic
+// thread vector, the dtv field of tcbhead_t.
+const dtvOffset = 8
+
+// The names of the fields of syscall.PtraceRegs, in order, and other
+// names of some of them.
+var (
+	registerNames = []string{
+		"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10",
+		"r9", "r8", "rax", "rcx", "rdx", "rsi", "rdi", "orig_rax",
+		"rip", "cs", "eflags", "rsp", "ss", "fs_base", "gs_base", "ds",
+		"es", "fs", "gs",
+	}
+	registerAliases = map[string]string{"pc": "rip", "sp": "rsp", "fp": "rbp", "rflags": "eflags"}
+)
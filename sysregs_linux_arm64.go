@@ -0,0 +1,89 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"syscall"
+)
+
+// Sets the system call number at a syscall-entry stop.  The system call
+// number is not in the general purpose registers on arm64; it has its
+// own register set.
+func setSyscallNr(pid int, regs *syscall.PtraceRegs, nr int) error {
+	var b [4]byte
+	binary.NativeEndian.PutUint32(b[:], uint32(int32(nr)))
+	return setRegSet(pid, NTARMSystemCall, b[:])
+}
+
+// Sets the ith system call argument at a syscall-entry stop.
+func setSyscallArg(regs *syscall.PtraceRegs, i int, v uint64) error {
+	if i < 0 || i > 5 {
+		return errBadSyscallArg
+	}
+	regs.Regs[i] = v
+	return nil
+}
+
+// Sets the system call return value at a syscall-exit stop.
+func setSyscallRet(regs *syscall.PtraceRegs, v uint64) error {
+	regs.Regs[0] = v
+	return nil
+}
+
+// The instruction that makes a system call, and the AUDIT_ARCH value
+// that identifies AArch64 system calls to seccomp filters.
+var (
+	syscallInsn        = []byte{0x01, 0x00, 0x00, 0xd4}
+	auditArch   uint32 = 0xc00000b7
+)
+
+// Sets the registers to make the system call nr with the given
+// arguments when syscallInsn is executed.
+func setSyscallRegs(regs *syscall.PtraceRegs, nr int, args []uint64) error {
+	regs.Regs[8] = uint64(nr)
+	for i, v := range args {
+		if err := setSyscallArg(regs, i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the raw return value of a system call made by syscallInsn.
+func syscallRet(regs *syscall.PtraceRegs) uint64 {
+	return regs.Regs[0]
+}
+
+// Returns the stack pointer.
+func stackPointer(regs *syscall.PtraceRegs) uint64 {
+	return regs.Sp
+}
+
+// Whether PTRACE_SYSEMU is supported on this architecture.
+const hasSysemu = true
+
+// Returns the thread pointer, TPIDR_EL0.
+func threadPointer(r Raw) (uint64, error) {
+	var b [8]byte
+	if _, err := r.GetRegSet(NTARMTLS, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.NativeEndian.Uint64(b[:]), nil
+}
+
+// The offset from the thread pointer of glibc's pointer to the dynamic
+// thread vector, the dtv field of tcbhead_t, which the thread pointer
+// points to.
+const dtvOffset = 0
+
+// The names of the fields of syscall.PtraceRegs, in order, and other
+// names of some of them.
+var (
+	registerNames = []string{
+		"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7",
+		"x8", "x9", "x10", "x11", "x12", "x13", "x14", "x15",
+		"x16", "x17", "x18", "x19", "x20", "x21", "x22", "x23",
+		"x24", "x25", "x26", "x27", "x28", "x29", "x30", "sp",
+		"pc", "pstate",
+	}
+	registerAliases = map[string]string{"fp": "x29", "lr": "x30"}
+)
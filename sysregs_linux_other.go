@@ -0,0 +1,49 @@
+//go:build linux && !amd64 && !386 && !arm64 && !riscv64
+
+package ptrace
+
+import (
+	"syscall"
+)
+
+func setSyscallNr(pid int, regs *syscall.PtraceRegs, nr int) error {
+	return errUnsupportedArch
+}
+
+func setSyscallArg(regs *syscall.PtraceRegs, i int, v uint64) error {
+	return errUnsupportedArch
+}
+
+func setSyscallRet(regs *syscall.PtraceRegs, v uint64) error {
+	return errUnsupportedArch
+}
+
+var (
+	syscallInsn []byte
+	auditArch   uint32
+)
+
+func setSyscallRegs(regs *syscall.PtraceRegs, nr int, args []uint64) error {
+	return errUnsupportedArch
+}
+
+func syscallRet(regs *syscall.PtraceRegs) uint64 {
+	return 0
+}
+
+func stackPointer(regs *syscall.PtraceRegs) uint64 {
+	return 0
+}
+
+const hasSysemu = false
+
+func threadPointer(r Raw) (uint64, error) {
+	return 0, errUnsupportedArch
+}
+
+const dtvOffset = 0
+
+var (
+	registerNames   []string
+	registerAliases map[string]string
+)
@@ -0,0 +1,102 @@
+package ptrace
+
+import (
+	"syscall"
+)
+
+// Sets the system call number at a syscall-entry stop.
+func setSyscallNr(pid int, regs *syscall.PtraceRegs, nr int) error {
+	regs.A7 = uint64(nr)
+	return nil
+}
+
+// Sets the ith system call argument at a syscall-entry stop.
+func setSyscallArg(regs *syscall.PtraceRegs, i int, v uint64) error {
+	switch i {
+	case 0:
+		regs.A0 = v
+	case 1:
+		regs.A1 = v
+	case 2:
+		regs.A2 = v
+	case 3:
+		regs.A3 = v
+	case 4:
+		regs.A4 = v
+	case 5:
+		regs.A5 = v
+	default:
+		return errBadSyscallArg
+	}
+	return nil
+}
+
+// Sets the system call return value at a syscall-exit stop.
+func setSyscallRet(regs *syscall.PtraceRegs, v uint64) error {
+	regs.A0 = v
+	return nil
+}
+
+// The instruction that makes a system call, and the AUDIT_ARCH value
+// that identifies RISC-V system calls to seccomp filters.
+var (
+	syscallInsn        = []byte{0x73, 0x00, 0x00, 0x00}
+	auditArch   uint32 = 0xc00000f3
+)
+
+// Sets the registers to make the system call nr with the given
+// arguments when syscallInsn is executed.
+func setSyscallRegs(regs *syscall.PtraceRegs, nr int, args []uint64) error {
+	regs.A7 = uint64(nr)
+	for i, v := range args {
+		if err := setSyscallArg(regs, i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the raw return value of a system call made by syscallInsn.
+func syscallRet(regs *syscall.PtraceRegs) uint64 {
+	return regs.A0
+}
+
+// Returns the stack pointer.
+func stackPointer(regs *syscall.PtraceRegs) uint64 {
+	return regs.Sp
+}
+
+// Whether PTRACE_SYSEMU is supported on this architecture.
+const hasSysemu = false
+
+// Returns the thread pointer, tp.
+func threadPointer(r Raw) (uint64, error) {
+	var regs syscall.PtraceRegs
+	if err := r.GetRegs(&regs); err != nil {
+		return 0, err
+	}
+	return regs.Tp, nil
+}
+
+// The offset from the thread pointer of glibc's pointer to the dynamic
+// thread vector, the dtv field of tcbhead_t, which ends at the thread
+// pointer.
+const dtvOffset = -16
+
+// The names of the fields of syscall.PtraceRegs, in order, which are the
+// ABI names of the registers, and other names of them.
+var (
+	registerNames = []string{
+		"pc", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+		"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+		"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+		"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+	}
+	registerAliases = map[string]string{
+		"x1": "ra", "x2": "sp", "x3": "gp", "x4": "tp", "x5": "t0", "x6": "t1", "x7": "t2",
+		"x8": "s0", "fp": "s0", "x9": "s1", "x10": "a0", "x11": "a1", "x12": "a2", "x13": "a3",
+		"x14": "a4", "x15": "a5", "x16": "a6", "x17": "a7", "x18": "s2", "x19": "s3", "x20": "s4",
+		"x21": "s5", "x22": "s6", "x23": "s7", "x24": "s8", "x25": "s9", "x26": "s10", "x27": "s11",
+		"x28": "t3", "x29": "t4", "x30": "t5", "x31": "t6",
+	}
+)
@@ -0,0 +1,125 @@
+package ptrace
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	errNotSyscallStop  = errors.New("ptrace: tracee is not at a system call stop")
+	errNotSyscallEntry = errors.New("ptrace: tracee is not at a system call entry")
+	errNotSyscallExit  = errors.New("ptrace: tracee is not at a system call exit")
+)
+
+// A SyscallStop modifies the system call at which the tracee is stopped.
+// It is only valid until the tracee is resumed.
+type SyscallStop struct {
+	t *Tracee
+	// Do runs the stop's commands on the tracer thread, as Tracee.Do.
+	do func(func(Raw) error) error
+	// Entry is whether the tracee is stopped at the system call
+	// entry, or at a seccomp stop, rather than its exit.
+	Entry bool
+	// Nr is the system call number, if Entry is true.
+	Nr int
+	// Emulated is whether the tracee is stopped at the entry of a
+	// system call that is emulated by the tracer, after SysEmu.
+	Emulated bool
+}
+
+// SyscallStop returns a SyscallStop for the system call entry or exit at
+// which the tracee is stopped.
+func (t *Tracee) SyscallStop() (*SyscallStop, error) {
+	return t.syscallStop(t.Do)
+}
+
+// Returns a SyscallStop as SyscallStop, whose commands, including its
+// own, are run with do: Do for the user's, and doInternal for the
+// tracer's own, from the wait go routine.
+func (t *Tracee) syscallStop(do func(func(Raw) error) error) (*SyscallStop, error) {
+	var info syscallInfo
+	var emulated bool
+	err := do(func(r Raw) error {
+		if t.State() != SyscallStopped {
+			return errNotSyscallStop
+		}
+		emulated = t.sysemu
+		return getSyscallInfo(r.Pid(), &info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch info.op {
+	case syscallInfoEntry:
+		return &SyscallStop{t: t, do: do, Entry: true, Nr: int(info.data[0]), Emulated: emulated}, nil
+	case syscallInfoSeccomp:
+		return &SyscallStop{t: t, do: do, Entry: true, Nr: int(info.data[0])}, nil
+	case syscallInfoExit:
+		return &SyscallStop{t: t, do: do, Nr: -1}, nil
+	}
+	return nil, errNotSyscallStop
+}
+
+// SetNr changes the system call to be executed.  It may only be called
+// at a system call entry.  Setting the number to -1 skips the system
+// call; it then returns -ENOSYS unless the return value is changed at
+// its exit.
+func (s *SyscallStop) SetNr(nr int) error {
+	if !s.Entry {
+		return errNotSyscallEntry
+	}
+	err := s.modify(func(r Raw, regs *syscall.PtraceRegs) error {
+		return setSyscallNr(r.Pid(), regs, nr)
+	})
+	if err == nil {
+		s.Nr = nr
+	}
+	return err
+}
+
+// SetArg changes the ith argument, counting from 0, of the system call
+// to be executed.  It may only be called at a system call entry.
+func (s *SyscallStop) SetArg(i int, v uint64) error {
+	if !s.Entry {
+		return errNotSyscallEntry
+	}
+	return s.modify(func(_ Raw, regs *syscall.PtraceRegs) error {
+		return setSyscallArg(regs, i, v)
+	})
+}
+
+// SetReturn changes the value returned by the system call.  It may only
+// be called at a system call exit, or at the entry of an emulated system
+// call.
+func (s *SyscallStop) SetReturn(v int64) error {
+	if s.Entry && !s.Emulated {
+		return errNotSyscallExit
+	}
+	return s.modify(func(_ Raw, regs *syscall.PtraceRegs) error {
+		return setSyscallRet(regs, uint64(v))
+	})
+}
+
+// SetErrno makes the system call fail with the given error.  It may only
+// be called at a system call exit, or at the entry of an emulated system
+// call.
+func (s *SyscallStop) SetErrno(errno syscall.Errno) error {
+	return s.SetReturn(-int64(errno))
+}
+
+// Modifies the tracee's registers in a single trip to the tracer thread.
+func (s *SyscallStop) modify(f func(Raw, *syscall.PtraceRegs) error) error {
+	return s.do(func(r Raw) error {
+		if s.t.State() != SyscallStopped {
+			return errNotSyscallStop
+		}
+		var regs syscall.PtraceRegs
+		if err := r.GetRegs(&regs); err != nil {
+			return err
+		}
+		if err := f(r, &regs); err != nil {
+			return err
+		}
+		return r.SetRegs(&regs)
+	})
+}
@@ -0,0 +1,223 @@
+package ptrace
+
+import (
+	"bytes"
+	"sync"
+)
+
+// An IOFilter transforms data that the tracee reads or writes on a file
+// descriptor.  The returned slice must have the same length as data;
+// otherwise, the data is left unchanged.
+type IOFilter func(fd int, data []byte) []byte
+
+// The maximum number of bytes filtered by a single read or write.
+const maxFilterSize = 1 << 20
+
+// WithReadFilter filters the data returned by the read(2) calls of a
+// tracee resumed with Syscall.  The filter is applied to the bytes
+// actually read, at the system call exit.
+func WithReadFilter(f IOFilter) Option {
+	return func(t *Tracee) {
+		t.tamperer().read = f
+	}
+}
+
+// WithWriteFilter filters the data written by the write(2) calls of a
+// tracee resumed with Syscall.  The filtered data is substituted into
+// the tracee's buffer at the system call entry, and the original data
+// is restored at the exit, so the tracee never observes the change.  If
+// the original data cannot be restored, the tracer is broken, and every
+// later command returns ErrBroken.
+//
+// If a write is short or fails, for example with EINTR, the filtered
+// bytes that were not written are kept, and if the tracee's next write
+// on the same descriptor retries the unwritten bytes, they are
+// substituted again without calling the filter a second time.  This
+// keeps the written stream byte-accurate for stateful filters.
+func WithWriteFilter(f IOFilter) Option {
+	return func(t *Tracee) {
+		t.tamperer().write = f
+	}
+}
+
+// TamperStats are statistics about data substituted by IOFilters.
+type TamperStats struct {
+	// BytesRead and BytesWritten are the number of filtered bytes
+	// that were read and written by the tracee.
+	BytesRead, BytesWritten uint64
+	// ShortWrites is the number of filtered writes that wrote fewer
+	// bytes than requested, or failed.
+	ShortWrites uint64
+	// Retries is the number of writes that retried unwritten,
+	// filtered bytes.
+	Retries uint64
+	// Dropped is the number of filtered bytes that were never
+	// written, because the tracee did not retry them.
+	Dropped uint64
+}
+
+// TamperStats returns statistics about the data substituted by the
+// tracee's IOFilters.
+func (t *Tracee) TamperStats() TamperStats {
+	if t.tamper == nil {
+		return TamperStats{}
+	}
+	t.tamper.mu.Lock()
+	defer t.tamper.mu.Unlock()
+	return t.tamper.stats
+}
+
+type tamper struct {
+	read, write IOFilter
+
+	// Enter is the pending system call entry, and orig and subst are
+	// the original and substituted bytes of its buffer, if any.
+	enter       SyscallEnterEvent
+	orig, subst []byte
+	// Unwritten holds the original and filtered bytes that were not
+	// written by the last write on each descriptor.
+	unwritten map[int]unwritten
+
+	// Peek and poke access the tracee's memory.
+	peek, poke func(addr uintptr, data []byte) (int, error)
+	// Fail is called with the error of restoring the original bytes
+	// of a write, which leaves the substituted bytes in the tracee's
+	// buffer.
+	fail func(error)
+
+	mu    sync.Mutex
+	stats TamperStats
+}
+
+type unwritten struct {
+	orig, subst []byte
+}
+
+// Returns the tracee's tamper, creating it if needed.
+func (t *Tracee) tamperer() *tamper {
+	if t.tamper == nil {
+		t.tamper = &tamper{
+			unwritten: make(map[int]unwritten),
+			peek:      t.peekInternal,
+			poke:      t.pokeInternal,
+			fail:      func(err error) { t.breakTracer("tamper", err) },
+		}
+		t.observers = append(t.observers, t.tamper.observe)
+	}
+	return t.tamper
+}
+
+// Called on the wait go routine.
+func (tp *tamper) observe(ev Event) {
+	switch ev := ev.(type) {
+	case ExecEvent:
+		clear(tp.unwritten)
+	case SyscallEnterEvent:
+		tp.enter = ev
+		tp.orig, tp.subst = nil, nil
+		if tp.write != nil && ev.Name() == "write" {
+			tp.enterWrite(ev)
+		}
+	case SyscallExitEvent:
+		if ev.Nr < 0 || ev.Nr != tp.enter.Nr {
+			return
+		}
+		switch ev.Name() {
+		case "write":
+			tp.exitWrite(ev)
+		case "read":
+			if tp.read != nil {
+				tp.exitRead(ev)
+			}
+		}
+	}
+}
+
+func (tp *tamper) enterWrite(ev SyscallEnterEvent) {
+	fd, addr, n := int(ev.Args[0]), uintptr(ev.Args[1]), ev.Args[2]
+	if n == 0 || n > maxFilterSize {
+		return
+	}
+	orig := make([]byte, n)
+	if _, err := tp.peek(addr, orig); err != nil {
+		return
+	}
+	var subst []byte
+	if u, ok := tp.unwritten[fd]; ok {
+		delete(tp.unwritten, fd)
+		if bytes.HasPrefix(orig, u.orig) {
+			tp.addStats(func(s *TamperStats) { s.Retries++ })
+			subst = append(subst, u.subst...)
+		} else {
+			tp.addStats(func(s *TamperStats) { s.Dropped += uint64(len(u.subst)) })
+		}
+	}
+	if rest := orig[len(subst):]; len(rest) > 0 {
+		if f := tp.write(fd, append([]byte(nil), rest...)); len(f) == len(rest) {
+			subst = append(subst, f...)
+		} else {
+			subst = append(subst, rest...)
+		}
+	}
+	if !bytes.Equal(orig, subst) {
+		if _, err := tp.poke(addr, subst); err != nil {
+			return
+		}
+	}
+	tp.orig, tp.subst = orig, subst
+}
+
+func (tp *tamper) exitWrite(ev SyscallExitEvent) {
+	if tp.orig == nil {
+		return
+	}
+	fd, addr := int(tp.enter.Args[0]), uintptr(tp.enter.Args[1])
+	if !bytes.Equal(tp.orig, tp.subst) {
+		if _, err := tp.poke(addr, tp.orig); err != nil {
+			tp.fail(err)
+		}
+	}
+	// A negative return, including the kernel's internal restart
+	// errors, means that nothing was written.
+	n := ev.Ret
+	if n < 0 {
+		n = 0
+	}
+	if n > int64(len(tp.orig)) {
+		n = int64(len(tp.orig))
+	}
+	tp.addStats(func(s *TamperStats) {
+		s.BytesWritten += uint64(n)
+		if n < int64(len(tp.orig)) {
+			s.ShortWrites++
+		}
+	})
+	if n < int64(len(tp.orig)) {
+		tp.unwritten[fd] = unwritten{orig: tp.orig[n:], subst: tp.subst[n:]}
+	}
+	tp.orig, tp.subst = nil, nil
+}
+
+func (tp *tamper) exitRead(ev SyscallExitEvent) {
+	fd, addr := int(tp.enter.Args[0]), uintptr(tp.enter.Args[1])
+	if ev.Ret <= 0 || ev.Ret > maxFilterSize {
+		return
+	}
+	data := make([]byte, ev.Ret)
+	if _, err := tp.peek(addr, data); err != nil {
+		return
+	}
+	f := tp.read(fd, append([]byte(nil), data...))
+	if len(f) != len(data) || bytes.Equal(f, data) {
+		return
+	}
+	if _, err := tp.poke(addr, f); err == nil {
+		tp.addStats(func(s *TamperStats) { s.BytesRead += uint64(len(f)) })
+	}
+}
+
+func (tp *tamper) addStats(f func(*TamperStats)) {
+	tp.mu.Lock()
+	f(&tp.stats)
+	tp.mu.Unlock()
+}
@@ -0,0 +1,225 @@
+package ptrace
+
+import (
+	"syscall"
+	"testing"
+)
+
+// A fake tracee memory for a tamper: a single buffer at bufAddr.
+type tamperMem struct {
+	buf []byte
+}
+
+const bufAddr = 0x1000
+
+func (m *tamperMem) peek(addr uintptr, data []byte) (int, error) {
+	off := int(addr - bufAddr)
+	if off < 0 || off+len(data) > len(m.buf) {
+		return 0, syscall.EIO
+	}
+	return copy(data, m.buf[off:]), nil
+}
+
+func (m *tamperMem) poke(addr uintptr, data []byte) (int, error) {
+	off := int(addr - bufAddr)
+	if off < 0 || off+len(data) > len(m.buf) {
+		return 0, syscall.EIO
+	}
+	return copy(m.buf[off:], data), nil
+}
+
+// A stateful filter that replaces each byte with its position in the
+// filtered stream, so that a byte filtered twice, or skipped, shows in
+// the output.
+func countingFilter(calls *int) IOFilter {
+	var next byte
+	return func(fd int, data []byte) []byte {
+		*calls++
+		for i := range data {
+			data[i] = 'a' + next
+			next++
+		}
+		return data
+	}
+}
+
+func syscallNr(tb testing.TB, name string) int {
+	nr, ok := SyscallNumber(name)
+	if !ok {
+		tb.Skipf("no %s system call", name)
+	}
+	return nr
+}
+
+func TestTamperWrites(t *testing.T) {
+	type write struct {
+		// Data is the tracee's buffer, and ret is the return of the
+		// write, which writes that many bytes of the buffer as
+		// substituted.
+		data string
+		ret  int64
+	}
+	tests := []struct {
+		name   string
+		writes []write
+		// Out is the data written, and calls is the number of
+		// calls of the filter.
+		out   string
+		calls int
+		stats TamperStats
+	}{
+		{
+			name:   "full",
+			writes: []write{{"xxxx", 4}, {"xx", 2}},
+			out:    "abcdef",
+			calls:  2,
+			stats:  TamperStats{BytesWritten: 6},
+		},
+		{
+			name:   "short then retried",
+			writes: []write{{"xxxxxx", 2}, {"xxxx", 4}},
+			out:    "abcdef",
+			calls:  1,
+			stats:  TamperStats{BytesWritten: 6, ShortWrites: 1, Retries: 1},
+		},
+		{
+			name:   "short retry with more data",
+			writes: []write{{"xxxx", 1}, {"xxxyy", 5}},
+			out:    "abcdef",
+			calls:  2,
+			stats:  TamperStats{BytesWritten: 6, ShortWrites: 1, Retries: 1},
+		},
+		{
+			name:   "EINTR then retried",
+			writes: []write{{"xxxx", -int64(syscall.EINTR)}, {"xxxx", 4}},
+			out:    "abcd",
+			calls:  1,
+			stats:  TamperStats{BytesWritten: 4, ShortWrites: 1, Retries: 1},
+		},
+		{
+			name:   "ERESTARTSYS then retried",
+			writes: []write{{"xxxx", -512}, {"xxxx", 4}},
+			out:    "abcd",
+			calls:  1,
+			stats:  TamperStats{BytesWritten: 4, ShortWrites: 1, Retries: 1},
+		},
+		{
+			name:   "repeated short writes",
+			writes: []write{{"xxxxxx", 1}, {"xxxxx", 2}, {"xxx", 0}, {"xxx", 3}},
+			out:    "abcdef",
+			calls:  1,
+			stats:  TamperStats{BytesWritten: 6, ShortWrites: 3, Retries: 3},
+		},
+		{
+			name:   "unwritten bytes dropped",
+			writes: []write{{"xxxx", 2}, {"yy", 2}},
+			out:    "abef",
+			calls:  2,
+			stats:  TamperStats{BytesWritten: 4, ShortWrites: 1, Dropped: 2},
+		},
+		{
+			name:   "failed write dropped",
+			writes: []write{{"xxxx", -int64(syscall.EBADF)}, {"yy", 2}},
+			out:    "ef",
+			calls:  2,
+			stats:  TamperStats{BytesWritten: 2, ShortWrites: 1, Dropped: 4},
+		},
+	}
+	writeNr := syscallNr(t, "write")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			mem := &tamperMem{}
+			tp := &tamper{
+				write:     countingFilter(&calls),
+				unwritten: make(map[int]unwritten),
+				peek:      mem.peek,
+				poke:      mem.poke,
+				fail:      func(err error) { t.Errorf("restore failed: %v", err) },
+			}
+			var out []byte
+			for _, w := range test.writes {
+				mem.buf = []byte(w.data)
+				enter := SyscallEnterEvent{Nr: writeNr, Args: [6]uint64{1, bufAddr, uint64(len(w.data))}}
+				tp.observe(enter)
+				if w.ret > 0 {
+					out = append(out, mem.buf[:w.ret]...)
+				}
+				tp.observe(SyscallExitEvent{Nr: writeNr, Ret: w.ret})
+				if string(mem.buf) != w.data {
+					t.Errorf("buffer after write: got %q, want %q", mem.buf, w.data)
+				}
+			}
+			if string(out) != test.out {
+				t.Errorf("written: got %q, want %q", out, test.out)
+			}
+			if calls != test.calls {
+				t.Errorf("filter calls: got %d, want %d", calls, test.calls)
+			}
+			if tp.stats != test.stats {
+				t.Errorf("stats: got %+v, want %+v", tp.stats, test.stats)
+			}
+		})
+	}
+}
+
+func TestTamperRestoreFails(t *testing.T) {
+	writeNr := syscallNr(t, "write")
+	var calls int
+	var failed error
+	mem := &tamperMem{buf: []byte("xxxx")}
+	tp := &tamper{
+		write:     countingFilter(&calls),
+		unwritten: make(map[int]unwritten),
+		peek:      mem.peek,
+		poke:      mem.poke,
+		fail:      func(err error) { failed = err },
+	}
+	tp.observe(SyscallEnterEvent{Nr: writeNr, Args: [6]uint64{1, bufAddr, 4}})
+	// The buffer can no longer be written in full.
+	mem.buf = mem.buf[:2]
+	tp.observe(SyscallExitEvent{Nr: writeNr, Ret: 4})
+	if failed != syscall.EIO {
+		t.Errorf("got failure %v, want %v", failed, syscall.EIO)
+	}
+}
+
+func TestTamperReads(t *testing.T) {
+	tests := []struct {
+		name string
+		// Data is the data read into the tracee's buffer, and ret
+		// is the return of the read.
+		data string
+		ret  int64
+		want string
+		read uint64
+	}{
+		{name: "full", data: "xxxx", ret: 4, want: "abcd", read: 4},
+		{name: "short", data: "xxxx", ret: 2, want: "abxx", read: 2},
+		{name: "EOF", data: "xxxx", ret: 0, want: "xxxx"},
+		{name: "EINTR", data: "xxxx", ret: -int64(syscall.EINTR), want: "xxxx"},
+	}
+	readNr := syscallNr(t, "read")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			mem := &tamperMem{buf: make([]byte, len(test.data))}
+			tp := &tamper{
+				read:      countingFilter(&calls),
+				unwritten: make(map[int]unwritten),
+				peek:      mem.peek,
+				poke:      mem.poke,
+				fail:      func(err error) { t.Errorf("restore failed: %v", err) },
+			}
+			tp.observe(SyscallEnterEvent{Nr: readNr, Args: [6]uint64{0, bufAddr, uint64(len(test.data))}})
+			copy(mem.buf, test.data)
+			tp.observe(SyscallExitEvent{Nr: readNr, Ret: test.ret})
+			if string(mem.buf) != test.want {
+				t.Errorf("buffer: got %q, want %q", mem.buf, test.want)
+			}
+			if tp.stats.BytesRead != test.read {
+				t.Errorf("BytesRead: got %d, want %d", tp.stats.BytesRead, test.read)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package ptrace
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Ptrace requests that the syscall package does not define.
+const (
+	ptraceSeize     = 0x4206
+	ptraceInterrupt = 0x4207
+)
+
+// A Thread is a thread of the tracee's process.
+type Thread struct {
+	TID int
+	// Name is the thread's name, from /proc/pid/task/tid/comm.
+	Name string
+}
+
+// ThreadRegs are the registers of a thread, from SnapshotAllRegs.
+type ThreadRegs struct {
+	Thread
+	Regs syscall.PtraceRegs
+}
+
+// Threads returns the threads of the tracee's process, sorted by TID.
+// Only the thread that was started, whose TID is the process ID, is
+// traced.  Threads can start and exit at any time, so the list may be
+// out of date by the time it is returned, unless the process is stopped
+// by StopAll.
+func (t *Tracee) Threads() ([]*Thread, error) {
+	dir := "/proc/" + strconv.Itoa(t.proc.Pid) + "/task"
+	tids, err := listTasks(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ts []*Thread
+	for _, tid := range tids {
+		b, err := os.ReadFile(dir + "/" + strconv.Itoa(tid) + "/comm")
+		if err != nil {
+			// The thread exited.
+			continue
+		}
+		ts = append(ts, &Thread{TID: tid, Name: strings.TrimSuffix(string(b), "\n")})
+	}
+	return ts, nil
+}
+
+// Returns the sorted IDs of the entries of a /proc/pid/task directory,
+// or of /proc itself.
+func listTasks(dir string) ([]int, error) {
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var tids []int
+	for _, e := range es {
+		if tid, err := strconv.Atoi(e.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	sort.Ints(tids)
+	return tids, nil
+}
+
+// SnapshotAllRegs returns the registers of every thread of the stopped
+// tracee's process, sorted by TID, with every thread stopped together.
+// The threads other than the traced thread are attached with
+// PTRACE_SEIZE and interrupted until no new threads appear, their
+// registers are read, and they are detached, so they stop only briefly
+// and are not otherwise disturbed.  Threads held by StopAll stay
+// stopped.  A thread that exits meanwhile is omitted.
+func (t *Tracee) SnapshotAllRegs() ([]ThreadRegs, error) {
+	var regs []ThreadRegs
+	err := t.run("snapshotregs", func() error {
+		if err := t.requireStopped(); err != nil {
+			return err
+		}
+		stopped, err := t.seizeThreads()
+		defer releaseThreads(stopped)
+		if err != nil {
+			return err
+		}
+		pid := t.proc.Pid
+		tids := append([]int{pid}, t.held...)
+		tids = append(tids, stopped...)
+		sort.Ints(tids)
+		dir := "/proc/" + strconv.Itoa(pid) + "/task"
+		for _, tid := range tids {
+			tr := ThreadRegs{Thread: Thread{TID: tid}}
+			if err := ptraceGetRegs(tid, &tr.Regs); err != nil {
+				if tid == pid {
+					return err
+				}
+				continue
+			}
+			if b, err := os.ReadFile(dir + "/" + strconv.Itoa(tid) + "/comm"); err == nil {
+				tr.Name = strings.TrimSuffix(string(b), "\n")
+			}
+			regs = append(regs, tr)
+		}
+		return nil
+	})
+	return regs, err
+}
+
+// StopAll stops the traced thread, as by Stop, and every other thread
+// of the tracee's process, and holds them stopped until ResumeAll.  The
+// other threads are attached with PTRACE_SEIZE and interrupted until no
+// new threads appear, so that a thread cloned meanwhile is stopped too;
+// a thread that exits meanwhile is skipped.  Calling StopAll again stops
+// threads started since.  The held threads are not traced, and report
+// no events; they are released if the tracer exits, but not by Detach,
+// so ResumeAll must be called before detaching.
+func (t *Tracee) StopAll(ctx context.Context) error {
+	if _, err := t.Stop(ctx); err != nil {
+		return err
+	}
+	return t.run("stopall", func() error {
+		if err := t.requireStopped(); err != nil {
+			return err
+		}
+		stopped, err := t.seizeThreads()
+		t.held = append(t.held, stopped...)
+		return err
+	})
+}
+
+// ResumeAll resumes the threads held by StopAll, and continues the
+// traced thread, as by Continue, if it is stopped.
+func (t *Tracee) ResumeAll() error {
+	err := t.run("resumeall", func() error {
+		releaseThreads(t.held)
+		t.held = nil
+		return nil
+	})
+	if err != nil || !t.State().IsStopped() {
+		return err
+	}
+	return t.Continue()
+}
+
+// Seizes and interrupts the threads of the process other than the
+// traced thread and the held threads, until no new threads appear, and
+// returns the TIDs of those that stopped.  Threads may clone new threads
+// until they are stopped, and may exit at any time.  Must be called on
+// the tracer thread.
+func (t *Tracee) seizeThreads() ([]int, error) {
+	dir := "/proc/" + strconv.Itoa(t.proc.Pid) + "/task"
+	seized := map[int]bool{t.proc.Pid: true}
+	for _, tid := range t.held {
+		seized[tid] = true
+	}
+	var stopped []int
+	for {
+		tids, err := listTasks(dir)
+		if err != nil {
+			return stopped, err
+		}
+		var fresh []int
+		for _, tid := range tids {
+			if seized[tid] {
+				continue
+			}
+			seized[tid] = true
+			if err := ptrace(ptraceSeize, tid, 0, 0); err != nil {
+				// The thread exited.
+				continue
+			}
+			if err := ptrace(ptraceInterrupt, tid, 0, 0); err != nil {
+				ptraceDetach(tid)
+				continue
+			}
+			fresh = append(fresh, tid)
+		}
+		if len(fresh) == 0 {
+			return stopped, nil
+		}
+		for _, tid := range fresh {
+			if ws, err := waitPid(tid); err == nil && ws.Stopped() {
+				stopped = append(stopped, tid)
+			}
+		}
+	}
+}
+
+// Detaches the seized threads, resuming them.  Must be called on the
+// tracer thread.
+func releaseThreads(tids []int) {
+	for _, tid := range tids {
+		ptraceDetach(tid)
+	}
+}
+
+// Issues a ptrace request, retrying it if it is interrupted by a signal.
+func ptrace(req int, pid int, addr, data uintptr) error {
+	for {
+		_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(req), uintptr(pid), addr, data, 0, 0)
+		switch e {
+		case 0:
+			return nil
+		case syscall.EINTR:
+			continue
+		}
+		return e
+	}
+}
+
+// Issues a ptrace request whose data is a pointer, as ptrace.  Data is
+// converted in the call itself, so that the memory it points to stays
+// in place until the call returns.
+func ptracePtr(req int, pid int, addr uintptr, data unsafe.Pointer) error {
+	for {
+		_, _, e := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(req), uintptr(pid), addr, uintptr(data), 0, 0)
+		switch e {
+		case 0:
+			return nil
+		case syscall.EINTR:
+			continue
+		}
+		return e
+	}
+}
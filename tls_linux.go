@@ -0,0 +1,75 @@
+package ptrace
+
+import "errors"
+
+var (
+	errNoTLSModule    = errors.New("ptrace: no such thread-local storage module")
+	errTLSUnallocated = errors.New("ptrace: thread-local storage block is not allocated")
+)
+
+// ThreadPointer returns the stopped tracee's thread pointer, which
+// locates its thread-local storage: the FS base on amd64, TPIDR_EL0 on
+// arm64, and tp on riscv64.  On amd64, the FS and GS bases are also the
+// Fs_base and Gs_base fields of the registers of GetRegs, and may be
+// changed with SetRegs.
+func (t *Tracee) ThreadPointer() (uint64, error) {
+	var tp uint64
+	err := t.Do(func(r Raw) (err error) {
+		tp, err = threadPointer(r)
+		return err
+	})
+	return tp, err
+}
+
+// TLSAddr returns the address of the thread-local variable at offset in
+// the TLS block of the module modid, for the stopped tracee's thread.
+// The module ID is l_tls_modid of the module's link_map, as in the
+// DTPMOD relocations of the variable; the executable, if it has a TLS
+// block, is module 1.  The address is found through glibc's dynamic
+// thread vector, so only tracees using glibc are supported.  The block
+// of a module loaded by dlopen is allocated by the thread's first access
+// to it; until then, TLSAddr fails.
+func (t *Tracee) TLSAddr(modid int, offset uint64) (uint64, error) {
+	var addr uint64
+	err := t.Do(func(r Raw) error {
+		tp, err := threadPointer(r)
+		if err != nil {
+			return err
+		}
+		dtv, err := readPtr(r, uint64(int64(tp)+dtvOffset))
+		if err != nil {
+			return err
+		}
+		// Each entry of the vector is a struct dtv_pointer of two
+		// words, the first of which is the block's address.  The
+		// entry before the first holds the number of entries.
+		n, err := readPtr(r, dtv-2*ptrSize)
+		if err != nil {
+			return err
+		}
+		if modid < 1 || uint64(modid) > n {
+			return errNoTLSModule
+		}
+		block, err := readPtr(r, dtv+uint64(modid)*2*ptrSize)
+		if err != nil {
+			return err
+		}
+		if block == 0 || block == ^uint64(0)>>(64-8*ptrSize) {
+			return errTLSUnallocated
+		}
+		addr = block + offset
+		return nil
+	})
+	return addr, err
+}
+
+// ReadTLS reads the thread-local variable at offset in the TLS block of
+// the module modid, as located by TLSAddr, into b.
+func (t *Tracee) ReadTLS(modid int, offset uint64, b []byte) error {
+	addr, err := t.TLSAddr(modid, offset)
+	if err != nil {
+		return err
+	}
+	_, err = t.PeekData(uintptr(addr), b)
+	return err
+}
@@ -0,0 +1,31 @@
+package ptrace
+
+import (
+	"context"
+	"syscall"
+)
+
+// A Tracer is the core of a Tracee's interface: its events, the control
+// of its execution, and access to its registers and memory.  Code that
+// needs only these can accept a Tracer, and be tested with the fake of
+// package ptracetest instead of a traced process.
+type Tracer interface {
+	Events() <-chan Event
+	NextEvent(ctx context.Context) (Event, error)
+	State() State
+
+	Continue() error
+	SingleStep() error
+	Syscall() error
+	Stop(ctx context.Context) (StopReason, error)
+	SendSignal(sig syscall.Signal) error
+	Detach() error
+	Close() error
+
+	GetRegs() (syscall.PtraceRegs, error)
+	SetRegs(regs syscall.PtraceRegs) error
+	PeekData(addr uintptr, out []byte) (int, error)
+	PokeData(addr uintptr, data []byte) (int, error)
+}
+
+var _ Tracer = (*Tracee)(nil)
@@ -0,0 +1,130 @@
+package ptrace
+
+import (
+	"errors"
+	"reflect"
+	"unsafe"
+)
+
+var errObjectPointers = errors.New("ptrace: object type contains Go pointers")
+
+// ReadUint8 reads a uint8 from tracee memory at addr.
+func (r Raw) ReadUint8(addr uint64) (uint8, error) { return rawRead[uint8](r, addr) }
+
+// ReadUint16 reads a uint16, in native byte order, from tracee memory at
+// addr.
+func (r Raw) ReadUint16(addr uint64) (uint16, error) { return rawRead[uint16](r, addr) }
+
+// ReadUint32 reads a uint32, in native byte order, from tracee memory at
+// addr.
+func (r Raw) ReadUint32(addr uint64) (uint32, error) { return rawRead[uint32](r, addr) }
+
+// ReadUint64 reads a uint64, in native byte order, from tracee memory at
+// addr.
+func (r Raw) ReadUint64(addr uint64) (uint64, error) { return rawRead[uint64](r, addr) }
+
+// ReadInt8 reads an int8 from tracee memory at addr.
+func (r Raw) ReadInt8(addr uint64) (int8, error) { return rawRead[int8](r, addr) }
+
+// ReadInt16 reads an int16, in native byte order, from tracee memory at
+// addr.
+func (r Raw) ReadInt16(addr uint64) (int16, error) { return rawRead[int16](r, addr) }
+
+// ReadInt32 reads an int32, in native byte order, from tracee memory at
+// addr.
+func (r Raw) ReadInt32(addr uint64) (int32, error) { return rawRead[int32](r, addr) }
+
+// ReadInt64 reads an int64, in native byte order, from tracee memory at
+// addr.
+func (r Raw) ReadInt64(addr uint64) (int64, error) { return rawRead[int64](r, addr) }
+
+// ReadPointer reads a pointer, of the tracee's word size, from tracee
+// memory at addr.
+func (r Raw) ReadPointer(addr uint64) (uint64, error) {
+	p, err := rawRead[uintptr](r, addr)
+	return uint64(p), err
+}
+
+// ReadUint8 reads a uint8 from tracee memory at addr.  Use Do to batch
+// many reads.
+func (t *Tracee) ReadUint8(addr uint64) (uint8, error) { return traceeRead[uint8](t, addr) }
+
+// ReadUint16 reads a uint16 from tracee memory at addr.
+func (t *Tracee) ReadUint16(addr uint64) (uint16, error) { return traceeRead[uint16](t, addr) }
+
+// ReadUint32 reads a uint32 from tracee memory at addr.
+func (t *Tracee) ReadUint32(addr uint64) (uint32, error) { return traceeRead[uint32](t, addr) }
+
+// ReadUint64 reads a uint64 from tracee memory at addr.
+func (t *Tracee) ReadUint64(addr uint64) (uint64, error) { return traceeRead[uint64](t, addr) }
+
+// ReadInt8 reads an int8 from tracee memory at addr.
+func (t *Tracee) ReadInt8(addr uint64) (int8, error) { return traceeRead[int8](t, addr) }
+
+// ReadInt16 reads an int16 from tracee memory at addr.
+func (t *Tracee) ReadInt16(addr uint64) (int16, error) { return traceeRead[int16](t, addr) }
+
+// ReadInt32 reads an int32 from tracee memory at addr.
+func (t *Tracee) ReadInt32(addr uint64) (int32, error) { return traceeRead[int32](t, addr) }
+
+// ReadInt64 reads an int64 from tracee memory at addr.
+func (t *Tracee) ReadInt64(addr uint64) (int64, error) { return traceeRead[int64](t, addr) }
+
+// ReadPointer reads a pointer from tracee memory at addr.
+func (t *Tracee) ReadPointer(addr uint64) (uint64, error) {
+	p, err := traceeRead[uintptr](t, addr)
+	return uint64(p), err
+}
+
+// ReadObject reads a value of the fixed-size type T, such as a struct
+// mirroring a C struct of the tracee, from tracee memory at addr into v.
+// The bytes are copied directly into v, so T must have the layout of the
+// tracee's type, in native byte order, and must not contain Go pointers,
+// slices, strings, maps, channels, functions, or interfaces; tracee
+// pointers are read into integer fields, such as uint64 or uintptr.
+func ReadObject[T any](t *Tracee, addr uint64, v *T) error {
+	if hasPointers(reflect.TypeFor[T]()) {
+		return errObjectPointers
+	}
+	return t.Do(func(r Raw) error { return readObject(r, addr, v) })
+}
+
+// Reads a value of a type without pointers from tracee memory.
+func rawRead[T any](r Raw, addr uint64) (T, error) {
+	var v T
+	err := readObject(r, addr, &v)
+	return v, err
+}
+
+func traceeRead[T any](t *Tracee, addr uint64) (T, error) {
+	var v T
+	err := t.Do(func(r Raw) error { return readObject(r, addr, &v) })
+	return v, err
+}
+
+// Reads tracee memory at addr into the bytes of v, whose type must not
+// contain pointers.
+func readObject[T any](r Raw, addr uint64, v *T) error {
+	b := unsafe.Slice((*byte)(unsafe.Pointer(v)), unsafe.Sizeof(*v))
+	return readMemory(r, addr, b)
+}
+
+// Returns whether a value of the type contains pointers.
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The unit of the CPU times of /proc/pid/stat, USER_HZ, which is 100 on
+// every architecture.
+const clockTick = time.Second / 100
+
+// A Usage is the resource usage of the tracee's process, summed over its
+// threads.
+type Usage struct {
+	// User and System are the CPU time spent in user and kernel mode.
+	User   time.Duration `json:"user"`
+	System time.Duration `json:"system"`
+	// RSS is the resident set size in bytes.
+	RSS int64 `json:"rss"`
+	// MinorFaults and MajorFaults are the number of page faults that
+	// did not and did require I/O.
+	MinorFaults int64 `json:"minor_faults"`
+	MajorFaults int64 `json:"major_faults"`
+	// VoluntarySwitches and InvoluntarySwitches are the number of
+	// context switches of the traced thread because it blocked or was
+	// preempted.
+	VoluntarySwitches   int64 `json:"voluntary_switches"`
+	InvoluntarySwitches int64 `json:"involuntary_switches"`
+}
+
+// A UsageEvent is sent periodically on the events channel with the
+// tracee's resource usage if the tracee was created WithUsageEvents.
+// Usage events are dropped if the events channel is full.
+type UsageEvent struct {
+	Time  time.Time `json:"time"`
+	Usage Usage     `json:"usage"`
+}
+
+// WithUsageEvents sends a UsageEvent every period until the tracee
+// exits or is closed.
+func WithUsageEvents(period time.Duration) Option {
+	return func(t *Tracee) {
+		var once sync.Once
+		t.observers = append(t.observers, func(Event) {
+			once.Do(func() { go t.sampleUsage(period) })
+		})
+	}
+}
+
+// Usage returns the resource usage of the tracee's process, from
+// /proc/pid/stat and /proc/pid/status.
+func (t *Tracee) Usage() (Usage, error) {
+	dir := "/proc/" + strconv.Itoa(t.proc.Pid)
+	// The status file is read first, so that an error means that the
+	// process is gone, and procStat then reads the same process.
+	b, err := os.ReadFile(dir + "/status")
+	if err != nil {
+		return Usage{}, err
+	}
+	var u Usage
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case "VmRSS":
+			kb, _ := strconv.ParseInt(strings.TrimSuffix(v, " kB"), 10, 64)
+			u.RSS = kb * 1024
+		case "voluntary_ctxt_switches":
+			u.VoluntarySwitches, _ = strconv.ParseInt(v, 10, 64)
+		case "nonvoluntary_ctxt_switches":
+			u.InvoluntarySwitches, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	// Fields 10, 12, 14, and 15 of the stat file, which are the 7th,
+	// 9th, 11th, and 12th following the state.
+	st := procStat(dir)
+	u.MinorFaults = int64(st.field(7))
+	u.MajorFaults = int64(st.field(9))
+	u.User = time.Duration(st.field(11)) * clockTick
+	u.System = time.Duration(st.field(12)) * clockTick
+	return u, nil
+}
+
+// Sends a UsageEvent every period until the tracee exits or is closed.
+// Runs on its own go routine.
+func (t *Tracee) sampleUsage(period time.Duration) {
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.waitDone:
+			return
+		case <-t.closing:
+			return
+		case now := <-tick.C:
+			u, err := t.Usage()
+			if err != nil {
+				return
+			}
+			t.trySend(UsageEvent{Time: now, Usage: u})
+		}
+	}
+}
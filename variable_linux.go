@@ -0,0 +1,332 @@
+package ptrace
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	errNoVariable      = errors.New("ptrace: global variable not found")
+	errVariableTooBig  = errors.New("ptrace: variable is too large to read")
+	errNoVariableDWARF = errors.New("ptrace: executable has no DWARF")
+)
+
+// The largest variable read by ReadVariable.
+const maxVariableSize = 1 << 20
+
+// A Kind is the kind of a Value.
+type Kind int
+
+const (
+	// KindOther is a value of a type that is not decoded, such as a
+	// function type.  Only its bytes are available.
+	KindOther Kind = iota
+	KindInt
+	KindUint
+	KindFloat
+	KindBool
+	KindPointer
+	KindArray
+	KindStruct
+)
+
+var kindNames = [...]string{
+	KindOther:   "other",
+	KindInt:     "int",
+	KindUint:    "uint",
+	KindFloat:   "float",
+	KindBool:    "bool",
+	KindPointer: "pointer",
+	KindArray:   "array",
+	KindStruct:  "struct",
+}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// A Value is a variable of the tracee, decoded according to its DWARF
+// type.
+type Value struct {
+	Kind Kind
+	// Type is the C name of the value's type, for example
+	// "unsigned int" or "struct point".
+	Type string
+	// Addr is the address of the value in the tracee.
+	Addr uint64
+	// Bytes are the bytes of the value, in the tracee's byte order.
+	Bytes []byte
+	// Int is the value of a KindInt, sign-extended; enums and signed
+	// chars are KindInt.
+	Int int64
+	// Uint is the value of a KindUint, and the address held by a
+	// KindPointer; unsigned chars are KindUint.
+	Uint uint64
+	// Float is the value of a KindFloat.
+	Float float64
+	// Bool is the value of a KindBool.
+	Bool bool
+	// Elems are the elements of a KindArray.
+	Elems []Value
+	// Fields are the members of a KindStruct, which is also the kind
+	// of unions.
+	Fields []Field
+}
+
+// A Field is a member of a struct or union Value.
+type Field struct {
+	Name  string
+	Value Value
+}
+
+// String returns the value formatted as a C initializer.
+func (v Value) String() string {
+	switch v.Kind {
+	case KindInt:
+		return strconv.FormatInt(v.Int, 10)
+	case KindUint:
+		return strconv.FormatUint(v.Uint, 10)
+	case KindFloat:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case KindBool:
+		return strconv.FormatBool(v.Bool)
+	case KindPointer:
+		return "0x" + strconv.FormatUint(v.Uint, 16)
+	case KindArray:
+		s := make([]string, len(v.Elems))
+		for i, e := range v.Elems {
+			s[i] = e.String()
+		}
+		return "{" + strings.Join(s, ", ") + "}"
+	case KindStruct:
+		s := make([]string, len(v.Fields))
+		for i, f := range v.Fields {
+			s[i] = "." + f.Name + " = " + f.Value.String()
+		}
+		return "{" + strings.Join(s, ", ") + "}"
+	}
+	return "<" + v.Type + ">"
+}
+
+// ReadVariable reads the named global or static variable of the stopped
+// tracee's executable, finding its address and type in the DWARF.
+// Integers, floats, booleans, enums, pointers, arrays, structs, and
+// unions are decoded; pointers are not followed.  Variables of shared
+// libraries, and thread-local variables, are not found.
+func (t *Tracee) ReadVariable(name string) (Value, error) {
+	info, err := t.debugInfo()
+	if err != nil {
+		return Value{}, err
+	}
+	if info.dwarf == nil {
+		return Value{}, errNoVariableDWARF
+	}
+	addr, typ, err := findVariable(info.dwarf, name)
+	if err != nil {
+		return Value{}, err
+	}
+	addr += info.bias
+	size := typ.Size()
+	if size < 0 || size > maxVariableSize {
+		return Value{}, errVariableTooBig
+	}
+	b := make([]byte, size)
+	if err := t.Do(func(r Raw) error { return readMemory(r, addr, b) }); err != nil {
+		return Value{}, err
+	}
+	return decodeValue(typ, addr, b), nil
+}
+
+// Returns the link-time address and the type of the named variable with
+// a static address.
+func findVariable(d *dwarf.Data, name string) (uint64, dwarf.Type, error) {
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return 0, nil, err
+		}
+		if e == nil {
+			return 0, nil, errNoVariable
+		}
+		// Static variables of functions are among their children.
+		if e.Tag != dwarf.TagVariable {
+			if e.Tag != dwarf.TagCompileUnit && e.Tag != dwarf.TagSubprogram && e.Tag != dwarf.TagLexDwarfBlock {
+				r.SkipChildren()
+			}
+			continue
+		}
+		if n, _ := e.Val(dwarf.AttrName).(string); n != name {
+			continue
+		}
+		loc, _ := e.Val(dwarf.AttrLocation).([]byte)
+		if len(loc) != 1+int(ptrSize) || loc[0] != dwOpAddr {
+			// A declaration, a local, or a thread-local.
+			continue
+		}
+		off, ok := e.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			continue
+		}
+		typ, err := d.Type(off)
+		if err != nil {
+			return 0, nil, err
+		}
+		var addr uint64
+		if ptrSize == 4 {
+			addr = uint64(binary.NativeEndian.Uint32(loc[1:]))
+		} else {
+			addr = binary.NativeEndian.Uint64(loc[1:])
+		}
+		return addr, typ, nil
+	}
+}
+
+// Decodes the value of the given type from its bytes, b, read from
+// addr.
+func decodeValue(typ dwarf.Type, addr uint64, b []byte) Value {
+	v := Value{Type: typeName(typ), Addr: addr, Bytes: b}
+	// Typedefs and qualifiers take the kind of the underlying type.
+	for {
+		switch t := typ.(type) {
+		case *dwarf.TypedefType:
+			typ = t.Type
+			continue
+		case *dwarf.QualType:
+			typ = t.Type
+			continue
+		}
+		break
+	}
+	switch t := typ.(type) {
+	case *dwarf.IntType, *dwarf.CharType, *dwarf.EnumType:
+		v.Kind, v.Int = KindInt, signExtend(b)
+	case *dwarf.UintType, *dwarf.UcharType:
+		v.Kind, v.Uint = KindUint, uintBytes(b)
+	case *dwarf.BoolType:
+		v.Kind, v.Bool = KindBool, uintBytes(b) != 0
+	case *dwarf.PtrType:
+		v.Kind, v.Uint = KindPointer, uintBytes(b)
+	case *dwarf.FloatType:
+		switch len(b) {
+		case 4:
+			v.Kind, v.Float = KindFloat, float64(math.Float32frombits(binary.NativeEndian.Uint32(b)))
+		case 8:
+			v.Kind, v.Float = KindFloat, math.Float64frombits(binary.NativeEndian.Uint64(b))
+		}
+	case *dwarf.ArrayType:
+		v.Kind = KindArray
+		n, size := t.Count, t.Type.Size()
+		if n < 0 || size <= 0 {
+			break
+		}
+		for i := int64(0); i < n && (i+1)*size <= int64(len(b)); i++ {
+			v.Elems = append(v.Elems, decodeValue(t.Type, addr+uint64(i*size), b[i*size:(i+1)*size]))
+		}
+	case *dwarf.StructType:
+		v.Kind = KindStruct
+		for _, f := range t.Field {
+			if f.BitSize > 0 {
+				if fv, ok := decodeBitField(f, addr, b); ok {
+					v.Fields = append(v.Fields, Field{Name: f.Name, Value: fv})
+				}
+				continue
+			}
+			size := f.Type.Size()
+			if f.ByteOffset < 0 || size < 0 || f.ByteOffset+size > int64(len(b)) {
+				continue
+			}
+			fv := decodeValue(f.Type, addr+uint64(f.ByteOffset), b[f.ByteOffset:f.ByteOffset+size])
+			v.Fields = append(v.Fields, Field{Name: f.Name, Value: fv})
+		}
+	}
+	return v
+}
+
+// Returns the C name of a type.  Unlike String, it does not spell out
+// the members of structs, unions, and enums.
+func typeName(typ dwarf.Type) string {
+	switch t := typ.(type) {
+	case *dwarf.StructType:
+		if t.StructName == "" {
+			return t.Kind
+		}
+		return t.Kind + " " + t.StructName
+	case *dwarf.EnumType:
+		if t.EnumName == "" {
+			return "enum"
+		}
+		return "enum " + t.EnumName
+	}
+	return typ.String()
+}
+
+// Decodes a bit field of the struct with bytes b, read from addr.  The
+// value's Bytes hold the field's bits, shifted down to the least
+// significant bit.
+func decodeBitField(f *dwarf.StructField, addr uint64, b []byte) (Value, bool) {
+	// DWARF 4 gives the offset of the field from the start of the
+	// struct.  Earlier versions give the offset of its most
+	// significant bit from that of its storage unit, which is at
+	// ByteOffset.
+	pos := f.DataBitOffset
+	if f.BitOffset != 0 || f.ByteSize != 0 {
+		unit := f.ByteSize
+		if unit == 0 {
+			unit = f.Type.Size()
+		}
+		pos = 8*(f.ByteOffset+unit) - f.BitOffset - f.BitSize
+	}
+	start, shift := pos/8, uint(pos%8)
+	size := f.Type.Size()
+	if pos < 0 || start >= int64(len(b)) || size <= 0 || size > 8 || int64(shift)+f.BitSize > 64 {
+		return Value{}, false
+	}
+	end := min(start+8, int64(len(b)))
+	bits := uintBytes(b[start:end]) >> shift & (1<<uint(f.BitSize) - 1)
+	// Sign-extend signed fields, so that the full-width integer
+	// decodes to the field's value.
+	if isSigned(f.Type) && bits>>(f.BitSize-1) != 0 {
+		bits |= ^uint64(0) << uint(f.BitSize)
+	}
+	buf := binary.LittleEndian.AppendUint64(nil, bits)[:size]
+	return decodeValue(f.Type, addr+uint64(start), buf), true
+}
+
+// Returns whether the type is a signed integer type.
+func isSigned(typ dwarf.Type) bool {
+	switch t := typ.(type) {
+	case *dwarf.TypedefType:
+		return isSigned(t.Type)
+	case *dwarf.QualType:
+		return isSigned(t.Type)
+	case *dwarf.IntType, *dwarf.CharType, *dwarf.EnumType:
+		return true
+	}
+	return false
+}
+
+// Returns the unsigned little-endian integer of up to 8 bytes.
+func uintBytes(b []byte) uint64 {
+	var v uint64
+	for i := min(len(b), 8) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// Returns the sign-extended little-endian integer of up to 8 bytes.
+func signExtend(b []byte) int64 {
+	if len(b) == 0 || len(b) >= 8 {
+		return int64(uintBytes(b))
+	}
+	shift := 64 - 8*uint(len(b))
+	return int64(uintBytes(b)<<shift) >> shift
+}
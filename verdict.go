@@ -0,0 +1,122 @@
+package ptrace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// An Action is what a policy rule does to a matching system call.
+type Action int
+
+const (
+	// Allow lets the system call execute.
+	Allow Action = iota
+	// Deny fails the system call with the rule's errno.
+	Deny
+	// Kill kills the tracee.
+	Kill
+)
+
+var actionNames = [...]string{Allow: "allow", Deny: "deny", Kill: "kill"}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// MarshalText encodes the action as its name.
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText decodes an action from its name.
+func (a *Action) UnmarshalText(text []byte) error {
+	for i, n := range actionNames {
+		if n == string(text) {
+			*a = Action(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q", text)
+}
+
+// A Verdict records a policy rule firing on a system call.
+type Verdict struct {
+	Time    time.Time `json:"time"`
+	Pid     int       `json:"pid"`
+	Rule    string    `json:"rule"`
+	Action  Action    `json:"action"`
+	Errno   string    `json:"errno,omitempty"`
+	Syscall string    `json:"syscall"`
+	// Args are the arguments of the system call, decoded according
+	// to its type.
+	Args []string `json:"args"`
+}
+
+// ReadVerdicts reads a log of verdicts written one JSON object per line.
+func ReadVerdicts(r io.Reader) ([]Verdict, error) {
+	var vs []Verdict
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var v Verdict
+		if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, s.Err()
+}
+
+// A VerdictCount is the number of times a rule fired on a system call in
+// each of two runs.
+type VerdictCount struct {
+	Rule    string
+	Syscall string
+	A, B    int
+}
+
+// DiffVerdicts compares the verdicts of two runs, returning the counts
+// for each rule and system call whose count differs, sorted by rule and
+// then system call.
+func DiffVerdicts(a, b []Verdict) []VerdictCount {
+	type key struct{ rule, syscall string }
+	counts := make(map[key]*VerdictCount)
+	count := func(v Verdict) *VerdictCount {
+		k := key{v.Rule, v.Syscall}
+		c := counts[k]
+		if c == nil {
+			c = &VerdictCount{Rule: v.Rule, Syscall: v.Syscall}
+			counts[k] = c
+		}
+		return c
+	}
+	for _, v := range a {
+		count(v).A++
+	}
+	for _, v := range b {
+		count(v).B++
+	}
+	var diffs []VerdictCount
+	for _, c := range counts {
+		if c.A != c.B {
+			diffs = append(diffs, *c)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Rule != diffs[j].Rule {
+			return diffs[i].Rule < diffs[j].Rule
+		}
+		return diffs[i].Syscall < diffs[j].Syscall
+	})
+	return diffs
+}
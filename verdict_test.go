@@ -0,0 +1,95 @@
+//go:build linux || darwin
+
+package ptrace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffVerdicts(t *testing.T) {
+	v := func(rule, syscall string) Verdict { return Verdict{Rule: rule, Syscall: syscall} }
+	tests := []struct {
+		name string
+		a, b []Verdict
+		want []VerdictCount
+	}{
+		{name: "empty"},
+		{
+			name: "same",
+			a:    []Verdict{v("net", "socket"), v("fs", "openat")},
+			b:    []Verdict{v("fs", "openat"), v("net", "socket")},
+		},
+		{
+			name: "only a",
+			a:    []Verdict{v("fs", "openat"), v("fs", "openat")},
+			want: []VerdictCount{{Rule: "fs", Syscall: "openat", A: 2}},
+		},
+		{
+			name: "only b",
+			b:    []Verdict{v("fs", "openat")},
+			want: []VerdictCount{{Rule: "fs", Syscall: "openat", B: 1}},
+		},
+		{
+			name: "counts differ",
+			a:    []Verdict{v("fs", "openat"), v("fs", "openat"), v("net", "socket")},
+			b:    []Verdict{v("fs", "openat"), v("net", "socket")},
+			want: []VerdictCount{{Rule: "fs", Syscall: "openat", A: 2, B: 1}},
+		},
+		{
+			name: "same syscall, different rules",
+			a:    []Verdict{v("deny", "openat")},
+			b:    []Verdict{v("allow", "openat")},
+			want: []VerdictCount{
+				{Rule: "allow", Syscall: "openat", B: 1},
+				{Rule: "deny", Syscall: "openat", A: 1},
+			},
+		},
+		{
+			name: "sorted by rule, then syscall",
+			a:    []Verdict{v("net", "socket"), v("fs", "unlink"), v("fs", "openat")},
+			want: []VerdictCount{
+				{Rule: "fs", Syscall: "openat", A: 1},
+				{Rule: "fs", Syscall: "unlink", A: 1},
+				{Rule: "net", Syscall: "socket", A: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DiffVerdicts(test.a, test.b); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadVerdicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     string
+		want    []Verdict
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "blank lines",
+			log:  "\n{\"rule\":\"fs\",\"action\":\"deny\",\"errno\":\"permission denied\",\"syscall\":\"openat\"}\n\n",
+			want: []Verdict{{Rule: "fs", Action: Deny, Errno: "permission denied", Syscall: "openat"}},
+		},
+		{name: "bad action", log: `{"action":"explode"}`, wantErr: true},
+		{name: "bad json", log: "{", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadVerdicts(strings.NewReader(test.log))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
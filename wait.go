@@ -0,0 +1,119 @@
+package ptrace
+
+import (
+	"context"
+	"errors"
+	"syscall"
+)
+
+var errOtherStop = errors.New("ptrace: tracee stopped for another reason")
+
+// Returns whether the event is sent for a stop of the tracee, from which
+// it must be resumed.  Other events, such as a LibraryLoadEvent sent
+// just before the event of the stop at which it was observed, or a
+// MemoryPressureEvent sent by another go routine, are not, whatever the
+// tracee's state when they are received.
+func isStop(ev Event) bool {
+	if ws, ok := ev.(syscall.WaitStatus); ok {
+		return ws.Stopped()
+	}
+	return isStopEvent(ev)
+}
+
+// WaitStop receives events until the tracee stops, and returns the
+// stop's event.  The events before it, including events such as
+// MemoryPressureEvents and RegionChangeEvents that are not themselves
+// stops, are discarded.  If the tracee exits first, ErrTraceeExited is
+// returned.  If ctx is done first, ctx's error is returned.
+func (t *Tracee) WaitStop(ctx context.Context) (Event, error) {
+	for {
+		ev, err := t.NextEvent(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if isStop(ev) {
+			return ev, nil
+		}
+	}
+}
+
+// WaitSignal waits for the tracee to stop, as by WaitStop, and returns
+// the stop's event if it is the delivery of the given signal.  If the
+// tracee stops for another reason, the stop's event is returned along
+// with an error.  Either way, the tracee is left stopped.
+func (t *Tracee) WaitSignal(ctx context.Context, sig syscall.Signal) (Event, error) {
+	ev, err := t.WaitStop(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := signalStop(ev); !ok || s != sig {
+		return ev, errOtherStop
+	}
+	return ev, nil
+}
+
+// WaitExit receives events until the tracee exits, and returns its exit
+// status.  If the tracee is stopped, it is first continued, as by
+// Continue.  The events before the exit are discarded, and the tracee is
+// continued from each stop, delivering the signal of a signal-delivery
+// stop.  If the exit was already received, the exit status is still
+// returned.  If ctx is done first, ctx's error is returned, and the
+// tracee may be left stopped.
+func (t *Tracee) WaitExit(ctx context.Context) (syscall.WaitStatus, error) {
+	if t.State().IsStopped() {
+		if err := t.Continue(); err != nil {
+			return 0, err
+		}
+	}
+	for {
+		ev, err := t.NextEvent(ctx)
+		switch {
+		case err == ErrTraceeExited:
+			// The events channel is closed just before waitDone.
+			<-t.waitDone
+			if !t.exited {
+				return 0, err
+			}
+			return t.exitStatus, nil
+		case err != nil:
+			return 0, err
+		}
+		if ws, ok := ev.(syscall.WaitStatus); ok && (ws.Exited() || ws.Signaled()) {
+			return ws, nil
+		}
+		if !isStop(ev) {
+			continue
+		}
+		if err := t.continueFrom(ev); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Continues the tracee from the stop of the event, as by Continue, but
+// delivering the signal of a signal-delivery stop.
+func (t *Tracee) continueFrom(ev Event) error {
+	sig, ok := signalStop(ev)
+	return t.run("cont", func() error {
+		cont := t.overBreakpoint(func() error { return ptraceCont(t.proc.Pid, 0) }, false)
+		t.signalResume = func(sig syscall.Signal) error { return ptraceCont(t.proc.Pid, int(sig)) }
+		if !ok {
+			return t.resume(Running, cont)
+		}
+		// The signal is delivered only once, so the tracee is
+		// resumed by cont, as by Continue, after a later stop.
+		err := t.resume(Running, func() error { return t.signalResume(sig) })
+		t.lastResume = cont
+		return err
+	})
+}
+
+// Returns the signal of a signal-delivery stop event.  SIGTRAP is not
+// considered delivered, since the tracer's own traps report it.
+func signalStop(ev Event) (syscall.Signal, bool) {
+	ws, ok := ev.(syscall.WaitStatus)
+	if !ok || !ws.Stopped() || int(ws)>>16 != 0 || ws.StopSignal() == syscall.SIGTRAP {
+		return 0, false
+	}
+	return ws.StopSignal(), true
+}
@@ -0,0 +1,53 @@
+package ptrace
+
+import (
+	"context"
+	"syscall"
+	"testing"
+)
+
+func TestIsStop(t *testing.T) {
+	stopped := syscall.WaitStatus(0x137f) // SIGSTOP
+	tests := []struct {
+		name string
+		ev   Event
+		want bool
+	}{
+		{"signal stop", stopped, true},
+		{"exit", syscall.WaitStatus(0), false},
+		{"syscall enter", SyscallEnterEvent{Status: stopped}, true},
+		{"seccomp notification", SyscallEnterEvent{Notification: &SeccompNotification{}}, false},
+		{"syscall exit", SyscallExitEvent{Status: stopped}, true},
+		{"group stop", GroupStopEvent{Status: stopped}, true},
+		{"breakpoint", BreakpointEvent{Status: stopped}, true},
+		{"region change", RegionChangeEvent{}, false},
+		{"network", NetworkEvent{}, false},
+		{"namespace change", NamespaceChangeEvent{}, false},
+		{"library load", LibraryLoadEvent{}, false},
+		{"library call", LibraryCallEvent{}, false},
+		{"memory pressure", MemoryPressureEvent{}, false},
+		{"usage", UsageEvent{}, false},
+	}
+	for _, test := range tests {
+		if got := isStop(test.ev); got != test.want {
+			t.Errorf("%s: isStop(%#v) = %v, want %v", test.name, test.ev, got, test.want)
+		}
+	}
+}
+
+func TestWaitStopSkipsAuxiliaryEvents(t *testing.T) {
+	tr := fakeTracee(1)
+	tr.state.Store(int32(Stopped))
+	stop := BreakpointEvent{Status: 0x57f, Addr: 0x1000}
+	tr.events = make(chan Event, 3)
+	tr.events <- RegionChangeEvent{Addr: 0x2000}
+	tr.events <- LibraryLoadEvent{}
+	tr.events <- stop
+	ev, err := tr.WaitStop(context.Background())
+	if err != nil {
+		t.Fatalf("WaitStop: %v", err)
+	}
+	if bp, ok := ev.(BreakpointEvent); !ok || bp != stop {
+		t.Errorf("WaitStop returned %#v, want %#v", ev, stop)
+	}
+}
@@ -0,0 +1,174 @@
+package ptrace
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	errNoWatch      = errors.New("ptrace: no watched region at address")
+	errBadWatchSize = errors.New("ptrace: watched region size out of range")
+)
+
+// The largest region that WatchRegion watches.  Since it is read in
+// full at every stop, a larger one is better found by other means.
+const maxWatchSize = 16 << 20
+
+// A RegionChangeEvent is sent, before the event for a stop, when the
+// contents of a region watched with WatchRegion have changed since the
+// previous stop.
+type RegionChangeEvent struct {
+	// Addr is the address of the watched region.
+	Addr uint64 `json:"addr"`
+	// Changes are the changed runs of bytes, in address order.
+	Changes []MemoryChange `json:"changes"`
+}
+
+// A MemoryChange is a run of changed bytes.
+type MemoryChange struct {
+	// Offset is the offset of the run from the start of the region.
+	Offset int `json:"offset"`
+	// Old and New are the bytes before and after the change.
+	Old []byte `json:"old"`
+	New []byte `json:"new"`
+}
+
+// A region of tracee memory watched for changes.
+type watch struct {
+	addr uint64
+	size int
+	// Mu guards old, which may be evicted by any go routine.
+	mu sync.Mutex
+	// Old is the region's contents at the previous stop, or nil if
+	// they were evicted.
+	old    []byte
+	charge *memCharge
+}
+
+// WatchRegion watches size bytes of the stopped tracee's memory at addr,
+// and sends a RegionChangeEvent at each later stop at which they have
+// changed.  The region is read in full at each stop, so it is a
+// software alternative to hardware watchpoints for finding which code
+// corrupts a structure: it reports the first stop after a change, not
+// the instruction that made it, and it is slow for large regions.
+//
+// The copy of the region is charged to the tracee as SnapshotMemory.  If
+// it is evicted, changes until the next stop are not reported.  Watching
+// an address that is already watched replaces the old watch.  The size
+// must be positive and at most 16MiB.
+func (t *Tracee) WatchRegion(addr uintptr, size int) error {
+	// The size is checked here, since a failed allocation on the
+	// tracer thread would break the tracer.
+	if size <= 0 || size > maxWatchSize {
+		return errBadWatchSize
+	}
+	return t.Do(func(r Raw) error {
+		w := &watch{addr: uint64(addr), size: size}
+		if _, err := t.snapshotWatch(r, w); err != nil {
+			return err
+		}
+		t.unwatch(uint64(addr))
+		t.watches = append(t.watches, w)
+		t.numWatches.Store(int32(len(t.watches)))
+		return nil
+	})
+}
+
+// UnwatchRegion stops watching the region at addr.
+func (t *Tracee) UnwatchRegion(addr uintptr) error {
+	return t.run("unwatch", func() error {
+		if !t.unwatch(uint64(addr)) {
+			return errNoWatch
+		}
+		return nil
+	})
+}
+
+// Removes the watch at addr, returning whether there was one.  Must be
+// called on the tracer thread.
+func (t *Tracee) unwatch(addr uint64) bool {
+	for i, w := range t.watches {
+		if w.addr == addr {
+			t.mem.release(w.charge)
+			t.watches = append(t.watches[:i], t.watches[i+1:]...)
+			t.numWatches.Store(int32(len(t.watches)))
+			return true
+		}
+	}
+	return false
+}
+
+// Reads the watched region, recording it as the previous contents, and
+// charging it if it is not already charged.  Returns the region's
+// previous contents, or nil if they were evicted.  Must be called on the
+// tracer thread.
+func (t *Tracee) snapshotWatch(r Raw, w *watch) ([]byte, error) {
+	cur := make([]byte, w.size)
+	if _, err := r.PeekData(uintptr(w.addr), cur); err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	old := w.old
+	w.old = cur
+	w.mu.Unlock()
+	if old == nil {
+		w.charge = t.mem.charge(SnapshotMemory, int64(w.size), func() {
+			w.mu.Lock()
+			w.old = nil
+			w.mu.Unlock()
+		})
+	}
+	return old, nil
+}
+
+// Sends a RegionChangeEvent for each watched region that has changed
+// since the previous stop.  Without watches, it costs no round trip to
+// the tracer thread.  Called on the wait go routine at a stop.
+func (t *Tracee) checkWatches() {
+	if t.numWatches.Load() == 0 {
+		return
+	}
+	var evs []Event
+	t.runInternal("watch", func() error {
+		r := Raw{t}
+		for _, w := range t.watches {
+			old, err := t.snapshotWatch(r, w)
+			if err != nil || old == nil {
+				continue
+			}
+			w.mu.Lock()
+			cur := w.old
+			w.mu.Unlock()
+			if cs := diffBytes(old, cur); len(cs) > 0 {
+				evs = append(evs, RegionChangeEvent{Addr: w.addr, Changes: cs})
+			}
+		}
+		return nil
+	})
+	for _, ev := range evs {
+		t.emit(ev)
+	}
+}
+
+// Returns the runs of bytes that differ between old and cur, which have
+// the same length.
+func diffBytes(old, cur []byte) []MemoryChange {
+	var cs []MemoryChange
+	for i := 0; i < len(cur); {
+		if old[i] == cur[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(cur) && old[j] != cur[j] {
+			j++
+		}
+		cs = append(cs, MemoryChange{
+			Offset: i,
+			Old:    append([]byte(nil), old[i:j]...),
+			New:    append([]byte(nil), cur[i:j]...),
+		})
+		i = j
+	}
+	return cs
+}
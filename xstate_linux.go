@@ -0,0 +1,260 @@
+package ptrace
+
+import (
+	"encoding/binary"
+	"errors"
+	"runtime"
+)
+
+var (
+	errBadVectorReg   = errors.New("ptrace: no such vector register")
+	errXStateFeature  = errors.New("ptrace: extended state component is not supported by the processor")
+	errShortXStateBuf = errors.New("ptrace: extended state is truncated")
+)
+
+// An XState is the extended processor state of an x86 tracee, in the
+// XSAVE layout of the NTX86XState register set: the x87 and SSE state,
+// and the AVX and AVX-512 state if the processor supports them.  It is
+// read by GetXState, modified with its setters, and written back by
+// SetXState.
+type XState struct {
+	buf []byte
+}
+
+// Offsets in the XSAVE area, from the Intel SDM, volume 1, chapter 13.
+// The offsets of the components after the header are those of the
+// standard, non-compacted format that ptrace uses; they are the same on
+// every processor that supports the components.
+const (
+	xsaveMXCSR      = 24
+	xsaveXMM        = 160
+	xsaveSWReserved = 464
+	xsaveHeader     = 512
+	xsaveYMMHi      = 576
+	xsaveOpmask     = 1088
+	xsaveZMMHi256   = 1152
+	xsaveHi16ZMM    = 1664
+
+	xfeatureYMM      = 1 << 2
+	xfeatureOpmask   = 1 << 5
+	xfeatureZMMHi256 = 1 << 6
+	xfeatureHi16ZMM  = 1 << 7
+)
+
+// Returns the number of XMM, YMM, and ZMM registers that the tracee
+// addresses without AVX-512: 16 on amd64, and 8 on 386.
+func numVectorRegs() int {
+	if runtime.GOARCH == "386" {
+		return 8
+	}
+	return 16
+}
+
+// GetXState returns the stopped tracee's extended processor state.  It
+// is supported on amd64 and 386.
+func (t *Tracee) GetXState() (*XState, error) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "386" {
+		return nil, errUnsupportedArch
+	}
+	// The size of the area depends on the processor, so it is read
+	// into larger buffers until it fits.
+	var buf []byte
+	err := t.Do(func(r Raw) error {
+		for size := 4096; ; size *= 2 {
+			buf = make([]byte, size)
+			n, err := r.GetRegSet(NTX86XState, buf)
+			if err != nil {
+				return err
+			}
+			if n < size {
+				buf = buf[:n]
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < xsaveHeader+64 {
+		return nil, errShortXStateBuf
+	}
+	return &XState{buf: buf}, nil
+}
+
+// SetXState writes the stopped tracee's extended processor state.
+func (t *Tracee) SetXState(x *XState) error {
+	return t.SetRegSet(NTX86XState, x.buf)
+}
+
+// Bytes returns the raw XSAVE area.  Modifying it modifies the XState.
+func (x *XState) Bytes() []byte { return x.buf }
+
+// Features returns the state components that the processor and kernel
+// support, XCR0, as a bit mask: bit 2 for AVX, and bits 5 to 7 for
+// AVX-512, for example.  The kernel stores it in the software-reserved
+// bytes of the area for debuggers.
+func (x *XState) Features() uint64 {
+	return binary.NativeEndian.Uint64(x.buf[xsaveSWReserved:])
+}
+
+// MXCSR returns the SSE control and status register.
+func (x *XState) MXCSR() uint32 {
+	return binary.NativeEndian.Uint32(x.buf[xsaveMXCSR:])
+}
+
+// SetMXCSR sets the SSE control and status register.
+func (x *XState) SetMXCSR(v uint32) {
+	binary.NativeEndian.PutUint32(x.buf[xsaveMXCSR:], v)
+	x.setInUse(1 << 1)
+}
+
+// XMM returns the 128-bit register XMMi, the low half of YMMi.
+func (x *XState) XMM(i int) ([16]byte, error) {
+	var v [16]byte
+	if i < 0 || i >= numVectorRegs() {
+		return v, errBadVectorReg
+	}
+	copy(v[:], x.buf[xsaveXMM+16*i:])
+	return v, nil
+}
+
+// SetXMM sets the 128-bit register XMMi.
+func (x *XState) SetXMM(i int, v [16]byte) error {
+	if i < 0 || i >= numVectorRegs() {
+		return errBadVectorReg
+	}
+	copy(x.buf[xsaveXMM+16*i:], v[:])
+	x.setInUse(1 << 1)
+	return nil
+}
+
+// YMM returns the 256-bit AVX register YMMi.
+func (x *XState) YMM(i int) ([32]byte, error) {
+	var v [32]byte
+	xmm, err := x.XMM(i)
+	if err != nil {
+		return v, err
+	}
+	copy(v[:], xmm[:])
+	hi, err := x.component(xfeatureYMM, xsaveYMMHi+16*i, 16)
+	copy(v[16:], hi)
+	return v, err
+}
+
+// SetYMM sets the 256-bit AVX register YMMi.
+func (x *XState) SetYMM(i int, v [32]byte) error {
+	if err := x.SetXMM(i, [16]byte(v[:16])); err != nil {
+		return err
+	}
+	return x.setComponent(xfeatureYMM, xsaveYMMHi+16*i, v[16:])
+}
+
+// ZMM returns the 512-bit AVX-512 register ZMMi.  ZMM16 through ZMM31
+// exist only on amd64.
+func (x *XState) ZMM(i int) ([64]byte, error) {
+	var v [64]byte
+	if i >= numVectorRegs() && i < 2*numVectorRegs() && runtime.GOARCH == "amd64" {
+		hi, err := x.component(xfeatureHi16ZMM, xsaveHi16ZMM+64*(i-16), 64)
+		copy(v[:], hi)
+		return v, err
+	}
+	ymm, err := x.YMM(i)
+	if err != nil {
+		return v, err
+	}
+	copy(v[:], ymm[:])
+	hi, err := x.component(xfeatureZMMHi256, xsaveZMMHi256+32*i, 32)
+	copy(v[32:], hi)
+	return v, err
+}
+
+// SetZMM sets the 512-bit AVX-512 register ZMMi.
+func (x *XState) SetZMM(i int, v [64]byte) error {
+	if i >= numVectorRegs() && i < 2*numVectorRegs() && runtime.GOARCH == "amd64" {
+		return x.setComponent(xfeatureHi16ZMM, xsaveHi16ZMM+64*(i-16), v[:])
+	}
+	if err := x.SetYMM(i, [32]byte(v[:32])); err != nil {
+		return err
+	}
+	return x.setComponent(xfeatureZMMHi256, xsaveZMMHi256+32*i, v[32:])
+}
+
+// Opmask returns the AVX-512 opmask register ki, for i from 0 to 7.
+func (x *XState) Opmask(i int) (uint64, error) {
+	if i < 0 || i > 7 {
+		return 0, errBadVectorReg
+	}
+	b, err := x.component(xfeatureOpmask, xsaveOpmask+8*i, 8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.NativeEndian.Uint64(b), nil
+}
+
+// SetOpmask sets the AVX-512 opmask register ki.
+func (x *XState) SetOpmask(i int, v uint64) error {
+	if i < 0 || i > 7 {
+		return errBadVectorReg
+	}
+	var b [8]byte
+	binary.NativeEndian.PutUint64(b[:], v)
+	return x.setComponent(xfeatureOpmask, xsaveOpmask+8*i, b[:])
+}
+
+// Returns n bytes at offset off of a state component.  A component that
+// is not in use, by XSTATE_BV, is in its initial state, which is zero,
+// whatever its bytes hold.
+func (x *XState) component(feature uint64, off, n int) ([]byte, error) {
+	if x.Features()&feature == 0 {
+		return nil, errXStateFeature
+	}
+	if off+n > len(x.buf) {
+		return nil, errShortXStateBuf
+	}
+	if x.inUse()&feature == 0 {
+		return make([]byte, n), nil
+	}
+	return x.buf[off : off+n], nil
+}
+
+// Sets bytes at offset off of a state component, marking it in use.  A
+// component that was not in use is zeroed first.
+func (x *XState) setComponent(feature uint64, off int, b []byte) error {
+	if x.Features()&feature == 0 {
+		return errXStateFeature
+	}
+	if off+len(b) > len(x.buf) {
+		return errShortXStateBuf
+	}
+	if x.inUse()&feature == 0 {
+		start, end := componentRange(feature)
+		clear(x.buf[start:min(end, len(x.buf))])
+	}
+	copy(x.buf[off:], b)
+	x.setInUse(feature)
+	return nil
+}
+
+// Returns the range of the XSAVE area of a state component.
+func componentRange(feature uint64) (int, int) {
+	switch feature {
+	case xfeatureYMM:
+		return xsaveYMMHi, xsaveYMMHi + 256
+	case xfeatureOpmask:
+		return xsaveOpmask, xsaveOpmask + 64
+	case xfeatureZMMHi256:
+		return xsaveZMMHi256, xsaveZMMHi256 + 512
+	case xfeatureHi16ZMM:
+		return xsaveHi16ZMM, xsaveHi16ZMM + 1024
+	}
+	return 0, 0
+}
+
+// Returns XSTATE_BV, the components that are not in their initial state.
+func (x *XState) inUse() uint64 {
+	return binary.NativeEndian.Uint64(x.buf[xsaveHeader:])
+}
+
+func (x *XState) setInUse(feature uint64) {
+	binary.NativeEndian.PutUint64(x.buf[xsaveHeader:], x.inUse()|feature)
+}